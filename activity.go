@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	activityRateWindow     = time.Minute
+	activityChattersWindow = 5 * time.Minute
+	activityPublishEvery   = 10 * time.Second
+)
+
+// ChatActivity holds rolling chat activity metrics
+type ChatActivity struct {
+	MessagesPerMinute int       `json:"messages_per_minute"`
+	UniqueChatters5m  int       `json:"unique_chatters_5m"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+type activityEvent struct {
+	at   time.Time
+	user string
+}
+
+// activityTracker records recent chat messages to compute activity metrics
+type activityTracker struct {
+	mu     sync.Mutex
+	events []activityEvent
+}
+
+func (t *activityTracker) record(msg ChatMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, activityEvent{at: time.Now(), user: strings.ToLower(msg.User.Username)})
+}
+
+// compute returns the metrics at the given time, dropping events too old to matter
+func (t *activityTracker) compute(now time.Time) ChatActivity {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := now.Add(-activityChattersWindow)
+	first := 0
+	for first < len(t.events) && t.events[first].at.Before(cutoff) {
+		first++
+	}
+	t.events = t.events[first:]
+
+	activity := ChatActivity{UpdatedAt: now}
+	chatters := make(map[string]bool)
+	rateCutoff := now.Add(-activityRateWindow)
+	for _, ev := range t.events {
+		chatters[ev.user] = true
+		if !ev.at.Before(rateCutoff) {
+			activity.MessagesPerMinute++
+		}
+	}
+	activity.UniqueChatters5m = len(chatters)
+	return activity
+}
+
+// publishActivity periodically publishes the chat activity metrics when they change
+func (b *Bridge) publishActivity(ctx context.Context) {
+	key := b.key("chat-activity")
+	var last ChatActivity
+	ticker := time.NewTicker(activityPublishEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			activity := b.activity.compute(now)
+			if activity.MessagesPerMinute == last.MessagesPerMinute && activity.UniqueChatters5m == last.UniqueChatters5m {
+				continue
+			}
+			last = activity
+			b.setJSON(key, activity)
+		}
+	}
+}
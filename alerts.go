@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Maximum accepted size for webhook request bodies
+const maxWebhookBodySize = 64 * 1024
+
+// Alert is the normalized form of every alert-worthy event (subscriptions, donations...),
+// so overlays can consume a single feed regardless of where the event came from
+type Alert struct {
+	Type      string    `json:"type"`
+	Source    string    `json:"source"`
+	Username  string    `json:"username"`
+	Amount    float64   `json:"amount,omitempty"`
+	Currency  string    `json:"currency,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DonationWebhook is the payload accepted by the donation webhook endpoint
+type DonationWebhook struct {
+	Source   string  `json:"source"`
+	Username string  `json:"username"`
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	Message  string  `json:"message"`
+}
+
+// publishAlert writes an alert to the unified alert feed
+func (b *Bridge) publishAlert(alert Alert) {
+	if b.inMaintenance() {
+		b.log.WithField("type", alert.Type).Debug("Maintenance mode, not publishing alert")
+		return
+	}
+	if alert.Timestamp.IsZero() {
+		alert.Timestamp = time.Now()
+	}
+	b.setJSON(b.key("ev/alert"), alert)
+}
+
+// donationWebhook receives donation events from third-party services and
+// forwards them to the alert feed
+type donationWebhook struct {
+	bridge *Bridge
+	secret string
+}
+
+func (d *donationWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	secret := r.Header.Get("X-Webhook-Secret")
+	if secret == "" {
+		secret = r.URL.Query().Get("secret")
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(d.secret)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var donation DonationWebhook
+	err := jsoniter.ConfigFastest.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBodySize)).Decode(&donation)
+	if err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if donation.Amount <= 0 {
+		http.Error(w, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+	if donation.Source == "" {
+		donation.Source = "webhook"
+	}
+
+	d.bridge.log.WithField("source", donation.Source).WithField("user", donation.Username).Info("Donation received")
+	d.bridge.setJSON(d.bridge.key("ev/donation"), donation)
+	d.bridge.publishAlert(Alert{
+		Type:     "donation",
+		Source:   strings.ToLower(donation.Source),
+		Username: donation.Username,
+		Amount:   donation.Amount,
+		Currency: strings.ToUpper(donation.Currency),
+		Message:  donation.Message,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
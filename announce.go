@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Minimum interval between repetitions of an announcement
+const minAnnouncementInterval = 30 * time.Second
+
+// AnnouncementRequest is the JSON form of an @announce RPC call,
+// plain text values are sent once
+type AnnouncementRequest struct {
+	// ID can be used to cancel a repeating announcement with @cancel-announcement
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	// Number of times the announcement is sent (defaults to 1)
+	Repeat          int `json:"repeat"`
+	IntervalSeconds int `json:"interval_seconds"`
+	// Source and Secret identify the sender, see ChatSendRequest
+	Source string `json:"source"`
+	Secret string `json:"secret"`
+}
+
+// announcer sends decorated announcements, keeping track of the repeating ones
+type announcer struct {
+	bridge *Bridge
+
+	mu      sync.Mutex
+	prefix  string
+	suffix  string
+	repeats map[string]*repeatingAnnouncement
+}
+
+type repeatingAnnouncement struct {
+	cancel context.CancelFunc
+}
+
+func (b *Bridge) newAnnouncer(config Config) *announcer {
+	return &announcer{
+		bridge:  b,
+		prefix:  config.AnnouncementPrefix,
+		suffix:  config.AnnouncementSuffix,
+		repeats: make(map[string]*repeatingAnnouncement),
+	}
+}
+
+func (a *announcer) configure(config Config) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prefix = config.AnnouncementPrefix
+	a.suffix = config.AnnouncementSuffix
+}
+
+func (a *announcer) send(req AnnouncementRequest) {
+	a.mu.Lock()
+	message := a.prefix + req.Message + a.suffix
+	a.mu.Unlock()
+	a.bridge.chat.send(ChatSendRequest{ID: req.ID, Message: message, Source: req.Source})
+}
+
+// announce sends an announcement, repeating it in the background if requested
+func (a *announcer) announce(ctx context.Context, req AnnouncementRequest) {
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" {
+		return
+	}
+	a.send(req)
+	if req.Repeat <= 1 {
+		return
+	}
+
+	interval := time.Duration(req.IntervalSeconds) * time.Second
+	if interval < minAnnouncementInterval {
+		interval = minAnnouncementInterval
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	repeating := &repeatingAnnouncement{cancel: cancel}
+	a.mu.Lock()
+	if previous, ok := a.repeats[req.ID]; ok {
+		previous.cancel()
+	}
+	a.repeats[req.ID] = repeating
+	a.mu.Unlock()
+
+	go func() {
+		defer func() {
+			a.mu.Lock()
+			if a.repeats[req.ID] == repeating {
+				delete(a.repeats, req.ID)
+			}
+			a.mu.Unlock()
+			cancel()
+		}()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for i := 1; i < req.Repeat; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if a.bridge.inMaintenance() {
+					continue
+				}
+				a.send(req)
+			}
+		}
+	}()
+}
+
+// cancel stops a repeating announcement
+func (a *announcer) cancel(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if repeating, ok := a.repeats[id]; ok {
+		repeating.cancel()
+		delete(a.repeats, id)
+	}
+}
+
+// setupAnnouncements registers the @announce and @cancel-announcement RPCs
+func (b *Bridge) setupAnnouncements(ctx context.Context, config Config) error {
+	b.announcer = b.newAnnouncer(config)
+	err := b.handleRPC(ctx, "@announce", func(value string) {
+		req := AnnouncementRequest{Message: value}
+		trimmed := strings.TrimSpace(value)
+		if strings.HasPrefix(trimmed, "{") {
+			err := jsoniter.ConfigFastest.UnmarshalFromString(trimmed, &req)
+			if err != nil {
+				b.log.WithError(err).Error("Could not decode announcement")
+				return
+			}
+		}
+		if b.authorizeSend("@announce", req.ID, req.Message, req.Source, req.Secret) {
+			b.announcer.announce(ctx, req)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return b.handleRPC(ctx, "@cancel-announcement", func(value string) {
+		b.announcer.cancel(strings.TrimSpace(value))
+	})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	bridgepb "github.com/ashkeel/glimesh-bridge/proto"
+)
+
+// API key scopes, admin implies send and send implies read
+const (
+	ScopeRead  = "read"
+	ScopeSend  = "send"
+	ScopeAdmin = "admin"
+)
+
+var scopeLevels = map[string]int{ScopeRead: 0, ScopeSend: 1, ScopeAdmin: 2}
+
+var (
+	errMissingAPIKey = errors.New("missing API key")
+	errInvalidAPIKey = errors.New("invalid API key")
+	errMissingScope  = errors.New("API key is not allowed to do this")
+	errRateLimited   = errors.New("rate limit exceeded")
+)
+
+// APIKey is an entry of the API keys file
+type APIKey struct {
+	Name   string   `json:"name"`
+	Key    string   `json:"key"`
+	Scopes []string `json:"scopes"`
+	// RateLimit is the maximum number of requests per minute (0 for unlimited)
+	RateLimit int `json:"rate_limit"`
+}
+
+func (k APIKey) allows(scope string) bool {
+	for _, granted := range k.Scopes {
+		if scopeLevels[granted] >= scopeLevels[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+type apiKeyState struct {
+	APIKey
+	windowStart time.Time
+	requests    int
+}
+
+// apiKeys authenticates requests to the HTTP and gRPC servers
+type apiKeys struct {
+	mu   sync.Mutex
+	keys []*apiKeyState
+}
+
+// replace swaps the keys with the ones in other, keeping the rate limit state of unchanged keys
+func (a *apiKeys) replace(other *apiKeys) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	previous := make(map[string]*apiKeyState)
+	for _, key := range a.keys {
+		previous[key.Key] = key
+	}
+	for i, key := range other.keys {
+		if old, ok := previous[key.Key]; ok && old.RateLimit == key.RateLimit {
+			old.APIKey = key.APIKey
+			other.keys[i] = old
+		}
+	}
+	a.keys = other.keys
+}
+
+// loadAPIKeys reads a JSON file containing a list of API keys
+func loadAPIKeys(path string) (*apiKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []APIKey
+	err = jsoniter.ConfigFastest.Unmarshal(data, &keys)
+	if err != nil {
+		return nil, err
+	}
+	result := &apiKeys{}
+	for _, key := range keys {
+		if key.Key == "" {
+			return nil, errors.New("API key \"" + key.Name + "\" is empty")
+		}
+		for _, scope := range key.Scopes {
+			if _, ok := scopeLevels[scope]; !ok {
+				return nil, errors.New("unknown scope \"" + scope + "\" for API key \"" + key.Name + "\"")
+			}
+		}
+		result.keys = append(result.keys, &apiKeyState{APIKey: key})
+	}
+	return result, nil
+}
+
+// authorize checks that key exists, has the required scope and is within its rate limit
+func (a *apiKeys) authorize(key string, scope string) error {
+	if key == "" {
+		return errMissingAPIKey
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, state := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(state.Key), []byte(key)) != 1 {
+			continue
+		}
+		if !state.allows(scope) {
+			return errMissingScope
+		}
+		if state.RateLimit > 0 {
+			now := time.Now()
+			if now.Sub(state.windowStart) >= time.Minute {
+				state.windowStart = now
+				state.requests = 0
+			}
+			if state.requests >= state.RateLimit {
+				return errRateLimited
+			}
+			state.requests++
+		}
+		return nil
+	}
+	return errInvalidAPIKey
+}
+
+// requestAPIKey reads the API key from the Authorization (Bearer) or X-API-Key headers,
+// or the api_key query parameter for clients that can't set headers (eg. browser sources)
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// requireScope wraps an HTTP handler so it requires an API key with the given scope,
+// if API keys are configured
+func (b *Bridge) requireScope(scope string, handler http.Handler) http.Handler {
+	if b.apiKeys == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := b.apiKeys.authorize(requestAPIKey(r), scope)
+		switch err {
+		case nil:
+			handler.ServeHTTP(w, r)
+		case errMissingAPIKey, errInvalidAPIKey:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errMissingScope:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errRateLimited:
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		}
+	})
+}
+
+// Scopes required by the gRPC methods
+var grpcMethodScopes = map[string]string{
+	bridgepb.Bridge_ChatEvents_FullMethodName:    ScopeRead,
+	bridgepb.Bridge_SendMessage_FullMethodName:   ScopeSend,
+	bridgepb.Bridge_DeleteMessage_FullMethodName: ScopeAdmin,
+}
+
+func (b *Bridge) authorizeGRPC(ctx context.Context, method string) error {
+	var key string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			key = strings.TrimPrefix(values[0], "Bearer ")
+		} else if values := md.Get("x-api-key"); len(values) > 0 {
+			key = values[0]
+		}
+	}
+	scope, ok := grpcMethodScopes[method]
+	if !ok {
+		scope = ScopeAdmin
+	}
+	err := b.apiKeys.authorize(key, scope)
+	switch err {
+	case nil:
+		return nil
+	case errMissingAPIKey, errInvalidAPIKey:
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errMissingScope:
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+}
+
+// grpcAuthOptions returns the interceptors checking API keys on gRPC calls, if API keys are configured
+func (b *Bridge) grpcAuthOptions() []grpc.ServerOption {
+	if b.apiKeys == nil {
+		return nil
+	}
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := b.authorizeGRPC(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := b.authorizeGRPC(stream.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// Default and maximum number of messages in a history page
+	historyPageSize    = 50
+	maxHistoryPageSize = 200
+)
+
+// ArchivedMessage is a chat message in the archive
+type ArchivedMessage struct {
+	ChatMessage
+	ReceivedAt time.Time `json:"received_at"`
+	Deleted    bool      `json:"deleted,omitempty"`
+}
+
+// HistoryPageRequest is the payload of the @get-history RPC
+type HistoryPageRequest struct {
+	// ID is an optional identifier echoed back in the response, to match requests and responses
+	ID string `json:"id"`
+	// Offset is the number of messages to skip, starting from the most recent
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+	User   string `json:"user"`
+}
+
+// HistoryPage is a page of archived messages, in chronological order
+type HistoryPage struct {
+	ID       string            `json:"id"`
+	Offset   int               `json:"offset"`
+	Total    int               `json:"total"`
+	Messages []ArchivedMessage `json:"messages"`
+}
+
+// chatArchive keeps a longer backlog of chat messages than the history,
+// optionally appending them to a JSON lines file so they survive restarts
+type chatArchive struct {
+	size int
+	path string
+	// Maximum size of a row, in bytes (0 for unlimited)
+	maxRow int
+
+	mu       sync.Mutex
+	messages []ArchivedMessage
+}
+
+func (b *Bridge) newChatArchive(size int, path string) *chatArchive {
+	archive := &chatArchive{size: size, path: path, maxRow: b.limits.ArchiveRowBytes, messages: make([]ArchivedMessage, 0)}
+	if path == "" {
+		return archive
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			b.log.WithError(err).Warn("Could not read chat archive")
+		}
+		return archive
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var message ArchivedMessage
+		if jsoniter.ConfigFastest.Unmarshal(scanner.Bytes(), &message) != nil {
+			continue
+		}
+		archive.append(message)
+	}
+	return archive
+}
+
+func (a *chatArchive) append(message ArchivedMessage) {
+	a.messages = append(a.messages, message)
+	if len(a.messages) > a.size {
+		a.messages = a.messages[len(a.messages)-a.size:]
+	}
+}
+
+func (a *chatArchive) add(msg ChatMessage) error {
+	message := limitArchiveRow(ArchivedMessage{ChatMessage: msg, ReceivedAt: time.Now()}, a.maxRow)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.append(message)
+	return a.write(message)
+}
+
+// retract marks a message deleted by a moderator, so it's left out of history pages
+func (a *chatArchive) retract(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := len(a.messages) - 1; i >= 0; i-- {
+		if a.messages[i].ID == id {
+			a.messages[i].Deleted = true
+			return a.write(a.messages[i])
+		}
+	}
+	return nil
+}
+
+// write appends a message to the archive file, deletions are written as a second
+// copy of the message that replaces the first one when loading
+func (a *chatArchive) write(message ArchivedMessage) error {
+	if a.path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return jsoniter.ConfigFastest.NewEncoder(file).Encode(message)
+}
+
+// filtered returns the (not deleted) messages, optionally only the ones from user
+func (a *chatArchive) filtered(user string) []ArchivedMessage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	deleted := make(map[string]bool)
+	for _, message := range a.messages {
+		if message.Deleted && message.ID != "" {
+			deleted[message.ID] = true
+		}
+	}
+	messages := make([]ArchivedMessage, 0, len(a.messages))
+	for _, message := range a.messages {
+		if message.Deleted || deleted[message.ID] {
+			continue
+		}
+		if user != "" && !strings.EqualFold(message.User.Username, user) {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// find returns the message with the given ID, unless it was deleted
+func (a *chatArchive) find(id string) (ArchivedMessage, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := len(a.messages) - 1; i >= 0; i-- {
+		if a.messages[i].ID == id {
+			// Deletions are written as a second copy of the message, after the original
+			return a.messages[i], !a.messages[i].Deleted
+		}
+	}
+	return ArchivedMessage{}, false
+}
+
+// page returns up to limit messages, skipping the offset most recent ones
+func (a *chatArchive) page(offset int, limit int, user string) HistoryPage {
+	if limit <= 0 {
+		limit = historyPageSize
+	}
+	if limit > maxHistoryPageSize {
+		limit = maxHistoryPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	messages := a.filtered(strings.TrimPrefix(user, "@"))
+	end := len(messages) - offset
+	if end < 0 {
+		end = 0
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	return HistoryPage{Offset: offset, Total: len(messages), Messages: messages[start:end]}
+}
+
+// setupHistoryRPC registers the @get-history RPC, replying on the history-page key
+func (b *Bridge) setupHistoryRPC(ctx context.Context) error {
+	responseKey := b.key("history-page")
+	return b.handleRPC(ctx, "@get-history", func(value string) {
+		var request HistoryPageRequest
+		if strings.TrimSpace(value) != "" {
+			err := jsoniter.ConfigFastest.UnmarshalFromString(value, &request)
+			if err != nil {
+				b.log.WithError(err).Error("Could not decode history RPC request")
+				return
+			}
+		}
+		page := b.archive.page(request.Offset, request.Limit, request.User)
+		page.ID = request.ID
+		b.setJSON(responseKey, page)
+	})
+}
+
+// before returns up to limit messages older than the message with the given ID
+// (or the given RFC3339 timestamp), and whether there are more
+func (a *chatArchive) before(cursor string, limit int) ([]ArchivedMessage, bool) {
+	messages := a.filtered("")
+	end := len(messages)
+	if cursor != "" {
+		timestamp, err := time.Parse(time.RFC3339, cursor)
+		for end = len(messages); end > 0; end-- {
+			message := messages[end-1]
+			if err == nil && message.ReceivedAt.Before(timestamp) {
+				break
+			}
+			if err != nil && message.ID == cursor {
+				end--
+				break
+			}
+		}
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	return messages[start:end], start > 0
+}
+
+// historyEndpoint serves GET /chat/history?limit=&before=
+type historyEndpoint struct {
+	archive *chatArchive
+}
+
+func (h *historyEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := historyPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		if limit > maxHistoryPageSize {
+			limit = maxHistoryPageSize
+		}
+	}
+
+	messages, more := h.archive.before(r.URL.Query().Get("before"), limit)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = jsoniter.ConfigFastest.NewEncoder(w).Encode(struct {
+		Messages []ArchivedMessage `json:"messages"`
+		HasMore  bool              `json:"has_more"`
+	}{messages, more})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Number of entries kept in the moderation/audit-log key
+const auditLogSize = 500
+
+// Moderators recorded in the audit log for actions not taken by a Glimesh user
+const (
+	AuditByBridge   = "bridge"
+	AuditByGRPC     = "grpc"
+	AuditByObserved = "observed"
+)
+
+// ModerationAuditEntry records a moderation action taken or observed by the bridge
+type ModerationAuditEntry struct {
+	Time   time.Time       `json:"time"`
+	Action string          `json:"action"`
+	By     string          `json:"by"`
+	User   ChatMessageUser `json:"user"`
+	// Message that caused (or was removed by) the action, if any
+	MessageID string `json:"message_id,omitempty"`
+	Message   string `json:"message,omitempty"`
+	// Reason is the rule that triggered an automated action
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// moderationAudit keeps the most recent moderation actions in KV, and all of them
+// in a JSON lines file if configured
+type moderationAudit struct {
+	bridge *Bridge
+	key    string
+	path   string
+
+	mu      sync.Mutex
+	entries []ModerationAuditEntry
+	// Messages deleted by the bridge, so their deletion isn't recorded again when observed
+	deletedByUs map[string]time.Time
+}
+
+func (b *Bridge) newModerationAudit(path string) *moderationAudit {
+	audit := &moderationAudit{bridge: b, key: b.key("moderation/audit-log"), path: path, deletedByUs: make(map[string]time.Time)}
+	err := b.kv.GetJSON(audit.key, &audit.entries)
+	if err != nil || audit.entries == nil {
+		audit.entries = make([]ModerationAuditEntry, 0)
+	}
+	return audit
+}
+
+func (a *moderationAudit) record(entry ModerationAuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if entry.Action == EscalationDelete && entry.MessageID != "" {
+		if entry.By == AuditByObserved {
+			if _, ok := a.deletedByUs[entry.MessageID]; ok {
+				delete(a.deletedByUs, entry.MessageID)
+				return
+			}
+		} else if entry.Error == "" {
+			a.deletedByUs[entry.MessageID] = entry.Time
+		}
+	}
+	for id, deleted := range a.deletedByUs {
+		if entry.Time.Sub(deleted) > time.Minute {
+			delete(a.deletedByUs, id)
+		}
+	}
+
+	a.entries = append(a.entries, entry)
+	if len(a.entries) > auditLogSize {
+		a.entries = a.entries[len(a.entries)-auditLogSize:]
+	}
+	a.bridge.setJSON(a.key, a.entries)
+	if a.path != "" {
+		if err := a.write(entry); err != nil {
+			a.bridge.log.WithError(err).Error("Could not write to moderation log")
+		}
+	}
+}
+
+func (a *moderationAudit) write(entry ModerationAuditEntry) error {
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return jsoniter.ConfigFastest.NewEncoder(file).Encode(entry)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
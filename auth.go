@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Authentication modes for -auth-mode
+const (
+	// AuthOAuth obtains (and refreshes) a token with the OAuth client credentials grant
+	AuthOAuth = "oauth"
+	// AuthToken uses a static bearer token, for instances without OAuth apps
+	AuthToken = "token"
+	// AuthClientID only identifies the app with its client ID, which is enough to read
+	// public data and chat but not to send messages or moderate (read-only mode)
+	AuthClientID = "client-id"
+)
+
+// GlimeshServer is the Glimesh instance the bridge connects to, the official one by default.
+// Self-hosted instances of the Glimesh codebase can use different paths or plain bearer tokens.
+type GlimeshServer struct {
+	URL        string
+	Auth       string
+	TokenPath  string
+	APIPath    string
+	SocketPath string
+	// Static bearer token, for AuthToken
+	AccessToken string
+	// App client ID, for AuthClientID
+	ClientID string
+}
+
+// registerServerFlags adds the flags selecting the Glimesh instance and how to authenticate to fs
+func registerServerFlags(fs *flag.FlagSet) *GlimeshServer {
+	server := &GlimeshServer{}
+	fs.StringVar(&server.URL, "glimesh-url", "https://glimesh.tv", "Base URL of the Glimesh instance, for self-hosted forks")
+	fs.StringVar(&server.Auth, "auth-mode", AuthOAuth, "How to authenticate with Glimesh: \"oauth\" (client ID and secret), \"token\" (a static bearer token from -access-token) or \"client-id\" (read-only, client ID only)")
+	fs.StringVar(&server.TokenPath, "oauth-token-path", "/api/oauth/token", "Path of the OAuth token endpoint")
+	fs.StringVar(&server.APIPath, "api-path", "/api/graph", "Path of the GraphQL API endpoint")
+	fs.StringVar(&server.SocketPath, "socket-path", "/api/socket/websocket", "Path of the GraphQL websocket endpoint")
+	fs.StringVar(&server.AccessToken, "access-token", "", "Bearer token for -auth-mode token")
+	return server
+}
+
+// validate checks that the credentials needed by the auth mode were provided.
+// OAuth without a secret key falls back to read-only mode.
+func (s *GlimeshServer) validate(clientID, clientSecret string) error {
+	base, err := url.Parse(s.URL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return fmt.Errorf("invalid Glimesh URL %q", s.URL)
+	}
+	switch s.Auth {
+	case AuthOAuth:
+		if clientID != "" && clientSecret == "" {
+			s.Auth = AuthClientID
+		} else if clientID == "" || clientSecret == "" {
+			return fmt.Errorf("oauth authentication needs a client ID and secret key")
+		}
+	case AuthClientID:
+		if clientID == "" {
+			return fmt.Errorf("client ID authentication needs a client ID")
+		}
+	case AuthToken:
+		if s.AccessToken == "" {
+			return fmt.Errorf("token authentication needs -access-token")
+		}
+	default:
+		return fmt.Errorf("unknown auth mode %q", s.Auth)
+	}
+	s.ClientID = clientID
+	return nil
+}
+
+// readOnly returns whether the bridge can only read, without a token to send messages or moderate
+func (s *GlimeshServer) readOnly() bool {
+	return s.Auth == AuthClientID
+}
+
+func (s *GlimeshServer) endpoint(path string) string {
+	return strings.TrimSuffix(s.URL, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// apiURL returns the GraphQL API endpoint
+func (s *GlimeshServer) apiURL() string {
+	return s.endpoint(s.APIPath)
+}
+
+// socketURL returns the websocket endpoint, authenticated with token (or the client ID if there is none)
+func (s *GlimeshServer) socketURL(token string, vsn string) string {
+	endpoint := s.endpoint(s.SocketPath)
+	if strings.HasPrefix(endpoint, "https://") {
+		endpoint = "wss://" + strings.TrimPrefix(endpoint, "https://")
+	} else {
+		endpoint = "ws://" + strings.TrimPrefix(endpoint, "http://")
+	}
+	query := url.Values{"vsn": {vsn}}
+	if token != "" {
+		query.Set("token", token)
+	} else {
+		query.Set("client_id", s.ClientID)
+	}
+	return endpoint + "?" + query.Encode()
+}
+
+// credentials obtains a token for the configured auth mode, static tokens never expire
+// and read-only mode has none
+func (s *GlimeshServer) credentials(ctx context.Context, clientID, clientSecret, scope string) (ClientCredentialsResult, error) {
+	switch s.Auth {
+	case AuthToken:
+		return ClientCredentialsResult{AccessToken: s.AccessToken, TokenType: "Bearer", ReceivedAt: time.Now()}, nil
+	case AuthClientID:
+		return ClientCredentialsResult{ReceivedAt: time.Now()}, nil
+	}
+	return getClientCredentials(ctx, s.endpoint(s.TokenPath), clientID, clientSecret, scope)
+}
+
+// newClient returns an API client for this instance
+func (s *GlimeshServer) newClient(token string) *GlimeshClient {
+	client := NewGlimeshClient(token)
+	client.Endpoint = s.apiURL()
+	if s.readOnly() {
+		client.ClientID = s.ClientID
+	}
+	return client
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+// Subscription ID of the frames in the benchmark corpus
+const benchSubscriptionID = "__absinthe__:doc:bench"
+
+// BenchResult is the throughput measured for one stage of the hot path
+type BenchResult struct {
+	Stage    string
+	Messages int
+	Elapsed  time.Duration
+}
+
+// PerSecond returns the number of messages per second the stage can handle
+func (r BenchResult) PerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Messages) / r.Elapsed.Seconds()
+}
+
+// benchCorpus builds n chat messages, and the websocket frames carrying them,
+// with the same users and texts as -generate
+func benchCorpus(n int) ([]ChatMessage, [][]byte, error) {
+	messages := make([]ChatMessage, n)
+	frames := make([][]byte, n)
+	for i := range messages {
+		user := generatedUser(i%generatedUsers + 1)
+		messages[i] = ChatMessage{
+			ID:       fmt.Sprintf("bench-%d", i),
+			Message:  generatedMessages[i%len(generatedMessages)],
+			User:     ChatMessageUser{ID: user.ID, Username: user.Username},
+			Metadata: &ChatMessageMetadata{Subscriber: i%4 == 0},
+		}
+		var payload struct {
+			Result struct {
+				Data ChatMessagesResponse `json:"data"`
+			} `json:"result"`
+			SubscriptionID string `json:"subscriptionId"`
+		}
+		payload.Result.Data.ChatMessage = &messages[i]
+		payload.SubscriptionID = benchSubscriptionID
+		byt, err := jsoniter.ConfigFastest.Marshal(payload)
+		if err != nil {
+			return nil, nil, err
+		}
+		frames[i], err = jsoniter.ConfigFastest.Marshal(PhoenixFrame{Topic: benchSubscriptionID, Event: "subscription:data", Payload: byt})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return messages, frames, nil
+}
+
+// newBenchBridge creates a bridge with the chat subsystems set up like a default run,
+// without a Glimesh connection
+func newBenchBridge(ctx context.Context, store kvStore, prefix string, log logrus.FieldLogger) *Bridge {
+	memory := MemoryLimits{EventBuffer: 4 * 1024 * 1024, UserCaches: 16 * 1024 * 1024, DedupSets: 8 * 1024 * 1024}
+	bridge := &Bridge{
+		ctx:      ctx,
+		kv:       store,
+		api:      NewGlimeshClient(""),
+		log:      log,
+		prefix:   prefix,
+		activity: &activityTracker{},
+		events:   newEventBus(memory.EventBuffer),
+		memory:   memory,
+		commands: newChatCommands(),
+		limits:   PayloadLimits{MessageLength: glimeshMaxMessageLength},
+	}
+	config := Config{
+		ChatHistorySize:       6,
+		ChatHistoryDeleteMode: "remove",
+		ChatMaxParts:          3,
+		Spam: SpamHeuristics{
+			CapsMinLetters: 10,
+			Action:         SpamActionTag,
+			ExemptRole:     RoleModerator,
+		},
+	}
+	bridge.health = bridge.newHealthTracker()
+	bridge.users = bridge.newUserCache(time.Hour, false)
+	bridge.history = bridge.newChatHistory(config)
+	bridge.relay = bridge.newChatRelay(config)
+	bridge.spam = &spamFilter{}
+	bridge.spam.configure(config)
+	bridge.escalation = bridge.newEscalationLadder(config)
+	bridge.audit = bridge.newModerationAudit("")
+	bridge.outgoing = bridge.newOutgoingAudit("")
+	bridge.archive = bridge.newChatArchive(1000, "")
+	bridge.chat = bridge.newChatSender(config)
+	bridge.session = bridge.newSessionTracker("")
+	bridge.firsts = bridge.newFirstMessageDetector(false, 0)
+	bridge.polls = &pollManager{bridge: bridge}
+	return bridge
+}
+
+// benchDecode measures decoding websocket frames into chat messages
+func benchDecode(ctx context.Context, frames [][]byte, log logrus.FieldLogger) (BenchResult, error) {
+	socket := newGlimeshSocket(log, SocketProtocol{Serializer: "auto", SubscriptionID: subscriptionIDAuto})
+	decoded := 0
+	socket.active[benchSubscriptionID] = func(data jsoniter.RawMessage) {
+		var result ChatMessagesResponse
+		if jsoniter.ConfigFastest.Unmarshal(data, &result) == nil && result.ChatMessage != nil {
+			decoded++
+		}
+	}
+	start := time.Now()
+	for _, frame := range frames {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := socket.handleFrame(frame); err != nil {
+			return BenchResult{}, err
+		}
+	}
+	return BenchResult{Stage: "decode", Messages: decoded, Elapsed: time.Since(start)}, nil
+}
+
+// benchPipeline measures processing chat messages, from sanitizing to publishing and archiving
+func benchPipeline(ctx context.Context, bridge *Bridge, messages []ChatMessage) BenchResult {
+	start := time.Now()
+	processed := 0
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			break
+		}
+		now := time.Now()
+		bridge.handleChatMessage(incomingChatMessage{ChatMessage: msg, timing: pipelineTiming{received: now, decoded: now}})
+		processed++
+	}
+	return BenchResult{Stage: "pipeline", Messages: processed, Elapsed: time.Since(start)}
+}
+
+// benchPublish measures publishing chat events to KV alone
+func benchPublish(ctx context.Context, bridge *Bridge, messages []ChatMessage) BenchResult {
+	key := bridge.key("ev/chat-message")
+	start := time.Now()
+	published := 0
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			break
+		}
+		bridge.setJSON(key, ChatEvent{ChatMessage: msg, Role: RoleViewer})
+		published++
+	}
+	return BenchResult{Stage: "publish", Messages: published, Elapsed: time.Since(start)}
+}
+
+func benchCommand(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	count := fs.Int("messages", 20000, "Number of chat messages to run through each stage")
+	stages := fs.String("stages", "decode,pipeline,publish", "Comma-separated list of stages to measure: decode (websocket frames), pipeline (chat processing) and publish (KV writes)")
+	endpoint := fs.String("kv-endpoint", "", "Kilovolt endpoint to publish to (empty to keep keys in memory)")
+	password := fs.String("password", "", "Optional password for Kilovolt")
+	prefix := fs.String("prefix", "glimesh-bench/", "Prefix/Namespace for keys, keep it separate from the live bridge")
+	_ = fs.Parse(args)
+
+	if *count <= 0 {
+		check(fmt.Errorf("must be positive"), "Invalid -messages")
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	log := logrus.New()
+	log.SetOutput(os.Stderr)
+	log.SetLevel(logrus.WarnLevel)
+
+	var store kvStore = newMemoryStore(log)
+	if *endpoint != "" {
+		client, err := newMultiStore(ctx, parseList(*endpoint), *password, log)
+		check(err, "Connection to kilovolt failed")
+		defer client.close()
+		store = client
+	}
+
+	messages, frames, err := benchCorpus(*count)
+	check(err, "Could not build message corpus")
+	bridge := newBenchBridge(ctx, store, *prefix, log)
+
+	var results []BenchResult
+	for _, stage := range parseList(*stages) {
+		switch stage {
+		case "decode":
+			result, err := benchDecode(ctx, frames, log)
+			check(err, "Could not decode frames")
+			results = append(results, result)
+		case "pipeline":
+			results = append(results, benchPipeline(ctx, bridge, messages))
+		case "publish":
+			results = append(results, benchPublish(ctx, bridge, messages))
+		default:
+			check(fmt.Errorf("unknown stage %q", stage), "Invalid -stages")
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(w, "stage\tmessages\telapsed\tmessages/s\t")
+	for _, result := range results {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%.0f\t\n", result.Stage, result.Messages, result.Elapsed.Round(time.Millisecond), result.PerSecond())
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+// Number of distinct messages the benchmarks cycle through
+const benchCorpusSize = 1000
+
+func benchSetup(b *testing.B) ([]ChatMessage, [][]byte, *Bridge) {
+	b.Helper()
+	messages, frames, err := benchCorpus(benchCorpusSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	ctx, cancel := context.WithCancel(context.Background())
+	b.Cleanup(cancel)
+	return messages, frames, newBenchBridge(ctx, newMemoryStore(log), "glimesh-bench/", log)
+}
+
+func BenchmarkDecodeFrame(b *testing.B) {
+	_, frames, _ := benchSetup(b)
+	socket := newTestSocket()
+	socket.active[benchSubscriptionID] = func(data jsoniter.RawMessage) {
+		var result ChatMessagesResponse
+		if err := jsoniter.ConfigFastest.Unmarshal(data, &result); err != nil || result.ChatMessage == nil {
+			b.Fatalf("could not decode chat message: %v", err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := socket.handleFrame(frames[i%len(frames)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPipeline(b *testing.B) {
+	messages, _, bridge := benchSetup(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		now := time.Now()
+		bridge.handleChatMessage(incomingChatMessage{ChatMessage: messages[i%len(messages)], timing: pipelineTiming{received: now, decoded: now}})
+	}
+}
+
+func BenchmarkPublish(b *testing.B) {
+	messages, _, bridge := benchSetup(b)
+	key := bridge.key("ev/chat-message")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bridge.setJSON(key, ChatEvent{ChatMessage: messages[i%len(messages)], Role: RoleViewer})
+	}
+}
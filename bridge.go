@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+// Bridge holds the state shared by all the bridge subsystems
+type Bridge struct {
+	// Last event sequence number, first so it's 64-bit aligned for atomic operations on 32-bit platforms
+	eventSeq uint64
+	// Cancelled when the bridge shuts down
+	ctx        context.Context
+	kv         kvStore
+	api        *GlimeshClient
+	log        logrus.FieldLogger
+	sampler    *logSampler
+	limits     PayloadLimits
+	prefix     string
+	configFile string
+	channelID  int
+	mux        *http.ServeMux
+	thumbnail  *thumbnailFetcher
+	activity   *activityTracker
+	hype       *hypeTracker
+	topChat    *leaderboards
+	session    *sessionTracker
+	history    *chatHistory
+	relay      *chatRelay
+	spam       *spamFilter
+	escalation *escalationLadder
+	audit      *moderationAudit
+	outgoing   *outgoingAudit
+	archive    *chatArchive
+	commands   *chatCommands
+	markers    *markerList
+	polls      *pollManager
+	queue      *viewerQueue
+	merged     *mergedChat
+	users      *userCache
+	followers  *followerCache
+	chat       *chatSender
+	announcer  *announcer
+	triggers   *triggerKeys
+	// Connection to obs-websocket, nil if not configured
+	obs       *obsClient
+	firsts    *firstMessageDetector
+	hooks     *HooksConfig
+	sounds    *soundPlayer
+	apiKeys   *apiKeys
+	sendAuth  *sendAuth
+	plugins   *pluginRuntime
+	events    *eventBus
+	eventLog  *eventLog
+	health    *healthTracker
+	connStats *connectionStats
+	// Websocket connection to Glimesh, nil until connected
+	connection *glimeshConnection
+	latency    *latencyMonitor
+	// State snapshot restored on startup, nil if there was none
+	restored *BridgeSnapshot
+
+	memory   MemoryLimits
+	cachesMu sync.Mutex
+	// Memory bounded caches, for the metrics
+	caches []*lruCache
+
+	// Guards the settings that can be reloaded from files (messages and hooks)
+	reloadMu sync.RWMutex
+	messages map[string]string
+
+	// Connected without a token, chat can be read but not sent to
+	readOnly        bool
+	userLastMessage bool
+	stripInvisible  bool
+	// Flag messages using look-alike characters as suspicious
+	detectConfusables bool
+	enrichChat        bool
+	// Profanity masking, link blocking and text-to-speech cleanup
+	family FamilyFilter
+
+	unparsedFrames uint64
+	// Recovered panics, see reportCrash
+	crashes uint64
+	// Open connections to the embedded HTTP server
+	httpConns int64
+	// Hook actions running in the background, see startHook
+	runningHooks int64
+	// Where crash reports are written, empty to only log and publish them
+	crashDir string
+	// 1 in maintenance mode, see inMaintenance
+	maintenance uint32
+
+	// Last fetched ChannelInfo
+	channel atomic.Value
+}
+
+// key returns the full name of a KV key under the bridge prefix
+func (b *Bridge) key(name string) string {
+	return b.prefix + name
+}
+
+// validKeyName returns whether name can be passed to key by untrusted callers (templates, plugins)
+// without escaping the bridge prefix
+func validKeyName(name string) bool {
+	return name != "" && !strings.Contains(name, "..") && !strings.HasPrefix(name, "/")
+}
+
+// setJSON writes a JSON value to a KV key, logging any failure.
+// Event keys (ev/...) get a sequence number and also trigger their hooks.
+func (b *Bridge) setJSON(key string, value interface{}) {
+	byt, err := jsoniter.ConfigFastest.Marshal(value)
+	if err != nil {
+		b.log.WithField("key", key).WithError(err).Error("Could not encode value")
+		return
+	}
+	event := strings.TrimPrefix(key, b.key("ev/"))
+	var published BridgeEvent
+	if event != key {
+		published = b.stampEvent(event, byt)
+		byt = published.Payload
+	}
+	err = b.kv.SetKey(key, string(byt))
+	if err != nil {
+		b.log.WithField("key", key).WithError(err).Error("Could not set key")
+	}
+	if event != key {
+		if b.eventLog != nil {
+			b.eventLog.append(published)
+		}
+		b.events.publish(published)
+		b.runEventHooks(event, byt)
+		if b.plugins != nil {
+			b.plugins.dispatch(event, byt)
+		}
+		if b.sounds != nil && !b.inMaintenance() {
+			b.sounds.event(event, byt)
+		}
+	}
+}
+
+func (b *Bridge) channelIDString() string {
+	return strconv.Itoa(b.channelID)
+}
+
+// channelInfo returns the last fetched info of the bridged channel, if any
+func (b *Bridge) channelInfo() (ChannelInfo, bool) {
+	info, ok := b.channel.Load().(ChannelInfo)
+	return info, ok
+}
+
+// isStreamer returns whether username is the owner of the bridged channel
+func (b *Bridge) isStreamer(username string) bool {
+	info, ok := b.channelInfo()
+	return ok && strings.EqualFold(info.Streamer.Username, username)
+}
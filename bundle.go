@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+
+	kvclient "github.com/strimertul/kilovolt-client-go/v6"
+)
+
+// Version of the bundle format, bumped on incompatible changes
+const bundleVersion = 1
+
+// Keys (relative to the prefix) holding live or derived state, which is rebuilt by the
+// bridge and makes no sense on another machine
+var bundleTransientKeys = []string{
+	"ev/", "@", "users/", "channel", "health", "stats", "snapshot", "chat-history", "chat-activity",
+	"history-page", "graphql-response", "stream-thumbnail", "unparsed-count", "event-log", "hype",
+}
+
+// ConfigBundle contains everything needed to move a bridge setup to another machine
+type ConfigBundle struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Keys by name, without the prefix
+	Keys map[string]string `json:"keys"`
+	// Local JSON files (config, messages, hooks, sounds, api_keys), by kind
+	Files map[string]jsoniter.RawMessage `json:"files"`
+}
+
+func bundleTransient(name string) bool {
+	for _, prefix := range bundleTransientKeys {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleFileFlags declares the flags for the local files of a bundle, by kind
+func bundleFileFlags(fs *flag.FlagSet, verb string) map[string]*string {
+	return map[string]*string{
+		"config":   fs.String("config-file", "", "Config file to "+verb),
+		"messages": fs.String("messages", "", "Messages file to "+verb),
+		"hooks":    fs.String("hooks", "", "Hooks file to "+verb),
+		"sounds":   fs.String("sounds", "", "Sounds file to "+verb),
+		"api_keys": fs.String("api-keys", "", "API keys file to "+verb+" (contains secrets, think twice before sharing it)"),
+	}
+}
+
+func bundleKVClient(endpoint, password string) *kvclient.Client {
+	log := logrus.New()
+	log.SetOutput(os.Stderr)
+	log.SetLevel(logrus.WarnLevel)
+	client, err := kvclient.NewClient(endpoint, kvclient.ClientOptions{Password: password, Logger: log})
+	check(err, "Connection to kilovolt failed")
+	return client
+}
+
+// exportBundleCommand writes the bridge keys and local config files to a bundle file
+func exportBundleCommand(args []string) {
+	fs := flag.NewFlagSet("export-bundle", flag.ExitOnError)
+	endpoint := fs.String("kv-endpoint", "http://localhost:4337/ws", "Kilovolt endpoint")
+	password := fs.String("password", "", "Optional password for Kilovolt")
+	prefix := fs.String("prefix", "glimesh/", "Prefix/Namespace for keys")
+	exclude := fs.String("exclude", "", "Comma-separated list of extra key prefixes to leave out (eg. \"known-chatters,moderation/\" when sharing a setup)")
+	output := fs.String("output", "-", "File to write the bundle to (- for stdout)")
+	files := bundleFileFlags(fs, "include")
+	_ = fs.Parse(args)
+
+	client := bundleKVClient(*endpoint, *password)
+	defer client.Close()
+	values, err := client.GetByPrefix(*prefix)
+	check(err, "Could not read keys")
+
+	excluded := parseList(*exclude)
+	bundle := ConfigBundle{
+		Version:    bundleVersion,
+		ExportedAt: time.Now(),
+		Keys:       make(map[string]string),
+		Files:      make(map[string]jsoniter.RawMessage),
+	}
+	for key, value := range values {
+		name := strings.TrimPrefix(key, *prefix)
+		if bundleTransient(name) {
+			continue
+		}
+		skip := false
+		for _, prefix := range excluded {
+			skip = skip || strings.HasPrefix(name, prefix)
+		}
+		if !skip {
+			bundle.Keys[name] = value
+		}
+	}
+	for kind, path := range files {
+		if *path == "" {
+			continue
+		}
+		byt, err := os.ReadFile(*path)
+		check(err, "Could not read %s file", kind)
+		if !jsoniter.ConfigFastest.Valid(byt) {
+			check(fmt.Errorf("%s is not valid JSON", *path), "Could not read %s file", kind)
+		}
+		bundle.Files[kind] = byt
+	}
+
+	byt, err := jsoniter.ConfigFastest.MarshalIndent(bundle, "", "  ")
+	check(err, "Could not encode bundle")
+	if *output == "-" {
+		_, err = os.Stdout.Write(append(byt, '\n'))
+	} else {
+		err = os.WriteFile(*output, byt, 0600)
+	}
+	check(err, "Could not write bundle")
+	_, _ = fmt.Fprintf(os.Stderr, "Exported %d keys and %d files\n", len(bundle.Keys), len(bundle.Files))
+}
+
+// importBundleCommand writes the keys and local files of a bundle
+func importBundleCommand(args []string) {
+	fs := flag.NewFlagSet("import-bundle", flag.ExitOnError)
+	endpoint := fs.String("kv-endpoint", "http://localhost:4337/ws", "Kilovolt endpoint")
+	password := fs.String("password", "", "Optional password for Kilovolt")
+	prefix := fs.String("prefix", "glimesh/", "Prefix/Namespace to import keys to (can differ from the exported one)")
+	input := fs.String("input", "-", "Bundle file to import (- for stdin)")
+	force := fs.Bool("force", false, "Overwrite existing local files")
+	files := bundleFileFlags(fs, "write")
+	_ = fs.Parse(args)
+
+	var byt []byte
+	var err error
+	if *input == "-" {
+		byt, err = io.ReadAll(os.Stdin)
+	} else {
+		byt, err = os.ReadFile(*input)
+	}
+	check(err, "Could not read bundle")
+	var bundle ConfigBundle
+	check(jsoniter.ConfigFastest.Unmarshal(byt, &bundle), "Could not decode bundle")
+	if bundle.Version > bundleVersion {
+		check(fmt.Errorf("bundle version %d is newer than %d", bundle.Version, bundleVersion), "Unsupported bundle, update the bridge")
+	}
+
+	// Check all the files first, so nothing is written if one of them would be overwritten
+	kinds := make([]string, 0, len(bundle.Files))
+	for kind := range bundle.Files {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		path, ok := files[kind]
+		if !ok || *path == "" {
+			_, _ = fmt.Fprintf(os.Stderr, "Skipping %s file, no path given\n", kind)
+			continue
+		}
+		if _, err := os.Stat(*path); err == nil && !*force {
+			check(fmt.Errorf("%s already exists", *path), "Refusing to overwrite %s file (use -force)", kind)
+		}
+	}
+
+	client := bundleKVClient(*endpoint, *password)
+	defer client.Close()
+	values := make(map[string]string, len(bundle.Keys))
+	for name, value := range bundle.Keys {
+		values[*prefix+name] = value
+	}
+	if len(values) > 0 {
+		check(client.SetKeys(values), "Could not write keys")
+	}
+
+	written := 0
+	for _, kind := range kinds {
+		if path := files[kind]; path != nil && *path != "" {
+			check(os.WriteFile(*path, bundle.Files[kind], 0600), "Could not write %s file", kind)
+			written++
+		}
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Imported %d keys and %d files\n", len(values), written)
+}
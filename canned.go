@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// CannedResponseRequest is the JSON form of a @send-canned-response RPC call,
+// plain text values are taken as the response name
+type CannedResponseRequest struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// User the response is addressed to, available as {{.User}}
+	User string `json:"user"`
+	// Vars are available in the template as {{.Vars.name}}
+	Vars map[string]interface{} `json:"vars"`
+	// Source, Secret and Requester identify the sender, see ChatSendRequest
+	Source    string `json:"source"`
+	Secret    string `json:"secret"`
+	Requester string `json:"requester"`
+}
+
+// sendCannedResponse renders a response from the canned-responses key and sends it to chat
+func (b *Bridge) sendCannedResponse(req CannedResponseRequest) {
+	var responses map[string]string
+	err := b.kv.GetJSON(b.key("canned-responses"), &responses)
+	if err != nil {
+		b.log.WithError(err).Error("Could not read canned responses")
+		return
+	}
+	text, ok := responses[req.Name]
+	if !ok {
+		b.log.WithField("name", req.Name).Warn("Unknown canned response")
+		b.chat.report(ChatSendResult{ID: req.ID, Message: req.Name, Source: req.Source, Status: "failed", Error: "unknown canned response"})
+		return
+	}
+
+	data := b.templateData(strings.TrimPrefix(req.User, "@"))
+	data.Vars = req.Vars
+	rendered, err := b.renderTemplate(text, data)
+	if err != nil {
+		b.log.WithError(err).WithField("name", req.Name).Error("Could not render canned response")
+		b.chat.report(ChatSendResult{ID: req.ID, Message: text, Source: req.Source, Status: "failed", Error: err.Error()})
+		return
+	}
+	b.chat.send(ChatSendRequest{ID: req.ID, Message: rendered, Raw: true, Source: req.Source, Requester: req.Requester})
+}
+
+// setupCannedResponses registers the @send-canned-response RPC. Responses are templates
+// stored by name in the canned-responses key, so dashboards can edit them directly.
+func (b *Bridge) setupCannedResponses(ctx context.Context) error {
+	key := b.key("canned-responses")
+	var responses map[string]string
+	if err := b.kv.GetJSON(key, &responses); err != nil {
+		b.setJSON(key, map[string]string{})
+	}
+	return b.handleRPC(ctx, "@send-canned-response", func(value string) {
+		trimmed := strings.TrimSpace(value)
+		req := CannedResponseRequest{Name: trimmed}
+		if strings.HasPrefix(trimmed, "{") {
+			err := jsoniter.ConfigFastest.UnmarshalFromString(trimmed, &req)
+			if err != nil {
+				b.log.WithError(err).Error("Could not decode canned response request")
+				return
+			}
+		}
+		if b.authorizeSend("@send-canned-response", req.ID, req.Name, req.Source, req.Secret) {
+			b.sendCannedResponse(req)
+		}
+	})
+}
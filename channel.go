@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// CoStreamPartner is a channel taking part in a co-stream/hosting arrangement with ours
+type CoStreamPartner struct {
+	ChannelID   string `json:"channel_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	// Relation is either "hosting" (we are hosting them) or "hosted-by" (they are hosting us)
+	Relation string `json:"relation"`
+}
+
+type CoStreamChange struct {
+	Partners []CoStreamPartner `json:"partners"`
+	Added    []CoStreamPartner `json:"added"`
+	Removed  []CoStreamPartner `json:"removed"`
+}
+
+func (c ChannelInfo) CoStreamPartners() []CoStreamPartner {
+	partners := make([]CoStreamPartner, 0)
+	if c.Hosting != nil && c.Hosting.TargetChannel.ID != "" {
+		partners = append(partners, CoStreamPartner{
+			ChannelID:   c.Hosting.TargetChannel.ID,
+			Username:    c.Hosting.TargetChannel.Streamer.Username,
+			DisplayName: c.Hosting.TargetChannel.Streamer.Displayname,
+			Relation:    "hosting",
+		})
+	}
+	for _, host := range c.Hosts {
+		partners = append(partners, CoStreamPartner{
+			ChannelID:   host.HostingChannel.ID,
+			Username:    host.HostingChannel.Streamer.Username,
+			DisplayName: host.HostingChannel.Streamer.Displayname,
+			Relation:    "hosted-by",
+		})
+	}
+	return partners
+}
+
+// diffPartners returns the partners in a that are not in b
+func diffPartners(a, b []CoStreamPartner) []CoStreamPartner {
+	out := make([]CoStreamPartner, 0)
+outer:
+	for _, pa := range a {
+		for _, pb := range b {
+			if pa.ChannelID == pb.ChannelID && pa.Relation == pb.Relation {
+				continue outer
+			}
+		}
+		out = append(out, pa)
+	}
+	return out
+}
+
+type coStreamTracker struct {
+	bridge   *Bridge
+	partners []CoStreamPartner
+}
+
+func (b *Bridge) newCoStreamTracker() *coStreamTracker {
+	var partners []CoStreamPartner
+	err := b.kv.GetJSON(b.key("co-stream-partners"), &partners)
+	if err != nil {
+		partners = make([]CoStreamPartner, 0)
+	}
+	return &coStreamTracker{bridge: b, partners: partners}
+}
+
+// update publishes the co-stream partners of the channel if they changed since the last update
+func (t *coStreamTracker) update(info *ChannelInfo) {
+	current := info.CoStreamPartners()
+	if reflect.DeepEqual(current, t.partners) {
+		return
+	}
+
+	change := CoStreamChange{
+		Partners: current,
+		Added:    diffPartners(current, t.partners),
+		Removed:  diffPartners(t.partners, current),
+	}
+	t.partners = current
+	t.bridge.log.WithField("partners", len(current)).Info("Co-stream partners changed")
+	t.bridge.setJSON(t.bridge.key("co-stream-partners"), current)
+	t.bridge.setJSON(t.bridge.key("ev/co-stream-changed"), change)
+}
+
+func (b *Bridge) fetchChannelInfo(ctx context.Context) (*ChannelInfo, error) {
+	result, err := b.api.FetchChannel(ctx, b.channelIDString())
+	if err != nil {
+		return nil, err
+	}
+	if result.Channel == nil {
+		return nil, ErrChannelNotFound
+	}
+	return result.Channel, nil
+}
+
+// pollChannel periodically fetches the channel info, publishes it and hands it
+// over to the subsystems that depend on it
+func (b *Bridge) pollChannel(ctx context.Context, interval time.Duration) {
+	infoKey := b.key("channel")
+	costream := b.newCoStreamTracker()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		info, err := b.fetchChannelInfo(ctx)
+		if err != nil {
+			// API outages are already reported by the health tracker
+			if b.health.healthy(ComponentAPI) {
+				b.log.WithError(err).Error("Could not fetch channel info")
+			} else {
+				b.log.WithError(err).Debug("Could not fetch channel info")
+			}
+		} else {
+			b.setJSON(infoKey, info)
+			b.channel.Store(*info)
+			costream.update(info)
+			b.thumbnail.update(ctx, info)
+			b.session.update(ctx, info)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Minimum number of messages kept in memory, so the history can be expanded
+// immediately when its size is increased at runtime
+const chatHistoryBufferSize = 100
+
+// ChatMessageGroup is a history entry made of consecutive messages from the same user,
+// used when history grouping is enabled
+type ChatMessageGroup struct {
+	User     ChatMessageUser `json:"user"`
+	Messages []string        `json:"messages"`
+	// IDs of the messages and when each was received, so deletions and grouping carry on after a restart
+	MessageIDs         []string    `json:"message_ids"`
+	MessagesReceivedAt []time.Time `json:"messages_received_at"`
+	// Which messages were removed by moderators, only when the delete mode is "mark"
+	MessagesDeleted []bool `json:"messages_deleted,omitempty"`
+}
+
+// HistoryMessage is a message in the (ungrouped) chat history
+type HistoryMessage struct {
+	ChatMessage
+	// Deleted is set on messages removed by moderators when the delete mode is "mark"
+	Deleted    bool      `json:"deleted,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// ChatMessageRetraction is emitted when a message is deleted by a moderator
+type ChatMessageRetraction struct {
+	ID   string          `json:"id"`
+	User ChatMessageUser `json:"user"`
+}
+
+// UserLastMessage is written to the per-user last message key
+type UserLastMessage struct {
+	ChatMessage
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+type chatHistoryEntry struct {
+	message    ChatMessage
+	receivedAt time.Time
+	deleted    bool
+}
+
+// storedHistoryEntry can decode both plain and grouped history entries
+type storedHistoryEntry struct {
+	ID       string          `json:"id"`
+	Message  string          `json:"message"`
+	Messages []string        `json:"messages"`
+	User     ChatMessageUser `json:"user"`
+	Deleted  bool            `json:"deleted"`
+	// Missing from histories stored by older versions
+	ReceivedAt         time.Time   `json:"received_at"`
+	MessageIDs         []string    `json:"message_ids"`
+	MessagesReceivedAt []time.Time `json:"messages_received_at"`
+	MessagesDeleted    []bool      `json:"messages_deleted"`
+}
+
+// chatHistory keeps the most recent chat messages and publishes them to the history key
+type chatHistory struct {
+	bridge      *Bridge
+	key         string
+	mu          sync.Mutex
+	size        int
+	groupWindow time.Duration
+	markDeleted bool
+	buffer      []chatHistoryEntry
+}
+
+func (b *Bridge) newChatHistory(config Config) *chatHistory {
+	history := &chatHistory{
+		bridge:      b,
+		key:         b.key("chat-history"),
+		size:        config.ChatHistorySize,
+		groupWindow: time.Duration(config.ChatHistoryGroupWindow) * time.Second,
+		markDeleted: config.ChatHistoryDeleteMode == "mark",
+		buffer:      make([]chatHistoryEntry, 0),
+	}
+
+	// Get old chat history, if available
+	var stored []storedHistoryEntry
+	err := b.kv.GetJSON(history.key, &stored)
+	if err != nil {
+		b.setJSON(history.key, []ChatMessage{})
+		return history
+	}
+	for _, entry := range stored {
+		if len(entry.Messages) == 0 {
+			history.buffer = append(history.buffer, chatHistoryEntry{
+				message:    ChatMessage{ID: entry.ID, Message: entry.Message, User: entry.User},
+				receivedAt: entry.ReceivedAt,
+				deleted:    entry.Deleted,
+			})
+			continue
+		}
+		for i, message := range entry.Messages {
+			restored := chatHistoryEntry{message: ChatMessage{Message: message, User: entry.User}}
+			if i < len(entry.MessageIDs) {
+				restored.message.ID = entry.MessageIDs[i]
+			}
+			if i < len(entry.MessagesReceivedAt) {
+				restored.receivedAt = entry.MessagesReceivedAt[i]
+			}
+			if i < len(entry.MessagesDeleted) {
+				restored.deleted = entry.MessagesDeleted[i]
+			}
+			history.buffer = append(history.buffer, restored)
+		}
+	}
+	return history
+}
+
+func (h *chatHistory) add(msg ChatMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buffer = append(h.buffer, chatHistoryEntry{message: msg, receivedAt: time.Now()})
+	limit := h.size
+	if limit < chatHistoryBufferSize {
+		limit = chatHistoryBufferSize
+	}
+	if len(h.buffer) > limit {
+		h.buffer = h.buffer[len(h.buffer)-limit:]
+	}
+	h.publish()
+}
+
+// configure applies history settings changed at runtime, publishing the history right away
+func (h *chatHistory) configure(config Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	groupWindow := time.Duration(config.ChatHistoryGroupWindow) * time.Second
+	markDeleted := config.ChatHistoryDeleteMode == "mark"
+	if config.ChatHistorySize == h.size && groupWindow == h.groupWindow && markDeleted == h.markDeleted {
+		return
+	}
+	h.size = config.ChatHistorySize
+	h.groupWindow = groupWindow
+	h.markDeleted = markDeleted
+	h.publish()
+}
+
+// retract removes (or marks as deleted) a message deleted by a moderator,
+// returning false if the message is not in the history
+func (h *chatHistory) retract(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, entry := range h.buffer {
+		if entry.message.ID != id {
+			continue
+		}
+		if h.markDeleted {
+			h.buffer[i].deleted = true
+		} else {
+			h.buffer = append(h.buffer[:i], h.buffer[i+1:]...)
+		}
+		h.publish()
+		return true
+	}
+	return false
+}
+
+// recent returns up to n of the most recent (not deleted) messages
+func (h *chatHistory) recent(n int) []ChatMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	messages := make([]ChatMessage, 0, n)
+	for i := len(h.buffer) - 1; i >= 0 && len(messages) < n; i-- {
+		if !h.buffer[i].deleted {
+			messages = append(messages, h.buffer[i].message)
+		}
+	}
+	// Restore chronological order
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
+
+// groups merges consecutive messages from the same user received within the group window.
+// Deleted messages are flagged when the delete mode is "mark", and left out otherwise.
+func (h *chatHistory) groups() []ChatMessageGroup {
+	groups := make([]ChatMessageGroup, 0)
+	var last time.Time
+	for _, entry := range h.buffer {
+		if entry.deleted && !h.markDeleted {
+			continue
+		}
+		var current *ChatMessageGroup
+		if len(groups) > 0 {
+			current = &groups[len(groups)-1]
+			if current.User.Username != entry.message.User.Username || entry.receivedAt.Sub(last) > h.groupWindow {
+				current = nil
+			}
+		}
+		if current == nil {
+			groups = append(groups, ChatMessageGroup{User: entry.message.User})
+			current = &groups[len(groups)-1]
+		}
+		current.Messages = append(current.Messages, entry.message.Message)
+		current.MessageIDs = append(current.MessageIDs, entry.message.ID)
+		current.MessagesReceivedAt = append(current.MessagesReceivedAt, entry.receivedAt)
+		if h.markDeleted {
+			current.MessagesDeleted = append(current.MessagesDeleted, entry.deleted)
+		}
+		last = entry.receivedAt
+	}
+	return groups
+}
+
+func (h *chatHistory) publish() {
+	if h.groupWindow > 0 {
+		groups := h.groups()
+		if len(groups) > h.size {
+			groups = groups[len(groups)-h.size:]
+		}
+		for len(groups) > 1 && !fits(groups, h.bridge.limits.HistoryBytes) {
+			groups = groups[1:]
+		}
+		h.bridge.setJSON(h.key, groups)
+		return
+	}
+
+	entries := h.buffer
+	if len(entries) > h.size {
+		entries = entries[len(entries)-h.size:]
+	}
+	messages := make([]HistoryMessage, len(entries))
+	for i, entry := range entries {
+		messages[i] = HistoryMessage{ChatMessage: entry.message, Deleted: entry.deleted, ReceivedAt: entry.receivedAt}
+	}
+	// Leave out the oldest messages if the history is too big, always keeping the last one
+	for len(messages) > 1 && !fits(messages, h.bridge.limits.HistoryBytes) {
+		messages = messages[1:]
+	}
+	h.bridge.setJSON(h.key, messages)
+}
+
+// publishUserLastMessage writes a message to the per-user last message key of its author
+func (b *Bridge) publishUserLastMessage(msg ChatMessage) {
+	username := strings.ToLower(msg.User.Username)
+	if username == "" {
+		return
+	}
+	b.setJSON(b.key("users/"+username+"/last-message"), UserLastMessage{ChatMessage: msg, ReceivedAt: time.Now()})
+}
+
+// incomingChatMessage is a chat message received from Glimesh, with its pipeline timing so far
+type incomingChatMessage struct {
+	ChatMessage
+	timing pipelineTiming
+	// Fields requested with -chat-extra-fields
+	extra map[string]jsoniter.RawMessage
+	// Channel the message was sent in, empty for the bridged channel
+	channelID string
+}
+
+// handleChatMessage publishes an incoming chat message and feeds it to all the chat subsystems.
+// Messages from the extra merged channels go through the same limits and filters, but are
+// only published to the merged feed.
+func (b *Bridge) handleChatMessage(incoming incomingChatMessage) {
+	msg, timing := incoming.ChatMessage, incoming.timing
+	channelID := b.channelIDString()
+	extraChannel := incoming.channelID != "" && incoming.channelID != channelID
+	if extraChannel {
+		channelID = incoming.channelID
+	}
+	timing.dequeued = time.Now()
+	msg.Message = sanitizeText(msg.Message, b.stripInvisible)
+	if text, truncated := truncateRunes(msg.Message, b.limits.MessageLength); truncated {
+		b.log.WithField("user", msg.User.Username).Warn("Truncated oversized chat message")
+		msg.Message = text
+	}
+	if logger, ok := b.sampledLog(logCategoryChat); ok {
+		logger.WithField("user", msg.User.Username).Debug("Received message")
+	}
+	event := ChatEvent{ChatMessage: msg, Extra: incoming.extra, Origin: b.merged.origin(channelID)}
+	if extraChannel {
+		// Our streamer and followers mean nothing in other channels
+		event.Role = metadataRole(msg.Metadata)
+	} else {
+		event.Role = b.chatRole(msg)
+	}
+	if b.detectConfusables && hasConfusables(msg.Message) {
+		event.Suspicious = true
+		event.Flags = append(event.Flags, "confusables")
+	}
+	if b.family.enabled() {
+		text, found := b.family.apply(msg.Message, event.Role)
+		msg.Message, event.ChatMessage.Message = text, text
+		event.Flags = append(event.Flags, found...)
+		if b.family.TTSText {
+			event.TTSText = b.family.ttsText(text)
+		}
+	}
+	if spam := b.spam.check(msg.Message, event.Role); len(spam) > 0 {
+		event.Flags = append(event.Flags, spam...)
+		b.setJSON(b.key("ev/chat-message-flagged"), event)
+		if extraChannel {
+			// We can't moderate other channels, so just keep spam out of the merged feed
+			return
+		}
+		action := b.spam.current().Action
+		b.escalation.strike(msg, event.Flags, action == SpamActionDelete)
+		switch action {
+		case SpamActionDelete:
+			go b.deleteChatMessage(msg, "spam: "+strings.Join(event.Flags, ", "))
+			return
+		case SpamActionFilter:
+			return
+		}
+	}
+	if extraChannel {
+		b.merged.publish(event)
+		return
+	}
+	if b.enrichChat {
+		b.users.enrich(&event)
+	}
+	timing.filtered = time.Now()
+	b.setJSON(b.key("ev/chat-message"), event)
+	timing.published = time.Now()
+	b.latency.record(timing)
+	b.relay.push(event)
+	if b.merged != nil {
+		b.merged.publish(event)
+	}
+	b.history.add(msg)
+	if err := b.archive.add(msg); err != nil {
+		b.log.WithError(err).Error("Could not write to chat archive")
+	}
+	b.activity.record(msg)
+	b.session.recordMessage()
+	b.firsts.record(msg)
+	if b.hype != nil {
+		b.hype.record(msg)
+	}
+	if b.topChat != nil {
+		b.topChat.record(msg)
+	}
+	if b.userLastMessage {
+		b.publishUserLastMessage(msg)
+	}
+	b.polls.vote(msg)
+	if !b.commands.dispatch(msg) {
+		b.runCommandHooks(msg)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Fields of the ChatMessage fragment known to the bridge, everything else is passed through as extra
+var knownChatMessageFields = map[string]bool{"id": true, "message": true, "user": true, "metadata": true}
+
+// extendChatMessageDocument appends extra fields (a GraphQL selection, eg. "insertedAt tokens { type text }")
+// to the ChatMessage fragment of a chat subscription document
+func extendChatMessageDocument(document string, fields string) (string, error) {
+	fields = strings.TrimSpace(fields)
+	if fields == "" {
+		return document, nil
+	}
+	depth := 0
+	for _, char := range fields {
+		switch char {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+		if depth < 0 {
+			break
+		}
+	}
+	if depth != 0 {
+		return "", fmt.Errorf("unbalanced braces in extra fields %q", fields)
+	}
+	// The fragment is the last definition of the document
+	end := strings.LastIndex(document, "}")
+	if !strings.Contains(document, "fragment ChatMessage on ChatMessage") || end < 0 {
+		return "", fmt.Errorf("document has no ChatMessage fragment")
+	}
+	return document[:end] + "\t" + fields + "\n" + document[end:], nil
+}
+
+// chatMessageExtraFields returns the fields of a chat message subscription result
+// that the bridge doesn't know about, nil if there are none
+func chatMessageExtraFields(data jsoniter.RawMessage) map[string]jsoniter.RawMessage {
+	var result struct {
+		ChatMessage map[string]jsoniter.RawMessage `json:"chatMessage"`
+	}
+	if jsoniter.ConfigFastest.Unmarshal(data, &result) != nil {
+		return nil
+	}
+	var extra map[string]jsoniter.RawMessage
+	for name, value := range result.ChatMessage {
+		if knownChatMessageFields[name] {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]jsoniter.RawMessage)
+		}
+		extra[name] = value
+	}
+	return extra
+}
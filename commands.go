@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+const chatCommandPrefix = "!"
+
+// chatCommandHandler handles a chat command, args is the rest of the message after the command name
+type chatCommandHandler func(msg ChatMessage, args string)
+
+// chatCommands dispatches chat messages starting with the command prefix to their handlers
+type chatCommands struct {
+	mu       sync.RWMutex
+	handlers map[string]chatCommandHandler
+}
+
+func newChatCommands() *chatCommands {
+	return &chatCommands{handlers: make(map[string]chatCommandHandler)}
+}
+
+// register adds a handler for one or more command names (without prefix)
+func (c *chatCommands) register(handler chatCommandHandler, names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range names {
+		c.handlers[strings.ToLower(name)] = handler
+	}
+}
+
+// parseCommand splits a chat message into command name and arguments,
+// returning an empty name if the message is not a command
+func parseCommand(message string) (string, string) {
+	message = strings.TrimSpace(message)
+	if !strings.HasPrefix(message, chatCommandPrefix) {
+		return "", ""
+	}
+	parts := strings.SplitN(message[len(chatCommandPrefix):], " ", 2)
+	name := strings.ToLower(parts[0])
+	args := ""
+	if len(parts) > 1 {
+		args = strings.TrimSpace(parts[1])
+	}
+	return name, args
+}
+
+// dispatch runs the handler for the command in msg, if any, returning whether one was found
+func (c *chatCommands) dispatch(msg ChatMessage) bool {
+	name, args := parseCommand(msg.Message)
+	if name == "" {
+		return false
+	}
+	c.mu.RLock()
+	handler, ok := c.handlers[name]
+	c.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	handler(msg, args)
+	return true
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Config holds the settings that can be changed at runtime by writing to the config key
+type Config struct {
+	ChatHistorySize int `json:"chat_history_size"`
+	// Consecutive messages from the same user within this many seconds are merged
+	// into a single history entry (0 to disable)
+	ChatHistoryGroupWindow int `json:"chat_history_group_window"`
+	// What to do with messages deleted by moderators: "remove" them from history or
+	// "mark" them as deleted (grouped history always removes them)
+	ChatHistoryDeleteMode string `json:"chat_history_delete_mode"`
+	// Minimum number of seconds between messages sent by the bridge, set this to
+	// match the channel slow mode (0 to send immediately)
+	ChatSlowMode int `json:"chat_slow_mode"`
+	// Messages longer than the Glimesh limit are split in up to this many messages
+	// (0 or 1 to only send the truncated message)
+	ChatMaxParts int `json:"chat_max_parts"`
+	// Decorations added around messages sent with @announce
+	AnnouncementPrefix string `json:"announcement_prefix"`
+	AnnouncementSuffix string `json:"announcement_suffix"`
+	// Heuristics flagging spammy chat messages
+	Spam SpamHeuristics `json:"spam"`
+	// Escalation ladder for users repeatedly flagged by the spam heuristics
+	Escalation EscalationPolicy `json:"escalation"`
+	// Paced copy of the chat feed for overlays
+	Relay RelaySettings `json:"relay"`
+}
+
+// setFlags returns the names of the flags that were explicitly set on the command line
+func setFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// loadConfig reads the config key, using the flag values for anything missing.
+// Settings in the config file take precedence over the stored config, and flags
+// explicitly set on the command line take precedence over both.
+func (b *Bridge) loadConfig(defaults Config) Config {
+	configKey := b.key("config")
+	config := defaults
+	err := b.kv.GetJSON(configKey, &config)
+	if err != nil {
+		b.log.WithField("key", configKey).Info("No config found, using defaults")
+	}
+
+	if b.configFile != "" {
+		if err := readConfigFile(b.configFile, &config); err != nil {
+			b.log.WithError(err).WithField("file", b.configFile).Error("Could not read config file")
+		}
+	}
+
+	explicit := setFlags()
+	if explicit["chat-history"] {
+		config.ChatHistorySize = defaults.ChatHistorySize
+	}
+	if explicit["chat-history-group-window"] {
+		config.ChatHistoryGroupWindow = defaults.ChatHistoryGroupWindow
+	}
+
+	b.setJSON(configKey, config)
+	return config
+}
+
+// watchConfig sends every valid config written to the config key to the returned channel
+func (b *Bridge) watchConfig(ctx context.Context) (<-chan Config, error) {
+	configKey := b.key("config")
+	incoming, err := b.kv.SubscribeKey(configKey)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(chan Config)
+	b.goSafe(ctx, "config", func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case kv := <-incoming:
+				var config Config
+				err := jsoniter.ConfigFastest.UnmarshalFromString(kv.Value, &config)
+				if err != nil {
+					b.log.WithError(err).Error("Could not decode config, ignoring update")
+					continue
+				}
+				if config.ChatHistorySize < 0 {
+					b.log.WithField("chat_history_size", config.ChatHistorySize).Error("Invalid chat history size, ignoring update")
+					continue
+				}
+				if config.ChatHistoryGroupWindow < 0 {
+					b.log.WithField("chat_history_group_window", config.ChatHistoryGroupWindow).Error("Invalid chat history group window, ignoring update")
+					continue
+				}
+				if config.ChatMaxParts < 0 {
+					b.log.WithField("chat_max_parts", config.ChatMaxParts).Error("Invalid chat max parts, ignoring update")
+					continue
+				}
+				if config.ChatSlowMode < 0 {
+					b.log.WithField("chat_slow_mode", config.ChatSlowMode).Error("Invalid chat slow mode, ignoring update")
+					continue
+				}
+				if config.ChatHistoryDeleteMode != "" && config.ChatHistoryDeleteMode != "remove" && config.ChatHistoryDeleteMode != "mark" {
+					b.log.WithField("chat_history_delete_mode", config.ChatHistoryDeleteMode).Error("Invalid chat history delete mode, ignoring update")
+					continue
+				}
+				if field, ok := config.Spam.validate(); !ok {
+					b.log.WithField("spam."+field, kv.Value).Error("Invalid spam heuristics setting, ignoring update")
+					continue
+				}
+				if field, ok := config.Escalation.validate(); !ok {
+					b.log.WithField("escalation."+field, kv.Value).Error("Invalid escalation setting, ignoring update")
+					continue
+				}
+				if field, ok := config.Relay.validate(); !ok {
+					b.log.WithField("relay."+field, kv.Value).Error("Invalid relay setting, ignoring update")
+					continue
+				}
+				b.log.Info("Config updated")
+				updates <- config
+			}
+		}
+	})
+	return updates, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Characters from other scripts that look like latin letters, mapped to the letter they imitate
+var confusableLetters = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c',
+	'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i', 'ї': 'i', 'ј': 'j', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'А': 'a', 'В': 'b', 'Е': 'e', 'К': 'k', 'М': 'm', 'Н': 'h', 'О': 'o', 'Р': 'p', 'С': 'c', 'Т': 't',
+	'У': 'y', 'Х': 'x', 'Ѕ': 's', 'І': 'i', 'Ј': 'j',
+	// Greek
+	'α': 'a', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+	'Α': 'a', 'Β': 'b', 'Ε': 'e', 'Ζ': 'z', 'Η': 'h', 'Ι': 'i', 'Κ': 'k', 'Μ': 'm', 'Ν': 'n', 'Ο': 'o',
+	'Ρ': 'p', 'Τ': 't', 'Υ': 'y', 'Χ': 'x',
+}
+
+// confusableLetter returns the latin letter r imitates, if any. Besides homoglyphs from other
+// scripts, this includes fullwidth, circled and mathematical styled letters.
+func confusableLetter(r rune) (rune, bool) {
+	if latin, ok := confusableLetters[r]; ok {
+		return latin, true
+	}
+	switch {
+	case r >= 'Ａ' && r <= 'Ｚ':
+		return 'a' + (r - 'Ａ'), true
+	case r >= 'ａ' && r <= 'ｚ':
+		return 'a' + (r - 'ａ'), true
+	case r >= 'Ⓐ' && r <= 'Ⓩ':
+		return 'a' + (r - 'Ⓐ'), true
+	case r >= 'ⓐ' && r <= 'ⓩ':
+		return 'a' + (r - 'ⓐ'), true
+	case r >= 0x1D400 && r <= 0x1D6A3:
+		// Mathematical alphanumeric symbols, 52 letters (A-Z, a-z) per style
+		return 'a' + (r-0x1D400)%52%26, true
+	}
+	return 0, false
+}
+
+// hasConfusables returns whether text has words mixing latin letters with look-alikes,
+// or written in styled letters, both common ways to get around word filters
+func hasConfusables(text string) bool {
+	for _, word := range strings.Fields(text) {
+		latin, lookalike, styled := false, false, false
+		for _, r := range word {
+			if r < unicode.MaxASCII && unicode.IsLetter(r) {
+				latin = true
+				continue
+			}
+			if _, ok := confusableLetters[r]; ok {
+				lookalike = true
+			} else if _, ok := confusableLetter(r); ok {
+				styled = true
+			}
+		}
+		if styled || (latin && lookalike) {
+			return true
+		}
+	}
+	return false
+}
+
+// confusableSkeleton lowercases text and replaces all look-alike characters with the latin
+// letters they imitate, so filters can match words written with them
+func confusableSkeleton(text string) string {
+	return strings.Map(func(r rune) rune {
+		if latin, ok := confusableLetter(r); ok {
+			return latin
+		}
+		return unicode.ToLower(r)
+	}, text)
+}
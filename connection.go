@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// Wait between reconnection attempts, doubled after every failure
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// errReconnectRequested is returned by serve when the connection was dropped by reconnect
+var errReconnectRequested = errors.New("reconnect requested")
+
+// glimeshConnection keeps the websocket connection to Glimesh up, feeding its frames to the socket.
+// Lost connections are dialed again, and the socket joins and subscribes again on every connection.
+type glimeshConnection struct {
+	bridge *Bridge
+	socket *glimeshSocket
+	// dial opens a new connection authenticated with token
+	dial func(ctx context.Context, token string) (*websocket.Conn, error)
+	// Requests to drop the current connection and dial a new one, with the reason
+	reconnects chan string
+
+	mu sync.Mutex
+	// Token the current connection was opened with
+	token string
+}
+
+func (b *Bridge) newGlimeshConnection(socket *glimeshSocket, dial func(ctx context.Context, token string) (*websocket.Conn, error)) *glimeshConnection {
+	return &glimeshConnection{bridge: b, socket: socket, dial: dial, reconnects: make(chan string, 1)}
+}
+
+// connect dials a connection with the current token
+func (c *glimeshConnection) connect(ctx context.Context) (*websocket.Conn, error) {
+	token := c.bridge.api.token()
+	conn, err := c.dial(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+	// The new connection already uses the current settings
+	select {
+	case <-c.reconnects:
+	default:
+	}
+	return conn, nil
+}
+
+// tokenChanged returns true if the API token was refreshed after the current connection was opened
+func (c *glimeshConnection) tokenChanged() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token != c.bridge.api.token()
+}
+
+// reconnect drops the current connection and dials a new one. Queued writes are kept.
+func (c *glimeshConnection) reconnect(reason string) {
+	select {
+	case c.reconnects <- reason:
+	default:
+		// A reconnection is already pending
+	}
+}
+
+// run serves conn and dials a new connection whenever it's lost or reconnect is called, until ctx is cancelled.
+// If conn is nil, a new connection is dialed first.
+func (c *glimeshConnection) run(ctx context.Context, conn *websocket.Conn) {
+	delay := minReconnectDelay
+	for {
+		started := time.Now()
+		err := ErrDisconnected
+		if conn != nil {
+			err = c.serve(ctx, conn)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errReconnectRequested) {
+			c.bridge.log.WithField("reason", err.Error()).Info("Reconnecting to the Glimesh websocket")
+		} else {
+			// Keep the features that only need the HTTP API running while reconnecting
+			c.bridge.connStats.recordDisconnect()
+			c.bridge.health.report(ComponentSubscriptions, err)
+			c.bridge.log.WithError(err).Warn("Lost the Glimesh websocket, reconnecting")
+			// Connections that lasted a while reset the backoff, ones that keep dropping right away don't
+			if time.Since(started) > maxReconnectDelay {
+				delay = minReconnectDelay
+			}
+		}
+
+		for {
+			if !errors.Is(err, errReconnectRequested) {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+				delay *= 2
+				if delay > maxReconnectDelay {
+					delay = maxReconnectDelay
+				}
+			}
+			conn, err = c.connect(ctx)
+			if err == nil {
+				c.bridge.connStats.recordReconnect()
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			c.bridge.health.report(ComponentSubscriptions, err)
+			c.bridge.log.WithError(err).WithField("retry-in", delay).Error("Could not connect to the Glimesh websocket")
+		}
+	}
+}
+
+// serve attaches conn to the socket and reads from it until the connection fails, reconnect is
+// called or ctx is cancelled. The writer and reader use a context of their own, cancelled before
+// serve returns, so neither can outlive the connection.
+func (c *glimeshConnection) serve(ctx context.Context, conn *websocket.Conn) error {
+	connCtx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		c.socket.detach()
+		_ = conn.Close(websocket.StatusGoingAway, "connection closed")
+	}()
+	if err := c.socket.attach(connCtx, conn); err != nil {
+		return err
+	}
+	c.bridge.health.report(ComponentSubscriptions, nil)
+
+	requested := make(chan string, 1)
+	go func() {
+		select {
+		case reason := <-c.reconnects:
+			requested <- reason
+			cancel()
+		case <-connCtx.Done():
+		}
+	}()
+
+	for {
+		mtyp, byt, err := conn.Read(connCtx)
+		if err != nil {
+			select {
+			case reason := <-requested:
+				return fmt.Errorf("%w: %s", errReconnectRequested, reason)
+			default:
+			}
+			if errors.Is(err, io.EOF) {
+				err = fmt.Errorf("%w: connection was closed by remote", ErrDisconnected)
+			}
+			return err
+		}
+		c.bridge.connStats.recordFrame()
+		if logger, ok := c.bridge.sampledLog(logCategoryFrames); ok {
+			logger.Debug(string(byt))
+		}
+		if mtyp == websocket.MessageText {
+			err := c.socket.handleFrame(byt)
+			if err != nil {
+				c.bridge.log.WithError(err).Error("Could not decode websocket message")
+				c.bridge.quarantineFrame(byt, err)
+			}
+		}
+	}
+}
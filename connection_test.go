@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"nhooyr.io/websocket"
+)
+
+func TestConnectionReconnects(t *testing.T) {
+	url, frames := testSocketServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	bridge := newBenchBridge(ctx, newMemoryStore(log), "glimesh-test/", log)
+	bridge.connStats = bridge.newConnectionStats()
+
+	socket := newGlimeshSocket(log, SocketProtocol{Serializer: phoenixSerializerV2, ControlTopic: absintheControlTopic, SubscriptionID: subscriptionIDAuto})
+	var dials int32
+	connection := bridge.newGlimeshConnection(socket, func(ctx context.Context, token string) (*websocket.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		c, _, err := websocket.Dial(ctx, url, nil)
+		return c, err
+	})
+	if err := socket.subscribe(ctx, "subscription { chatMessage }", nil, func(jsoniter.RawMessage) {}); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := connection.connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go connection.run(ctx, conn)
+
+	for i := 0; i < 3; i++ {
+		if frame := nextFrame(t, frames); frame.Event != "phx_join" {
+			t.Fatalf("connection %d: expected a join, got %s", i, frame.Event)
+		}
+		if frame := nextFrame(t, frames); frame.Event != "doc" {
+			t.Fatalf("connection %d: expected the subscription, got %s", i, frame.Event)
+		}
+		connection.reconnect("test")
+	}
+	cancel()
+	if n := atomic.LoadInt32(&dials); n < 3 {
+		t.Errorf("expected at least 3 dials, got %d", n)
+	}
+	if reconnects := bridge.connStats.current().GlimeshReconnects; reconnects < 2 {
+		t.Errorf("expected at least 2 reconnects, got %d", reconnects)
+	}
+}
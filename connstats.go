@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// How often the stats key is updated
+	statsInterval = 30 * time.Second
+	// Weight of the last heartbeat in the average round-trip time
+	rttSmoothing = 0.2
+)
+
+// ConnectionStats describes the quality of the connections to Glimesh and Kilovolt
+type ConnectionStats struct {
+	// Round-trip time of the last acknowledged heartbeat, and its moving average
+	RTTMillis        float64 `json:"rtt_ms"`
+	AverageRTTMillis float64 `json:"avg_rtt_ms"`
+	// Frames received from Glimesh and how many of them could not be decoded
+	Frames          uint64  `json:"frames"`
+	DecodeErrors    uint64  `json:"decode_errors"`
+	DecodeErrorRate float64 `json:"decode_error_rate"`
+	// Times the Glimesh websocket was lost, and reconnected (overall and per hour of uptime)
+	GlimeshDisconnects       uint64  `json:"glimesh_disconnects"`
+	GlimeshReconnects        uint64  `json:"glimesh_reconnects"`
+	GlimeshReconnectsPerHour float64 `json:"glimesh_reconnects_per_hour"`
+	// Times a Kilovolt endpoint was reconnected, overall and per hour of uptime
+	KVReconnects        uint64  `json:"kv_reconnects"`
+	KVReconnectsPerHour float64 `json:"kv_reconnects_per_hour"`
+}
+
+// BridgeStats is written to the stats key periodically
+type BridgeStats struct {
+	UptimeSeconds int64           `json:"uptime_seconds"`
+	Connection    ConnectionStats `json:"connection"`
+}
+
+// connectionStats collects connection quality measurements
+type connectionStats struct {
+	// Counters first, so they're 64-bit aligned for atomic operations
+	frames      uint64
+	disconnects uint64
+	reconnects  uint64
+
+	bridge  *Bridge
+	started time.Time
+
+	mu         sync.Mutex
+	rtt        time.Duration
+	averageRTT time.Duration
+}
+
+func (b *Bridge) newConnectionStats() *connectionStats {
+	stats := &connectionStats{bridge: b, started: time.Now()}
+	if b.restored != nil && !b.restored.StartedAt.IsZero() {
+		stats.started = b.restored.StartedAt
+	}
+	return stats
+}
+
+func (c *connectionStats) recordFrame() {
+	atomic.AddUint64(&c.frames, 1)
+}
+
+func (c *connectionStats) recordDisconnect() {
+	atomic.AddUint64(&c.disconnects, 1)
+}
+
+func (c *connectionStats) recordReconnect() {
+	atomic.AddUint64(&c.reconnects, 1)
+}
+
+func (c *connectionStats) recordRTT(rtt time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rtt = rtt
+	if c.averageRTT == 0 {
+		c.averageRTT = rtt
+	} else {
+		c.averageRTT = time.Duration(rttSmoothing*float64(rtt) + (1-rttSmoothing)*float64(c.averageRTT))
+	}
+}
+
+func (c *connectionStats) current() ConnectionStats {
+	c.mu.Lock()
+	stats := ConnectionStats{
+		RTTMillis:        float64(c.rtt) / float64(time.Millisecond),
+		AverageRTTMillis: float64(c.averageRTT) / float64(time.Millisecond),
+	}
+	c.mu.Unlock()
+
+	stats.Frames = atomic.LoadUint64(&c.frames)
+	stats.DecodeErrors = atomic.LoadUint64(&c.bridge.unparsedFrames)
+	if stats.Frames > 0 {
+		stats.DecodeErrorRate = float64(stats.DecodeErrors) / float64(stats.Frames)
+	}
+	stats.GlimeshDisconnects = atomic.LoadUint64(&c.disconnects)
+	stats.GlimeshReconnects = atomic.LoadUint64(&c.reconnects)
+	if hours := time.Since(c.started).Hours(); hours > 0 {
+		stats.GlimeshReconnectsPerHour = float64(stats.GlimeshReconnects) / hours
+	}
+	if store, ok := c.bridge.kv.(*multiStore); ok {
+		stats.KVReconnects = store.reconnectCount()
+		if hours := time.Since(c.started).Hours(); hours > 0 {
+			stats.KVReconnectsPerHour = float64(stats.KVReconnects) / hours
+		}
+	}
+	return stats
+}
+
+// run publishes the stats key every statsInterval until ctx is cancelled
+func (c *connectionStats) run(ctx context.Context) {
+	key := c.bridge.key("stats")
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.bridge.setJSON(key, BridgeStats{
+				UptimeSeconds: int64(time.Since(c.started).Seconds()),
+				Connection:    c.current(),
+			})
+		}
+	}
+}
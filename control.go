@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// Line-based control protocol, one command per line:
+//
+//	SEND <message>   send a chat message
+//	SUBSCRIBE        stream events as "EVENT <name> <json>" lines
+//	PING             replies with PONG
+//
+// Every command other than SUBSCRIBE is answered with "OK", "PONG" or "ERR <reason>".
+
+// serveControlSocket listens on a unix domain socket (also supported on Windows 10 and later)
+func (b *Bridge) serveControlSocket(ctx context.Context, path string) error {
+	// Remove a stale socket left by a previous run
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	b.log.WithField("path", path).Info("Listening on control socket")
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	b.goSafe(ctx, "control-socket", func(ctx context.Context) {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					b.log.WithError(err).Error("Control socket stopped")
+				}
+				return
+			}
+			go b.handleControlConn(ctx, conn)
+		}
+	})
+	return nil
+}
+
+func (b *Bridge) handleControlConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	writer := bufio.NewWriter(conn)
+	reply := func(format string, args ...interface{}) bool {
+		_, _ = fmt.Fprintf(writer, format+"\n", args...)
+		return writer.Flush() == nil
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		command, args := scanner.Text(), ""
+		if i := strings.IndexByte(command, ' '); i >= 0 {
+			command, args = command[:i], command[i+1:]
+		}
+		switch strings.ToUpper(command) {
+		case "":
+			continue
+		case "PING":
+			reply("PONG")
+		case "SEND":
+			if strings.TrimSpace(args) == "" {
+				reply("ERR empty message")
+				continue
+			}
+			b.chat.send(ChatSendRequest{Message: args, Source: "control-socket"})
+			reply("OK")
+		case "SUBSCRIBE":
+			b.streamControlEvents(ctx, conn, writer)
+			return
+		default:
+			reply("ERR unknown command")
+		}
+	}
+}
+
+// streamControlEvents writes events to the connection until it's closed
+func (b *Bridge) streamControlEvents(ctx context.Context, conn net.Conn, writer *bufio.Writer) {
+	events := b.events.subscribe()
+	defer b.events.unsubscribe(events)
+
+	// Stop when the other side closes the connection
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	for {
+		event, ok := events.next(ctx)
+		if !ok {
+			return
+		}
+		_, _ = fmt.Fprintf(writer, "EVENT %s %s\n", event.Name, event.Payload)
+		if writer.Flush() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Restarts of a crashing component before giving up on it
+	maxComponentRestarts = 5
+	// A component that ran this long since its last crash gets its restarts back
+	crashResetAfter = 10 * time.Minute
+	// Longest wait before restarting a crashed component
+	maxRestartBackoff = time.Minute
+)
+
+// CrashReport is published to ev/crash when a component panics
+type CrashReport struct {
+	Component string    `json:"component"`
+	Panic     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+	Time      time.Time `json:"time"`
+	// Restart is set when the component is restarted, it's false for components that
+	// gave up (too many crashes) and for handlers that simply move on to the next input
+	Restart bool `json:"restart"`
+	// File is the crash report written in -crash-dir, if any
+	File  string `json:"file,omitempty"`
+	Count uint64 `json:"count"`
+}
+
+// reportCrash logs a recovered panic, writes its crash report and publishes it
+func (b *Bridge) reportCrash(component string, value interface{}, stack []byte, restart bool) {
+	report := CrashReport{
+		Component: component,
+		Panic:     fmt.Sprint(value),
+		Stack:     string(stack),
+		Time:      time.Now(),
+		Restart:   restart,
+		Count:     atomic.AddUint64(&b.crashes, 1),
+	}
+	b.log.WithField("component", component).WithField("panic", report.Panic).Errorf("Recovered from panic\n%s", stack)
+	if b.crashDir != "" {
+		file, err := writeCrashReport(b.crashDir, report)
+		if err != nil {
+			b.log.WithError(err).Error("Could not write crash report")
+		}
+		report.File = file
+	}
+	b.setJSON(b.key("ev/crash"), report)
+}
+
+// writeCrashReport writes a plain text crash report, ready to be attached to a bug report
+func writeCrashReport(dir string, report CrashReport) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	component := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, report.Component)
+	name := fmt.Sprintf("crash-%s-%d-%s.txt", report.Time.Format("20060102-150405"), report.Count, component)
+	path := filepath.Join(dir, name)
+	var text strings.Builder
+	fmt.Fprintf(&text, "component: %s\n", report.Component)
+	fmt.Fprintf(&text, "time: %s\n", report.Time.Format(time.RFC3339))
+	fmt.Fprintf(&text, "version: %s\n", bridgeVersion())
+	fmt.Fprintf(&text, "panic: %s\n\n%s", report.Panic, report.Stack)
+	return path, os.WriteFile(path, []byte(text.String()), 0644)
+}
+
+// bridgeVersion returns the module version the bridge was built from
+func bridgeVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	return info.Main.Version
+}
+
+// protect runs fn, recovering (and reporting) any panic. Returns whether fn panicked.
+func (b *Bridge) protect(component string, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			b.reportCrash(component, r, debug.Stack(), false)
+		}
+	}()
+	fn()
+	return false
+}
+
+// goSafe runs a long-lived component in the background, restarting it with a backoff
+// if it panics instead of taking down the whole bridge
+func (b *Bridge) goSafe(ctx context.Context, component string, run func(ctx context.Context)) {
+	go func() {
+		restarts := 0
+		for {
+			started := time.Now()
+			crashed := false
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						crashed = true
+						if time.Since(started) > crashResetAfter {
+							restarts = 0
+						}
+						b.reportCrash(component, r, debug.Stack(), restarts < maxComponentRestarts)
+					}
+				}()
+				run(ctx)
+			}()
+			if !crashed || ctx.Err() != nil {
+				return
+			}
+			if restarts >= maxComponentRestarts {
+				b.log.WithField("component", component).Error("Component crashed too many times, not restarting it")
+				return
+			}
+			backoff := time.Second << restarts
+			if backoff > maxRestartBackoff {
+				backoff = maxRestartBackoff
+			}
+			restarts++
+			b.log.WithField("component", component).WithField("backoff", backoff).Warn("Restarting crashed component")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+		}
+	}()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Errors waiting to be reported, anything more is dropped
+	errorReportQueueSize = 32
+	// Maximum reports sent per minute, so an error loop can't flood the reporting service
+	maxErrorReportsPerMinute = 10
+	// Longest message (with its stack trace, for crashes) included in a report
+	maxErrorReportLength = 8 * 1024
+	errorReportTimeout   = 5 * time.Second
+)
+
+var (
+	// Credentials in URLs and authorization headers
+	sensitiveParamRegex  = regexp.MustCompile(`(?i)((token|secret|password|key|client_id)=)[^&\s"]+`)
+	sensitiveBearerRegex = regexp.MustCompile(`(?i)(bearer\s+)\S+`)
+	// Log fields that may carry chat content or personal data
+	privateLogFields = map[string]bool{"user": true, "username": true, "message": true, "payload": true, "text": true, "value": true, "raw": true}
+)
+
+// ErrorReport is the redacted form of an error logged by the bridge, sent to -error-report-url
+type ErrorReport struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	// Details holds the rest of multi-line messages, eg. the stack trace of a crash
+	Details string            `json:"details,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Time    time.Time         `json:"time"`
+	Version string            `json:"version"`
+	OS      string            `json:"os"`
+	Arch    string            `json:"arch"`
+}
+
+// redactReportText removes credentials from text and truncates it
+func redactReportText(text string) string {
+	text = sensitiveFieldRegex.ReplaceAllString(text, `$1"<redacted>"`)
+	text = sensitiveParamRegex.ReplaceAllString(text, `$1<redacted>`)
+	text = sensitiveBearerRegex.ReplaceAllString(text, `$1<redacted>`)
+	if len(text) > maxErrorReportLength {
+		text = strings.ToValidUTF8(text[:maxErrorReportLength], "") + "…"
+	}
+	return text
+}
+
+// newErrorReport builds a report from a log entry, leaving out chat content and credentials
+func newErrorReport(entry *logrus.Entry) ErrorReport {
+	report := ErrorReport{
+		Level:   entry.Level.String(),
+		Time:    entry.Time,
+		Version: bridgeVersion(),
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+	}
+	message := redactReportText(entry.Message)
+	if i := strings.IndexByte(message, '\n'); i >= 0 {
+		report.Message, report.Details = message[:i], message[i+1:]
+	} else {
+		report.Message = message
+	}
+	for name, value := range entry.Data {
+		if report.Fields == nil {
+			report.Fields = make(map[string]string)
+		}
+		lower := strings.ToLower(name)
+		if privateLogFields[lower] || strings.Contains(lower, "token") || strings.Contains(lower, "secret") || strings.Contains(lower, "password") {
+			report.Fields[name] = "<redacted>"
+			continue
+		}
+		report.Fields[name] = redactReportText(fmt.Sprint(value))
+	}
+	return report
+}
+
+// sentryDSN is a parsed Sentry DSN (https://<public key>@<host>/<project ID>)
+type sentryDSN struct {
+	storeURL  string
+	publicKey string
+}
+
+func parseSentryDSN(dsn string) (sentryDSN, error) {
+	parsed, err := url.Parse(dsn)
+	if err != nil {
+		return sentryDSN{}, err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.User == nil || parsed.User.Username() == "" {
+		return sentryDSN{}, fmt.Errorf("invalid Sentry DSN, expected https://<key>@<host>/<project>")
+	}
+	path := strings.Trim(parsed.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	prefix, project := "", path
+	if slash >= 0 {
+		prefix, project = "/"+path[:slash], path[slash+1:]
+	}
+	if project == "" {
+		return sentryDSN{}, fmt.Errorf("Sentry DSN has no project ID")
+	}
+	return sentryDSN{
+		storeURL:  fmt.Sprintf("%s://%s%s/api/%s/store/", parsed.Scheme, parsed.Host, prefix, project),
+		publicKey: parsed.User.Username(),
+	}, nil
+}
+
+// errorReporter is a log hook sending errors (and crashes, which are logged as errors)
+// to Sentry and/or a generic HTTP endpoint. Off unless -sentry-dsn or -error-report-url is set.
+type errorReporter struct {
+	client  *http.Client
+	sentry  *sentryDSN
+	url     string
+	reports chan ErrorReport
+
+	mu     sync.Mutex
+	window time.Time
+	sent   int
+}
+
+func newErrorReporter(dsn string, reportURL string) (*errorReporter, error) {
+	reporter := &errorReporter{
+		client:  &http.Client{Timeout: errorReportTimeout},
+		url:     reportURL,
+		reports: make(chan ErrorReport, errorReportQueueSize),
+	}
+	if dsn != "" {
+		parsed, err := parseSentryDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		reporter.sentry = &parsed
+	}
+	return reporter, nil
+}
+
+func (r *errorReporter) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+}
+
+func (r *errorReporter) Fire(entry *logrus.Entry) error {
+	if !r.allow() {
+		return nil
+	}
+	report := newErrorReport(entry)
+	// The process exits right after fatal errors, send them before it does
+	if entry.Level <= logrus.FatalLevel {
+		r.send(report)
+		return nil
+	}
+	select {
+	case r.reports <- report:
+	default:
+	}
+	return nil
+}
+
+// allow returns whether another report can be sent this minute
+func (r *errorReporter) allow() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if now.Sub(r.window) > time.Minute {
+		r.window, r.sent = now, 0
+	}
+	if r.sent >= maxErrorReportsPerMinute {
+		return false
+	}
+	r.sent++
+	return true
+}
+
+// run sends queued reports until ctx is cancelled
+func (r *errorReporter) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case report := <-r.reports:
+			r.send(report)
+		}
+	}
+}
+
+// send delivers a report, failures are ignored since logging them would report them again
+func (r *errorReporter) send(report ErrorReport) {
+	if r.sentry != nil {
+		_ = r.post(r.sentry.storeURL, sentryEvent(report), map[string]string{
+			"X-Sentry-Auth": fmt.Sprintf("Sentry sentry_version=7, sentry_client=glimesh-bridge/%s, sentry_key=%s", report.Version, r.sentry.publicKey),
+		})
+	}
+	if r.url != "" {
+		_ = r.post(r.url, report, nil)
+	}
+}
+
+func (r *errorReporter) post(endpoint string, body interface{}, headers map[string]string) error {
+	byt, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(byt))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("error report rejected with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// sentryEvent converts a report to a Sentry store API event
+func sentryEvent(report ErrorReport) map[string]interface{} {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	extra := make(map[string]interface{}, len(report.Fields)+1)
+	for name, value := range report.Fields {
+		extra[name] = value
+	}
+	if report.Details != "" {
+		extra["details"] = report.Details
+	}
+	return map[string]interface{}{
+		"event_id":  hex.EncodeToString(id),
+		"timestamp": report.Time.UTC().Format(time.RFC3339),
+		"level":     report.Level,
+		"logger":    "glimesh-bridge",
+		"platform":  "go",
+		"release":   report.Version,
+		"message":   map[string]string{"formatted": report.Message},
+		"extra":     extra,
+		"tags":      map[string]string{"os": report.OS, "arch": report.Arch},
+	}
+}
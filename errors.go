@@ -0,0 +1,23 @@
+package main
+
+import "errors"
+
+// Failure modes callers can branch on with errors.Is, the returned errors wrap these with more details
+var (
+	// ErrAuthFailed is returned when Glimesh rejects the app credentials or token
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrChannelNotFound is returned when the configured channel doesn't exist
+	ErrChannelNotFound = errors.New("channel not found")
+	// ErrUserNotFound is returned when looking up a user that doesn't exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrRateLimited is returned when Glimesh is throttling our requests
+	ErrRateLimited = errors.New("rate limited")
+	// ErrDisconnected is returned when a request can't be made because a connection is down
+	ErrDisconnected = errors.New("disconnected")
+	// ErrReadOnly is returned for mutations when the bridge is connected without a token (read-only mode)
+	ErrReadOnly = errors.New("read-only mode")
+	// ErrUnsupported is returned for optional API operations the Glimesh API doesn't have
+	ErrUnsupported = errors.New("not supported by the Glimesh API")
+	// ErrFramePanic is returned when handling an incoming frame panicked
+	ErrFramePanic = errors.New("panic while handling frame")
+)
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Steps of the escalation ladder for repeat offenders
+const (
+	EscalationWarn         = "warn"
+	EscalationDelete       = "delete"
+	EscalationShortTimeout = "short-timeout"
+	EscalationLongTimeout  = "long-timeout"
+	EscalationBan          = "ban"
+)
+
+// EscalationPolicy decides what happens to users whose messages keep getting flagged
+type EscalationPolicy struct {
+	// Action for each strike, the last one is repeated for any further strike (empty to disable)
+	Steps []string `json:"steps"`
+	// A strike expires every this many minutes without new ones (0 to never expire)
+	DecayMinutes int `json:"decay_minutes"`
+}
+
+// validate returns the name of the first invalid setting, if any
+func (p EscalationPolicy) validate() (string, bool) {
+	if p.DecayMinutes < 0 {
+		return "decay_minutes", false
+	}
+	for _, step := range p.Steps {
+		switch step {
+		case EscalationWarn, EscalationDelete, EscalationShortTimeout, EscalationLongTimeout, EscalationBan:
+		default:
+			return "steps", false
+		}
+	}
+	return "", true
+}
+
+// UserStrikes is the strike count of a user, persisted in moderation/strikes
+type UserStrikes struct {
+	Strikes    int       `json:"strikes"`
+	LastStrike time.Time `json:"last_strike"`
+}
+
+// ModerationAction is published when the bridge takes action against a user
+type ModerationAction struct {
+	User      ChatMessageUser `json:"user"`
+	Action    string          `json:"action"`
+	Strikes   int             `json:"strikes"`
+	Flags     []string        `json:"flags"`
+	MessageID string          `json:"message_id"`
+	Error     string          `json:"error,omitempty"`
+}
+
+type escalationLadder struct {
+	bridge *Bridge
+	key    string
+
+	mu      sync.Mutex
+	policy  EscalationPolicy
+	strikes map[string]UserStrikes
+}
+
+func (b *Bridge) newEscalationLadder(config Config) *escalationLadder {
+	ladder := &escalationLadder{bridge: b, key: b.key("moderation/strikes"), policy: config.Escalation}
+	err := b.kv.GetJSON(ladder.key, &ladder.strikes)
+	if err != nil || ladder.strikes == nil {
+		ladder.strikes = make(map[string]UserStrikes)
+		if b.restored != nil && b.restored.Strikes != nil {
+			ladder.strikes = b.restored.Strikes
+		}
+	}
+	return ladder
+}
+
+func (l *escalationLadder) configure(config Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.policy = config.Escalation
+}
+
+// current returns the strikes of an entry after decay
+func (l *escalationLadder) current(entry UserStrikes, now time.Time) int {
+	if l.policy.DecayMinutes <= 0 {
+		return entry.Strikes
+	}
+	expired := int(now.Sub(entry.LastStrike) / (time.Duration(l.policy.DecayMinutes) * time.Minute))
+	if expired >= entry.Strikes {
+		return 0
+	}
+	return entry.Strikes - expired
+}
+
+// strike records a strike for the author of a flagged message and takes the matching action.
+// alreadyDeleted avoids deleting the message twice when the spam action did it.
+func (l *escalationLadder) strike(msg ChatMessage, flags []string, alreadyDeleted bool) {
+	username := strings.ToLower(msg.User.Username)
+	now := time.Now()
+
+	l.mu.Lock()
+	if len(l.policy.Steps) == 0 || username == "" {
+		l.mu.Unlock()
+		return
+	}
+	strikes := l.current(l.strikes[username], now) + 1
+	l.strikes[username] = UserStrikes{Strikes: strikes, LastStrike: now}
+	// Forget users whose strikes have all expired
+	for user, entry := range l.strikes {
+		if l.current(entry, now) == 0 {
+			delete(l.strikes, user)
+		}
+	}
+	step := strikes
+	if step > len(l.policy.Steps) {
+		step = len(l.policy.Steps)
+	}
+	action := l.policy.Steps[step-1]
+	l.bridge.setJSON(l.key, l.strikes)
+	l.mu.Unlock()
+
+	go l.apply(msg, action, strikes, flags, alreadyDeleted)
+}
+
+func (l *escalationLadder) apply(msg ChatMessage, action string, strikes int, flags []string, alreadyDeleted bool) {
+	b := l.bridge
+	channelID := b.channelIDString()
+	var err error
+	switch action {
+	case EscalationWarn:
+		b.say("moderation.warn", msg.User.Username, map[string]interface{}{"strikes": strikes})
+	case EscalationShortTimeout, EscalationLongTimeout, EscalationBan:
+		err = b.api.ModerateUser(b.ctx, escalationField(action), channelID, msg.User.ID)
+	}
+	reason := fmt.Sprintf("strike %d (%s)", strikes, strings.Join(flags, ", "))
+	if action != EscalationWarn && !alreadyDeleted {
+		b.deleteChatMessage(msg, reason)
+	}
+	if action != EscalationDelete {
+		b.audit.record(ModerationAuditEntry{
+			Action:    action,
+			By:        AuditByBridge,
+			User:      msg.User,
+			MessageID: msg.ID,
+			Message:   msg.Message,
+			Reason:    reason,
+			Error:     errorString(err),
+		})
+	}
+
+	result := ModerationAction{User: msg.User, Action: action, Strikes: strikes, Flags: flags, MessageID: msg.ID}
+	logger := b.log.WithField("user", msg.User.Username).WithField("action", action).WithField("strikes", strikes)
+	if err != nil {
+		logger.WithError(err).Error("Could not apply moderation action")
+		result.Error = err.Error()
+	} else {
+		logger.Info("Applied moderation action")
+	}
+	b.setJSON(b.key("ev/moderation-action"), result)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Number of events buffered for each subscriber before they start being dropped
+const eventSubscriberBuffer = 100
+
+// BridgeEvent is an event published by the bridge (written to an ev/... key)
+type BridgeEvent struct {
+	// Name of the event, without prefix (eg. "chat-message")
+	Name    string
+	Payload []byte
+	// Seq increases by one with every event, starting from 1 when the bridge starts
+	Seq        uint64
+	ReceivedAt time.Time
+}
+
+// stampEvent assigns the next sequence number to an event and adds it to the payload
+// (as "seq" and "bridge_received_at"), if the payload is a JSON object
+func (b *Bridge) stampEvent(name string, payload []byte) BridgeEvent {
+	event := BridgeEvent{
+		Name:       name,
+		Seq:        atomic.AddUint64(&b.eventSeq, 1),
+		ReceivedAt: time.Now(),
+	}
+	event.Payload = payload
+	if len(payload) < 2 || payload[0] != '{' {
+		return event
+	}
+	stamp := fmt.Sprintf(`{"seq":%d,"bridge_received_at":"%s"`, event.Seq, event.ReceivedAt.Format(time.RFC3339Nano))
+	if len(bytes.TrimSpace(payload[1:])) > 1 {
+		stamp += ","
+	}
+	event.Payload = append([]byte(stamp), payload[1:]...)
+	return event
+}
+
+// Events published on the priority lane of every subscriber, so alerts are
+// never delayed (or dropped) behind a backlog of chat messages
+var priorityEvents = map[string]bool{
+	"alert":          true,
+	"donation":       true,
+	"new-subscriber": true,
+}
+
+// eventSubscription receives the events published on the bus
+type eventSubscription struct {
+	// Size of the payloads waiting to be consumed, first so it's 64-bit aligned for atomic operations
+	pending  int64
+	events   chan BridgeEvent
+	priority chan BridgeEvent
+}
+
+// next waits for the next event, always returning pending priority events first.
+// It returns false once ctx is cancelled.
+func (s *eventSubscription) next(ctx context.Context) (BridgeEvent, bool) {
+	var event BridgeEvent
+	select {
+	case event = <-s.priority:
+	default:
+		select {
+		case <-ctx.Done():
+			return BridgeEvent{}, false
+		case event = <-s.priority:
+		case event = <-s.events:
+		}
+	}
+	atomic.AddInt64(&s.pending, -int64(len(event.Payload)))
+	return event, true
+}
+
+// eventBus fans out bridge events to in-process subscribers (streaming APIs, sinks...).
+// Slow subscribers miss events instead of blocking the bridge.
+type eventBus struct {
+	// Events not delivered to a subscriber because its buffer was full, first so it's 64-bit aligned
+	dropped uint64
+	// Maximum size of the payloads waiting for each subscriber (0 for no limit besides the event count)
+	maxPending int64
+
+	mu          sync.Mutex
+	subscribers map[*eventSubscription]bool
+}
+
+func newEventBus(maxPending int) *eventBus {
+	return &eventBus{maxPending: int64(maxPending), subscribers: make(map[*eventSubscription]bool)}
+}
+
+func (e *eventBus) subscribe() *eventSubscription {
+	sub := &eventSubscription{
+		events:   make(chan BridgeEvent, eventSubscriberBuffer),
+		priority: make(chan BridgeEvent, eventSubscriberBuffer),
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.subscribers[sub] = true
+	return sub
+}
+
+// stats returns the number of subscribers and of the events waiting to be delivered to them
+func (e *eventBus) stats() (subscribers int, backlog int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for sub := range e.subscribers {
+		backlog += len(sub.events) + len(sub.priority)
+	}
+	return len(e.subscribers), backlog
+}
+
+// droppedCount returns how many events subscribers missed because they were too slow
+func (e *eventBus) droppedCount() uint64 {
+	return atomic.LoadUint64(&e.dropped)
+}
+
+func (e *eventBus) unsubscribe(sub *eventSubscription) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.subscribers, sub)
+}
+
+func (e *eventBus) publish(event BridgeEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	size := int64(len(event.Payload))
+	for sub := range e.subscribers {
+		if e.maxPending > 0 && atomic.LoadInt64(&sub.pending)+size > e.maxPending {
+			atomic.AddUint64(&e.dropped, 1)
+			continue
+		}
+		ch := sub.events
+		if priorityEvents[event.Name] {
+			ch = sub.priority
+		}
+		select {
+		case ch <- event:
+			atomic.AddInt64(&sub.pending, size)
+		default:
+			atomic.AddUint64(&e.dropped, 1)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+
+	kvclient "github.com/strimertul/kilovolt-client-go/v6"
+)
+
+// exportTable is a dataset ready to be written as CSV or Parquet
+type exportTable struct {
+	columns []exportColumn
+	rows    [][]interface{}
+}
+
+// parseExportTime parses a date (YYYY-MM-DD, local time) or an RFC 3339 timestamp
+func parseExportTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// readJSONLines decodes every line of a JSON lines file with decode, skipping invalid lines
+func readJSONLines(path string, decode func(line []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		_ = decode(scanner.Bytes())
+	}
+	return scanner.Err()
+}
+
+// readChatArchive reads every message of a chat archive file, deleted messages are included with Deleted set
+func readChatArchive(path string) ([]ArchivedMessage, error) {
+	// Deletions are written as a second copy of the message, which replaces the first one
+	var messages []ArchivedMessage
+	index := make(map[string]int)
+	err := readJSONLines(path, func(line []byte) error {
+		var message ArchivedMessage
+		if err := jsoniter.ConfigFastest.Unmarshal(line, &message); err != nil {
+			return err
+		}
+		if i, ok := index[message.ID]; ok && message.ID != "" {
+			messages[i].Deleted = messages[i].Deleted || message.Deleted
+			return nil
+		}
+		index[message.ID] = len(messages)
+		messages = append(messages, message)
+		return nil
+	})
+	return messages, err
+}
+
+// exportChat reads the chat archive file, deleted messages are included with deleted = true
+func exportChat(path string, inRange func(time.Time) bool) (exportTable, error) {
+	table := exportTable{columns: []exportColumn{
+		{Name: "received_at", Timestamp: true}, {Name: "id"}, {Name: "user_id"}, {Name: "username"}, {Name: "message"}, {Name: "deleted"},
+	}}
+	messages, err := readChatArchive(path)
+	for _, message := range messages {
+		if inRange(message.ReceivedAt) {
+			table.rows = append(table.rows, []interface{}{
+				message.ReceivedAt, message.ID, message.User.ID, message.User.Username, message.Message, strconv.FormatBool(message.Deleted),
+			})
+		}
+	}
+	return table, err
+}
+
+// exportModeration reads the moderation log file
+func exportModeration(path string, inRange func(time.Time) bool) (exportTable, error) {
+	table := exportTable{columns: []exportColumn{
+		{Name: "time", Timestamp: true}, {Name: "action"}, {Name: "by"}, {Name: "user_id"}, {Name: "username"},
+		{Name: "message_id"}, {Name: "message"}, {Name: "reason"}, {Name: "error"},
+	}}
+	err := readJSONLines(path, func(line []byte) error {
+		var entry ModerationAuditEntry
+		if err := jsoniter.ConfigFastest.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		if inRange(entry.Time) {
+			table.rows = append(table.rows, []interface{}{
+				entry.Time, entry.Action, entry.By, entry.User.ID, entry.User.Username, entry.MessageID, entry.Message, entry.Reason, entry.Error,
+			})
+		}
+		return nil
+	})
+	return table, err
+}
+
+// exportOutgoing reads the outgoing message log file
+func exportOutgoing(path string, inRange func(time.Time) bool) (exportTable, error) {
+	table := exportTable{columns: []exportColumn{
+		{Name: "time", Timestamp: true}, {Name: "id"}, {Name: "source"}, {Name: "requester"}, {Name: "message"}, {Name: "status"}, {Name: "error"},
+	}}
+	err := readJSONLines(path, func(line []byte) error {
+		var entry OutgoingAuditEntry
+		if err := jsoniter.ConfigFastest.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		if inRange(entry.Time) {
+			table.rows = append(table.rows, []interface{}{
+				entry.Time, entry.ID, entry.Source, entry.Requester, entry.Message, entry.Status, entry.Error,
+			})
+		}
+		return nil
+	})
+	return table, err
+}
+
+// exportEvents reads the event log key (kept with -reliable-events), event data is written as JSON
+func exportEvents(endpoint, password, prefix string, inRange func(time.Time) bool) (exportTable, error) {
+	table := exportTable{columns: []exportColumn{
+		{Name: "received_at", Timestamp: true}, {Name: "seq"}, {Name: "event"}, {Name: "data"},
+	}}
+	log := logrus.New()
+	log.SetOutput(os.Stderr)
+	log.SetLevel(logrus.WarnLevel)
+	client, err := kvclient.NewClient(endpoint, kvclient.ClientOptions{Password: password, Logger: log})
+	if err != nil {
+		return table, err
+	}
+	defer client.Close()
+	var events []LoggedEvent
+	if err := client.GetJSON(prefix+"event-log", &events); err != nil {
+		return table, err
+	}
+	for _, event := range events {
+		if inRange(event.ReceivedAt) {
+			table.rows = append(table.rows, []interface{}{
+				event.ReceivedAt, strconv.FormatUint(event.Seq, 10), event.Event, string(event.Data),
+			})
+		}
+	}
+	return table, nil
+}
+
+func writeExportCSV(w io.Writer, table exportTable) error {
+	out := csv.NewWriter(w)
+	header := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		header[i] = column.Name
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(table.columns))
+	for _, row := range table.rows {
+		for i, value := range row {
+			if t, ok := value.(time.Time); ok {
+				record[i] = t.Format(time.RFC3339)
+			} else {
+				record[i] = value.(string)
+			}
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// exportCommand dumps archived chat, moderation actions or logged events for a date range
+func exportCommand(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	data := fs.String("data", "chat", "What to export: \"chat\" (-chat-archive file), \"moderation\" (-moderation-log file), \"outgoing\" (-outgoing-log file) or \"events\" (event-log key, kept with -reliable-events)")
+	chatArchive := fs.String("chat-archive", "", "Chat archive file written by the bridge")
+	moderationLog := fs.String("moderation-log", "", "Moderation log file written by the bridge")
+	outgoingLog := fs.String("outgoing-log", "", "Outgoing message log file written by the bridge")
+	endpoint := fs.String("kv-endpoint", "http://localhost:4337/ws", "Kilovolt endpoint, for events")
+	password := fs.String("password", "", "Optional password for Kilovolt")
+	prefix := fs.String("prefix", "glimesh/", "Prefix/Namespace for keys")
+	from := fs.String("from", "", "Only export data from this date (YYYY-MM-DD) or time (RFC 3339) on")
+	to := fs.String("to", "", "Only export data before this date (YYYY-MM-DD, excluded) or time (RFC 3339)")
+	format := fs.String("format", "csv", "Output format (csv, parquet)")
+	output := fs.String("output", "-", "File to write the export to (- for stdout)")
+	_ = fs.Parse(args)
+
+	if *format != "csv" && *format != "parquet" {
+		check(fmt.Errorf("unknown format %q", *format), "Invalid output format")
+	}
+	var start, end time.Time
+	var err error
+	if *from != "" {
+		start, err = parseExportTime(*from)
+		check(err, "Invalid -from")
+	}
+	if *to != "" {
+		end, err = parseExportTime(*to)
+		check(err, "Invalid -to")
+	}
+	inRange := func(t time.Time) bool {
+		return (start.IsZero() || !t.Before(start)) && (end.IsZero() || t.Before(end))
+	}
+
+	var table exportTable
+	switch *data {
+	case "chat":
+		if *chatArchive == "" {
+			check(fmt.Errorf("missing -chat-archive"), "You must provide the chat archive file")
+		}
+		table, err = exportChat(*chatArchive, inRange)
+	case "moderation":
+		if *moderationLog == "" {
+			check(fmt.Errorf("missing -moderation-log"), "You must provide the moderation log file")
+		}
+		table, err = exportModeration(*moderationLog, inRange)
+	case "outgoing":
+		if *outgoingLog == "" {
+			check(fmt.Errorf("missing -outgoing-log"), "You must provide the outgoing message log file")
+		}
+		table, err = exportOutgoing(*outgoingLog, inRange)
+	case "events":
+		table, err = exportEvents(*endpoint, *password, *prefix, inRange)
+	default:
+		err = fmt.Errorf("unknown data %q", *data)
+	}
+	check(err, "Could not read %s data", *data)
+	sort.SliceStable(table.rows, func(i, j int) bool {
+		return table.rows[i][0].(time.Time).Before(table.rows[j][0].(time.Time))
+	})
+
+	out := os.Stdout
+	if *output != "-" {
+		out, err = os.Create(*output)
+		check(err, "Could not create output file")
+		defer out.Close()
+	}
+	if *format == "parquet" {
+		err = writeParquet(out, table.columns, table.rows)
+	} else {
+		err = writeExportCSV(out, table)
+	}
+	check(err, "Could not write export")
+	_, _ = fmt.Fprintf(os.Stderr, "Exported %d rows\n", len(table.rows))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Replaces links in chat messages when link blocking is enabled
+const blockedLinkText = "[link removed]"
+
+// Maximum length of the text-to-speech version of chat messages
+const ttsMaxLength = 200
+
+// Words masked by default when profanity masking is enabled, extended with -profanity-list
+var defaultProfanity = []string{
+	"fuck", "fucking", "fucker", "motherfucker", "shit", "shitty", "bullshit", "bitch", "bastard",
+	"asshole", "dick", "dickhead", "cunt", "cock", "pussy", "whore", "slut", "wanker", "twat", "prick",
+	"damn", "goddamn", "crap", "piss", "pissed",
+}
+
+// Links with a scheme, starting with www. or bare domains with a common TLD
+var linkPattern = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://\S+|www\.\S+|[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:com|net|org|tv|gg|io|co|me|ly|xyz|info|biz|ru|tk)\b(?:/\S*)?)`)
+
+// FamilyFilter makes the chat output (history, overlays, events) safe for all ages
+type FamilyFilter struct {
+	// Replace profanity with asterisks
+	MaskProfanity bool
+	// Replace links in messages from users below LinkExemptRole
+	BlockLinks     bool
+	LinkExemptRole string
+	// Add a text-to-speech friendly version of each message to chat events
+	TTSText bool
+
+	profanity *regexp.Regexp
+}
+
+// familyModePreset enables all the filters with their default settings
+func familyModePreset() FamilyFilter {
+	return FamilyFilter{MaskProfanity: true, BlockLinks: true, LinkExemptRole: RoleModerator, TTSText: true}
+}
+
+// loadProfanityList builds the masking pattern from the default words and those
+// in the file at path (one per line, if set)
+func (f *FamilyFilter) loadProfanityList(path string) error {
+	words := append([]string{}, defaultProfanity...)
+	if path != "" {
+		byt, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(byt), "\n") {
+			if word := strings.TrimSpace(line); word != "" && !strings.HasPrefix(word, "#") {
+				words = append(words, word)
+			}
+		}
+	}
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	f.profanity = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	return nil
+}
+
+func (f *FamilyFilter) enabled() bool {
+	return f.MaskProfanity || f.BlockLinks || f.TTSText
+}
+
+// apply filters a chat message from a user with the given role, returning the filtered
+// text and what was found in it ("profanity", "link")
+func (f *FamilyFilter) apply(text string, role string) (string, []string) {
+	var flags []string
+	if f.MaskProfanity && f.profanity != nil {
+		masked := f.profanity.ReplaceAllStringFunc(text, func(word string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(word))
+		})
+		if masked != text {
+			flags = append(flags, "profanity")
+			text = masked
+		}
+	}
+	if f.BlockLinks && (f.LinkExemptRole == "" || !roleAtLeast(role, f.LinkExemptRole)) {
+		if blocked := linkPattern.ReplaceAllString(text, blockedLinkText); blocked != text {
+			flags = append(flags, "link")
+			text = blocked
+		}
+	}
+	return text, flags
+}
+
+// ttsText returns a version of an (already filtered) message suited for text-to-speech:
+// no emotes, links, masked words or long character runs, and a capped length
+func (f *FamilyFilter) ttsText(text string) string {
+	text = emotePattern.ReplaceAllString(text, " ")
+	text = linkPattern.ReplaceAllString(text, " ")
+	text = strings.ReplaceAll(text, blockedLinkText, " ")
+	if f.profanity != nil {
+		text = f.profanity.ReplaceAllString(text, " ")
+	}
+	// Long runs of the same character are read out one by one, keep two at most
+	var collapsed strings.Builder
+	var last rune
+	run := 0
+	for _, r := range text {
+		if r == last {
+			run++
+		} else {
+			last, run = r, 1
+		}
+		if run <= 2 {
+			collapsed.WriteRune(r)
+		}
+	}
+	// Drop the words masked by the profanity filter
+	var words []string
+	for _, word := range strings.Fields(collapsed.String()) {
+		if strings.Trim(word, "*") != "" {
+			words = append(words, word)
+		}
+	}
+	text = strings.Join(words, " ")
+	text, _ = truncateRunes(text, ttsMaxLength)
+	return text
+}
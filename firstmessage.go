@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the list of known chatters is saved to KV when it changes
+const knownChattersSaveInterval = 30 * time.Second
+
+// FirstMessage is emitted for the first message of a user, ever or in the current stream
+type FirstMessage struct {
+	ChatMessage
+	// FirstEver is set if the user never chatted in the channel before
+	FirstEver bool `json:"first_ever"`
+}
+
+// firstMessageDetector recognizes first-time chatters and the first message of each user in a stream
+type firstMessageDetector struct {
+	bridge *Bridge
+	key    string
+
+	mu     sync.Mutex
+	known  *lruCache
+	dirty  bool
+	stream time.Time
+	seen   *lruCache
+
+	// Greetings for first-time chatters, if enabled
+	welcome     bool
+	welcomeRate int
+	greeted     map[string]bool
+	greetings   []time.Time
+}
+
+func (b *Bridge) newFirstMessageDetector(welcome bool, welcomeRate int) *firstMessageDetector {
+	detector := &firstMessageDetector{
+		bridge:      b,
+		key:         b.key("known-chatters"),
+		known:       b.newLRUCache("known-chatters", b.memory.DedupSets),
+		seen:        b.newLRUCache("stream-chatters", b.memory.DedupSets),
+		welcome:     welcome,
+		welcomeRate: welcomeRate,
+		greeted:     make(map[string]bool),
+	}
+	var stored []string
+	if err := b.kv.GetJSON(detector.key, &stored); err == nil {
+		for _, username := range stored {
+			detector.known.put(username, true)
+		}
+	}
+	if snapshot := b.restored; snapshot != nil {
+		detector.stream = snapshot.Stream
+		for _, username := range snapshot.StreamChatters {
+			detector.seen.put(username, true)
+		}
+		for _, username := range snapshot.Greeted {
+			detector.greeted[username] = true
+		}
+	}
+	return detector
+}
+
+// record checks whether msg is a first message, emitting the relevant events
+func (d *firstMessageDetector) record(msg ChatMessage) {
+	username := strings.ToLower(msg.User.Username)
+	if username == "" {
+		return
+	}
+
+	d.mu.Lock()
+	// Reset the per-stream state when a new stream starts
+	if startedAt, live := d.bridge.session.liveSince(); live && !startedAt.Equal(d.stream) {
+		d.stream = startedAt
+		d.seen.clear()
+		d.greeted = make(map[string]bool)
+	}
+	firstEver := !d.known.has(username)
+	firstInStream := !d.seen.has(username)
+	d.known.put(username, true)
+	d.seen.put(username, true)
+	if firstEver {
+		d.dirty = true
+	}
+	greet := firstEver && d.welcome && !d.greeted[username] && d.allowGreeting(time.Now())
+	if greet {
+		d.greeted[username] = true
+	}
+	d.mu.Unlock()
+
+	if firstInStream {
+		d.bridge.setJSON(d.bridge.key("ev/first-message"), FirstMessage{ChatMessage: msg, FirstEver: firstEver})
+	}
+	if greet {
+		d.bridge.say("welcome.first-time", msg.User.Username, nil)
+	}
+}
+
+// allowGreeting applies the greetings per minute cap, must be called with the lock held
+func (d *firstMessageDetector) allowGreeting(now time.Time) bool {
+	if d.welcomeRate <= 0 {
+		return true
+	}
+	kept := d.greetings[:0]
+	for _, t := range d.greetings {
+		if now.Sub(t) < time.Minute {
+			kept = append(kept, t)
+		}
+	}
+	d.greetings = kept
+	if len(d.greetings) >= d.welcomeRate {
+		return false
+	}
+	d.greetings = append(d.greetings, now)
+	return true
+}
+
+// saveKnown periodically writes the known chatters to KV
+func (d *firstMessageDetector) saveKnown(ctx context.Context) {
+	ticker := time.NewTicker(knownChattersSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.mu.Lock()
+		if !d.dirty {
+			d.mu.Unlock()
+			continue
+		}
+		// Least recently seen first, so they're the first evicted when loaded again
+		known := d.known.keys()
+		d.dirty = false
+		d.mu.Unlock()
+		d.bridge.setJSON(d.key, known)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+func (g *GlimeshClient) userID(ctx context.Context, username string) (string, error) {
+	result, err := g.LookupUserID(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	if result.User == nil {
+		return "", ErrUserNotFound
+	}
+	return result.User.ID, nil
+}
+
+// setFollow makes the authenticated account follow or unfollow a channel
+func (g *GlimeshClient) setFollow(ctx context.Context, username string, follow bool) error {
+	streamerID, err := g.userID(ctx, username)
+	if err != nil {
+		return err
+	}
+	if follow {
+		_, err = g.Follow(ctx, streamerID)
+	} else {
+		_, err = g.Unfollow(ctx, streamerID)
+	}
+	return err
+}
+
+func (b *Bridge) setupFollowRPC(ctx context.Context) error {
+	handler := func(follow bool) func(string) {
+		return func(value string) {
+			username := strings.TrimPrefix(strings.TrimSpace(value), "@")
+			logger := b.log.WithField("channel", username)
+			err := b.api.setFollow(ctx, username, follow)
+			if err != nil {
+				logger.WithError(err).Error("Could not change follow status")
+				return
+			}
+			if follow {
+				logger.Info("Followed channel")
+			} else {
+				logger.Info("Unfollowed channel")
+			}
+		}
+	}
+
+	err := b.handleRPC(ctx, "@follow-channel", handler(true))
+	if err != nil {
+		return err
+	}
+	return b.handleRPC(ctx, "@unfollow-channel", handler(false))
+}
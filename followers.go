@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// fetchFollowers pages through the full follower list of a streamer
+func (g *GlimeshClient) fetchFollowers(ctx context.Context, streamerID string) ([]Follower, error) {
+	followers := make([]Follower, 0)
+	var after *string
+	for {
+		result, err := g.Followers(ctx, streamerID, after)
+		if err != nil {
+			return followers, err
+		}
+		if result.Followers == nil {
+			return followers, nil
+		}
+		for _, edge := range result.Followers.Edges {
+			if edge.Node != nil {
+				followers = append(followers, *edge.Node)
+			}
+		}
+		if !result.Followers.PageInfo.HasNextPage {
+			return followers, nil
+		}
+		cursor := result.Followers.PageInfo.EndCursor
+		after = &cursor
+	}
+}
+
+func writeFollowersCSV(w io.Writer, followers []Follower) error {
+	out := csv.NewWriter(w)
+	err := out.Write([]string{"user_id", "username", "display_name", "followed_at", "live_notifications"})
+	if err != nil {
+		return err
+	}
+	for _, follower := range followers {
+		err = out.Write([]string{
+			follower.User.ID,
+			follower.User.Username,
+			follower.User.Displayname,
+			follower.InsertedAt,
+			strconv.FormatBool(follower.HasLiveNotifications),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func exportFollowersCommand(args []string) {
+	fs := flag.NewFlagSet("export-followers", flag.ExitOnError)
+	channelID := fs.Int("channel-id", -1, "Glimesh channel ID")
+	clientID := fs.String("client-id", "", "Glimesh app client ID")
+	clientSecret := fs.String("client-secret", "", "Glimesh app secret key")
+	server := registerServerFlags(fs)
+	format := fs.String("format", "csv", "Output format (csv, json)")
+	output := fs.String("output", "-", "File to write the follower list to (- for stdout)")
+	_ = fs.Parse(args)
+
+	if *channelID == -1 {
+		check(fmt.Errorf("missing required flags"), "You must provide a channel ID")
+	}
+	check(server.validate(*clientID, *clientSecret), "Invalid Glimesh server options")
+	if *format != "csv" && *format != "json" {
+		check(fmt.Errorf("unknown format %q", *format), "Invalid output format")
+	}
+
+	ctx := context.Background()
+	credentials, err := server.credentials(ctx, *clientID, *clientSecret, "public")
+	check(err, "Could not retrieve Glimesh API token")
+	api := server.newClient(credentials.AccessToken)
+
+	bridge := &Bridge{api: api, channelID: *channelID}
+	info, err := bridge.fetchChannelInfo(ctx)
+	check(err, "Could not fetch channel info")
+
+	followers, err := api.fetchFollowers(ctx, info.Streamer.ID)
+	check(err, "Could not fetch followers")
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		check(err, "Could not create output file")
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "csv":
+		err = writeFollowersCSV(w, followers)
+	case "json":
+		enc := jsoniter.ConfigFastest.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(followers)
+	}
+	check(err, "Could not write follower list")
+
+	_, _ = fmt.Fprintf(os.Stderr, "Exported %d followers\n", len(followers))
+}
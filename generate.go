@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Number of distinct synthetic users, so caches behave like they would with a real audience
+const generatedUsers = 50
+
+// Kinds of synthetic events for -generate
+const (
+	GenerateChat   = "chat"
+	GenerateFollow = "follow"
+	GenerateSub    = "sub"
+)
+
+// Messages picked at random for synthetic chat, with emotes, links and long lines
+// so overlays get a realistic mix
+var generatedMessages = []string{
+	"hello!",
+	"gg",
+	"lol",
+	"that was close :glimSweat:",
+	"how long have you been streaming today?",
+	":glimLove: :glimLove: :glimLove:",
+	"check out https://glimesh.tv",
+	"what game is this?",
+	"POG",
+	"I've been watching for a while and I have to say this is one of the best streams on the platform, keep it up! Also the new overlay looks great, did you make it yourself?",
+}
+
+// GenerateRates is the number of synthetic events per second, by kind
+type GenerateRates map[string]float64
+
+// parseGenerateRates parses -generate, a comma-separated list of kind=rate (eg. "chat=10,follow=0.5,sub=0.1")
+func parseGenerateRates(value string) (GenerateRates, error) {
+	rates := make(GenerateRates)
+	for _, item := range parseList(value) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid rate %q, expected kind=rate", item)
+		}
+		kind := strings.TrimSpace(parts[0])
+		switch kind {
+		case GenerateChat, GenerateFollow, GenerateSub:
+		default:
+			return nil, fmt.Errorf("unknown event kind %q, expected chat, follow or sub", kind)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid rate %q for %s", parts[1], kind)
+		}
+		rates[kind] = rate
+	}
+	return rates, nil
+}
+
+// eventGenerator produces synthetic chat messages, follows and subscriptions for load testing.
+// Chat messages go through the same pipeline as the ones received from Glimesh.
+type eventGenerator struct {
+	seq    uint64
+	bridge *Bridge
+	rates  GenerateRates
+	chat   chan<- incomingChatMessage
+}
+
+func (b *Bridge) newEventGenerator(rates GenerateRates, chat chan<- incomingChatMessage) *eventGenerator {
+	// Synthetic users don't exist on Glimesh, keep them from being looked up
+	expires := time.Now().Add(24 * time.Hour * 365)
+	for i := 1; i <= generatedUsers; i++ {
+		user := generatedUser(i)
+		if b.followers != nil {
+			b.followers.entries.put(user.ID, followerCacheEntry{following: i%3 == 0, expires: expires})
+		}
+		if b.users != nil {
+			b.users.put(strings.ToLower(user.Username), nil, expires)
+		}
+	}
+	return &eventGenerator{bridge: b, rates: rates, chat: chat}
+}
+
+func generatedUser(n int) UserInfo {
+	username := fmt.Sprintf("synthetic_user_%d", n)
+	return UserInfo{ID: fmt.Sprintf("synthetic-%d", n), Username: username, Displayname: username}
+}
+
+func (g *eventGenerator) randomUser() UserInfo {
+	return generatedUser(rand.Intn(generatedUsers) + 1)
+}
+
+func (g *eventGenerator) nextID() string {
+	return fmt.Sprintf("synthetic-%d", atomic.AddUint64(&g.seq, 1))
+}
+
+// run generates events at the configured rates until ctx is done
+func (g *eventGenerator) run(ctx context.Context) {
+	g.bridge.log.WithField("rates", g.rates).Warn("Generating synthetic events, do not use on a live channel")
+	for kind, rate := range g.rates {
+		if rate <= 0 {
+			continue
+		}
+		kind, interval := kind, time.Duration(float64(time.Second)/rate)
+		g.bridge.goSafe(ctx, "generate:"+kind, func(ctx context.Context) {
+			g.loop(ctx, kind, interval)
+		})
+	}
+}
+
+func (g *eventGenerator) loop(ctx context.Context, kind string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		switch kind {
+		case GenerateChat:
+			g.sendChat(ctx)
+		case GenerateFollow:
+			user := g.randomUser()
+			g.bridge.publishAlert(Alert{Type: "follow", Source: "generate", Username: user.Username})
+		case GenerateSub:
+			user := g.randomUser()
+			sub := Subscriber{ID: g.nextID(), InsertedAt: time.Now().UTC().Format(time.RFC3339), ProductName: "Channel Subscription", User: user}
+			g.bridge.setJSON(g.bridge.key("ev/new-subscriber"), sub)
+			g.bridge.publishAlert(Alert{Type: "subscription", Source: "generate", Username: user.Username})
+		}
+	}
+}
+
+func (g *eventGenerator) sendChat(ctx context.Context) {
+	user := g.randomUser()
+	now := time.Now()
+	incoming := incomingChatMessage{
+		ChatMessage: ChatMessage{
+			ID:       g.nextID(),
+			Message:  generatedMessages[rand.Intn(len(generatedMessages))],
+			User:     ChatMessageUser{ID: user.ID, Username: user.Username},
+			Metadata: &ChatMessageMetadata{Subscriber: rand.Intn(4) == 0},
+		},
+		timing: pipelineTiming{received: now, decoded: now},
+	}
+	select {
+	case g.chat <- incoming:
+	case <-ctx.Done():
+	}
+}
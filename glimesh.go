@@ -0,0 +1,206 @@
+package main
+
+//go:generate go run ./tools/gqlgen -schema schema/glimesh.json -queries queries -out graphql_gen.go
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const glimeshAPIEndpoint = "https://glimesh.tv/api/graph"
+
+type ClientCredentialsResult struct {
+	AccessToken  string  `json:"access_token"`
+	RefreshToken *string `json:"refresh_token"`
+	CreatedAt    string  `json:"created_at"`
+	Expires      int     `json:"expires_in"`
+	Scope        string  `json:"scope"`
+	TokenType    string  `json:"token_type"`
+
+	// Local time the token was received at and server time from the response Date header
+	// (zero if missing), used to compute the expiry regardless of the local clock
+	ReceivedAt time.Time `json:"-"`
+	ServerTime time.Time `json:"-"`
+}
+
+type GQLError struct {
+	Message string `json:"message"`
+	// Passed through as returned by the API
+	Locations  jsoniter.RawMessage `json:"locations,omitempty"`
+	Path       jsoniter.RawMessage `json:"path,omitempty"`
+	Extensions jsoniter.RawMessage `json:"extensions,omitempty"`
+}
+
+type GQLResponse struct {
+	Data   jsoniter.RawMessage `json:"data"`
+	Errors []GQLError          `json:"errors"`
+}
+
+// getClientCredentials obtains an app token from Glimesh OAuth using the client credentials grant
+func getClientCredentials(ctx context.Context, tokenURL, clientID, clientSecret, scope string) (ClientCredentialsResult, error) {
+	credentials := ClientCredentialsResult{}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"scope":         {scope},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return credentials, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return credentials, err
+	}
+	defer res.Body.Close()
+
+	err = jsoniter.ConfigFastest.NewDecoder(res.Body).Decode(&credentials)
+	if err != nil {
+		return credentials, fmt.Errorf("could not decode Glimesh API response: %w", err)
+	}
+	credentials.ReceivedAt = time.Now()
+	if date, err := http.ParseTime(res.Header.Get("Date")); err == nil {
+		credentials.ServerTime = date
+	}
+	if credentials.AccessToken == "" {
+		return credentials, fmt.Errorf("%w: no token returned (status code %d)", ErrAuthFailed, res.StatusCode)
+	}
+	return credentials, nil
+}
+
+// GlimeshClient performs GraphQL queries and mutations against the Glimesh HTTP API
+type GlimeshClient struct {
+	// Token can be replaced with SetToken while the client is in use
+	Token string
+	// GraphQL endpoint, the official instance by default
+	Endpoint string
+	// ClientID identifies requests when there is no token (read-only mode)
+	ClientID string
+	HTTP     *http.Client
+	mu       sync.RWMutex
+	// OnResult, if set, is called with the outcome of every request (nil on success)
+	// except rate limited ones, to keep track of the API health
+	OnResult func(err error)
+	// Cache for idempotent queries, nil to always query the API
+	cache *queryCache
+	// Optional fields found on the API by detectFields
+	fields map[string]bool
+}
+
+func NewGlimeshClient(token string) *GlimeshClient {
+	return &GlimeshClient{
+		Token:    token,
+		Endpoint: glimeshAPIEndpoint,
+		HTTP:     &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// RawQuery runs a GraphQL query and returns the full response, including any GraphQL errors
+func (g *GlimeshClient) RawQuery(ctx context.Context, query string, variables map[string]interface{}) (GQLResponse, error) {
+	result, err := g.rawQuery(ctx, query, variables)
+	if g.OnResult != nil && !errors.Is(err, ErrRateLimited) {
+		g.OnResult(err)
+	}
+	return result, err
+}
+
+func (g *GlimeshClient) rawQuery(ctx context.Context, query string, variables map[string]interface{}) (GQLResponse, error) {
+	var result GQLResponse
+	if variables == nil {
+		variables = map[string]interface{}{}
+	}
+	body, err := jsoniter.ConfigFastest.Marshal(GQLQuery{Query: query, Variables: variables})
+	if err != nil {
+		return result, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	g.mu.RLock()
+	if g.Token == "" && g.ClientID != "" {
+		req.Header.Set("Authorization", "Client-ID "+g.ClientID)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	g.mu.RUnlock()
+
+	res, err := g.HTTP.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return result, fmt.Errorf("%w: status code %d from Glimesh API", ErrAuthFailed, res.StatusCode)
+	case http.StatusTooManyRequests:
+		return result, fmt.Errorf("%w: status code %d from Glimesh API", ErrRateLimited, res.StatusCode)
+	default:
+		return result, fmt.Errorf("unexpected status code from Glimesh API: %d", res.StatusCode)
+	}
+
+	err = jsoniter.ConfigFastest.NewDecoder(res.Body).Decode(&result)
+	return result, err
+}
+
+// SetToken replaces the token used for the following requests
+func (g *GlimeshClient) SetToken(token string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.Token = token
+}
+
+// token returns the token used for requests
+func (g *GlimeshClient) token() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.Token
+}
+
+// Query runs a GraphQL query and decodes the "data" field of the response into out (if not nil)
+func (g *GlimeshClient) Query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	result, err := g.execute(ctx, query, variables)
+	if err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return errors.New(result.Errors[0].Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return jsoniter.ConfigFastest.Unmarshal(result.Data, out)
+}
+
+// execute runs a GraphQL query through the cache, refusing mutations in read-only mode.
+// Unlike Query, the whole response is returned, with all its errors and any partial data.
+func (g *GlimeshClient) execute(ctx context.Context, query string, variables map[string]interface{}) (GQLResponse, error) {
+	g.mu.RLock()
+	readOnly := g.Token == "" && g.ClientID != ""
+	g.mu.RUnlock()
+	if readOnly && isMutation(query) {
+		return GQLResponse{}, ErrReadOnly
+	}
+	if g.cache != nil {
+		return g.cache.query(ctx, query, variables, func() (GQLResponse, error) {
+			return g.RawQuery(ctx, query, variables)
+		})
+	}
+	return g.RawQuery(ctx, query, variables)
+}
@@ -0,0 +1,510 @@
+// Code generated by tools/gqlgen. DO NOT EDIT.
+
+package main
+
+import "context"
+
+// fetchChannelDocument is the document for the FetchChannel query
+const fetchChannelDocument = `query FetchChannel($id: ID!) {
+	channel(id: $id) {
+		...ChannelInfo
+	}
+}
+
+fragment ChannelInfo on Channel {
+	id
+	title
+	status
+	language
+	streamer { ...UserInfo }
+	category { ...ChannelCategory }
+	subcategory { ...ChannelSubcategory }
+	tags { ...ChannelTag }
+	hosting { targetChannel { ...PartnerChannel } }
+	hosts { hostingChannel { ...PartnerChannel } }
+	stream { ...ChannelStream }
+}
+
+fragment UserInfo on User {
+	id
+	username
+	displayname
+}
+
+fragment ChannelCategory on Category {
+	id
+	name
+	slug
+}
+
+fragment ChannelSubcategory on Subcategory {
+	id
+	name
+	slug
+	backgroundImageUrl
+	source
+	sourceId
+	userCreated
+}
+
+fragment ChannelTag on Tag {
+	id
+	name
+	slug
+}
+
+fragment PartnerChannel on Channel {
+	id
+	streamer { ...UserInfo }
+}
+
+fragment ChannelStream on Stream {
+	id
+	startedAt
+	countViewers
+	peakViewers
+	thumbnailUrl
+}`
+
+// chatMessagesDocument is the document for the ChatMessages subscription
+const chatMessagesDocument = `subscription ChatMessages($channelId: ID!) {
+	chatMessage(channelId: $channelId) {
+		...ChatMessage
+	}
+}
+
+fragment ChatMessage on ChatMessage {
+	id
+	message
+	user { id username }
+	metadata { admin moderator streamer subscriber platformFounderSubscriber platformSupporterSubscriber }
+}`
+
+// sendChatMessageDocument is the document for the SendChatMessage mutation
+const sendChatMessageDocument = `mutation SendChatMessage($channelId: ID!, $message: ChatMessageInput!) {
+	createChatMessage(channelId: $channelId, message: $message) {
+		message
+	}
+}`
+
+// followersDocument is the document for the Followers query
+const followersDocument = `query Followers($streamerId: ID!, $after: String) {
+	followers(streamerId: $streamerId, first: 100, after: $after) {
+		pageInfo { hasNextPage endCursor }
+		edges { node { ...Follower } }
+	}
+}
+
+fragment Follower on Follower {
+	id
+	insertedAt
+	hasLiveNotifications
+	user { ...UserInfo }
+}
+
+fragment UserInfo on User {
+	id
+	username
+	displayname
+}`
+
+// lookupUserIDDocument is the document for the LookupUserID query
+const lookupUserIDDocument = `query LookupUserID($username: String!) {
+	user(username: $username) {
+		id
+	}
+}`
+
+// followDocument is the document for the Follow mutation
+const followDocument = `mutation Follow($streamerId: ID!) {
+	follow(streamerId: $streamerId, liveNotifications: false) {
+		id
+	}
+}`
+
+// unfollowDocument is the document for the Unfollow mutation
+const unfollowDocument = `mutation Unfollow($streamerId: ID!) {
+	unfollow(streamerId: $streamerId) {
+		id
+	}
+}`
+
+// followerCountDocument is the document for the FollowerCount query
+const followerCountDocument = `query FollowerCount($streamerId: ID!) {
+	followers(streamerId: $streamerId, first: 1) {
+		count
+	}
+}`
+
+// userProfileDocument is the document for the UserProfile query
+const userProfileDocument = `query UserProfile($username: String!) {
+	user(username: $username) {
+		...UserProfile
+	}
+}
+
+fragment UserProfile on User {
+	id
+	username
+	displayname
+	avatarUrl
+	insertedAt
+}`
+
+// isFollowerDocument is the document for the IsFollower query
+const isFollowerDocument = `query IsFollower($streamerId: ID!, $userId: ID!) {
+	followers(streamerId: $streamerId, userId: $userId, first: 1) {
+		count
+	}
+}`
+
+// subscribersDocument is the document for the Subscribers query
+const subscribersDocument = `query Subscribers($streamerId: ID!, $after: String) {
+	subscriptions(streamerId: $streamerId, isActive: true, first: 100, after: $after) {
+		pageInfo { hasNextPage endCursor }
+		edges { node { ...Subscriber } }
+	}
+}
+
+fragment Subscriber on Sub {
+	id
+	insertedAt
+	productName
+	user { ...UserInfo }
+}
+
+fragment UserInfo on User {
+	id
+	username
+	displayname
+}`
+
+type FetchChannelResponse struct {
+	Channel *ChannelInfo `json:"channel"`
+}
+
+type ChannelInfoHosting struct {
+	TargetChannel PartnerChannel `json:"targetChannel"`
+}
+
+type ChannelInfoHosts struct {
+	HostingChannel PartnerChannel `json:"hostingChannel"`
+}
+
+type ChannelInfo struct {
+	ID          string              `json:"id"`
+	Title       string              `json:"title"`
+	Status      string              `json:"status"`
+	Language    string              `json:"language"`
+	Streamer    UserInfo            `json:"streamer"`
+	Category    *ChannelCategory    `json:"category"`
+	Subcategory *ChannelSubcategory `json:"subcategory"`
+	Tags        []ChannelTag        `json:"tags"`
+	Hosting     *ChannelInfoHosting `json:"hosting"`
+	Hosts       []ChannelInfoHosts  `json:"hosts"`
+	Stream      *ChannelStream      `json:"stream"`
+}
+
+type UserInfo struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	Displayname string `json:"displayname"`
+}
+
+type ChannelCategory struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type ChannelSubcategory struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	Slug               string `json:"slug"`
+	BackgroundImageURL string `json:"backgroundImageUrl"`
+	Source             string `json:"source"`
+	SourceID           string `json:"sourceId"`
+	UserCreated        bool   `json:"userCreated"`
+}
+
+type ChannelTag struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type ChannelStream struct {
+	ID           string `json:"id"`
+	StartedAt    string `json:"startedAt"`
+	CountViewers int    `json:"countViewers"`
+	PeakViewers  int    `json:"peakViewers"`
+	ThumbnailURL string `json:"thumbnailUrl"`
+}
+
+type PartnerChannel struct {
+	ID       string   `json:"id"`
+	Streamer UserInfo `json:"streamer"`
+}
+
+type ChatMessagesResponse struct {
+	ChatMessage *ChatMessage `json:"chatMessage"`
+}
+
+type SendChatMessageResponseCreateChatMessage struct {
+	Message string `json:"message"`
+}
+
+type SendChatMessageResponse struct {
+	CreateChatMessage *SendChatMessageResponseCreateChatMessage `json:"createChatMessage"`
+}
+
+type ChatMessageInput struct {
+	Message string `json:"message,omitempty"`
+}
+
+type ChatMessageUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type ChatMessageMetadata struct {
+	Admin                       bool `json:"admin"`
+	Moderator                   bool `json:"moderator"`
+	Streamer                    bool `json:"streamer"`
+	Subscriber                  bool `json:"subscriber"`
+	PlatformFounderSubscriber   bool `json:"platformFounderSubscriber"`
+	PlatformSupporterSubscriber bool `json:"platformSupporterSubscriber"`
+}
+
+type ChatMessage struct {
+	ID       string               `json:"id"`
+	Message  string               `json:"message"`
+	User     ChatMessageUser      `json:"user"`
+	Metadata *ChatMessageMetadata `json:"metadata"`
+}
+
+type FollowersResponseFollowersPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type FollowersResponseFollowersEdges struct {
+	Node *Follower `json:"node"`
+}
+
+type FollowersResponseFollowers struct {
+	PageInfo FollowersResponseFollowersPageInfo `json:"pageInfo"`
+	Edges    []FollowersResponseFollowersEdges  `json:"edges"`
+}
+
+type FollowersResponse struct {
+	Followers *FollowersResponseFollowers `json:"followers"`
+}
+
+type LookupUserIDResponseUser struct {
+	ID string `json:"id"`
+}
+
+type LookupUserIDResponse struct {
+	User *LookupUserIDResponseUser `json:"user"`
+}
+
+type FollowResponseFollow struct {
+	ID string `json:"id"`
+}
+
+type FollowResponse struct {
+	Follow *FollowResponseFollow `json:"follow"`
+}
+
+type UnfollowResponseUnfollow struct {
+	ID string `json:"id"`
+}
+
+type UnfollowResponse struct {
+	Unfollow *UnfollowResponseUnfollow `json:"unfollow"`
+}
+
+type Follower struct {
+	ID                   string   `json:"id"`
+	InsertedAt           string   `json:"insertedAt"`
+	HasLiveNotifications bool     `json:"hasLiveNotifications"`
+	User                 UserInfo `json:"user"`
+}
+
+type FollowerCountResponseFollowers struct {
+	Count int `json:"count"`
+}
+
+type FollowerCountResponse struct {
+	Followers *FollowerCountResponseFollowers `json:"followers"`
+}
+
+type UserProfileResponse struct {
+	User *UserProfile `json:"user"`
+}
+
+type UserProfile struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	Displayname string `json:"displayname"`
+	AvatarURL   string `json:"avatarUrl"`
+	InsertedAt  string `json:"insertedAt"`
+}
+
+type IsFollowerResponseFollowers struct {
+	Count int `json:"count"`
+}
+
+type IsFollowerResponse struct {
+	Followers *IsFollowerResponseFollowers `json:"followers"`
+}
+
+type SubscribersResponseSubscriptionsPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type SubscribersResponseSubscriptionsEdges struct {
+	Node *Subscriber `json:"node"`
+}
+
+type SubscribersResponseSubscriptions struct {
+	PageInfo SubscribersResponseSubscriptionsPageInfo `json:"pageInfo"`
+	Edges    []SubscribersResponseSubscriptionsEdges  `json:"edges"`
+}
+
+type SubscribersResponse struct {
+	Subscriptions *SubscribersResponseSubscriptions `json:"subscriptions"`
+}
+
+type Subscriber struct {
+	ID          string   `json:"id"`
+	InsertedAt  string   `json:"insertedAt"`
+	ProductName string   `json:"productName"`
+	User        UserInfo `json:"user"`
+}
+
+// FetchChannel runs the FetchChannel query
+func (g *GlimeshClient) FetchChannel(ctx context.Context, id string) (*FetchChannelResponse, error) {
+	var result FetchChannelResponse
+	err := g.Query(ctx, fetchChannelDocument, map[string]interface{}{
+		"id": id,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SendChatMessage runs the SendChatMessage mutation
+func (g *GlimeshClient) SendChatMessage(ctx context.Context, channelID string, message ChatMessageInput) (*SendChatMessageResponse, error) {
+	var result SendChatMessageResponse
+	err := g.Query(ctx, sendChatMessageDocument, map[string]interface{}{
+		"channelId": channelID,
+		"message":   message,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Followers runs the Followers query
+func (g *GlimeshClient) Followers(ctx context.Context, streamerID string, after *string) (*FollowersResponse, error) {
+	var result FollowersResponse
+	err := g.Query(ctx, followersDocument, map[string]interface{}{
+		"streamerId": streamerID,
+		"after":      after,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// LookupUserID runs the LookupUserID query
+func (g *GlimeshClient) LookupUserID(ctx context.Context, username string) (*LookupUserIDResponse, error) {
+	var result LookupUserIDResponse
+	err := g.Query(ctx, lookupUserIDDocument, map[string]interface{}{
+		"username": username,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Follow runs the Follow mutation
+func (g *GlimeshClient) Follow(ctx context.Context, streamerID string) (*FollowResponse, error) {
+	var result FollowResponse
+	err := g.Query(ctx, followDocument, map[string]interface{}{
+		"streamerId": streamerID,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Unfollow runs the Unfollow mutation
+func (g *GlimeshClient) Unfollow(ctx context.Context, streamerID string) (*UnfollowResponse, error) {
+	var result UnfollowResponse
+	err := g.Query(ctx, unfollowDocument, map[string]interface{}{
+		"streamerId": streamerID,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// FollowerCount runs the FollowerCount query
+func (g *GlimeshClient) FollowerCount(ctx context.Context, streamerID string) (*FollowerCountResponse, error) {
+	var result FollowerCountResponse
+	err := g.Query(ctx, followerCountDocument, map[string]interface{}{
+		"streamerId": streamerID,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UserProfile runs the UserProfile query
+func (g *GlimeshClient) UserProfile(ctx context.Context, username string) (*UserProfileResponse, error) {
+	var result UserProfileResponse
+	err := g.Query(ctx, userProfileDocument, map[string]interface{}{
+		"username": username,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// IsFollower runs the IsFollower query
+func (g *GlimeshClient) IsFollower(ctx context.Context, streamerID string, userID string) (*IsFollowerResponse, error) {
+	var result IsFollowerResponse
+	err := g.Query(ctx, isFollowerDocument, map[string]interface{}{
+		"streamerId": streamerID,
+		"userId":     userID,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Subscribers runs the Subscribers query
+func (g *GlimeshClient) Subscribers(ctx context.Context, streamerID string, after *string) (*SubscribersResponse, error) {
+	var result SubscribersResponse
+	err := g.Query(ctx, subscribersDocument, map[string]interface{}{
+		"streamerId": streamerID,
+		"after":      after,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var errMutationsDisabled = errors.New("mutations are disabled, enable them with -graphql-rpc-mutations")
+
+type GraphQLRequest struct {
+	// ID is an optional identifier echoed back in the response, to match requests and responses
+	ID        string                 `json:"id"`
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+	// Source and Secret authenticate the request like chat messages (see -send-secret)
+	Source string `json:"source"`
+	Secret string `json:"secret"`
+}
+
+type GraphQLResponse struct {
+	ID     string              `json:"id"`
+	Data   jsoniter.RawMessage `json:"data,omitempty"`
+	Errors []GQLError          `json:"errors,omitempty"`
+}
+
+// isMutation returns whether a GraphQL document contains a mutation operation, skipping
+// comments, strings and selection sets so field names can't be mistaken for operations
+func isMutation(document string) bool {
+	depth := 0
+	for i := 0; i < len(document); i++ {
+		switch c := document[i]; {
+		case c == '#':
+			for i < len(document) && document[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			quote := `"`
+			if strings.HasPrefix(document[i:], `"""`) {
+				quote = `"""`
+			}
+			i += len(quote)
+			for i < len(document) && !strings.HasPrefix(document[i:], quote) {
+				if document[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i += len(quote) - 1
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case depth == 0 && (c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'):
+			start := i
+			for i+1 < len(document) && isNameChar(document[i+1]) {
+				i++
+			}
+			if document[start:i+1] == "mutation" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// setupGraphQLRPC exposes a passthrough RPC that runs queries (and mutations, if allowed)
+// with the bridge's token, writing the result to the graphql-response key. Requests are
+// authenticated like chat messages, since they run with the same token.
+func (b *Bridge) setupGraphQLRPC(ctx context.Context, allowMutations bool) error {
+	responseKey := b.key("graphql-response")
+	return b.handleRPC(ctx, "@graphql", func(value string) {
+		var request GraphQLRequest
+		err := jsoniter.ConfigFastest.UnmarshalFromString(value, &request)
+		if err != nil {
+			b.log.WithError(err).Error("Could not decode GraphQL RPC request")
+			return
+		}
+
+		response := GraphQLResponse{ID: request.ID}
+		switch {
+		case b.sendAuth.authorize(request.Source, request.Secret) != nil:
+			b.log.WithField("source", request.Source).Warn("Rejected GraphQL RPC request from unauthorized sender")
+			err = errSendUnauthorized
+		case !allowMutations && isMutation(request.Query):
+			err = errMutationsDisabled
+		default:
+			// Passed through whole, so callers get all the errors and any partial data
+			var result GQLResponse
+			result, err = b.api.execute(ctx, request.Query, request.Variables)
+			response.Data, response.Errors = result.Data, result.Errors
+		}
+		if err != nil {
+			b.log.WithError(err).Error("GraphQL RPC request failed")
+			response.Data = nil
+			response.Errors = []GQLError{{Message: err.Error()}}
+		}
+		b.setJSON(responseKey, response)
+	})
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestIsMutation(t *testing.T) {
+	tests := map[string]bool{
+		`query { channel(id: 1) { id } }`:     false,
+		`{ mutation: channel(id: 1) { id } }`: false,
+		`# mutation
+		query { channel(id: 1) { id } }`: false,
+		`query($s: String = "mutation") { channel(id: 1) { id } }`: false,
+		`query($s: String = "\"mutation") { user { id } }`:         false,
+		`query($s: String = """mutation""") { user { id } }`:       false,
+		`mutation { sendChatMessage { id } }`:                      true,
+		`  mutation Send { sendChatMessage { id } }`:               true,
+		`query Q { user { id } } mutation M { ban { id } }`:        true,
+		`fragment F on User { id } mutation { ban { ...F } }`:      true,
+		`#comment
+		mutation { ban { id } }`: true,
+	}
+	for document, want := range tests {
+		if got := isMutation(document); got != want {
+			t.Errorf("isMutation(%q) = %v, want %v", document, got, want)
+		}
+	}
+}
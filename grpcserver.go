@@ -0,0 +1,112 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative proto/bridge.proto
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	jsoniter "github.com/json-iterator/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	bridgepb "github.com/ashkeel/glimesh-bridge/proto"
+)
+
+// grpcServer implements the Bridge gRPC service
+type grpcServer struct {
+	bridgepb.UnimplementedBridgeServer
+	bridge *Bridge
+}
+
+func (s *grpcServer) ChatEvents(_ *bridgepb.ChatEventsRequest, stream bridgepb.Bridge_ChatEventsServer) error {
+	events := s.bridge.events.subscribe()
+	defer s.bridge.events.unsubscribe(events)
+
+	for {
+		event, ok := events.next(stream.Context())
+		if !ok {
+			return nil
+		}
+		var out *bridgepb.ChatEvent
+		switch event.Name {
+		case "chat-message":
+			var msg ChatEvent
+			if jsoniter.ConfigFastest.Unmarshal(event.Payload, &msg) != nil {
+				continue
+			}
+			out = &bridgepb.ChatEvent{
+				Type:     bridgepb.ChatEvent_TYPE_MESSAGE,
+				Id:       msg.ID,
+				Message:  msg.Message,
+				UserId:   msg.User.ID,
+				Username: msg.User.Username,
+				Role:     msg.Role,
+			}
+		case "chat-message-deleted":
+			var retraction ChatMessageRetraction
+			if jsoniter.ConfigFastest.Unmarshal(event.Payload, &retraction) != nil {
+				continue
+			}
+			out = &bridgepb.ChatEvent{
+				Type:     bridgepb.ChatEvent_TYPE_DELETED,
+				Id:       retraction.ID,
+				UserId:   retraction.User.ID,
+				Username: retraction.User.Username,
+			}
+		default:
+			continue
+		}
+		if err := stream.Send(out); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *grpcServer) SendMessage(_ context.Context, req *bridgepb.SendMessageRequest) (*bridgepb.SendMessageResponse, error) {
+	if req.Message == "" {
+		return nil, status.Error(codes.InvalidArgument, "message is empty")
+	}
+	s.bridge.chat.send(ChatSendRequest{ID: req.Id, Message: req.Message, Source: "grpc"})
+	return &bridgepb.SendMessageResponse{}, nil
+}
+
+func (s *grpcServer) DeleteMessage(ctx context.Context, req *bridgepb.DeleteMessageRequest) (*bridgepb.DeleteMessageResponse, error) {
+	err := s.bridge.api.DeleteChatMessage(ctx, s.bridge.channelIDString(), req.Id)
+	s.bridge.audit.record(ModerationAuditEntry{
+		Action:    EscalationDelete,
+		By:        AuditByGRPC,
+		MessageID: req.Id,
+		Error:     errorString(err),
+	})
+	if errors.Is(err, ErrUnsupported) {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &bridgepb.DeleteMessageResponse{}, nil
+}
+
+// serveGRPC starts the gRPC API server
+func (b *Bridge) serveGRPC(ctx context.Context, addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		b.log.WithError(err).Fatal("Could not start gRPC server")
+	}
+	server := grpc.NewServer(b.grpcAuthOptions()...)
+	bridgepb.RegisterBridgeServer(server, &grpcServer{bridge: b})
+	// Free the address if serving panics, so the restarted server can listen on it
+	defer server.Stop()
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+	}()
+	b.log.WithField("addr", addr).Info("Starting gRPC server")
+	err = server.Serve(listener)
+	if err != nil {
+		b.log.WithError(err).Fatal("gRPC server stopped")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Parts of Glimesh the bridge depends on, which can fail independently
+const (
+	// HTTP GraphQL API (channel info, moderation, user lookups...)
+	ComponentAPI = "api"
+	// Websocket subscriptions (incoming chat, sending messages)
+	ComponentSubscriptions = "subscriptions"
+)
+
+// Overall status reported in the health key
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// Features turned off in read-only mode (no token)
+var readOnlyDisabled = []string{"chat-send", "moderation", "follow"}
+
+// Features turned off while the component they depend on is failing
+var healthFeatures = map[string][]string{
+	ComponentAPI:           {"channel-info", "user-profiles", "follower-role", "moderation", "subscriber-sync"},
+	ComponentSubscriptions: {"chat", "chat-send", "merged-chat"},
+}
+
+// ComponentHealth is the state of a single component
+type ComponentHealth struct {
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"`
+	Since time.Time `json:"since"`
+}
+
+// HealthStatus is written to the health key every time a component changes state
+type HealthStatus struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+	Disabled   []string                   `json:"disabled"`
+	// ReadOnly is set when the bridge is connected without a token and can't send to chat
+	ReadOnly bool `json:"read_only,omitempty"`
+	// Maintenance is set while automated responses, alerts and hooks are suppressed
+	Maintenance bool `json:"maintenance,omitempty"`
+}
+
+// healthTracker keeps track of which components are working, so a partial outage
+// disables the affected features instead of stopping the whole bridge
+type healthTracker struct {
+	bridge *Bridge
+	key    string
+
+	mu         sync.Mutex
+	components map[string]ComponentHealth
+}
+
+func (b *Bridge) newHealthTracker() *healthTracker {
+	now := time.Now()
+	tracker := &healthTracker{bridge: b, key: b.key("health"), components: make(map[string]ComponentHealth)}
+	for component := range healthFeatures {
+		tracker.components[component] = ComponentHealth{OK: true, Since: now}
+	}
+	tracker.publish()
+	return tracker
+}
+
+// report records the outcome of an operation on a component, publishing
+// the health status if the component changed state
+func (h *healthTracker) report(component string, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	h.mu.Lock()
+	current := h.components[component]
+	if current.OK == (err == nil) {
+		h.mu.Unlock()
+		return
+	}
+	updated := ComponentHealth{OK: err == nil, Since: time.Now()}
+	if err != nil {
+		updated.Error = err.Error()
+	}
+	h.components[component] = updated
+	h.mu.Unlock()
+
+	logger := h.bridge.log.WithField("component", component)
+	if err != nil {
+		logger.WithError(err).WithField("disabled", healthFeatures[component]).Warn("Glimesh component is failing, disabling the features that depend on it")
+	} else {
+		logger.Info("Glimesh component recovered")
+	}
+	h.publish()
+}
+
+func (h *healthTracker) healthy(component string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.components[component].OK
+}
+
+func (h *healthTracker) status() HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := HealthStatus{Status: HealthOK, Components: make(map[string]ComponentHealth), Disabled: []string{}, ReadOnly: h.bridge.readOnly, Maintenance: h.bridge.inMaintenance()}
+	if h.bridge.readOnly {
+		status.Disabled = append(status.Disabled, readOnlyDisabled...)
+	}
+	failing := 0
+	for component, state := range h.components {
+		status.Components[component] = state
+		if !state.OK {
+			failing++
+			status.Disabled = append(status.Disabled, healthFeatures[component]...)
+		}
+	}
+	sort.Strings(status.Disabled)
+	// Features can be disabled for more than one reason
+	unique := status.Disabled[:0]
+	for i, feature := range status.Disabled {
+		if i == 0 || feature != status.Disabled[i-1] {
+			unique = append(unique, feature)
+		}
+	}
+	status.Disabled = unique
+	switch {
+	case failing == len(h.components):
+		status.Status = HealthDown
+	case failing > 0:
+		status.Status = HealthDegraded
+	}
+	return status
+}
+
+func (h *healthTracker) publish() {
+	h.bridge.setJSON(h.key, h.status())
+}
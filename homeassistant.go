@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// How often the stream state sensors are refreshed
+const homeAssistantStateInterval = 30 * time.Second
+
+// HomeAssistantOptions configures the Home Assistant MQTT integration
+type HomeAssistantOptions struct {
+	// Broker URL (eg. tcp://localhost:1883) and credentials
+	URL      string
+	Username string
+	Password string
+	// Prefix Home Assistant watches for discovery messages (usually "homeassistant")
+	DiscoveryPrefix string
+	// Prefix of the bridge state, event and command topics
+	TopicPrefix string
+	// Events exposed as device triggers (eg. "alert" for ev/alert)
+	Triggers []string
+}
+
+// haDevice groups all the entities of the bridge in a single Home Assistant device
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// haEntity is the discovery config of an entity or device trigger
+type haEntity struct {
+	Name              string   `json:"name,omitempty"`
+	UniqueID          string   `json:"unique_id,omitempty"`
+	Device            haDevice `json:"device"`
+	AvailabilityTopic string   `json:"availability_topic,omitempty"`
+	StateTopic        string   `json:"state_topic,omitempty"`
+	CommandTopic      string   `json:"command_topic,omitempty"`
+	ValueTemplate     string   `json:"value_template,omitempty"`
+	Icon              string   `json:"icon,omitempty"`
+	UnitOfMeasurement string   `json:"unit_of_measurement,omitempty"`
+	// Device triggers only
+	AutomationType string `json:"automation_type,omitempty"`
+	Topic          string `json:"topic,omitempty"`
+	Type           string `json:"type,omitempty"`
+	Subtype        string `json:"subtype,omitempty"`
+}
+
+type homeAssistant struct {
+	bridge  *Bridge
+	client  mqtt.Client
+	options HomeAssistantOptions
+	node    string
+	device  haDevice
+}
+
+func (h *homeAssistant) topic(parts ...string) string {
+	return h.options.TopicPrefix + "/" + strings.Join(parts, "/")
+}
+
+func (h *homeAssistant) publish(topic string, retained bool, payload interface{}) {
+	var byt []byte
+	switch value := payload.(type) {
+	case string:
+		byt = []byte(value)
+	case []byte:
+		byt = value
+	default:
+		var err error
+		if byt, err = jsoniter.ConfigFastest.Marshal(payload); err != nil {
+			h.bridge.log.WithError(err).WithField("topic", topic).Error("Could not encode MQTT payload")
+			return
+		}
+	}
+	token := h.client.Publish(topic, 1, retained, byt)
+	go func() {
+		if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+			h.bridge.log.WithError(token.Error()).WithField("topic", topic).Warn("Could not publish to MQTT")
+		}
+	}()
+}
+
+// announce publishes the discovery configs and subscribes to the command topics, on every (re)connection
+func (h *homeAssistant) announce() {
+	status := h.topic("status")
+	entity := func(component string, id string, config haEntity) {
+		config.UniqueID = h.node + "_" + id
+		config.Device = h.device
+		config.AvailabilityTopic = status
+		h.publish(fmt.Sprintf("%s/%s/%s/%s/config", h.options.DiscoveryPrefix, component, h.node, id), true, config)
+	}
+	entity("binary_sensor", "live", haEntity{Name: "Live", StateTopic: h.topic("live"), Icon: "mdi:broadcast"})
+	entity("sensor", "viewers", haEntity{Name: "Viewers", StateTopic: h.topic("viewers"), Icon: "mdi:eye", UnitOfMeasurement: "viewers"})
+	entity("sensor", "last_alert", haEntity{Name: "Last alert", StateTopic: h.topic("event", "alert"), ValueTemplate: "{{ value_json.type }}: {{ value_json.username }}", Icon: "mdi:bell"})
+	entity("button", "marker", haEntity{Name: "Add stream marker", CommandTopic: h.topic("marker", "set"), Icon: "mdi:bookmark"})
+	entity("text", "chat", haEntity{Name: "Send chat message", CommandTopic: h.topic("chat", "set"), Icon: "mdi:chat"})
+	for _, event := range h.options.Triggers {
+		h.publish(fmt.Sprintf("%s/device_automation/%s/%s/config", h.options.DiscoveryPrefix, h.node, strings.ReplaceAll(event, "-", "_")), true, haEntity{
+			AutomationType: "trigger",
+			Topic:          h.topic("event", event),
+			Type:           "glimesh_event",
+			Subtype:        event,
+			Device:         h.device,
+		})
+	}
+	h.publish(status, true, "online")
+	h.publishState()
+
+	h.client.Subscribe(h.topic("marker", "set"), 1, func(_ mqtt.Client, message mqtt.Message) {
+		if h.bridge.markers != nil {
+			h.bridge.markers.add("", "home-assistant", false)
+		}
+	})
+	h.client.Subscribe(h.topic("chat", "set"), 1, func(_ mqtt.Client, message mqtt.Message) {
+		text := strings.TrimSpace(string(message.Payload()))
+		if text != "" {
+			h.bridge.chat.send(ChatSendRequest{Message: text, Source: "home-assistant"})
+		}
+	})
+}
+
+// publishState refreshes the stream state sensors
+func (h *homeAssistant) publishState() {
+	live := "OFF"
+	if _, ok := h.bridge.session.liveSince(); ok {
+		live = "ON"
+	}
+	viewers := 0
+	if info, ok := h.bridge.channelInfo(); ok && info.Stream != nil {
+		viewers = info.Stream.CountViewers
+	}
+	h.publish(h.topic("live"), true, live)
+	h.publish(h.topic("viewers"), true, strconv.Itoa(viewers))
+}
+
+// runHomeAssistant connects to an MQTT broker, announces the bridge to Home Assistant with MQTT
+// discovery and publishes every event to <topic prefix>/event/<event>
+func (b *Bridge) runHomeAssistant(ctx context.Context, options HomeAssistantOptions) error {
+	node := "glimesh_bridge_" + b.channelIDString()
+	h := &homeAssistant{
+		bridge:  b,
+		options: options,
+		node:    node,
+		device:  haDevice{Identifiers: []string{node}, Name: "Glimesh channel " + b.channelIDString(), Manufacturer: "glimesh-bridge", Model: "Glimesh bridge"},
+	}
+	if info, ok := b.channelInfo(); ok {
+		h.device.Name = "Glimesh " + info.Streamer.Displayname
+	}
+
+	clientOptions := mqtt.NewClientOptions().
+		AddBroker(options.URL).
+		SetClientID(node).
+		SetUsername(options.Username).
+		SetPassword(options.Password).
+		SetAutoReconnect(true).
+		SetWill(h.topic("status"), "offline", 1, true).
+		SetOnConnectHandler(func(mqtt.Client) {
+			b.log.Info("Connected to MQTT broker")
+			go h.announce()
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			b.log.WithError(err).Warn("Disconnected from MQTT broker")
+		})
+	h.client = mqtt.NewClient(clientOptions)
+	token := h.client.Connect()
+	if !token.WaitTimeout(30 * time.Second) {
+		return fmt.Errorf("timed out connecting to %s", options.URL)
+	}
+	if err := token.Error(); err != nil {
+		return err
+	}
+
+	b.goSafe(ctx, "home-assistant-state", func(ctx context.Context) {
+		ticker := time.NewTicker(homeAssistantStateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.publishState()
+			}
+		}
+	})
+
+	b.goSafe(ctx, "home-assistant", func(ctx context.Context) {
+		events := b.events.subscribe()
+		defer b.events.unsubscribe(events)
+		for {
+			event, ok := events.next(ctx)
+			if !ok {
+				// Publish the offline status now, the will is only sent by the broker on unclean disconnections
+				h.client.Publish(h.topic("status"), 1, true, "offline").WaitTimeout(time.Second)
+				h.client.Disconnect(250)
+				return
+			}
+			h.publish(h.topic("event", event.Name), false, event.Payload)
+			if event.Name == "session-started" || event.Name == "session-ended" {
+				h.publishState()
+			}
+		}
+	})
+	return nil
+}
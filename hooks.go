@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	webhookTimeout = 10 * time.Second
+	// Default time limit for commands run by hooks
+	execTimeout = 30 * time.Second
+	// Live hooks are skipped if the stream started longer than this ago,
+	// so restarting the bridge mid-stream doesn't announce it again
+	liveHookMaxDelay = 15 * time.Minute
+	// Maximum number of webhooks, commands and OBS actions running at once, more are dropped
+	// (eg. an exec hook on every chat message during a raid)
+	maxRunningHooks = 16
+)
+
+// HookAction is a single action run by a hook, only one of its fields should be set.
+// Chat messages, key values and webhook bodies can use templates.
+// Webhooks and commands receive the event (or stream info, for live hooks) as JSON.
+type HookAction struct {
+	// Chat sends a chat message
+	Chat string `json:"chat,omitempty"`
+	// SetKey writes Value to a Kilovolt key (eg. to trigger a scene change)
+	SetKey string `json:"set_key,omitempty"`
+	Value  string `json:"value,omitempty"`
+	// Trigger writes Value (default "true") to triggers/<name> under the prefix, then
+	// Reset (default "false") after DurationSeconds (default 5)
+	Trigger         string  `json:"trigger,omitempty"`
+	Reset           *string `json:"reset,omitempty"`
+	DurationSeconds int     `json:"duration_seconds,omitempty"`
+	// OBS switches scene, shows/hides a source or sets a text source (requires -obs-url)
+	OBS *OBSAction `json:"obs,omitempty"`
+	// Webhook POSTs Body to a URL, or the event JSON if Body is empty
+	Webhook string `json:"webhook,omitempty"`
+	Body    string `json:"body,omitempty"`
+	// Exec runs a local command (program and arguments) with the event JSON on stdin
+	Exec           []string `json:"exec,omitempty"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+}
+
+// HooksConfig lists the actions to run on stream status changes and events
+type HooksConfig struct {
+	OnLive    []HookAction `json:"on_live"`
+	OnOffline []HookAction `json:"on_offline"`
+	// OnEvent maps event names (eg. "chat-message" for ev/chat-message) to actions
+	OnEvent map[string][]HookAction `json:"on_event"`
+	// OnCommand maps chat commands (without the ! prefix) to actions, commands handled
+	// by the bridge itself (eg. !join) take precedence
+	OnCommand map[string]CommandHook `json:"on_command"`
+}
+
+// CommandHook is a chat command defined by the hooks file, the command arguments are
+// available in templates as {{.Vars.args}}
+type CommandHook struct {
+	// Only users with this role or higher can use the command (anyone if empty)
+	Role    string       `json:"role"`
+	Actions []HookAction `json:"actions"`
+}
+
+func loadHooks(path string) (*HooksConfig, error) {
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hooks HooksConfig
+	err = jsoniter.ConfigFastest.Unmarshal(byt, &hooks)
+	if err != nil {
+		return nil, err
+	}
+	return &hooks, nil
+}
+
+// runHooks runs a list of actions, webhooks and commands are run in the background
+func (b *Bridge) runHooks(ctx context.Context, actions []HookAction, payload []byte) {
+	b.runHooksWith(ctx, actions, payload, b.templateData(""))
+}
+
+// runHooksWith runs a list of actions, rendering their templates with data.
+// No actions are run in maintenance mode.
+func (b *Bridge) runHooksWith(ctx context.Context, actions []HookAction, payload []byte, data TemplateData) {
+	if len(actions) > 0 && b.inMaintenance() {
+		b.log.WithField("actions", len(actions)).Debug("Maintenance mode, not running hooks")
+		return
+	}
+	render := func(text string) string {
+		out, err := b.renderTemplate(text, data)
+		if err != nil {
+			b.log.WithError(err).Error("Could not render hook template")
+		}
+		return out
+	}
+
+	for _, action := range actions {
+		switch {
+		case action.Chat != "":
+			b.chat.send(ChatSendRequest{Message: render(action.Chat), Raw: true, Source: "hooks"})
+		case action.SetKey != "":
+			err := b.kv.SetKey(action.SetKey, render(action.Value))
+			if err != nil {
+				b.log.WithError(err).WithField("key", action.SetKey).Error("Could not set hook key")
+			}
+		case action.Trigger != "":
+			value, reset, duration := defaultTriggerValue, defaultTriggerReset, defaultTriggerDuration
+			if action.Value != "" {
+				value = render(action.Value)
+			}
+			if action.Reset != nil {
+				reset = render(*action.Reset)
+			}
+			if action.DurationSeconds > 0 {
+				duration = time.Duration(action.DurationSeconds) * time.Second
+			}
+			b.triggers.fire(action.Trigger, value, reset, duration)
+		case action.OBS != nil:
+			if b.obs == nil {
+				b.log.Warn("Skipping OBS hook action, OBS is not configured (-obs-url)")
+				continue
+			}
+			obsAction := *action.OBS
+			b.startHook("obs", func() {
+				if err := b.obs.runAction(ctx, obsAction, render); err != nil {
+					b.log.WithError(err).Error("OBS hook action failed")
+				}
+			})
+		case action.Webhook != "":
+			body := string(payload)
+			if action.Body != "" {
+				body = render(action.Body)
+			}
+			url := action.Webhook
+			b.startHook("webhook", func() {
+				b.sendWebhook(ctx, url, body)
+			})
+		case len(action.Exec) > 0:
+			timeout := execTimeout
+			if action.TimeoutSeconds > 0 {
+				timeout = time.Duration(action.TimeoutSeconds) * time.Second
+			}
+			command := action.Exec
+			b.startHook("exec", func() {
+				b.runCommand(ctx, command, payload, timeout)
+			})
+		}
+	}
+}
+
+// startHook runs a hook action in the background, unless too many are already running
+func (b *Bridge) startHook(kind string, run func()) {
+	if atomic.AddInt64(&b.runningHooks, 1) > maxRunningHooks {
+		atomic.AddInt64(&b.runningHooks, -1)
+		b.log.WithField("action", kind).Warn("Too many hook actions running, dropping one")
+		return
+	}
+	go func() {
+		defer atomic.AddInt64(&b.runningHooks, -1)
+		run()
+	}()
+}
+
+func (b *Bridge) sendWebhook(ctx context.Context, url string, body string) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		b.log.WithError(err).Error("Could not create webhook request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		b.log.WithError(err).Error("Could not send webhook")
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		b.log.WithField("status", res.StatusCode).Error("Webhook returned an error")
+	}
+}
+
+// runCommand runs a local command with payload on stdin, killing it after timeout
+func (b *Bridge) runCommand(ctx context.Context, command []string, payload []byte, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		b.log.WithError(err).WithField("command", command[0]).WithField("output", string(output)).Error("Hook command failed")
+		return
+	}
+	b.log.WithField("command", command[0]).Debug("Hook command completed")
+}
+
+// runEventHooks runs the actions configured for an event, if any
+func (b *Bridge) runEventHooks(event string, payload []byte) {
+	hooks := b.currentHooks()
+	if hooks == nil {
+		return
+	}
+	actions := hooks.OnEvent[event]
+	if len(actions) > 0 {
+		b.runHooks(b.ctx, actions, payload)
+	}
+}
+
+// runCommandHooks runs the actions of the hook command in msg, if any
+func (b *Bridge) runCommandHooks(msg ChatMessage) {
+	hooks := b.currentHooks()
+	if hooks == nil {
+		return
+	}
+	name, args := parseCommand(msg.Message)
+	command, ok := hooks.OnCommand[name]
+	if !ok || name == "" {
+		return
+	}
+	if command.Role != "" && !roleAtLeast(b.chatRole(msg), command.Role) {
+		return
+	}
+	payload, err := jsoniter.ConfigFastest.Marshal(msg)
+	if err != nil {
+		return
+	}
+	data := b.templateData(msg.User.Username)
+	data.Vars = map[string]interface{}{"args": args}
+	b.runHooksWith(b.ctx, command.Actions, payload, data)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPServerOptions are the settings shared by all the endpoints of the embedded HTTP server
+type HTTPServerOptions struct {
+	Addr string
+	// CORS lists the origins allowed to make cross-origin requests
+	CORS corsOrigins
+	// TLS certificate and key files, the server uses plain HTTP if unset
+	CertFile string
+	KeyFile  string
+	// SelfSigned generates a certificate if the files above don't exist (or aren't set)
+	SelfSigned bool
+}
+
+// serveHTTP starts the embedded HTTP server for all the endpoints registered on the bridge mux
+func (b *Bridge) serveHTTP(ctx context.Context, options HTTPServerOptions) {
+	server := &http.Server{
+		Addr: options.Addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if options.CORS.apply(w, r) {
+				return
+			}
+			b.mux.ServeHTTP(w, r)
+		}),
+		ConnState: func(conn net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateNew:
+				atomic.AddInt64(&b.httpConns, 1)
+			case http.StateHijacked, http.StateClosed:
+				atomic.AddInt64(&b.httpConns, -1)
+			}
+		},
+	}
+
+	// Free the address if serving panics, so the restarted server can listen on it
+	defer server.Close()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	var err error
+	if options.SelfSigned {
+		server.TLSConfig, err = selfSignedTLSConfig(options.Addr, options.CertFile, options.KeyFile)
+		if err != nil {
+			b.log.WithError(err).Fatal("Could not create self-signed certificate")
+		}
+		options.CertFile, options.KeyFile = "", ""
+	}
+
+	logger := b.log.WithField("addr", options.Addr)
+	if server.TLSConfig != nil || options.CertFile != "" {
+		logger.Info("Starting HTTPS server")
+		err = server.ListenAndServeTLS(options.CertFile, options.KeyFile)
+	} else {
+		logger.Info("Starting HTTP server")
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		b.log.WithError(err).Fatal("HTTP server stopped")
+	}
+}
+
+// selfSignedTLSConfig loads the certificate at certFile/keyFile, generating a new self-signed one
+// if they don't exist. Generated certificates are saved there (if set), so browsers only need
+// to trust them once.
+func selfSignedTLSConfig(addr string, certFile string, keyFile string) (*tls.Config, error) {
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err == nil {
+			return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"glimesh-bridge"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(5, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "localhost" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	if certFile != "" && keyFile != "" {
+		err = os.WriteFile(certFile, certPEM, 0644)
+		if err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(keyFile, keyPEM, 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// corsOrigins is a list of origins allowed to make cross-origin requests ("*" allows any)
+type corsOrigins []string
+
+func (c corsOrigins) allowed(origin string) bool {
+	for _, allowed := range c {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply adds the CORS headers for allowed origins, returning true if the request
+// was a preflight request that has been fully handled
+func (c corsOrigins) apply(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || !c.allowed(origin) {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Add("Vary", "Origin")
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+	}
+	w.Header().Set("Access-Control-Max-Age", "600")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
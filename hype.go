@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Glimesh emotes are written as :name:
+var emoteRegex = regexp.MustCompile(`:[a-zA-Z0-9_]+:`)
+
+// HypeScore summarizes chat excitement over a time window.
+// Score is messages per minute, boosted by emote density and caps ratio.
+type HypeScore struct {
+	Score             float64   `json:"score"`
+	MessagesPerMinute float64   `json:"messages_per_minute"`
+	EmoteDensity      float64   `json:"emote_density"`
+	CapsRatio         float64   `json:"caps_ratio"`
+	WindowSeconds     int       `json:"window_seconds"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// hypeTracker accumulates message stats for the current window
+type hypeTracker struct {
+	window time.Duration
+
+	mu       sync.Mutex
+	messages int
+	emotes   int
+	letters  int
+	upper    int
+}
+
+func (t *hypeTracker) record(msg ChatMessage) {
+	emotes := emoteRegex.FindAllStringIndex(msg.Message, -1)
+	// Don't count letters in emote names towards the caps ratio
+	text := emoteRegex.ReplaceAllString(msg.Message, "")
+
+	letters, upper := 0, 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages++
+	t.emotes += len(emotes)
+	t.letters += letters
+	t.upper += upper
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// flush computes the score for the window that just ended and starts a new one
+func (t *hypeTracker) flush(now time.Time) HypeScore {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	score := HypeScore{WindowSeconds: int(t.window.Seconds()), UpdatedAt: now}
+	if t.messages > 0 {
+		score.MessagesPerMinute = float64(t.messages) / t.window.Minutes()
+		score.EmoteDensity = float64(t.emotes) / float64(t.messages)
+		if t.letters > 0 {
+			score.CapsRatio = float64(t.upper) / float64(t.letters)
+		}
+		score.Score = score.MessagesPerMinute * (1 + score.EmoteDensity) * (1 + score.CapsRatio)
+	}
+	score.Score = round2(score.Score)
+	score.MessagesPerMinute = round2(score.MessagesPerMinute)
+	score.EmoteDensity = round2(score.EmoteDensity)
+	score.CapsRatio = round2(score.CapsRatio)
+
+	t.messages, t.emotes, t.letters, t.upper = 0, 0, 0, 0
+	return score
+}
+
+// publishHype publishes the hype score at the end of every window
+func (b *Bridge) publishHype(ctx context.Context) {
+	key := b.key("hype")
+	ticker := time.NewTicker(b.hype.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			b.setJSON(key, b.hype.flush(now))
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	kvclient "github.com/strimertul/kilovolt-client-go/v6"
+)
+
+const (
+	// Requests to Kilovolt taking longer than this mark the endpoint as disconnected
+	kvRequestTimeout = 5 * time.Second
+	// How often connected endpoints are checked
+	kvHealthCheckInterval = 15 * time.Second
+	// Maximum delay between reconnection attempts
+	kvMaxReconnectDelay = 30 * time.Second
+)
+
+var (
+	errKVTimeout      = fmt.Errorf("%w: kilovolt request timed out", ErrDisconnected)
+	errKVDisconnected = fmt.Errorf("%w: no kilovolt endpoint connected", ErrDisconnected)
+)
+
+// kvEndpoint is a single Kilovolt server, reconnected independently from the others
+type kvEndpoint struct {
+	url      string
+	password string
+	log      logrus.FieldLogger
+
+	mu     sync.RWMutex
+	client *kvclient.Client
+	// Closed when the current connection is dropped, stops its subscription forwarders
+	done chan struct{}
+}
+
+func (e *kvEndpoint) current() *kvclient.Client {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.client
+}
+
+// drop closes the current connection, the supervisor will reconnect
+func (e *kvEndpoint) drop(client *kvclient.Client, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client != client || client == nil {
+		return
+	}
+	e.log.WithError(err).Warn("Lost connection to Kilovolt")
+	_ = client.Close()
+	close(e.done)
+	e.client = nil
+}
+
+// withTimeout runs a Kilovolt request, giving up after kvRequestTimeout
+// (the client waits forever for replies on dead connections)
+func withTimeout(fn func() error) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- fn()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(kvRequestTimeout):
+		return errKVTimeout
+	}
+}
+
+// multiStore writes keys to one or more Kilovolt endpoints, reading from the first connected one
+// and merging subscriptions from all of them
+type multiStore struct {
+	// Number of times an endpoint was reconnected, first so it's 64-bit aligned for atomic operations
+	reconnects uint64
+	log        logrus.FieldLogger
+	endpoints  []*kvEndpoint
+
+	mu            sync.Mutex
+	subscriptions map[string][]chan kvclient.KeyValuePair
+}
+
+// newMultiStore connects to all the endpoints, failing only if none is reachable.
+// Passwords can be set per endpoint in the URL (http://:password@host/ws), defaulting to password.
+func newMultiStore(ctx context.Context, endpoints []string, password string, log logrus.FieldLogger) (*multiStore, error) {
+	store := &multiStore{log: log, subscriptions: make(map[string][]chan kvclient.KeyValuePair)}
+	connected := false
+	var lastErr error
+	for _, endpoint := range endpoints {
+		uri, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		ep := &kvEndpoint{password: password}
+		if uri.User != nil {
+			if secret, ok := uri.User.Password(); ok {
+				ep.password = secret
+			}
+			uri.User = nil
+		}
+		ep.url = uri.String()
+		ep.log = log.WithField("endpoint", ep.url)
+		store.endpoints = append(store.endpoints, ep)
+
+		if err := store.connect(ctx, ep); err != nil {
+			if _, ok := err.(kvProtocolError); ok {
+				// Retrying won't help, the user has to update something
+				return nil, err
+			}
+			ep.log.WithError(err).Warn("Could not connect to Kilovolt, will retry")
+			lastErr = err
+		} else {
+			connected = true
+		}
+	}
+	if !connected {
+		return nil, lastErr
+	}
+	for _, ep := range store.endpoints {
+		go store.supervise(ctx, ep)
+	}
+	return store, nil
+}
+
+func (m *multiStore) connect(ctx context.Context, ep *kvEndpoint) error {
+	err := checkKVVersion(ctx, ep.url)
+	if err != nil {
+		return err
+	}
+	client, err := kvclient.NewClient(ep.url, kvclient.ClientOptions{Password: ep.password, Logger: ep.log})
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+
+	// Subscribe to all the keys the bridge is interested in
+	m.mu.Lock()
+	keys := make([]string, 0, len(m.subscriptions))
+	for key := range m.subscriptions {
+		keys = append(keys, key)
+	}
+	m.mu.Unlock()
+	for _, key := range keys {
+		err := m.subscribeEndpoint(client, done, key)
+		if err != nil {
+			_ = client.Close()
+			return err
+		}
+	}
+
+	ep.mu.Lock()
+	ep.client = client
+	ep.done = done
+	ep.mu.Unlock()
+	ep.log.Info("Connected to Kilovolt")
+	return nil
+}
+
+// supervise checks the endpoint periodically, reconnecting it with backoff when needed
+func (m *multiStore) supervise(ctx context.Context, ep *kvEndpoint) {
+	delay := time.Second
+	for {
+		wait := kvHealthCheckInterval
+		client := ep.current()
+		if client == nil {
+			if err := m.connect(ctx, ep); err != nil {
+				if _, ok := err.(kvProtocolError); ok {
+					ep.log.WithError(err).Error("Incompatible Kilovolt server, giving up on this endpoint")
+					return
+				}
+				ep.log.WithError(err).Debug("Could not reconnect to Kilovolt")
+				wait = delay
+				delay *= 2
+				if delay > kvMaxReconnectDelay {
+					delay = kvMaxReconnectDelay
+				}
+			} else {
+				delay = time.Second
+				atomic.AddUint64(&m.reconnects, 1)
+			}
+		} else {
+			err := withTimeout(func() error {
+				_, err := client.ListKeys("__glimesh_bridge_healthcheck")
+				return err
+			})
+			if err != nil {
+				ep.drop(client, err)
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// subscribeEndpoint forwards updates of key from a connection to the bridge subscribers
+func (m *multiStore) subscribeEndpoint(client *kvclient.Client, done chan struct{}, key string) error {
+	var incoming chan kvclient.KeyValuePair
+	err := withTimeout(func() error {
+		var err error
+		incoming, err = client.SubscribeKey(key)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case kv := <-incoming:
+				m.mu.Lock()
+				subscribers := m.subscriptions[kv.Key]
+				m.mu.Unlock()
+				for _, ch := range subscribers {
+					ch <- kv
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *multiStore) GetKey(key string) (string, error) {
+	var value string
+	err := m.read(func(client *kvclient.Client) error {
+		var err error
+		value, err = client.GetKey(key)
+		return err
+	})
+	return value, err
+}
+
+func (m *multiStore) GetJSON(key string, dst interface{}) error {
+	return m.read(func(client *kvclient.Client) error {
+		return client.GetJSON(key, dst)
+	})
+}
+
+// read runs a request on the first connected endpoint
+func (m *multiStore) read(fn func(client *kvclient.Client) error) error {
+	for _, ep := range m.endpoints {
+		client := ep.current()
+		if client == nil {
+			continue
+		}
+		var reqErr error
+		err := withTimeout(func() error {
+			reqErr = fn(client)
+			return nil
+		})
+		if err != nil {
+			ep.drop(client, err)
+			continue
+		}
+		return reqErr
+	}
+	return errKVDisconnected
+}
+
+// SetKey writes a key to all connected endpoints, succeeding if at least one write did
+func (m *multiStore) SetKey(key string, data string) error {
+	lastErr := errKVDisconnected
+	written := false
+	for _, ep := range m.endpoints {
+		client := ep.current()
+		if client == nil {
+			continue
+		}
+		err := withTimeout(func() error {
+			return client.SetKey(key, data)
+		})
+		if err != nil {
+			if err == errKVTimeout {
+				ep.drop(client, err)
+			}
+			lastErr = err
+			continue
+		}
+		written = true
+	}
+	if written {
+		return nil
+	}
+	return lastErr
+}
+
+// SubscribeKey returns a channel receiving the updates to key from any endpoint
+func (m *multiStore) SubscribeKey(key string) (chan kvclient.KeyValuePair, error) {
+	ch := make(chan kvclient.KeyValuePair, 10)
+	m.mu.Lock()
+	_, existing := m.subscriptions[key]
+	m.subscriptions[key] = append(m.subscriptions[key], ch)
+	m.mu.Unlock()
+	if existing {
+		return ch, nil
+	}
+
+	for _, ep := range m.endpoints {
+		ep.mu.RLock()
+		client, done := ep.client, ep.done
+		ep.mu.RUnlock()
+		if client == nil {
+			continue
+		}
+		err := m.subscribeEndpoint(client, done, key)
+		if err != nil {
+			ep.drop(client, err)
+		}
+	}
+	return ch, nil
+}
+
+// close disconnects from all the endpoints
+func (m *multiStore) close() {
+	for _, ep := range m.endpoints {
+		ep.mu.Lock()
+		if ep.client != nil {
+			_ = ep.client.Close()
+			close(ep.done)
+			ep.client = nil
+		}
+		ep.mu.Unlock()
+	}
+}
+
+// connectedCount returns how many endpoints are currently connected
+func (m *multiStore) connectedCount() int {
+	count := 0
+	for _, ep := range m.endpoints {
+		if ep.current() != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// reconnectCount returns how many times endpoints were reconnected after losing their connection
+func (m *multiStore) reconnectCount() uint64 {
+	return atomic.LoadUint64(&m.reconnects)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+
+	kvclient "github.com/strimertul/kilovolt-client-go/v6"
+)
+
+var errKeyNotFound = errors.New("key not found")
+
+// memorySubscriberBuffer is how many updates a memory store subscriber can fall behind before they're dropped
+const memorySubscriberBuffer = 10
+
+// kvStore is the subset of the Kilovolt client used by the bridge
+type kvStore interface {
+	GetKey(key string) (string, error)
+	GetJSON(key string, dst interface{}) error
+	SetKey(key string, data string) error
+	SubscribeKey(key string) (chan kvclient.KeyValuePair, error)
+}
+
+// memoryStore is an in-memory kvStore, used when running without Kilovolt
+// so the bridge keeps working with its other outputs
+type memoryStore struct {
+	mu          sync.RWMutex
+	log         logrus.FieldLogger
+	data        map[string]string
+	subscribers map[string][]chan kvclient.KeyValuePair
+}
+
+func newMemoryStore(log logrus.FieldLogger) *memoryStore {
+	return &memoryStore{
+		log:         log,
+		data:        make(map[string]string),
+		subscribers: make(map[string][]chan kvclient.KeyValuePair),
+	}
+}
+
+func (m *memoryStore) GetKey(key string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.data[key], nil
+}
+
+func (m *memoryStore) GetJSON(key string, dst interface{}) error {
+	m.mu.RLock()
+	value, ok := m.data[key]
+	m.mu.RUnlock()
+	if !ok {
+		return errKeyNotFound
+	}
+	return jsoniter.ConfigFastest.UnmarshalFromString(value, dst)
+}
+
+func (m *memoryStore) SetKey(key string, data string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = data
+
+	// Queued under the lock so subscribers get the updates in order, without blocking the writer
+	for _, ch := range m.subscribers[key] {
+		select {
+		case ch <- kvclient.KeyValuePair{Key: key, Value: data}:
+		default:
+			m.log.WithField("key", key).Warn("Memory store subscriber is falling behind, dropped update")
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) SubscribeKey(key string) (chan kvclient.KeyValuePair, error) {
+	ch := make(chan kvclient.KeyValuePair, memorySubscriberBuffer)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribers[key] = append(m.subscribers[key], ch)
+	return ch, nil
+}
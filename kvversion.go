@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"nhooyr.io/websocket"
+)
+
+// Kilovolt protocol version spoken by the kilovolt-client-go version we use
+const kvProtocolVersion = 6
+
+// kvProtocolError is returned when the Kilovolt server speaks an incompatible protocol version
+type kvProtocolError struct {
+	Server string
+}
+
+func (e kvProtocolError) Error() string {
+	version, _ := parseKVVersion(e.Server)
+	if version > kvProtocolVersion {
+		return fmt.Sprintf("Kilovolt server uses protocol %s but this bridge only supports v%d, update glimesh-bridge to a build matching your strimertul version", e.Server, kvProtocolVersion)
+	}
+	return fmt.Sprintf("Kilovolt server uses protocol %s but this bridge requires v%d, update strimertul (or the Kilovolt server) to a newer version", e.Server, kvProtocolVersion)
+}
+
+func parseKVVersion(version string) (int, error) {
+	major := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 2)[0]
+	return strconv.Atoi(major)
+}
+
+// kvServerVersion connects to a Kilovolt server and returns the protocol version it reports,
+// either in the hello message or as reply to the version command (for servers not sending hello)
+func kvServerVersion(ctx context.Context, endpoint string) (string, error) {
+	uri, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if uri.Scheme == "https" {
+		uri.Scheme = "wss"
+	} else {
+		uri.Scheme = "ws"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, kvRequestTimeout)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, uri.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	err = conn.Write(ctx, websocket.MessageText, []byte(`{"command":"version","request_id":"version-check"}`))
+	if err != nil {
+		return "", err
+	}
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			return "", err
+		}
+		var message struct {
+			Type      string      `json:"type"`
+			Version   string      `json:"version"`
+			RequestID string      `json:"request_id"`
+			Ok        bool        `json:"ok"`
+			Data      interface{} `json:"data"`
+		}
+		if jsoniter.ConfigFastest.Unmarshal(data, &message) != nil {
+			continue
+		}
+		switch {
+		case message.Type == "hello" && message.Version != "":
+			return message.Version, nil
+		case message.RequestID == "version-check":
+			if version, ok := message.Data.(string); ok && message.Ok {
+				return version, nil
+			}
+			return "", fmt.Errorf("unexpected reply to version command: %s", data)
+		}
+	}
+}
+
+// checkKVVersion makes sure the server at endpoint speaks a protocol version we support
+func checkKVVersion(ctx context.Context, endpoint string) error {
+	server, err := kvServerVersion(ctx, endpoint)
+	if err != nil {
+		return fmt.Errorf("could not detect Kilovolt protocol version: %w", err)
+	}
+	version, err := parseKVVersion(server)
+	if err != nil || version != kvProtocolVersion {
+		return kvProtocolError{Server: server}
+	}
+	return nil
+}
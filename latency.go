@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Stages of the incoming chat pipeline, in order
+const (
+	// Decoding the frame and the subscription payload
+	StageDecode = "decode"
+	// Waiting for the main loop to pick up the message
+	StageQueue = "queue"
+	// Sanitizing, role lookup, moderation heuristics and enrichment
+	StageFilter = "filter"
+	// Writing the chat message event to Kilovolt (and running sinks, hooks and plugins)
+	StageKVWrite = "kv-write"
+)
+
+// pipelineTiming records when an incoming chat message went through each stage
+type pipelineTiming struct {
+	received  time.Time
+	decoded   time.Time
+	dequeued  time.Time
+	filtered  time.Time
+	published time.Time
+}
+
+func (t pipelineTiming) stages() map[string]time.Duration {
+	return map[string]time.Duration{
+		StageDecode:  t.decoded.Sub(t.received),
+		StageQueue:   t.dequeued.Sub(t.decoded),
+		StageFilter:  t.filtered.Sub(t.dequeued),
+		StageKVWrite: t.published.Sub(t.filtered),
+	}
+}
+
+// LatencyWarning is emitted when chat messages take longer than the latency budget
+// to be published, for longer than the sustain period
+type LatencyWarning struct {
+	// Average receive-to-publish latency since the budget was first exceeded
+	LatencyMS   float64   `json:"latency_ms"`
+	ThresholdMS float64   `json:"threshold_ms"`
+	Since       time.Time `json:"since"`
+	// Stage taking the most time on average, and the average time of every stage
+	SlowStage string             `json:"slow_stage"`
+	Stages    map[string]float64 `json:"stages_ms"`
+}
+
+// latencyMonitor warns when the chat pipeline is over budget for a sustained period
+type latencyMonitor struct {
+	bridge    *Bridge
+	threshold time.Duration
+	sustain   time.Duration
+
+	mu        sync.Mutex
+	overSince time.Time
+	alerted   bool
+	samples   int
+	total     time.Duration
+	stages    map[string]time.Duration
+}
+
+func (b *Bridge) newLatencyMonitor(threshold, sustain time.Duration) *latencyMonitor {
+	return &latencyMonitor{bridge: b, threshold: threshold, sustain: sustain}
+}
+
+func (l *latencyMonitor) record(timing pipelineTiming) {
+	if l == nil || timing.received.IsZero() {
+		return
+	}
+	latency := timing.published.Sub(timing.received)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if latency <= l.threshold {
+		if l.alerted {
+			l.bridge.log.WithField("latency", latency).Info("Chat latency is back within budget")
+		}
+		l.overSince = time.Time{}
+		l.alerted = false
+		return
+	}
+
+	if l.overSince.IsZero() {
+		l.overSince = timing.received
+		l.samples = 0
+		l.total = 0
+		l.stages = make(map[string]time.Duration)
+	}
+	l.samples++
+	l.total += latency
+	for stage, duration := range timing.stages() {
+		l.stages[stage] += duration
+	}
+	if l.alerted || time.Since(l.overSince) < l.sustain {
+		return
+	}
+
+	l.alerted = true
+	warning := LatencyWarning{
+		LatencyMS:   averageMillis(l.total, l.samples),
+		ThresholdMS: float64(l.threshold) / float64(time.Millisecond),
+		Since:       l.overSince,
+		Stages:      make(map[string]float64),
+	}
+	var slowest time.Duration
+	for stage, duration := range l.stages {
+		warning.Stages[stage] = averageMillis(duration, l.samples)
+		if duration > slowest {
+			slowest = duration
+			warning.SlowStage = stage
+		}
+	}
+	l.bridge.log.WithFields(logrus.Fields{
+		"latency-ms": warning.LatencyMS,
+		"slow-stage": warning.SlowStage,
+		"since":      warning.Since.Format(time.RFC3339),
+	}).Warn("Chat messages are over the latency budget")
+	l.bridge.setJSON(l.bridge.key("ev/latency-warning"), warning)
+}
+
+func averageMillis(total time.Duration, samples int) float64 {
+	return float64(total) / float64(samples) / float64(time.Millisecond)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LeaderboardEntry struct {
+	Username string `json:"username"`
+	Messages int    `json:"messages"`
+}
+
+// How often leaderboards with new messages are published
+const leaderboardPublishInterval = 5 * time.Second
+
+// Leaderboard counts messages per chatter over a period (daily or weekly).
+// Only the top chatters are published, the counts are kept in snapshots.
+type Leaderboard struct {
+	Period string             `json:"period"`
+	Since  time.Time          `json:"since"`
+	Counts map[string]int     `json:"-"`
+	Top    []LeaderboardEntry `json:"top"`
+}
+
+// LeaderboardSnapshot is the state of a leaderboard saved in snapshots
+type LeaderboardSnapshot struct {
+	Since  time.Time      `json:"since"`
+	Counts map[string]int `json:"counts"`
+}
+
+// periodStart returns the start of the period containing t, in local time
+func periodStart(period string, t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if period == "weekly" {
+		// Weeks start on Monday
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	}
+	return day
+}
+
+// leaderboards keeps the daily and weekly top chatters, resetting them when their period ends.
+// Messages only update the counts, the leaderboards are sorted and published periodically.
+type leaderboards struct {
+	bridge *Bridge
+	size   int
+
+	mu     sync.Mutex
+	boards map[string]*Leaderboard
+	// Set when there are counts that weren't published yet
+	dirty bool
+}
+
+// newLeaderboards restores the counts from the snapshot, or else from the published top chatters
+func (b *Bridge) newLeaderboards(size int) *leaderboards {
+	l := &leaderboards{bridge: b, size: size, boards: make(map[string]*Leaderboard)}
+	for _, period := range []string{"daily", "weekly"} {
+		board := &Leaderboard{Period: period, Since: periodStart(period, time.Now()), Counts: make(map[string]int)}
+		if b.restored != nil && b.restored.Leaderboards[period].Counts != nil {
+			restored := b.restored.Leaderboards[period]
+			board.Since, board.Counts = restored.Since, restored.Counts
+		} else {
+			var stored Leaderboard
+			if err := b.kv.GetJSON(l.key(period), &stored); err == nil && !stored.Since.IsZero() {
+				board.Since = stored.Since
+				for _, entry := range stored.Top {
+					board.Counts[entry.Username] = entry.Messages
+				}
+			}
+		}
+		l.boards[period] = board
+	}
+	return l
+}
+
+// snapshot returns the counts of all leaderboards
+func (l *leaderboards) snapshot() map[string]LeaderboardSnapshot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	snapshot := make(map[string]LeaderboardSnapshot, len(l.boards))
+	for period, board := range l.boards {
+		counts := make(map[string]int, len(board.Counts))
+		for username, count := range board.Counts {
+			counts[username] = count
+		}
+		snapshot[period] = LeaderboardSnapshot{Since: board.Since, Counts: counts}
+	}
+	return snapshot
+}
+
+func (l *leaderboards) key(period string) string {
+	return l.bridge.key("leaderboard/" + period)
+}
+
+// resetExpired starts a new period for leaderboards whose period is over, returning true if any was reset
+func (l *leaderboards) resetExpired(now time.Time) bool {
+	reset := false
+	for period, board := range l.boards {
+		start := periodStart(period, now)
+		if board.Since.Before(start) {
+			l.boards[period] = &Leaderboard{Period: period, Since: start, Counts: make(map[string]int)}
+			reset = true
+		}
+	}
+	return reset
+}
+
+func (l *leaderboards) record(msg ChatMessage) {
+	username := strings.ToLower(msg.User.Username)
+	if username == "" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resetExpired(time.Now())
+	for _, board := range l.boards {
+		board.Counts[username]++
+	}
+	l.dirty = true
+}
+
+func (l *leaderboards) publish() {
+	for period, board := range l.boards {
+		top := make([]LeaderboardEntry, 0, len(board.Counts))
+		for username, count := range board.Counts {
+			top = append(top, LeaderboardEntry{Username: username, Messages: count})
+		}
+		sort.Slice(top, func(i, j int) bool {
+			if top[i].Messages == top[j].Messages {
+				return top[i].Username < top[j].Username
+			}
+			return top[i].Messages > top[j].Messages
+		})
+		if len(top) > l.size {
+			top = top[:l.size]
+		}
+		board.Top = top
+		l.bridge.setJSON(l.key(period), board)
+	}
+	l.dirty = false
+}
+
+// run publishes the leaderboards every leaderboardPublishInterval if there were new messages,
+// and as soon as their period ends even without new messages
+func (l *leaderboards) run(ctx context.Context) {
+	ticker := time.NewTicker(leaderboardPublishInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			if l.resetExpired(now) {
+				l.bridge.log.Info("Leaderboard period ended, resetting")
+				l.dirty = true
+			}
+			if l.dirty {
+				l.publish()
+			}
+			l.mu.Unlock()
+		}
+	}
+}
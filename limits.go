@@ -0,0 +1,96 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Appended to anything cut because it was over its size limit
+const truncationMarker = "…[truncated]"
+
+// PayloadLimits protects the KV store from pathologically large values (0 disables a limit)
+type PayloadLimits struct {
+	// Maximum length of an incoming chat message, in characters
+	MessageLength int
+	// Maximum size of the chat history value, in bytes (older messages are left out)
+	HistoryBytes int
+	// Maximum size of a row of the chat archive, in bytes
+	ArchiveRowBytes int
+}
+
+// truncateRunes cuts text to at most max characters, including the truncation marker
+func truncateRunes(text string, max int) (string, bool) {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return text, false
+	}
+	// Leave out the marker if it doesn't fit either
+	marker := truncationMarker
+	keep := max - utf8.RuneCountInString(marker)
+	if keep < 0 {
+		keep, marker = max, ""
+	}
+	cut := 0
+	for i := 0; i < keep; i++ {
+		_, size := utf8.DecodeRuneInString(text[cut:])
+		cut += size
+	}
+	return text[:cut] + marker, true
+}
+
+// truncateBytes cuts text to at most max bytes (on a character boundary), including the truncation marker
+func truncateBytes(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	marker := truncationMarker
+	if max < len(marker) {
+		marker = ""
+	}
+	cut := max - len(marker)
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + marker
+}
+
+// limitArchiveRow shortens the message of an archive row so its encoded form fits in max bytes,
+// if the rest of the row leaves any room for it
+func limitArchiveRow(message ArchivedMessage, max int) ArchivedMessage {
+	if max <= 0 {
+		return message
+	}
+	encoded, err := jsoniter.ConfigFastest.Marshal(message)
+	if err != nil || len(encoded) <= max {
+		return message
+	}
+	// JSON escaping can make the message longer than its text, so cut in proportion
+	// and keep cutting until the row fits
+	text := message.Message
+	budget := len(text)
+	for len(encoded) > max && budget > 0 {
+		overflow := len(encoded) - max
+		budget -= overflow*budget/len(encoded) + overflow
+		if budget < 0 {
+			budget = 0
+		}
+		message.Message = truncateBytes(text, budget)
+		encoded, err = jsoniter.ConfigFastest.Marshal(message)
+		if err != nil {
+			break
+		}
+	}
+	return message
+}
+
+// fits returns whether the encoded value is at most max bytes (always true if max is 0)
+func fits(value interface{}, max int) bool {
+	if max <= 0 {
+		return true
+	}
+	encoded, err := jsoniter.ConfigFastest.Marshal(value)
+	return err != nil || len(encoded) <= max
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestTruncateRunes(t *testing.T) {
+	text := strings.Repeat("é", 50)
+	for _, max := range []int{0, 1, 5, 12, 13, 20, 49, 50, 100} {
+		out, truncated := truncateRunes(text, max)
+		if max > 0 && utf8.RuneCountInString(out) > max {
+			t.Errorf("truncateRunes(%d) returned %d characters", max, utf8.RuneCountInString(out))
+		}
+		if truncated != (max > 0 && max < 50) {
+			t.Errorf("truncateRunes(%d) truncated = %v", max, truncated)
+		}
+	}
+}
+
+func TestLimitArchiveRow(t *testing.T) {
+	message := ArchivedMessage{ChatMessage: ChatMessage{Message: strings.Repeat(`"\<é>`, 200)}}
+	// Size of the row without the message, the least it can be cut to
+	empty, err := jsoniter.ConfigFastest.Marshal(ArchivedMessage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, extra := range []int{0, 5, 13, 100, 500} {
+		max := len(empty) + extra
+		row := limitArchiveRow(message, max)
+		encoded, err := jsoniter.ConfigFastest.Marshal(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(encoded) > max {
+			t.Errorf("row limited to %d bytes is %d bytes", max, len(encoded))
+		}
+		if !utf8.ValidString(row.Message) {
+			t.Errorf("row limited to %d bytes has invalid UTF-8", max)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// LogFileOptions configures logging to a rotating file
+type LogFileOptions struct {
+	Path string
+	// Rotate when the file grows over this many megabytes
+	MaxSizeMB int
+	// Rotate at least this often (0 to only rotate by size)
+	RotateEvery time.Duration
+	// Number of rotated files to keep (0 to keep all)
+	MaxBackups int
+	// Delete rotated files older than this many days (0 to keep them regardless of age)
+	MaxAgeDays int
+}
+
+// logFileHook writes every log entry to a rotating file, uncolored
+type logFileHook struct {
+	file      *lumberjack.Logger
+	formatter logrus.Formatter
+}
+
+func (h *logFileHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *logFileHook) Fire(entry *logrus.Entry) error {
+	line, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	_, err = h.file.Write(line)
+	return err
+}
+
+// addLogFile makes log also write to a rotating file, until ctx is cancelled
+func addLogFile(ctx context.Context, log *logrus.Logger, options LogFileOptions) {
+	file := &lumberjack.Logger{
+		Filename:   options.Path,
+		MaxSize:    options.MaxSizeMB,
+		MaxBackups: options.MaxBackups,
+		MaxAge:     options.MaxAgeDays,
+		LocalTime:  true,
+	}
+	log.AddHook(&logFileHook{
+		file:      file,
+		formatter: &logrus.TextFormatter{DisableColors: true, FullTimestamp: true},
+	})
+
+	go func() {
+		defer file.Close()
+		var rotate <-chan time.Time
+		if options.RotateEvery > 0 {
+			ticker := time.NewTicker(options.RotateEvery)
+			defer ticker.Stop()
+			rotate = ticker.C
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-rotate:
+				if err := file.Rotate(); err != nil {
+					log.WithError(err).Error("Could not rotate log file")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Categories of high-frequency log statements that can be sampled
+const (
+	logCategoryFrames = "frames"
+	logCategoryChat   = "chat"
+	logCategoryRPC    = "rpc"
+	logCategorySend   = "send"
+)
+
+type logSampleWindow struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// logSampler limits how many lines per second each category of debug logs can write.
+// It's only used for high-frequency debug statements, errors are always logged.
+type logSampler struct {
+	mu      sync.Mutex
+	limits  map[string]int
+	windows map[string]*logSampleWindow
+}
+
+// parseLogSampling parses a list of category=lines-per-second limits (eg. "frames=10,chat=5"),
+// categories not in the list are not limited
+func parseLogSampling(spec string) (*logSampler, error) {
+	sampler := &logSampler{limits: make(map[string]int), windows: make(map[string]*logSampleWindow)}
+	for _, item := range parseList(spec) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid log sampling rule %q, expected category=limit", item)
+		}
+		switch parts[0] {
+		case logCategoryFrames, logCategoryChat, logCategoryRPC, logCategorySend:
+		default:
+			return nil, fmt.Errorf("unknown log category %q", parts[0])
+		}
+		limit, err := strconv.Atoi(parts[1])
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid limit for log category %q", parts[0])
+		}
+		sampler.limits[parts[0]] = limit
+	}
+	return sampler, nil
+}
+
+// sample returns whether a line of the category can be logged, and how many lines were
+// suppressed since the last one that was
+func (s *logSampler) sample(category string) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	limit, ok := s.limits[category]
+	if !ok {
+		return true, 0
+	}
+	window, ok := s.windows[category]
+	if !ok {
+		window = &logSampleWindow{}
+		s.windows[category] = window
+	}
+	now := time.Now()
+	if now.Sub(window.start) >= time.Second {
+		window.start = now
+		window.count = 0
+	}
+	if window.count >= limit {
+		window.suppressed++
+		return false, 0
+	}
+	window.count++
+	suppressed := window.suppressed
+	window.suppressed = 0
+	return true, suppressed
+}
+
+// sampledLog returns the logger to use for a line of the given category, or false if the
+// line should be skipped. Lines following suppressed ones report how many were skipped.
+func (b *Bridge) sampledLog(category string) (logrus.FieldLogger, bool) {
+	if b.sampler == nil {
+		return b.log, true
+	}
+	ok, suppressed := b.sampler.sample(category)
+	if !ok {
+		return nil, false
+	}
+	if suppressed > 0 {
+		return b.log.WithField("suppressed", suppressed), true
+	}
+	return b.log, true
+}
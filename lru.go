@@ -0,0 +1,170 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Estimated bookkeeping overhead of a cache entry (list element, map bucket, headers), in bytes
+const lruEntryOverhead = 96
+
+// MemoryLimits caps the memory used by the bridge buffers and caches, in bytes (0 for no limit)
+type MemoryLimits struct {
+	// Events waiting to be consumed by each event bus subscriber (sinks, streaming APIs...)
+	EventBuffer int
+	// User profile and follower caches
+	UserCaches int
+	// Sets of already seen users (known chatters, first messages in stream)
+	DedupSets int
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+	size  int
+}
+
+// lruCache is a map bounded by the estimated memory of its entries,
+// evicting the least recently used ones when full
+type lruCache struct {
+	// Evicted entries, first so it's 64-bit aligned for atomic operations
+	evicted  uint64
+	name     string
+	maxBytes int
+
+	mu      sync.Mutex
+	used    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// newLRUCache creates a cache and registers it for the memory metrics
+func (b *Bridge) newLRUCache(name string, maxBytes int) *lruCache {
+	cache := &lruCache{name: name, maxBytes: maxBytes, order: list.New(), entries: make(map[string]*list.Element)}
+	b.cachesMu.Lock()
+	b.caches = append(b.caches, cache)
+	b.cachesMu.Unlock()
+	return cache
+}
+
+// entrySize estimates the memory used by a key and its value
+func entrySize(key string, value interface{}) int {
+	size := lruEntryOverhead + len(key)
+	switch v := value.(type) {
+	case nil, bool, struct{}:
+	case interface{ memorySize() int }:
+		size += v.memorySize()
+	case string:
+		size += len(v)
+	default:
+		if byt, err := jsoniter.ConfigFastest.Marshal(v); err == nil {
+			size += len(byt)
+		}
+	}
+	return size
+}
+
+func (c *lruCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruEntry).value, true
+}
+
+// has returns whether key is in the cache, without marking it as recently used
+func (c *lruCache) has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	return ok
+}
+
+func (c *lruCache) put(key string, value interface{}) {
+	size := entrySize(key, value)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		c.used += size - entry.size
+		entry.value, entry.size = value, size
+		c.order.MoveToFront(element)
+	} else {
+		c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, size: size})
+		c.used += size
+	}
+	// Always keep the newest entry, even if it's bigger than the limit on its own
+	for c.maxBytes > 0 && c.used > c.maxBytes && c.order.Len() > 1 {
+		c.removeElement(c.order.Back())
+		atomic.AddUint64(&c.evicted, 1)
+	}
+}
+
+func (c *lruCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+// removeElement must be called with the lock held
+func (c *lruCache) removeElement(element *list.Element) {
+	entry := element.Value.(*lruEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	c.used -= entry.size
+}
+
+// removeFunc removes all the entries for which fn returns true
+func (c *lruCache) removeFunc(fn func(key string, value interface{}) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		entry := element.Value.(*lruEntry)
+		if fn(entry.key, entry.value) {
+			c.removeElement(element)
+		}
+		element = next
+	}
+}
+
+// keys returns all the keys, from the least to the most recently used
+func (c *lruCache) keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.entries))
+	for element := c.order.Back(); element != nil; element = element.Prev() {
+		keys = append(keys, element.Value.(*lruEntry).key)
+	}
+	return keys
+}
+
+func (c *lruCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.used = 0
+}
+
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// usage returns the estimated memory used by the cache and how many entries were evicted
+func (c *lruCache) usage() (int, uint64) {
+	c.mu.Lock()
+	used := c.used
+	c.mu.Unlock()
+	return used, atomic.LoadUint64(&c.evicted)
+}
@@ -2,47 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/mattn/go-colorable"
 	"github.com/sirupsen/logrus"
 	"nhooyr.io/websocket"
-
-	kvclient "github.com/strimertul/kilovolt-client-go/v6"
 )
 
-type ClientCredentialsResult struct {
-	AccessToken  string  `json:"access_token"`
-	RefreshToken *string `json:"refresh_token"`
-	CreatedAt    string  `json:"created_at"`
-	Expires      int     `json:"expires_in"`
-	Scope        string  `json:"scope"`
-	TokenType    string  `json:"token_type"`
-}
-
-type ChatMessage struct {
-	Message string `json:"message"`
-	User    struct {
-		Username string `json:"username"`
-	} `json:"user"`
-}
-
-type ChatMessageResult struct {
-	Result struct {
-		Data struct {
-			ChatMessage ChatMessage `json:"chatMessage"`
-		} `json:"data"`
-	} `json:"result"`
-}
-
 type GQLQuery struct {
 	Query     string                 `json:"query"`
 	Variables map[string]interface{} `json:"variables"`
@@ -56,6 +32,18 @@ func check(err error, format string, args ...interface{}) {
 	}
 }
 
+// parseList parses a comma-separated flag value, ignoring empty items
+func parseList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func parseLogLevel(level string) logrus.Level {
 	switch level {
 	case "error":
@@ -74,144 +62,702 @@ func parseLogLevel(level string) logrus.Level {
 }
 
 func main() {
-	endpoint := flag.String("kv-endpoint", "http://localhost:4337/ws", "Kilovolt endpoint")
-	password := flag.String("password", "", "Optional password for Kilovolt")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export-followers":
+			exportFollowersCommand(os.Args[2:])
+			return
+		case "send":
+			sendCommand(os.Args[2:])
+			return
+		case "export-bundle":
+			exportBundleCommand(os.Args[2:])
+			return
+		case "import-bundle":
+			importBundleCommand(os.Args[2:])
+			return
+		case "export":
+			exportCommand(os.Args[2:])
+			return
+		case "bench":
+			benchCommand(os.Args[2:])
+			return
+		case "run":
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
+	}
+
+	endpoint := flag.String("kv-endpoint", "http://localhost:4337/ws", "Kilovolt endpoint, or comma-separated list of endpoints to publish to (empty to run without Kilovolt)")
+	password := flag.String("password", "", "Optional password for Kilovolt (can be overridden per endpoint with http://:password@host/ws)")
 	prefix := flag.String("prefix", "glimesh/", "Prefix/Namespace for keys")
 	channelID := flag.Int("channel-id", -1, "Glimesh channel ID")
 	clientID := flag.String("client-id", "", "Glimesh app client ID")
 	clientSecret := flag.String("client-secret", "", "Glimesh app secret key")
-	chatHistorySize := flag.Int("chat-history", 6, "Number of chat messages to keep in history")
+	server := registerServerFlags(flag.CommandLine)
+	chatHistorySize := flag.Int("chat-history", 6, "Number of chat messages to keep in history (overrides the config key when set)")
+	chatHistoryGroupWindow := flag.Int("chat-history-group-window", 0, "Merge consecutive messages from the same user within this many seconds in history (0 to disable, overrides the config key when set)")
+	chatArchiveSize := flag.Int("chat-archive-size", 10000, "Number of chat messages kept in the archive used by @get-history")
+	chatArchiveFile := flag.String("chat-archive", "", "Append archived chat messages to this JSON lines file, so they survive restarts")
+	maxMessageLength := flag.Int("max-message-length", 1000, "Truncate incoming chat messages longer than this many characters (0 for no limit)")
+	maxHistoryBytes := flag.Int("max-history-bytes", 64*1024, "Leave older messages out of the chat history key when it gets bigger than this many bytes (0 for no limit)")
+	maxArchiveRowBytes := flag.Int("max-archive-row-bytes", 4096, "Truncate the message of chat archive rows bigger than this many bytes (0 for no limit)")
+	stripInvisible := flag.Bool("strip-invisible", false, "Remove zero-width and text direction characters from incoming and outgoing chat messages")
+	moderationLog := flag.String("moderation-log", "", "Append every moderation action taken or observed by the bridge to this JSON lines file")
+	generate := flag.String("generate", "", "Generate synthetic events for load testing overlays and the KV store, as kind=rate per second (eg. \"chat=10,follow=0.5,sub=0.1\"); chat messages go through the full pipeline")
+	watchdogInterval := flag.Duration("watchdog-interval", time.Minute, "How often to check goroutines, connections and queue depths for leaks (0 to disable)")
+	watchdogMaxGoroutines := flag.Int("watchdog-max-goroutines", 5000, "Warn when the number of goroutines goes over this (0 for no limit)")
+	crashDir := flag.String("crash-dir", "crash-reports", "Write a report with the stack trace of every recovered panic to this directory (empty to only log them)")
+	maintenance := flag.Bool("maintenance", false, "Start in maintenance mode: stay connected and archive chat, but suppress automated responses, alerts, sounds and hooks (toggle with the @maintenance RPC)")
+	outgoingLog := flag.String("outgoing-log", "", "Append every message sent (or dropped) by the bridge, with its source and outcome, to this JSON lines file")
+	familyMode := flag.Bool("family-mode", false, "Preset enabling -mask-profanity, -block-links and -tts-text, for a stream output safe for all ages")
+	maskProfanity := flag.Bool("mask-profanity", false, "Replace profanity in chat messages with asterisks")
+	profanityList := flag.String("profanity-list", "", "File with extra words to mask (one per line), added to the built-in list")
+	blockLinks := flag.Bool("block-links", false, "Replace links in chat messages with \""+blockedLinkText+"\"")
+	blockLinksExempt := flag.String("block-links-exempt-role", RoleModerator, "Don't block links sent by users with this role or higher (empty to block everyone's)")
+	markerRole := flag.String("marker-role", RoleModerator, "Minimum role allowed to add stream markers with !clip/!marker")
+	ttsText := flag.Bool("tts-text", false, "Add a text-to-speech friendly version of chat messages (no emotes, links, profanity or character spam) as tts_text")
+	detectConfusables := flag.Bool("detect-confusables", false, "Flag chat messages using look-alike (homoglyph) or styled characters as suspicious")
+	userLastMessage := flag.Bool("user-last-message", false, "Write the last message of each user to users/<username>/last-message")
+	hypeWindow := flag.Duration("hype-window", 0, "Compute a hype score over windows of this duration (0 to disable)")
+	leaderboardSize := flag.Int("leaderboard-size", 0, "Number of top chatters to publish in the daily/weekly leaderboards (0 to disable)")
+	sessionReport := flag.String("session-report", "", "Append a summary of every stream session to this file (CSV if it ends in .csv, JSON lines otherwise)")
+	monthlyReportDir := flag.String("monthly-report", "", "Write a report of chat volume, top chatters, follower growth and stream hours to this directory at the end of every month")
+	monthlyReportFormat := flag.String("monthly-report-format", "markdown", "Format of the monthly report (markdown, html)")
+	songRequests := flag.Bool("song-requests", false, "Enable the !sr chat command for song requests")
+	songRequestHosts := flag.String("song-request-hosts", "youtube.com,youtu.be,soundcloud.com,open.spotify.com", "Comma-separated list of sites allowed in song requests")
+	songRequestLimit := flag.Int("song-request-limit", 3, "Maximum number of song requests per user per hour (0 for unlimited)")
+	donationWebhookSecret := flag.String("donation-webhook-secret", "", "Enable the /webhook/donation endpoint on the HTTP server, requiring this shared secret")
+	mergeChannels := flag.String("merge-channels", "", "Comma-separated list of extra channel IDs whose chat is merged with ours in ev/merged-chat-message")
+	chatExtraFields := flag.String("chat-extra-fields", "", "Extra GraphQL fields requested for chat messages (eg. \"insertedAt tokens { type text }\"), new top-level fields are published as is in the extra field of ev/chat-message")
+	enrichChat := flag.Bool("enrich-chat", false, "Add the author's profile (display name, avatar, account age) to chat message events, profiles that aren't cached yet follow in ev/chat-message-profile")
+	userCacheTTL := flag.Duration("user-cache-ttl", time.Hour, "How long to keep user profiles in the cache")
+	userCacheKV := flag.Bool("user-cache-kv", false, "Also store cached user profiles in users/<username>/profile, so they survive restarts")
+	followerRole := flag.Bool("follower-role", false, "Look up whether chatters follow the channel to assign them the follower role (costs an API call per chatter per cache TTL)")
+	configFile := flag.String("config-file", "", "JSON file with runtime settings (same format as the config key) applied on startup and on reload (SIGHUP or @reload-config)")
+	messagesFile := flag.String("messages", "", "JSON file with translations/overrides for the chat messages sent by the bridge")
+	welcome := flag.Bool("welcome", false, "Greet first-time chatters in chat")
+	welcomeRate := flag.Int("welcome-rate", 3, "Maximum number of greetings sent per minute (0 for unlimited)")
+	soundsFile := flag.String("sounds", "", "JSON file with local audio files to play on events, chat keywords or mentions of the streamer")
+	soundPlayerCommand := flag.String("sound-player", defaultSoundPlayer(), "Command playing sounds, {file} is replaced with the file and {volume} with the volume (0-100, also {volume_fraction} for 0-1 and {volume_pa} for 0-65536)")
+	hooksFile := flag.String("hooks", "", "JSON file with actions to run when the stream goes live or offline and on events")
+	pluginDir := flag.String("plugins", "", "Load all the WebAssembly plugins (.wasm) in this directory")
+	grpcAddr := flag.String("grpc-addr", "", "Address for the gRPC API server (eg. localhost:4339), disabled if empty")
+	natsURL := flag.String("nats-url", "", "Publish all events to this NATS server (eg. nats://localhost:4222)")
+	natsSubject := flag.String("nats-subject-prefix", "glimesh", "Prefix for NATS subjects, events are published to <prefix>.<channel id>.<event>")
+	redisURL := flag.String("redis-url", "", "Publish all events to this Redis server (eg. redis://localhost:6379/0)")
+	redisMode := flag.String("redis-mode", "pubsub", "How to publish events to Redis: \"pubsub\" (<prefix>:<channel id>:<event> channels) or \"stream\" (<prefix>:<channel id>:events stream)")
+	redisPrefix := flag.String("redis-prefix", "glimesh", "Prefix for Redis channel and stream names")
+	redisMaxLen := flag.Int64("redis-stream-maxlen", 10000, "Approximate maximum length of the Redis stream")
+	mqttURL := flag.String("mqtt-url", "", "Connect to this MQTT broker (eg. tcp://localhost:1883) to integrate with Home Assistant through MQTT discovery")
+	mqttUsername := flag.String("mqtt-username", "", "Username for the MQTT broker")
+	mqttPassword := flag.String("mqtt-password", "", "Password for the MQTT broker")
+	mqttTopicPrefix := flag.String("mqtt-topic-prefix", "glimesh-bridge", "Prefix for MQTT topics, events are published to <prefix>/event/<event>")
+	haDiscoveryPrefix := flag.String("ha-discovery-prefix", "homeassistant", "Home Assistant MQTT discovery prefix")
+	haTriggers := flag.String("ha-triggers", "alert,new-subscriber,donation,first-message,session-started,session-ended,timer-finished", "Comma-separated list of events exposed as Home Assistant device triggers")
+	sendSecret := flag.String("send-secret", "", "Require requests sending chat messages through RPC keys to include this shared secret (in their secret field)")
+	sendSources := flag.String("send-sources", "", "Comma-separated list of senders allowed to send chat messages through RPC keys, as source=secret")
+	controlSocket := flag.String("control-socket", "", "Path of a unix socket accepting line-based commands (SEND, SUBSCRIBE, PING)")
+	output := flag.String("output", "", "Set to \"stdout\" to also print every event as a JSON line on stdout (logs go to stderr)")
+	apiCache := flag.String("api-cache", "channel=10s,user=10m,follower-count=1m", "Cache API query results for this long, by query (channel, user, follower-count), concurrent identical queries are always coalesced into one (empty to disable)")
+	logSampling := flag.String("log-sample", "frames=10,chat=10", "Maximum debug lines per second for noisy log categories (frames, chat, rpc, send), eg. \"frames=5,chat=0\"")
+	sentryDSN := flag.String("sentry-dsn", "", "Report errors and crashes to this Sentry project, with credentials and chat content redacted (off by default)")
+	errorReportURL := flag.String("error-report-url", "", "Also POST redacted errors and crashes as JSON to this URL (off by default)")
+	logFile := flag.String("log-file", "", "Also write logs to this file, rotating it by size and time")
+	logMaxSize := flag.Int("log-max-size", 10, "Rotate the log file when it grows over this many megabytes")
+	logRotateEvery := flag.Duration("log-rotate-every", 24*time.Hour, "Rotate the log file at least this often (0 to only rotate by size)")
+	logMaxBackups := flag.Int("log-max-backups", 7, "Number of rotated log files to keep (0 to keep all)")
+	logMaxAge := flag.Int("log-max-age", 30, "Delete rotated log files older than this many days (0 to keep them regardless of age)")
+	reliableEvents := flag.Int("reliable-events", 0, "Keep up to this many events in the event-log key until consumers acknowledge them with @ack-events (0 to disable)")
 	loglevel := flag.String("log-level", "info", "Logging level (debug, info, warn, error)")
+	logOutput := flag.String("log-output", LogOutputConsole, "Where to log: console, eventlog (Windows Event Log), oslog (macOS unified logging) or syslog, for running as a background service")
+	phoenixVsn := flag.String("phoenix-vsn", "auto", "Phoenix serializer version used on the Glimesh websocket (1.0.0, 2.0.0, or auto for 2.0.0 falling back to 1.0.0 if the server answers with v1 frames)")
+	absintheControlTopicFlag := flag.String("absinthe-control-topic", absintheControlTopic, "Topic of the Absinthe control channel on the Glimesh websocket")
+	absintheSubscriptionID := flag.String("absinthe-subscription-id", subscriptionIDAuto, "Where subscription data frames carry their subscription ID: payload (subscriptionId field), topic (frame topic) or auto (payload, then topic)")
+	pollInterval := flag.Duration("poll-interval", time.Minute, "How often to poll the Glimesh API for channel info")
+	httpAddr := flag.String("http-addr", "", "Address for the embedded HTTP server (eg. localhost:4338), disabled if empty")
+	subscriberSync := flag.Duration("subscriber-sync-interval", 0, "How often to sync the list of active subscribers (0 to disable)")
+	enableGraphQLRPC := flag.Bool("enable-graphql-rpc", false, "Enable the @graphql RPC key, which lets anyone with access to Kilovolt run arbitrary queries with the bridge's token")
+	graphQLMutations := flag.Bool("graphql-rpc-mutations", false, "Allow mutations through the @graphql RPC key (needs -enable-graphql-rpc)")
+	corsOriginList := flag.String("cors-origins", "", "Comma-separated list of origins allowed to call the HTTP server from the browser (\"*\" for any)")
+	metricsPushURL := flag.String("metrics-push-url", "", "Periodically push metrics to this Prometheus pushgateway or InfluxDB write URL")
+	metricsPushFormat := flag.String("metrics-push-format", "prometheus", "Format of pushed metrics: \"prometheus\" (pushgateway) or \"influx\" (line protocol)")
+	metricsPushInterval := flag.Duration("metrics-push-interval", 15*time.Second, "How often to push metrics")
+	metricsPushToken := flag.String("metrics-push-token", "", "Token sent with pushed metrics (InfluxDB API token or pushgateway bearer token)")
+	apiKeysFile := flag.String("api-keys", "", "JSON file with the API keys (and their scopes and rate limits) required by the HTTP and gRPC servers")
+	tlsCert := flag.String("tls-cert", "", "Serve the HTTP server over TLS with this certificate file")
+	tlsKey := flag.String("tls-key", "", "Private key file for -tls-cert")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "Serve the HTTP server over TLS with a self-signed certificate (saved to -tls-cert/-tls-key if set)")
+	tokenRefreshMargin := flag.Duration("token-refresh-margin", 5*time.Minute, "Refresh the Glimesh API token this long before it expires")
+	latencyBudget := flag.Duration("latency-budget", 0, "Warn (ev/latency-warning) when chat messages take longer than this from being received to being published (0 to disable)")
+	latencyBudgetPeriod := flag.Duration("latency-budget-period", 30*time.Second, "How long chat messages must be over the latency budget before warning")
+	maxEventBufferMB := flag.Int("max-event-buffer-mb", 4, "Maximum size of the events waiting for each slow consumer (sinks, streaming APIs), newer events are dropped past it (0 for no limit)")
+	maxUserCacheMB := flag.Int("max-user-cache-mb", 16, "Maximum memory used by the user profile and follower caches, least recently used entries are evicted past it (0 for no limit)")
+	maxDedupMB := flag.Int("max-dedup-mb", 8, "Maximum memory used by the known chatter sets, least recently seen chatters are forgotten past it (0 for no limit)")
+	snapshot := flag.String("snapshot", "", "Periodically save internal state (stream chatters, strikes, queue, session, uptime) to this file, or \"kv\" for the snapshot key, and restore it on startup")
+	snapshotInterval := flag.Duration("snapshot-interval", time.Minute, "How often to save the state snapshot")
+	snapshotMaxAge := flag.Duration("snapshot-max-age", 30*time.Minute, "Ignore state snapshots older than this on startup")
+	waitForKV := flag.Bool("wait-for-kv", false, "Keep retrying the initial connection to Kilovolt instead of exiting if it's not available yet")
+	waitForGlimesh := flag.Bool("wait-for-glimesh", false, "Keep retrying the initial connection to Glimesh instead of exiting if it's not reachable yet")
+	obsURL := flag.String("obs-url", "", "Connect to obs-websocket (v5) at this address (eg. ws://localhost:4455) to run OBS hook actions")
+	obsPassword := flag.String("obs-password", "", "Password for obs-websocket")
+	thumbnailFile := flag.String("thumbnail-file", "", "If set, download the live stream thumbnail to this file")
+	profile := flag.String("profile", "", "Load flag values (channel, credentials, prefix, files...) from this named profile, flags on the command line take precedence")
+	profilesFile := flag.String("profiles", defaultProfilesFile(), "JSON file with the profiles for -profile, mapping each profile name to flag values")
 	flag.Parse()
 
+	var profileFlags []string
+	if *profile != "" {
+		values, err := loadProfile(*profilesFile, *profile)
+		check(err, "Could not load profile %q", *profile)
+		profileFlags, err = applyProfile(flag.CommandLine, values)
+		check(err, "Could not apply profile %q", *profile)
+	}
+
 	log := logrus.New()
 	log.SetLevel(parseLogLevel(*loglevel))
-	ctx := context.Background()
+	// Cancelled on interrupt, stopping every goroutine started by the bridge
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Ok this is dumb but listen, I like colors.
 	if runtime.GOOS == "windows" {
 		log.SetFormatter(&logrus.TextFormatter{ForceColors: true})
-		log.SetOutput(colorable.NewColorableStdout())
+		if *output == "stdout" {
+			log.SetOutput(colorable.NewColorableStderr())
+		} else {
+			log.SetOutput(colorable.NewColorableStdout())
+		}
+	}
+
+	check(setLogOutput(log, *logOutput), "Invalid -log-output")
+
+	if *logFile != "" {
+		addLogFile(ctx, log, LogFileOptions{
+			Path:        *logFile,
+			MaxSizeMB:   *logMaxSize,
+			RotateEvery: *logRotateEvery,
+			MaxBackups:  *logMaxBackups,
+			MaxAgeDays:  *logMaxAge,
+		})
+	}
+
+	if *sentryDSN != "" || *errorReportURL != "" {
+		reporter, err := newErrorReporter(*sentryDSN, *errorReportURL)
+		check(err, "Invalid error reporting options")
+		log.AddHook(reporter)
+		go reporter.run(ctx)
+	}
+
+	if *profile != "" {
+		log.WithFields(logrus.Fields{"profile": *profile, "flags": profileFlags}).Info("Using profile")
+	}
+
+	family := FamilyFilter{MaskProfanity: *maskProfanity, BlockLinks: *blockLinks, LinkExemptRole: *blockLinksExempt, TTSText: *ttsText}
+	if *familyMode {
+		// Explicitly set flags still win over the preset, eg. -family-mode -block-links=false
+		preset, set := familyModePreset(), setFlags()
+		if !set["mask-profanity"] {
+			family.MaskProfanity = preset.MaskProfanity
+		}
+		if !set["block-links"] {
+			family.BlockLinks = preset.BlockLinks
+		}
+		if !set["tts-text"] {
+			family.TTSText = preset.TTSText
+		}
+	}
+	if _, ok := roleRank[family.LinkExemptRole]; family.LinkExemptRole != "" && !ok {
+		log.WithField("role", family.LinkExemptRole).Fatal("Unknown role for -block-links-exempt-role")
+	}
+	if _, ok := roleRank[*markerRole]; !ok {
+		log.WithField("role", *markerRole).Fatal("Unknown role for -marker-role")
+	}
+	if family.MaskProfanity || family.TTSText {
+		check(family.loadProfanityList(*profanityList), "Could not read profanity list")
 	}
 
-	if *clientID == "" || *clientSecret == "" {
-		log.Fatal("You must provide a client ID and secret key, check https://glimesh.tv/users/settings/applications/new to make a new Glimesh.tv application")
+	if err := server.validate(*clientID, *clientSecret); err != nil {
+		if server.Auth == AuthOAuth {
+			log.WithError(err).Fatal("You must provide a client ID and secret key, check https://glimesh.tv/users/settings/applications/new to make a new Glimesh.tv application")
+		}
+		log.WithError(err).Fatal("Invalid Glimesh server options")
+	}
+	if server.readOnly() {
+		log.Warn("No secret key provided, running in read-only mode: chat can be read but not sent to, moderation and follows are disabled")
 	}
 
 	if *channelID == -1 {
 		log.Fatal("You must provide a channel ID")
 	}
 
-	// Connect to strimertul/Kilovolt
-	client, err := kvclient.NewClient(*endpoint, kvclient.ClientOptions{Password: *password})
-	check(err, "Connection to kilovolt failed")
-	defer client.Close()
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("You must provide both -tls-cert and -tls-key")
+	}
 
-	chatEventKey := fmt.Sprintf("%sev/chat-message", *prefix)
-	chatRPCKey := fmt.Sprintf("%s@send-chat-message", *prefix)
-	chatHistoryKey := fmt.Sprintf("%schat-history", *prefix)
-	var chatHistory []ChatMessage
-	// Get old chat history, if available
-	err = client.GetJSON(chatHistoryKey, &chatHistory)
-	if err != nil {
-		chatHistory = make([]ChatMessage, 0)
-		_ = client.SetJSON(chatHistoryKey, chatHistory)
+	// Connect to strimertul/Kilovolt, if configured
+	var store kvStore
+	if *endpoint != "" {
+		var client *multiStore
+		err := retryStartup(ctx, log, *waitForKV, "kilovolt", func(err error) bool {
+			_, ok := err.(kvProtocolError)
+			return ok
+		}, func() (err error) {
+			client, err = newMultiStore(ctx, parseList(*endpoint), *password, log)
+			return err
+		})
+		check(err, "Connection to kilovolt failed")
+		defer client.close()
+		store = client
+	} else {
+		log.Warn("No Kilovolt endpoint configured, keys will only be kept in memory")
+		store = newMemoryStore(log)
 	}
 
 	// Obtain a token from Glimesh OAuth
-	res, err := http.Post("https://glimesh.tv/api/oauth/token", "application/x-www-form-urlencoded",
-		strings.NewReader(fmt.Sprintf("grant_type=client_credentials&client_id=%s&client_secret=%s&scope=chat", *clientID, *clientSecret)))
+	const scope = "public chat follow"
+	var credentials ClientCredentialsResult
+	err := retryStartup(ctx, log, *waitForGlimesh, "glimesh", func(err error) bool {
+		return errors.Is(err, ErrAuthFailed)
+	}, func() (err error) {
+		credentials, err = server.credentials(ctx, *clientID, *clientSecret, scope)
+		return err
+	})
+	if errors.Is(err, ErrAuthFailed) {
+		log.WithError(err).Fatal("Glimesh rejected the app credentials, check the client ID and secret key")
+	}
 	check(err, "Could not retrieve Glimesh API token")
 
-	credentials := ClientCredentialsResult{}
-	err = jsoniter.ConfigFastest.NewDecoder(res.Body).Decode(&credentials)
-	check(err, "Could not decode Glimesh API response")
+	memory := MemoryLimits{
+		EventBuffer: *maxEventBufferMB * 1024 * 1024,
+		UserCaches:  *maxUserCacheMB * 1024 * 1024,
+		DedupSets:   *maxDedupMB * 1024 * 1024,
+	}
+	bridge := &Bridge{
+		ctx:        ctx,
+		kv:         store,
+		api:        server.newClient(credentials.AccessToken),
+		log:        log,
+		prefix:     *prefix,
+		configFile: *configFile,
+		channelID:  *channelID,
+		mux:        http.NewServeMux(),
+		activity:   &activityTracker{},
+		events:     newEventBus(memory.EventBuffer),
+		memory:     memory,
+		commands:   newChatCommands(),
+
+		limits: PayloadLimits{
+			MessageLength:   *maxMessageLength,
+			HistoryBytes:    *maxHistoryBytes,
+			ArchiveRowBytes: *maxArchiveRowBytes,
+		},
+		readOnly:        server.readOnly(),
+		userLastMessage: *userLastMessage,
+		stripInvisible:  *stripInvisible,
+
+		detectConfusables: *detectConfusables,
+		family:            family,
+		enrichChat:        *enrichChat,
+		crashDir:          *crashDir,
+	}
+	if *reliableEvents > 0 {
+		// Before anything publishes events, so sequence numbers continue from the stored log
+		check(bridge.setupEventLog(ctx, *reliableEvents), "Could not subscribe to event ack RPC key")
+	}
+	bridge.goSafe(ctx, "token-refresh", func(ctx context.Context) {
+		bridge.refreshToken(ctx, server, *clientID, *clientSecret, scope, credentials, *tokenRefreshMargin)
+	})
+	var snapshots *snapshotter
+	if *snapshot != "" {
+		// Before creating the subsystems, which restore their state from it
+		snapshots = bridge.newSnapshotter(*snapshot)
+		bridge.restored = snapshots.load(*snapshotMaxAge)
+	}
+	bridge.health = bridge.newHealthTracker()
+	bridge.connStats = bridge.newConnectionStats()
+	bridge.goSafe(ctx, "connection-stats", bridge.connStats.run)
+	if *latencyBudget > 0 {
+		bridge.latency = bridge.newLatencyMonitor(*latencyBudget, *latencyBudgetPeriod)
+	}
+	bridge.api.OnResult = func(err error) {
+		bridge.health.report(ComponentAPI, err)
+	}
+	cacheTTLs, err := parseQueryCacheTTLs(*apiCache)
+	check(err, "Invalid API cache rules")
+	if len(cacheTTLs) > 0 {
+		bridge.api.cache = bridge.newQueryCache(cacheTTLs)
+	}
+	bridge.checkAPIFields(ctx)
+	bridge.sendAuth, err = parseSendAuth(*sendSecret, *sendSources)
+	check(err, "Invalid -send-sources")
+	generateRates, err := parseGenerateRates(*generate)
+	check(err, "Invalid -generate")
+	bridge.sampler, err = parseLogSampling(*logSampling)
+	check(err, "Invalid log sampling rules")
+	bridge.messages, err = loadMessages(*messagesFile)
+	check(err, "Could not load messages file")
+	if *soundsFile != "" {
+		sounds, err := loadSounds(*soundsFile)
+		check(err, "Could not load sounds")
+		bridge.sounds = bridge.newSoundPlayer(*soundPlayerCommand, sounds)
+	}
+	if *hooksFile != "" {
+		bridge.hooks, err = loadHooks(*hooksFile)
+		check(err, "Could not load hooks file")
+	}
+	if *pluginDir != "" {
+		bridge.plugins, err = bridge.loadPlugins(ctx, *pluginDir)
+		check(err, "Could not start plugin runtime")
+		defer bridge.plugins.close(ctx)
+	}
+	if *apiKeysFile != "" {
+		bridge.apiKeys, err = loadAPIKeys(*apiKeysFile)
+		check(err, "Could not load API keys file")
+	}
+	bridge.users = bridge.newUserCache(*userCacheTTL, *userCacheKV)
+	if *followerRole {
+		bridge.followers = bridge.newFollowerCache(*userCacheTTL)
+	}
+	config := bridge.loadConfig(Config{
+		ChatHistorySize:        *chatHistorySize,
+		ChatHistoryGroupWindow: *chatHistoryGroupWindow,
+		ChatHistoryDeleteMode:  "remove",
+		ChatMaxParts:           3,
+		AnnouncementPrefix:     "📢 ",
+		Spam: SpamHeuristics{
+			CapsMinLetters: 10,
+			Action:         SpamActionTag,
+			ExemptRole:     RoleModerator,
+		},
+	})
+	bridge.history = bridge.newChatHistory(config)
+	bridge.relay = bridge.newChatRelay(config)
+	bridge.goSafe(ctx, "relay", bridge.relay.run)
+	bridge.spam = &spamFilter{}
+	bridge.spam.configure(config)
+	bridge.escalation = bridge.newEscalationLadder(config)
+	bridge.audit = bridge.newModerationAudit(*moderationLog)
+	bridge.outgoing = bridge.newOutgoingAudit(*outgoingLog)
+	bridge.archive = bridge.newChatArchive(*chatArchiveSize, *chatArchiveFile)
+	bridge.chat = bridge.newChatSender(config)
+	bridge.triggers = bridge.newTriggerKeys()
+	if *obsURL != "" {
+		bridge.obs = newOBSClient(*obsURL, *obsPassword, log)
+		bridge.goSafe(ctx, "obs", bridge.obs.run)
+	}
+	configUpdates, err := bridge.watchConfig(ctx)
+	check(err, "Could not subscribe to config key")
+
+	if *output == "stdout" {
+		bridge.goSafe(ctx, "stdout", func(ctx context.Context) {
+			bridge.writeEventLines(ctx, os.Stdout)
+		})
+	} else if *output != "" {
+		log.WithField("output", *output).Fatal("Unknown output mode")
+	}
+
+	bridge.thumbnail = bridge.newThumbnailFetcher(*httpAddr != "", *thumbnailFile)
+	bridge.session = bridge.newSessionTracker(*sessionReport)
+	bridge.firsts = bridge.newFirstMessageDetector(*welcome, *welcomeRate)
+	bridge.goSafe(ctx, "known-chatters", bridge.firsts.saveKnown)
+	bridge.mux.Handle("/thumbnail", bridge.requireScope(ScopeRead, bridge.thumbnail))
+	metrics := bridge.newMetricsCollector()
+	bridge.goSafe(ctx, "metrics", metrics.run)
+	if *watchdogInterval > 0 {
+		bridge.goSafe(ctx, "watchdog", func(ctx context.Context) {
+			bridge.runWatchdog(ctx, *watchdogInterval, *watchdogMaxGoroutines)
+		})
+	}
+	bridge.mux.Handle("/metrics", bridge.requireScope(ScopeRead, metrics))
+	if *metricsPushURL != "" {
+		if *metricsPushFormat != "prometheus" && *metricsPushFormat != "influx" {
+			log.WithField("format", *metricsPushFormat).Fatal("Unknown metrics push format")
+		}
+		pushOptions := MetricsPushOptions{
+			URL:      *metricsPushURL,
+			Format:   *metricsPushFormat,
+			Interval: *metricsPushInterval,
+			Token:    *metricsPushToken,
+		}
+		bridge.goSafe(ctx, "metrics-push", func(ctx context.Context) {
+			metrics.push(ctx, pushOptions)
+		})
+	}
+	bridge.mux.Handle("/chat/history", bridge.requireScope(ScopeRead, &historyEndpoint{archive: bridge.archive}))
+	bridge.goSafe(ctx, "channel-poll", func(ctx context.Context) {
+		bridge.pollChannel(ctx, *pollInterval)
+	})
+	bridge.goSafe(ctx, "activity", bridge.publishActivity)
+	if *hypeWindow > 0 {
+		bridge.hype = &hypeTracker{window: *hypeWindow}
+		bridge.goSafe(ctx, "hype", bridge.publishHype)
+	}
+	if *leaderboardSize > 0 {
+		bridge.topChat = bridge.newLeaderboards(*leaderboardSize)
+		bridge.goSafe(ctx, "leaderboards", bridge.topChat.run)
+	}
+	if *subscriberSync > 0 {
+		bridge.goSafe(ctx, "subscriber-sync", func(ctx context.Context) {
+			bridge.syncSubscribers(ctx, *subscriberSync)
+		})
+	}
+
+	if *donationWebhookSecret != "" {
+		bridge.mux.Handle("/webhook/donation", &donationWebhook{bridge: bridge, secret: *donationWebhookSecret})
+	}
+	if *httpAddr != "" {
+		httpOptions := HTTPServerOptions{
+			Addr:       *httpAddr,
+			CORS:       parseList(*corsOriginList),
+			CertFile:   *tlsCert,
+			KeyFile:    *tlsKey,
+			SelfSigned: *tlsSelfSigned,
+		}
+		bridge.goSafe(ctx, "http-server", func(ctx context.Context) {
+			bridge.serveHTTP(ctx, httpOptions)
+		})
+	}
+	if *natsURL != "" {
+		check(bridge.runNATSSink(ctx, *natsURL, *natsSubject), "Could not connect to NATS")
+	}
+	if *redisURL != "" {
+		check(bridge.runRedisSink(ctx, *redisURL, *redisMode, *redisPrefix, *redisMaxLen), "Could not connect to Redis")
+	}
+	if *mqttURL != "" {
+		check(bridge.runHomeAssistant(ctx, HomeAssistantOptions{
+			URL:             *mqttURL,
+			Username:        *mqttUsername,
+			Password:        *mqttPassword,
+			DiscoveryPrefix: *haDiscoveryPrefix,
+			TopicPrefix:     *mqttTopicPrefix,
+			Triggers:        parseList(*haTriggers),
+		}), "Could not connect to MQTT broker")
+	}
+	if *controlSocket != "" {
+		check(bridge.serveControlSocket(ctx, *controlSocket), "Could not open control socket")
+	}
+	if *grpcAddr != "" {
+		bridge.goSafe(ctx, "grpc-server", func(ctx context.Context) {
+			bridge.serveGRPC(ctx, *grpcAddr)
+		})
+	}
 
 	// Connect to Glimesh
-	c, _, err := websocket.Dial(ctx, fmt.Sprintf("wss://glimesh.tv/api/socket/websocket?vsn=2.0.0&token=%s", credentials.AccessToken), nil)
+	protocol := SocketProtocol{Serializer: *phoenixVsn, ControlTopic: *absintheControlTopicFlag, SubscriptionID: *absintheSubscriptionID}
+	check(protocol.validate(), "Invalid websocket protocol options")
+	socket := newGlimeshSocket(log, protocol)
+	socket.onHeartbeatAck = bridge.connStats.recordRTT
+	bridge.connection = bridge.newGlimeshConnection(socket, func(ctx context.Context, token string) (*websocket.Conn, error) {
+		c, _, err := websocket.Dial(ctx, server.socketURL(token, protocol.vsn()), nil)
+		return c, err
+	})
+	var c *websocket.Conn
+	err = retryStartup(ctx, log, *waitForGlimesh, "glimesh websocket", nil, func() (err error) {
+		c, err = bridge.connection.connect(ctx)
+		return err
+	})
 	check(err, "Could not connect to Glimesh websocket")
-	defer c.Close(websocket.StatusGoingAway, "app was closed")
+	bridge.goSafe(ctx, "websocket", func(ctx context.Context) {
+		// A restart after a crash dials a new connection, the first one was closed with it
+		conn := c
+		c = nil
+		bridge.connection.run(ctx, conn)
+	})
 
-	check(c.Write(ctx, websocket.MessageText, []byte("[\"1\",\"1\",\"__absinthe__:control\",\"phx_join\",{}]")), "Could not send join message")
-	check(c.Write(ctx, websocket.MessageText, []byte(fmt.Sprintf("[\"1\",\"2\",\"__absinthe__:control\",\"doc\",{\"query\":\"subscription{ chatMessage(channelId: %d) { user { username } message } }\",\"variables\":{} }]", *channelID))), "Could not send join message")
+	wsmsg := make(chan incomingChatMessage)
 
-	log.WithField("endpoint", *endpoint).Info("Connected to Kilovolt")
+	if len(generateRates) > 0 {
+		bridge.newEventGenerator(generateRates, wsmsg).run(ctx)
+	}
 
-	wsmsg := make(chan ChatMessage)
-	go func() {
-		for {
-			mtyp, byt, err := c.Read(ctx)
-			if err != nil {
-				if err != io.EOF {
-					log.WithError(err).Fatal("Could not read from websocket")
-				}
-				log.WithError(err).Fatal("Connection was closed by remote")
+	chatDocument, err := extendChatMessageDocument(chatMessagesDocument, *chatExtraFields)
+	check(err, "Invalid chat extra fields")
+	err = socket.subscribe(ctx, chatDocument, map[string]interface{}{"channelId": bridge.channelIDString()}, func(data jsoniter.RawMessage) {
+		var result ChatMessagesResponse
+		err := jsoniter.ConfigFastest.Unmarshal(data, &result)
+		if err != nil {
+			log.WithError(err).Error("Could not decode chat message")
+			return
+		}
+		if result.ChatMessage != nil {
+			incoming := incomingChatMessage{
+				ChatMessage: *result.ChatMessage,
+				timing:      pipelineTiming{received: socket.frameReceivedAt, decoded: time.Now()},
 			}
-			log.Debug(string(byt))
-			if mtyp == websocket.MessageText {
-				var msgType *string
-				var msgSubType *string
-				var subId string
-				var subType string
-				var result ChatMessageResult
-
-				payload := []interface{}{&msgType, &msgSubType, &subId, &subType, &result}
-				err := jsoniter.ConfigFastest.Unmarshal(byt, &payload)
-				if err != nil {
-					log.WithError(err).Error("Could not decode websocket message")
-					continue
-				}
+			if *chatExtraFields != "" {
+				incoming.extra = chatMessageExtraFields(data)
+			}
+			select {
+			case wsmsg <- incoming:
+			case <-ctx.Done():
+			}
+		}
+	})
+	if err != nil {
+		bridge.health.report(ComponentSubscriptions, err)
+	}
 
-				if msgType == nil && msgSubType == nil {
-					wsmsg <- result.Result.Data.ChatMessage
+	// Stays nil (never ready) if the API can't tell us about deleted messages
+	var deletedMsgs chan ChatMessage
+	if bridge.api.supports(fieldChatMessageDeleted) {
+		deletedMsgs = make(chan ChatMessage)
+		err = socket.subscribe(ctx, chatMessagesDeletedDocument, map[string]interface{}{"channelId": bridge.channelIDString()}, func(data jsoniter.RawMessage) {
+			var result ChatMessagesDeletedResponse
+			err := jsoniter.ConfigFastest.Unmarshal(data, &result)
+			if err != nil {
+				log.WithError(err).Error("Could not decode deleted chat message")
+				return
+			}
+			if result.ChatMessageDeleted != nil {
+				select {
+				case deletedMsgs <- *result.ChatMessageDeleted:
+				case <-ctx.Done():
 				}
 			}
+		})
+		if err != nil {
+			bridge.health.report(ComponentSubscriptions, err)
+		}
+	}
+
+	if *mergeChannels != "" {
+		bridge.merged = bridge.newMergedChat(ctx, append([]string{bridge.channelIDString()}, parseList(*mergeChannels)...))
+		if err := bridge.merged.subscribe(ctx, socket, wsmsg); err != nil {
+			bridge.health.report(ComponentSubscriptions, err)
 		}
-	}()
+	}
 
-	incoming, err := client.SubscribeKey(chatRPCKey)
+	err = bridge.setupChatSender(ctx, socket)
 	if err != nil {
 		log.WithError(err).Fatal("Could not subscribe to chat RPC key")
 	}
+	err = bridge.setupAnnouncements(ctx, config)
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to announcement RPC keys")
+	}
+	err = bridge.setupCannedResponses(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to canned response RPC key")
+	}
+	err = bridge.setupMarkers(ctx, *markerRole)
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to marker RPC key")
+	}
+	err = bridge.setupPolls(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to poll RPC keys")
+	}
+	err = bridge.setupQueue(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to queue RPC keys")
+	}
+	err = bridge.setupPins(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to pin RPC keys")
+	}
+	err = bridge.setupTimers(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to timer RPC keys")
+	}
+	if *monthlyReportDir != "" {
+		err = bridge.setupMonthlyReports(ctx, MonthlyReportOptions{
+			Dir:           *monthlyReportDir,
+			Format:        *monthlyReportFormat,
+			SessionReport: *sessionReport,
+		})
+		if err != nil {
+			log.WithError(err).Fatal("Could not set up monthly reports")
+		}
+	}
+	if *songRequests {
+		bridge.setupSongRequests(*songRequestHosts, *songRequestLimit)
+	}
+	err = bridge.setupHistoryRPC(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to history RPC key")
+	}
+	err = bridge.setupMaintenance(ctx, *maintenance, setFlags()["maintenance"])
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to maintenance RPC key")
+	}
+	if !bridge.readOnly {
+		err = bridge.setupFollowRPC(ctx)
+		if err != nil {
+			log.WithError(err).Fatal("Could not subscribe to follow RPC keys")
+		}
+	}
+	if *enableGraphQLRPC {
+		err = bridge.setupGraphQLRPC(ctx, *graphQLMutations)
+		if err != nil {
+			log.WithError(err).Fatal("Could not subscribe to GraphQL RPC key")
+		}
+		log.Warn("GraphQL passthrough RPC is enabled")
+	}
+
+	reloadSources := ReloadSources{
+		ConfigFile:   *configFile,
+		MessagesFile: *messagesFile,
+		HooksFile:    *hooksFile,
+		APIKeysFile:  *apiKeysFile,
+		SoundsFile:   *soundsFile,
+	}
+	err = bridge.setupReloadRPC(ctx, reloadSources)
+	if err != nil {
+		log.WithError(err).Fatal("Could not subscribe to reload RPC key")
+	}
+	if snapshots != nil {
+		bridge.goSafe(ctx, "snapshots", func(ctx context.Context) {
+			snapshots.run(ctx, *snapshotInterval)
+		})
+	}
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	defer signal.Stop(reloads)
 
 	// Create a 30 sec ticker for heartbeats to Glimesh
 	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-ticker.C:
-			check(c.Write(ctx, websocket.MessageText, []byte("[\"1\",\"3\",\"phoenix\",\"heartbeat\",{}]")), "Could not send heartbeat")
-		case msg := <-wsmsg:
-			log.WithField("user", msg.User.Username).Debug("Received message")
-			err := client.SetJSON(chatEventKey, msg)
-			if err != nil {
-				log.WithField("key", chatEventKey).WithError(err).Error("Could not set chat key")
+		case <-ctx.Done():
+			log.Info("Shutting down")
+			if snapshots != nil {
+				snapshots.save()
 			}
-			chatHistory = append(chatHistory, msg)
-			if len(chatHistory) > *chatHistorySize {
-				chatHistory = chatHistory[len(chatHistory)-*chatHistorySize:]
-			}
-			err = client.SetJSON(chatHistoryKey, chatHistory)
-			if err != nil {
-				log.WithField("key", chatHistoryKey).WithError(err).Error("Could not set chat key")
-			}
-		case kv := <-incoming:
-			log.WithField("key", kv.Key).Debug("Received RPC message")
-			// Escape and clean message
-			message := strings.TrimSpace(strings.Replace(kv.Value, "\"", "\\\"", -1))
-			// Prepare payload
-			payload := fmt.Sprintf(`mutation {createChatMessage(channelId: %d, message: {message: "%s"}) { message }}`, *channelID, message)
-			byt, err := jsoniter.ConfigFastest.Marshal([]interface{}{"1", "4", "__absinthe__:control", "doc", GQLQuery{Query: payload, Variables: map[string]interface{}{}}})
-			if err != nil {
-				log.WithError(err).Error("Could not encode chat message")
-				continue
+			return
+		case <-reloads:
+			log.Info("Received SIGHUP, reloading settings")
+			bridge.reload(reloadSources)
+		case <-ticker.C:
+			if bridge.health.healthy(ComponentSubscriptions) {
+				bridge.health.report(ComponentSubscriptions, socket.heartbeat(ctx))
 			}
-			fmt.Printf("%s\n", string(byt))
-			err = c.Write(ctx, websocket.MessageText, byt)
-			if err != nil {
-				log.WithError(err).Error("Could not send chat message")
-				continue
+		case msg := <-wsmsg:
+			bridge.protect("chat-pipeline", func() {
+				bridge.handleChatMessage(msg)
+			})
+		case msg := <-deletedMsgs:
+			log.WithFields(logrus.Fields{"user": msg.User.Username, "id": msg.ID}).Debug("Message deleted")
+			bridge.setJSON(bridge.key("ev/chat-message-deleted"), ChatMessageRetraction{ID: msg.ID, User: msg.User})
+			bridge.history.retract(msg.ID)
+			bridge.relay.retract(msg.ID)
+			bridge.audit.record(ModerationAuditEntry{
+				Action:    EscalationDelete,
+				By:        AuditByObserved,
+				User:      msg.User,
+				MessageID: msg.ID,
+				Message:   msg.Message,
+			})
+			if err := bridge.archive.retract(msg.ID); err != nil {
+				log.WithError(err).Error("Could not write to chat archive")
 			}
-			log.Debug("Sent message")
+		case config = <-configUpdates:
+			bridge.history.configure(config)
+			bridge.relay.configure(config)
+			bridge.chat.configure(config)
+			bridge.spam.configure(config)
+			bridge.escalation.configure(config)
+			bridge.announcer.configure(config)
 		}
 	}
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Sources of the messages the bridge sends on its own, suppressed in maintenance mode.
+// Messages explicitly requested through RPC, gRPC or the control socket still go through.
+var automatedSources = map[string]bool{"bridge": true, "hooks": true, "plugin": true, "pin": true}
+
+// MaintenanceStatus is written to the maintenance key
+type MaintenanceStatus struct {
+	Enabled bool      `json:"enabled"`
+	Since   time.Time `json:"since"`
+}
+
+// inMaintenance returns whether automated responses, alerts and hooks are suppressed
+func (b *Bridge) inMaintenance() bool {
+	return atomic.LoadUint32(&b.maintenance) == 1
+}
+
+// setMaintenance turns maintenance mode on or off, publishing the change
+func (b *Bridge) setMaintenance(enabled bool) {
+	value := uint32(0)
+	if enabled {
+		value = 1
+	}
+	if atomic.SwapUint32(&b.maintenance, value) == value {
+		return
+	}
+	status := MaintenanceStatus{Enabled: enabled, Since: time.Now()}
+	if enabled {
+		b.log.Warn("Maintenance mode enabled, automated responses, alerts and hooks are suppressed")
+	} else {
+		b.log.Info("Maintenance mode disabled")
+	}
+	b.setJSON(b.key("maintenance"), status)
+	b.setJSON(b.key("ev/maintenance-changed"), status)
+}
+
+// setupMaintenance restores the mode set through the RPC before a restart (unless -maintenance
+// was set explicitly) and registers the @maintenance RPC, which takes "on" or "off"
+func (b *Bridge) setupMaintenance(ctx context.Context, enabled bool, explicit bool) error {
+	status := MaintenanceStatus{Enabled: enabled, Since: time.Now()}
+	var previous MaintenanceStatus
+	if err := b.kv.GetJSON(b.key("maintenance"), &previous); err == nil && (!explicit || previous.Enabled == enabled) {
+		status = previous
+	}
+	if status.Enabled {
+		atomic.StoreUint32(&b.maintenance, 1)
+		b.log.Warn("Maintenance mode enabled, automated responses, alerts and hooks are suppressed")
+	}
+	b.setJSON(b.key("maintenance"), status)
+	return b.handleRPC(ctx, "@maintenance", func(value string) {
+		value = strings.ToLower(strings.TrimSpace(value))
+		switch value {
+		case "on":
+			b.setMaintenance(true)
+		case "off":
+			b.setMaintenance(false)
+		default:
+			on, err := strconv.ParseBool(value)
+			if err != nil {
+				b.log.WithField("value", value).Error("Invalid maintenance mode, expected on or off")
+				return
+			}
+			b.setMaintenance(on)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of recent chat messages saved with each marker
+	markerContextSize = 10
+	// Maximum number of markers kept in the list
+	maxMarkers = 500
+	// Minimum time between markers from chat, so a clip-worthy moment doesn't produce a dozen
+	markerCooldown = 10 * time.Second
+)
+
+// StreamMarker is a timestamped highlight, used to find moments when editing VODs
+type StreamMarker struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Seconds since the stream started, -1 if the stream was offline
+	StreamOffset int           `json:"stream_offset"`
+	Note         string        `json:"note"`
+	CreatedBy    string        `json:"created_by"`
+	Context      []ChatMessage `json:"context"`
+}
+
+type markerList struct {
+	bridge *Bridge
+	key    string
+
+	mu      sync.Mutex
+	markers []StreamMarker
+	last    time.Time
+}
+
+func (b *Bridge) newMarkerList() *markerList {
+	list := &markerList{bridge: b, key: b.key("markers")}
+	err := b.kv.GetJSON(list.key, &list.markers)
+	if err != nil {
+		list.markers = make([]StreamMarker, 0)
+	}
+	return list
+}
+
+// add records a new marker, skipping it if it comes from chat within the cooldown
+func (l *markerList) add(note string, createdBy string, fromChat bool) {
+	now := time.Now()
+	marker := StreamMarker{
+		Timestamp:    now,
+		StreamOffset: -1,
+		Note:         note,
+		CreatedBy:    createdBy,
+		Context:      l.bridge.history.recent(markerContextSize),
+	}
+	if startedAt, live := l.bridge.session.liveSince(); live {
+		marker.StreamOffset = int(now.Sub(startedAt).Seconds())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if fromChat && now.Sub(l.last) < markerCooldown {
+		return
+	}
+	l.last = now
+	l.markers = append(l.markers, marker)
+	if len(l.markers) > maxMarkers {
+		l.markers = l.markers[len(l.markers)-maxMarkers:]
+	}
+	l.bridge.log.WithField("by", createdBy).Info("Marker added")
+	l.bridge.setJSON(l.key, l.markers)
+	l.bridge.setJSON(l.bridge.key("ev/marker-added"), marker)
+}
+
+// setupMarkers registers the !clip/!marker chat commands, for users with at least minRole, and the @add-marker RPC
+func (b *Bridge) setupMarkers(ctx context.Context, minRole string) error {
+	b.markers = b.newMarkerList()
+	b.commands.register(func(msg ChatMessage, args string) {
+		if !roleAtLeast(b.chatRole(msg), minRole) {
+			return
+		}
+		b.markers.add(args, msg.User.Username, true)
+	}, "clip", "marker")
+	return b.handleRPC(ctx, "@add-marker", func(value string) {
+		b.markers.add(strings.TrimSpace(value), "rpc", false)
+	})
+}
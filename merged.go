@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Colors assigned to bridged channels, picked by hashing the channel ID so
+// each channel keeps the same color across restarts
+var channelColors = []string{
+	"#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4",
+	"#42d4f4", "#f032e6", "#bfef45", "#fabed4", "#469990",
+}
+
+// ChannelOrigin identifies which bridged channel an event comes from
+type ChannelOrigin struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Color       string `json:"color"`
+}
+
+func channelColor(channelID string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(channelID))
+	return channelColors[h.Sum32()%uint32(len(channelColors))]
+}
+
+// mergedChat publishes the chat of the bridged channel and any extra channels to a single feed
+type mergedChat struct {
+	bridge  *Bridge
+	origins map[string]ChannelOrigin
+}
+
+// newMergedChat resolves the names of all the merged channels, falling back to their ID
+func (b *Bridge) newMergedChat(ctx context.Context, channelIDs []string) *mergedChat {
+	merged := &mergedChat{bridge: b, origins: make(map[string]ChannelOrigin)}
+	for _, id := range channelIDs {
+		origin := ChannelOrigin{ChannelID: id, ChannelName: id, Color: channelColor(id)}
+		result, err := b.api.FetchChannel(ctx, id)
+		if err != nil {
+			b.log.WithError(err).WithField("channel-id", id).Warn("Could not fetch merged channel info")
+		} else if result.Channel != nil {
+			origin.ChannelName = result.Channel.Streamer.Displayname
+		}
+		merged.origins[id] = origin
+	}
+	return merged
+}
+
+// origin returns the origin of messages sent in a channel, nil if chat isn't merged
+func (m *mergedChat) origin(channelID string) *ChannelOrigin {
+	if m == nil {
+		return nil
+	}
+	origin, ok := m.origins[channelID]
+	if !ok {
+		return nil
+	}
+	return &origin
+}
+
+// publish writes a chat event (already tagged with its origin) to the merged feed
+func (m *mergedChat) publish(event ChatEvent) {
+	m.bridge.setJSON(m.bridge.key("ev/merged-chat-message"), event)
+}
+
+// subscribe listens to the chat of the extra (non-bridged) channels and feeds their messages
+// to the chat pipeline like ours, which only publishes them to the merged feed
+func (m *mergedChat) subscribe(ctx context.Context, socket *glimeshSocket, chat chan<- incomingChatMessage) error {
+	for id := range m.origins {
+		if id == m.bridge.channelIDString() {
+			continue
+		}
+		channelID := id
+		err := socket.subscribe(ctx, chatMessagesDocument, map[string]interface{}{"channelId": channelID}, func(data jsoniter.RawMessage) {
+			var result ChatMessagesResponse
+			err := jsoniter.ConfigFastest.Unmarshal(data, &result)
+			if err != nil {
+				m.bridge.log.WithError(err).Error("Could not decode merged chat message")
+				return
+			}
+			if result.ChatMessage != nil {
+				incoming := incomingChatMessage{
+					ChatMessage: *result.ChatMessage,
+					channelID:   channelID,
+					timing:      pipelineTiming{received: socket.frameReceivedAt, decoded: time.Now()},
+				}
+				select {
+				case chat <- incoming:
+				case <-ctx.Done():
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
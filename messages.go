@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// defaultMessages are the chat messages sent by the bridge itself, by ID.
+// They can be translated or changed with a messages file, an empty message disables it.
+var defaultMessages = map[string]string{
+	"welcome.first-time":   "Welcome to the stream @{{.User}}!",
+	"queue.joined":         "@{{.User}} you are #{{.Vars.position}} in the queue",
+	"queue.left":           "@{{.User}} you left the queue",
+	"queue.next":           "@{{.User}} it's your turn!",
+	"songrequest.accepted": "@{{.User}} your song request was added",
+	"songrequest.invalid":  "@{{.User}} that's not a valid link",
+	"songrequest.blocked":  "@{{.User}} songs from that site are not allowed",
+	"songrequest.limit":    "@{{.User}} you have reached the song request limit, try again later",
+	"moderation.warn":      "@{{.User}} please don't spam, repeat offenses will get you timed out",
+}
+
+// loadMessages returns the default messages, overridden by those in the JSON file at path (if set)
+func loadMessages(path string) (map[string]string, error) {
+	messages := make(map[string]string)
+	for id, text := range defaultMessages {
+		messages[id] = text
+	}
+	if path == "" {
+		return messages, nil
+	}
+
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var overrides map[string]string
+	err = jsoniter.ConfigFastest.Unmarshal(byt, &overrides)
+	if err != nil {
+		return nil, err
+	}
+	for id, text := range overrides {
+		messages[id] = text
+	}
+	return messages, nil
+}
+
+// say sends one of the bridge messages to chat, vars are available in the template as {{.Vars.name}}
+func (b *Bridge) say(id string, user string, vars map[string]interface{}) {
+	text := b.message(id)
+	if text == "" {
+		return
+	}
+	data := b.templateData(user)
+	data.Vars = vars
+	rendered, err := b.renderTemplate(text, data)
+	if err != nil {
+		b.log.WithError(err).WithField("message", id).Error("Could not render bridge message")
+		return
+	}
+	b.chat.send(ChatSendRequest{Message: rendered, Raw: true, Source: "bridge", Requester: user})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+type metricLabel struct {
+	Name  string
+	Value string
+}
+
+// metricSample is a single value of a metric at collection time
+type metricSample struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []metricLabel
+	Value  float64
+}
+
+// metricsCollector counts bridge events and exposes them, along with the stream status,
+// in the Prometheus text format on /metrics or by pushing them somewhere
+type metricsCollector struct {
+	bridge *Bridge
+
+	mu     sync.Mutex
+	events map[string]int64
+	sent   map[string]int64
+}
+
+func (b *Bridge) newMetricsCollector() *metricsCollector {
+	return &metricsCollector{bridge: b, events: make(map[string]int64), sent: make(map[string]int64)}
+}
+
+// run counts events from the event bus until ctx is cancelled
+func (m *metricsCollector) run(ctx context.Context) {
+	events := m.bridge.events.subscribe()
+	defer m.bridge.events.unsubscribe(events)
+	for {
+		event, ok := events.next(ctx)
+		if !ok {
+			return
+		}
+		m.mu.Lock()
+		m.events[event.Name]++
+		if event.Name == "chat-send-result" {
+			var result ChatSendResult
+			if jsoniter.ConfigFastest.Unmarshal(event.Payload, &result) == nil {
+				m.sent[result.Status]++
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+func sortedCounters(counters map[string]int64, name string, help string, label string) []metricSample {
+	keys := make([]string, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	samples := make([]metricSample, 0, len(keys))
+	for _, key := range keys {
+		samples = append(samples, metricSample{
+			Name:   name,
+			Help:   help,
+			Type:   "counter",
+			Labels: []metricLabel{{label, key}},
+			Value:  float64(counters[key]),
+		})
+	}
+	return samples
+}
+
+func (m *metricsCollector) samples() []metricSample {
+	m.mu.Lock()
+	samples := sortedCounters(m.events, "glimesh_bridge_events_total", "Number of events published by the bridge", "event")
+	samples = append(samples, sortedCounters(m.sent, "glimesh_bridge_chat_messages_sent_total", "Number of outgoing chat messages by result", "status")...)
+	m.mu.Unlock()
+
+	live, viewers := 0.0, 0.0
+	if info, ok := m.bridge.channelInfo(); ok && info.Status == "LIVE" && info.Stream != nil {
+		live = 1
+		viewers = float64(info.Stream.CountViewers)
+	}
+	samples = append(samples,
+		metricSample{Name: "glimesh_bridge_stream_live", Help: "Whether the stream is live", Type: "gauge", Value: live},
+		metricSample{Name: "glimesh_bridge_stream_viewers", Help: "Current number of viewers", Type: "gauge", Value: viewers},
+	)
+	samples = append(samples, metricSample{
+		Name:  "glimesh_bridge_events_dropped_total",
+		Help:  "Number of events not delivered to a consumer because its buffer was full",
+		Type:  "counter",
+		Value: float64(m.bridge.events.droppedCount()),
+	})
+	m.bridge.cachesMu.Lock()
+	caches := m.bridge.caches
+	m.bridge.cachesMu.Unlock()
+	evictions := make([]metricSample, 0, len(caches))
+	for _, cache := range caches {
+		used, evicted := cache.usage()
+		labels := []metricLabel{{"cache", cache.name}}
+		samples = append(samples, metricSample{Name: "glimesh_bridge_cache_memory_bytes", Help: "Estimated memory used by a cache", Type: "gauge", Labels: labels, Value: float64(used)})
+		evictions = append(evictions, metricSample{Name: "glimesh_bridge_cache_evictions_total", Help: "Number of entries evicted from a cache to stay under its memory limit", Type: "counter", Labels: labels, Value: float64(evicted)})
+	}
+	samples = append(samples, evictions...)
+	if cache := m.bridge.api.cache; cache != nil {
+		hits, misses, coalesced := cache.stats()
+		samples = append(samples,
+			metricSample{Name: "glimesh_bridge_api_cache_hits_total", Help: "Number of API queries answered from the cache", Type: "counter", Value: float64(hits)},
+			metricSample{Name: "glimesh_bridge_api_cache_misses_total", Help: "Number of cacheable API queries sent to Glimesh", Type: "counter", Value: float64(misses)},
+			metricSample{Name: "glimesh_bridge_api_cache_coalesced_total", Help: "Number of API queries that waited for an identical query already in flight", Type: "counter", Value: float64(coalesced)},
+		)
+	}
+	conn := m.bridge.connStats.current()
+	usage := m.bridge.resourceUsage()
+	samples = append(samples,
+		metricSample{Name: "glimesh_bridge_websocket_rtt_seconds", Help: "Round-trip time of the last Glimesh heartbeat", Type: "gauge", Value: conn.RTTMillis / 1000},
+		metricSample{Name: "glimesh_bridge_websocket_frames_total", Help: "Number of frames received from Glimesh", Type: "counter", Value: float64(conn.Frames)},
+		metricSample{Name: "glimesh_bridge_websocket_decode_errors_total", Help: "Number of frames from Glimesh that could not be decoded", Type: "counter", Value: float64(conn.DecodeErrors)},
+		metricSample{Name: "glimesh_bridge_websocket_disconnects_total", Help: "Number of times the Glimesh websocket was lost", Type: "counter", Value: float64(conn.GlimeshDisconnects)},
+		metricSample{Name: "glimesh_bridge_websocket_reconnects_total", Help: "Number of times the Glimesh websocket was reconnected", Type: "counter", Value: float64(conn.GlimeshReconnects)},
+		metricSample{Name: "glimesh_bridge_goroutines", Help: "Number of running goroutines", Type: "gauge", Value: float64(usage.Goroutines)},
+		metricSample{Name: "glimesh_bridge_http_connections", Help: "Open connections to the embedded HTTP server", Type: "gauge", Value: float64(usage.HTTPConnections)},
+		metricSample{Name: "glimesh_bridge_event_subscribers", Help: "Number of in-process event consumers", Type: "gauge", Value: float64(usage.EventSubscribers)},
+		metricSample{Name: "glimesh_bridge_queue_depth", Help: "Number of items waiting in a queue", Type: "gauge", Labels: []metricLabel{{"queue", "events"}}, Value: float64(usage.EventBacklog)},
+		metricSample{Name: "glimesh_bridge_queue_depth", Help: "Number of items waiting in a queue", Type: "gauge", Labels: []metricLabel{{"queue", "chat-send"}}, Value: float64(usage.ChatSendQueue)},
+		metricSample{Name: "glimesh_bridge_queue_depth", Help: "Number of items waiting in a queue", Type: "gauge", Labels: []metricLabel{{"queue", "relay"}}, Value: float64(usage.RelayBacklog)},
+		metricSample{Name: "glimesh_bridge_crashes_total", Help: "Number of panics recovered by the bridge", Type: "counter", Value: float64(atomic.LoadUint64(&m.bridge.crashes))},
+	)
+	if store, ok := m.bridge.kv.(*multiStore); ok {
+		samples = append(samples, metricSample{
+			Name:  "glimesh_bridge_kv_reconnects_total",
+			Help:  "Number of times a Kilovolt endpoint was reconnected",
+			Type:  "counter",
+			Value: float64(store.reconnectCount()),
+		})
+		samples = append(samples, metricSample{
+			Name:  "glimesh_bridge_kv_endpoints_connected",
+			Help:  "Number of Kilovolt endpoints currently connected",
+			Type:  "gauge",
+			Value: float64(store.connectedCount()),
+		})
+	}
+	return samples
+}
+
+// writePrometheus writes samples in the Prometheus text exposition format
+func writePrometheus(w io.Writer, samples []metricSample) {
+	last := ""
+	for _, sample := range samples {
+		if sample.Name != last {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", sample.Name, sample.Help, sample.Name, sample.Type)
+			last = sample.Name
+		}
+		fmt.Fprint(w, sample.Name)
+		if len(sample.Labels) > 0 {
+			labels := make([]string, len(sample.Labels))
+			for i, label := range sample.Labels {
+				labels[i] = label.Name + "=" + strconv.Quote(label.Value)
+			}
+			fmt.Fprintf(w, "{%s}", strings.Join(labels, ","))
+		}
+		fmt.Fprintf(w, " %s\n", strconv.FormatFloat(sample.Value, 'g', -1, 64))
+	}
+}
+
+var influxEscaper = strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ")
+
+// writeInflux writes samples in the InfluxDB line protocol, one measurement per metric
+func writeInflux(w io.Writer, samples []metricSample, channelID string, timestamp time.Time) {
+	for _, sample := range samples {
+		fmt.Fprintf(w, "%s,channel=%s", sample.Name, influxEscaper.Replace(channelID))
+		for _, label := range sample.Labels {
+			fmt.Fprintf(w, ",%s=%s", label.Name, influxEscaper.Replace(label.Value))
+		}
+		fmt.Fprintf(w, " value=%s %d\n", strconv.FormatFloat(sample.Value, 'g', -1, 64), timestamp.UnixNano())
+	}
+}
+
+// ServeHTTP serves the metrics for Prometheus scraping
+func (m *metricsCollector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writePrometheus(w, m.samples())
+}
+
+// MetricsPushOptions configures pushing metrics to a Prometheus pushgateway or InfluxDB
+type MetricsPushOptions struct {
+	URL string
+	// Format is "prometheus" (pushgateway) or "influx" (line protocol)
+	Format   string
+	Interval time.Duration
+	// Token is sent in the Authorization header, if set
+	Token string
+}
+
+// push sends the metrics every interval until ctx is cancelled
+func (m *metricsCollector) push(ctx context.Context, options MetricsPushOptions) {
+	url := options.URL
+	if options.Format == "prometheus" && !strings.Contains(url, "/metrics/job/") {
+		url = strings.TrimSuffix(url, "/") + "/metrics/job/glimesh-bridge/instance/" + m.bridge.channelIDString()
+	}
+	logger := m.bridge.log.WithField("url", options.URL)
+
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var body bytes.Buffer
+		contentType := "text/plain; version=0.0.4"
+		if options.Format == "influx" {
+			writeInflux(&body, m.samples(), m.bridge.channelIDString(), time.Now())
+			contentType = "text/plain; charset=utf-8"
+		} else {
+			writePrometheus(&body, m.samples())
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+		if err != nil {
+			logger.WithError(err).Error("Could not create metrics push request")
+			return
+		}
+		req.Header.Set("Content-Type", contentType)
+		if options.Token != "" {
+			if options.Format == "influx" {
+				req.Header.Set("Authorization", "Token "+options.Token)
+			} else {
+				req.Header.Set("Authorization", "Bearer "+options.Token)
+			}
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			logger.WithError(err).Warn("Could not push metrics")
+			continue
+		}
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		if res.StatusCode >= 300 {
+			logger.WithField("status", res.Status).Warn("Metrics push was rejected")
+		}
+	}
+}
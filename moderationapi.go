@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// API fields used by the moderation features that aren't in schema/glimesh.json: they
+// haven't been checked against an introspection of the live API, so their documents
+// are written by hand and only used if detectFields finds them at startup.
+const (
+	fieldChatMessageDeleted = "chatMessageDeleted"
+	fieldDeleteChatMessage  = "deleteChatMessage"
+	fieldShortTimeoutUser   = "shortTimeoutUser"
+	fieldLongTimeoutUser    = "longTimeoutUser"
+	fieldBanUser            = "banUser"
+)
+
+// Features disabled when each optional field is missing, for the startup log
+var optionalAPIFields = map[string]string{
+	fieldChatMessageDeleted: "removing messages deleted by moderators from history",
+	fieldDeleteChatMessage:  "deleting messages (spam filter, escalation, gRPC DeleteMessage)",
+	fieldShortTimeoutUser:   "short timeouts in the escalation ladder",
+	fieldLongTimeoutUser:    "long timeouts in the escalation ladder",
+	fieldBanUser:            "bans in the escalation ladder",
+}
+
+const rootFieldsDocument = `query RootFields {
+	__schema {
+		mutationType { fields { name } }
+		subscriptionType { fields { name } }
+	}
+}`
+
+type rootFieldsType struct {
+	Fields []struct {
+		Name string `json:"name"`
+	} `json:"fields"`
+}
+
+type rootFieldsResponse struct {
+	Schema struct {
+		MutationType     *rootFieldsType `json:"mutationType"`
+		SubscriptionType *rootFieldsType `json:"subscriptionType"`
+	} `json:"__schema"`
+}
+
+const chatMessagesDeletedDocument = `subscription ChatMessagesDeleted($channelId: ID!) {
+	chatMessageDeleted(channelId: $channelId) {
+		...ChatMessage
+	}
+}
+
+fragment ChatMessage on ChatMessage {
+	id
+	message
+	user { id username }
+	metadata { admin moderator streamer subscriber platformFounderSubscriber platformSupporterSubscriber }
+}`
+
+type ChatMessagesDeletedResponse struct {
+	ChatMessageDeleted *ChatMessage `json:"chatMessageDeleted"`
+}
+
+const deleteChatMessageDocument = `mutation DeleteChatMessage($channelId: ID!, $messageId: ID!) {
+	deleteChatMessage(channelId: $channelId, messageId: $messageId) {
+		id
+	}
+}`
+
+// userModerationDocument returns the document for a timeout or ban mutation, which all take the same arguments
+func userModerationDocument(field string) string {
+	return fmt.Sprintf(`mutation($channelId: ID!, $userId: ID!) {
+	%s(channelId: $channelId, userId: $userId) {
+		id
+	}
+}`, field)
+}
+
+// detectFields asks the API which of the optional fields it has and returns the missing ones.
+// If the introspection query fails, all of them are treated as missing.
+func (g *GlimeshClient) detectFields(ctx context.Context) ([]string, error) {
+	var result rootFieldsResponse
+	err := g.Query(ctx, rootFieldsDocument, nil, &result)
+	found := make(map[string]bool)
+	if err == nil {
+		for _, typ := range []*rootFieldsType{result.Schema.MutationType, result.Schema.SubscriptionType} {
+			if typ == nil {
+				continue
+			}
+			for _, field := range typ.Fields {
+				if _, ok := optionalAPIFields[field.Name]; ok {
+					found[field.Name] = true
+				}
+			}
+		}
+	}
+	g.mu.Lock()
+	g.fields = found
+	g.mu.Unlock()
+
+	var missing []string
+	for field := range optionalAPIFields {
+		if !found[field] {
+			missing = append(missing, field)
+		}
+	}
+	sort.Strings(missing)
+	return missing, err
+}
+
+// supports returns true if detectFields found an optional field on the API
+func (g *GlimeshClient) supports(field string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.fields[field]
+}
+
+func (g *GlimeshClient) optionalMutation(ctx context.Context, field string, document string, variables map[string]interface{}) error {
+	if !g.supports(field) {
+		return fmt.Errorf("%w: %s", ErrUnsupported, field)
+	}
+	return g.Query(ctx, document, variables, nil)
+}
+
+// DeleteChatMessage removes a message from chat
+func (g *GlimeshClient) DeleteChatMessage(ctx context.Context, channelID string, messageID string) error {
+	return g.optionalMutation(ctx, fieldDeleteChatMessage, deleteChatMessageDocument, map[string]interface{}{
+		"channelId": channelID,
+		"messageId": messageID,
+	})
+}
+
+// ModerateUser runs a timeout or ban mutation (field is one of the fieldXXXUser constants)
+func (g *GlimeshClient) ModerateUser(ctx context.Context, field string, channelID string, userID string) error {
+	return g.optionalMutation(ctx, field, userModerationDocument(field), map[string]interface{}{
+		"channelId": channelID,
+		"userId":    userID,
+	})
+}
+
+// checkAPIFields detects the optional API fields and logs the features that are disabled
+func (b *Bridge) checkAPIFields(ctx context.Context) {
+	missing, err := b.api.detectFields(ctx)
+	if err != nil {
+		b.log.WithError(err).Warn("Could not check which moderation fields the Glimesh API has, moderation actions are disabled")
+		return
+	}
+	for _, field := range missing {
+		b.log.WithField("field", field).Warnf("Glimesh API has no %s field, disabled %s", field, optionalAPIFields[field])
+	}
+	if len(missing) == 0 {
+		b.log.Debug("All optional Glimesh API fields are available")
+	}
+}
+
+// escalationField returns the API field used by an escalation step, if any
+func escalationField(action string) string {
+	switch action {
+	case EscalationShortTimeout:
+		return fieldShortTimeoutUser
+	case EscalationLongTimeout:
+		return fieldLongTimeoutUser
+	case EscalationBan:
+		return fieldBanUser
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// runNATSSink publishes every bridge event to NATS, on the <prefix>.<channel id>.<event> subject
+func (b *Bridge) runNATSSink(ctx context.Context, url string, subjectPrefix string) error {
+	conn, err := nats.Connect(url,
+		nats.Name("glimesh-bridge"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			b.log.WithError(err).Warn("Disconnected from NATS")
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			b.log.Info("Reconnected to NATS")
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	b.log.WithField("url", url).Info("Connected to NATS")
+
+	b.goSafe(ctx, "nats-sink", func(ctx context.Context) {
+		events := b.events.subscribe()
+		defer b.events.unsubscribe(events)
+		for {
+			event, ok := events.next(ctx)
+			if !ok {
+				conn.Close()
+				return
+			}
+			subject := fmt.Sprintf("%s.%d.%s", subjectPrefix, b.channelID, event.Name)
+			err := conn.Publish(subject, event.Payload)
+			if err != nil {
+				b.log.WithError(err).WithField("subject", subject).Warn("Could not publish event to NATS")
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"nhooyr.io/websocket"
+)
+
+// obs-websocket (v5) opcodes
+const (
+	obsOpHello           = 0
+	obsOpIdentify        = 1
+	obsOpIdentified      = 2
+	obsOpRequest         = 6
+	obsOpRequestResponse = 7
+)
+
+const (
+	obsRPCVersion     = 1
+	obsRequestTimeout = 10 * time.Second
+	// Delay before reconnecting to OBS, doubled after every failed attempt
+	obsRetryDelay    = time.Second
+	obsMaxRetryDelay = time.Minute
+)
+
+var errOBSNotConnected = errors.New("not connected to OBS")
+
+// OBSAction is an action run on OBS by a hook, only one of Scene, Source and TextSource should be set
+type OBSAction struct {
+	// Scene switches the program scene
+	Scene string `json:"scene,omitempty"`
+	// Source shows or hides a source in SourceScene (the current program scene if empty),
+	// toggling it if Visible is not set
+	Source      string `json:"source,omitempty"`
+	SourceScene string `json:"source_scene,omitempty"`
+	Visible     *bool  `json:"visible,omitempty"`
+	// TextSource sets the text of a text source to Text
+	TextSource string `json:"text_source,omitempty"`
+	Text       string `json:"text,omitempty"`
+}
+
+type obsMessage struct {
+	Op int                 `json:"op"`
+	D  jsoniter.RawMessage `json:"d"`
+}
+
+type obsHello struct {
+	Authentication *struct {
+		Challenge string `json:"challenge"`
+		Salt      string `json:"salt"`
+	} `json:"authentication"`
+}
+
+type obsResponse struct {
+	RequestID     string `json:"requestId"`
+	RequestStatus struct {
+		Result  bool   `json:"result"`
+		Code    int    `json:"code"`
+		Comment string `json:"comment"`
+	} `json:"requestStatus"`
+	ResponseData jsoniter.RawMessage `json:"responseData"`
+}
+
+// obsClient keeps a connection to obs-websocket, reconnecting when it drops
+type obsClient struct {
+	// Last request ID, first so it's 64-bit aligned for atomic operations
+	ref      uint64
+	url      string
+	password string
+	log      logrus.FieldLogger
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	pending map[string]chan obsResponse
+}
+
+func newOBSClient(url string, password string, log logrus.FieldLogger) *obsClient {
+	return &obsClient{url: url, password: password, log: log.WithField("module", "obs"), pending: make(map[string]chan obsResponse)}
+}
+
+// obsAuthentication computes the authentication string for the Identify message
+func obsAuthentication(password, salt, challenge string) string {
+	secret := sha256.Sum256([]byte(password + salt))
+	auth := sha256.Sum256([]byte(base64.StdEncoding.EncodeToString(secret[:]) + challenge))
+	return base64.StdEncoding.EncodeToString(auth[:])
+}
+
+// run connects to OBS and handles responses until ctx is cancelled, reconnecting with backoff
+func (o *obsClient) run(ctx context.Context) {
+	delay := obsRetryDelay
+	for {
+		connected, err := o.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			delay = obsRetryDelay
+		}
+		o.log.WithError(err).WithField("retry-in", delay).Warn("OBS connection lost, reconnecting")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > obsMaxRetryDelay {
+			delay = obsMaxRetryDelay
+		}
+	}
+}
+
+// session runs a single connection, returning when it drops and whether it connected at all
+func (o *obsClient) session(ctx context.Context) (bool, error) {
+	conn, _, err := websocket.Dial(ctx, o.url, &websocket.DialOptions{Subprotocols: []string{"obswebsocket.json"}})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	if err := o.identify(ctx, conn); err != nil {
+		return false, err
+	}
+	o.log.Info("Connected to OBS")
+
+	o.mu.Lock()
+	o.conn = conn
+	o.mu.Unlock()
+	defer func() {
+		o.mu.Lock()
+		o.conn = nil
+		// Fail the requests still waiting for a response
+		for id, result := range o.pending {
+			close(result)
+			delete(o.pending, id)
+		}
+		o.mu.Unlock()
+	}()
+
+	for {
+		message, err := o.read(ctx, conn)
+		if err != nil {
+			return true, err
+		}
+		if message.Op != obsOpRequestResponse {
+			continue
+		}
+		var response obsResponse
+		if err := jsoniter.ConfigFastest.Unmarshal(message.D, &response); err != nil {
+			o.log.WithError(err).Warn("Could not decode OBS response")
+			continue
+		}
+		o.mu.Lock()
+		result, ok := o.pending[response.RequestID]
+		delete(o.pending, response.RequestID)
+		o.mu.Unlock()
+		if ok {
+			result <- response
+		}
+	}
+}
+
+func (o *obsClient) read(ctx context.Context, conn *websocket.Conn) (obsMessage, error) {
+	var message obsMessage
+	_, byt, err := conn.Read(ctx)
+	if err != nil {
+		return message, err
+	}
+	err = jsoniter.ConfigFastest.Unmarshal(byt, &message)
+	return message, err
+}
+
+func (o *obsClient) write(ctx context.Context, conn *websocket.Conn, op int, data interface{}) error {
+	byt, err := jsoniter.ConfigFastest.Marshal(map[string]interface{}{"op": op, "d": data})
+	if err != nil {
+		return err
+	}
+	return conn.Write(ctx, websocket.MessageText, byt)
+}
+
+// identify completes the handshake, authenticating if OBS requires it
+func (o *obsClient) identify(ctx context.Context, conn *websocket.Conn) error {
+	message, err := o.read(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if message.Op != obsOpHello {
+		return fmt.Errorf("unexpected OBS message (op %d) instead of hello", message.Op)
+	}
+	var hello obsHello
+	if err := jsoniter.ConfigFastest.Unmarshal(message.D, &hello); err != nil {
+		return err
+	}
+	// Don't subscribe to any OBS event, the bridge only sends requests
+	identify := map[string]interface{}{"rpcVersion": obsRPCVersion, "eventSubscriptions": 0}
+	if hello.Authentication != nil {
+		identify["authentication"] = obsAuthentication(o.password, hello.Authentication.Salt, hello.Authentication.Challenge)
+	}
+	if err := o.write(ctx, conn, obsOpIdentify, identify); err != nil {
+		return err
+	}
+	message, err = o.read(ctx, conn)
+	if err != nil {
+		// OBS closes the connection if authentication fails
+		return fmt.Errorf("OBS refused identification (wrong password?): %w", err)
+	}
+	if message.Op != obsOpIdentified {
+		return fmt.Errorf("unexpected OBS message (op %d) instead of identified", message.Op)
+	}
+	return nil
+}
+
+// request sends an obs-websocket request and waits for its response data
+func (o *obsClient) request(ctx context.Context, requestType string, data interface{}) (jsoniter.RawMessage, error) {
+	id := strconv.FormatUint(atomic.AddUint64(&o.ref, 1), 10)
+	result := make(chan obsResponse, 1)
+	o.mu.Lock()
+	conn := o.conn
+	if conn == nil {
+		o.mu.Unlock()
+		return nil, errOBSNotConnected
+	}
+	o.pending[id] = result
+	o.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, obsRequestTimeout)
+	defer cancel()
+	request := map[string]interface{}{"requestType": requestType, "requestId": id}
+	if data != nil {
+		request["requestData"] = data
+	}
+	err := o.write(ctx, conn, obsOpRequest, request)
+	if err == nil {
+		select {
+		case response, ok := <-result:
+			if !ok {
+				return nil, errOBSNotConnected
+			}
+			if !response.RequestStatus.Result {
+				return nil, fmt.Errorf("%s failed (code %d): %s", requestType, response.RequestStatus.Code, response.RequestStatus.Comment)
+			}
+			return response.ResponseData, nil
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	o.mu.Lock()
+	delete(o.pending, id)
+	o.mu.Unlock()
+	return nil, err
+}
+
+// setSourceVisible shows or hides a source in a scene, toggling it if visible is nil
+func (o *obsClient) setSourceVisible(ctx context.Context, scene string, source string, visible *bool) error {
+	if scene == "" {
+		data, err := o.request(ctx, "GetCurrentProgramScene", nil)
+		if err != nil {
+			return err
+		}
+		var current struct {
+			SceneName string `json:"currentProgramSceneName"`
+		}
+		if err := jsoniter.ConfigFastest.Unmarshal(data, &current); err != nil {
+			return err
+		}
+		scene = current.SceneName
+	}
+	data, err := o.request(ctx, "GetSceneItemId", map[string]interface{}{"sceneName": scene, "sourceName": source})
+	if err != nil {
+		return err
+	}
+	var item struct {
+		ID int `json:"sceneItemId"`
+	}
+	if err := jsoniter.ConfigFastest.Unmarshal(data, &item); err != nil {
+		return err
+	}
+	if visible == nil {
+		data, err := o.request(ctx, "GetSceneItemEnabled", map[string]interface{}{"sceneName": scene, "sceneItemId": item.ID})
+		if err != nil {
+			return err
+		}
+		var state struct {
+			Enabled bool `json:"sceneItemEnabled"`
+		}
+		if err := jsoniter.ConfigFastest.Unmarshal(data, &state); err != nil {
+			return err
+		}
+		toggled := !state.Enabled
+		visible = &toggled
+	}
+	_, err = o.request(ctx, "SetSceneItemEnabled", map[string]interface{}{"sceneName": scene, "sceneItemId": item.ID, "sceneItemEnabled": *visible})
+	return err
+}
+
+// runAction performs an OBS action, render resolves the templates in names and text
+func (o *obsClient) runAction(ctx context.Context, action OBSAction, render func(string) string) error {
+	switch {
+	case action.Scene != "":
+		_, err := o.request(ctx, "SetCurrentProgramScene", map[string]interface{}{"sceneName": render(action.Scene)})
+		return err
+	case action.Source != "":
+		return o.setSourceVisible(ctx, render(action.SourceScene), render(action.Source), action.Visible)
+	case action.TextSource != "":
+		_, err := o.request(ctx, "SetInputSettings", map[string]interface{}{
+			"inputName":     render(action.TextSource),
+			"inputSettings": map[string]interface{}{"text": render(action.Text)},
+		})
+		return err
+	}
+	return nil
+}
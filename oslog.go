@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Log outputs for -log-output
+const (
+	LogOutputConsole = "console"
+	// LogOutputEventLog is the Windows Event Log
+	LogOutputEventLog = "eventlog"
+	// LogOutputOSLog is the macOS unified logging system
+	LogOutputOSLog = "oslog"
+	// LogOutputSyslog is the system logger on other Unix systems
+	LogOutputSyslog = "syslog"
+)
+
+// Source name used by the OS logging backends
+const osLogSource = "glimesh-bridge"
+
+// osLogHook sends log entries to a native OS logging backend
+type osLogHook struct {
+	writer    osLogWriter
+	formatter logrus.Formatter
+}
+
+// osLogWriter writes a message to an OS logging backend at the closest matching level
+type osLogWriter interface {
+	write(level logrus.Level, message string) error
+}
+
+func (h *osLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *osLogHook) Fire(entry *logrus.Entry) error {
+	line, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	return h.writer.write(entry.Level, string(line))
+}
+
+// setLogOutput sends logs to the OS logging backend selected with -log-output instead of
+// the console, so the bridge shows up in the platform log viewer when run as a service
+func setLogOutput(log *logrus.Logger, output string) error {
+	if output == LogOutputConsole {
+		return nil
+	}
+	writer, err := openOSLog(output)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %w", output, err)
+	}
+	// The backends add their own timestamps and levels
+	log.AddHook(&osLogHook{
+		writer:    writer,
+		formatter: &logrus.TextFormatter{DisableColors: true, DisableTimestamp: true},
+	})
+	log.SetOutput(io.Discard)
+	return nil
+}
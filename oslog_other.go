@@ -0,0 +1,9 @@
+//go:build plan9 || js || wasip1
+
+package main
+
+import "fmt"
+
+func openOSLog(output string) (osLogWriter, error) {
+	return nil, fmt.Errorf("no OS logging backend on this platform")
+}
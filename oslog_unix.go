@@ -0,0 +1,45 @@
+//go:build !windows && !plan9 && !js && !wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+	"runtime"
+
+	"github.com/sirupsen/logrus"
+)
+
+type syslogWriter struct {
+	log *syslog.Writer
+}
+
+// openOSLog connects to the system logger. On macOS, syslog messages go to the
+// unified logging system, where they can be read with Console.app or `log show`.
+func openOSLog(output string) (osLogWriter, error) {
+	switch {
+	case output == LogOutputSyslog:
+	case output == LogOutputOSLog && runtime.GOOS == "darwin":
+	default:
+		return nil, fmt.Errorf("unsupported log output %q on %s, expected console, syslog or oslog (macOS only)", output, runtime.GOOS)
+	}
+	log, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, osLogSource)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{log: log}, nil
+}
+
+func (w *syslogWriter) write(level logrus.Level, message string) error {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return w.log.Crit(message)
+	case logrus.ErrorLevel:
+		return w.log.Err(message)
+	case logrus.WarnLevel:
+		return w.log.Warning(message)
+	case logrus.InfoLevel:
+		return w.log.Info(message)
+	}
+	return w.log.Debug(message)
+}
@@ -0,0 +1,43 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Event ID of all the entries written by the bridge
+const eventLogID = 1
+
+type eventLogWriter struct {
+	log *eventlog.Log
+}
+
+// openOSLog opens the Windows Event Log, registering the event source if it can
+// (it needs administrator rights the first time, entries are still written without it)
+func openOSLog(output string) (osLogWriter, error) {
+	if output != LogOutputEventLog {
+		return nil, fmt.Errorf("unsupported log output %q on Windows, expected console or eventlog", output)
+	}
+	_ = eventlog.InstallAsEventCreate(osLogSource, eventlog.Error|eventlog.Warning|eventlog.Info)
+	log, err := eventlog.Open(osLogSource)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogWriter{log: log}, nil
+}
+
+func (w *eventLogWriter) write(level logrus.Level, message string) error {
+	message = strings.TrimSuffix(message, "\n")
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		return w.log.Error(eventLogID, message)
+	case logrus.WarnLevel:
+		return w.log.Warning(eventLogID, message)
+	}
+	return w.log.Info(eventLogID, message)
+}
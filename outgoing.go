@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Number of entries kept in the outgoing/audit-log key
+const outgoingLogSize = 500
+
+// OutgoingAuditEntry records the outcome of a message the bridge sent (or tried to send) to chat
+type OutgoingAuditEntry struct {
+	Time      time.Time `json:"time"`
+	ID        string    `json:"id,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Requester string    `json:"requester,omitempty"`
+	Message   string    `json:"message"`
+	// Status is the final status of the message: "sent", "dropped", "failed", "rejected" or "suppressed"
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// outgoingAudit keeps the most recent outgoing messages in KV, and all of them
+// in a JSON lines file if configured, so streamers can review what automation posted
+type outgoingAudit struct {
+	bridge *Bridge
+	key    string
+	path   string
+
+	mu      sync.Mutex
+	entries []OutgoingAuditEntry
+}
+
+func (b *Bridge) newOutgoingAudit(path string) *outgoingAudit {
+	audit := &outgoingAudit{bridge: b, key: b.key("outgoing/audit-log"), path: path}
+	err := b.kv.GetJSON(audit.key, &audit.entries)
+	if err != nil || audit.entries == nil {
+		audit.entries = make([]OutgoingAuditEntry, 0)
+	}
+	return audit
+}
+
+// record adds the result of a send, delayed messages are recorded once they're sent
+func (a *outgoingAudit) record(result ChatSendResult) {
+	if result.Status == "delayed" {
+		return
+	}
+	entry := OutgoingAuditEntry{
+		Time:      time.Now(),
+		ID:        result.ID,
+		Source:    result.Source,
+		Requester: result.Requester,
+		Message:   result.Message,
+		Status:    result.Status,
+		Error:     result.Error,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, entry)
+	if len(a.entries) > outgoingLogSize {
+		a.entries = a.entries[len(a.entries)-outgoingLogSize:]
+	}
+	a.bridge.setJSON(a.key, a.entries)
+	if a.path != "" {
+		if err := a.write(entry); err != nil {
+			a.bridge.log.WithError(err).Error("Could not write to outgoing message log")
+		}
+	}
+}
+
+func (a *outgoingAudit) write(entry OutgoingAuditEntry) error {
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return jsoniter.ConfigFastest.NewEncoder(file).Encode(entry)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// Minimal Parquet writer for flat tables of required columns: a single row group,
+// one uncompressed PLAIN encoded data page per column. Enough for analytics exports
+// to be read by pandas, DuckDB, Spark and friends without pulling in a full implementation.
+
+// Parquet physical and converted types used by the writer
+const (
+	parquetTypeInt64     = 2
+	parquetTypeByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+)
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol, as used by Parquet metadata
+type thriftWriter struct {
+	buf    bytes.Buffer
+	fields []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	t.buf.Write(tmp[:n])
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftWriter) field(id int16, kind byte) {
+	last := int16(0)
+	if len(t.fields) > 0 {
+		last = t.fields[len(t.fields)-1]
+	}
+	if delta := id - last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		t.buf.WriteByte(kind)
+		t.zigzag(int64(id))
+	}
+	if len(t.fields) > 0 {
+		t.fields[len(t.fields)-1] = id
+	}
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) binary(v string) {
+	t.varint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
+
+func (t *thriftWriter) string(id int16, v string) {
+	t.field(id, thriftBinary)
+	t.binary(v)
+}
+
+func (t *thriftWriter) listHeader(id int16, kind byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | kind)
+	} else {
+		t.buf.WriteByte(0xf0 | kind)
+		t.varint(uint64(size))
+	}
+}
+
+// begin starts a struct, as a field (id > 0) or as a list element (id == 0)
+func (t *thriftWriter) begin(id int16) {
+	if id > 0 {
+		t.field(id, thriftStruct)
+	}
+	t.fields = append(t.fields, 0)
+}
+
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.fields = t.fields[:len(t.fields)-1]
+}
+
+// exportColumn is a column of an exported table
+type exportColumn struct {
+	Name string
+	// Timestamp columns hold time.Time values (written as milliseconds), the others strings
+	Timestamp bool
+}
+
+// writeParquet writes rows (strings, or time.Time for timestamp columns) as a Parquet file
+func writeParquet(w io.Writer, columns []exportColumn, rows [][]interface{}) error {
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+
+	type chunk struct {
+		offset int64
+		size   int64
+	}
+	chunks := make([]chunk, len(columns))
+	for c, column := range columns {
+		var values bytes.Buffer
+		for _, row := range rows {
+			if column.Timestamp {
+				_ = binary.Write(&values, binary.LittleEndian, row[c].(time.Time).UnixMilli())
+			} else {
+				value := row[c].(string)
+				_ = binary.Write(&values, binary.LittleEndian, uint32(len(value)))
+				values.WriteString(value)
+			}
+		}
+
+		var header thriftWriter
+		header.begin(0)
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(values.Len()))
+		header.i32(3, int32(values.Len()))
+		header.begin(5)
+		header.i32(1, int32(len(rows)))
+		header.i32(2, 0) // PLAIN
+		header.i32(3, 3) // RLE
+		header.i32(4, 3) // RLE
+		header.end()
+		header.end()
+
+		chunks[c] = chunk{offset: int64(file.Len()), size: int64(header.buf.Len() + values.Len())}
+		file.Write(header.buf.Bytes())
+		file.Write(values.Bytes())
+	}
+
+	var meta thriftWriter
+	meta.begin(0)
+	meta.i32(1, 1)
+	meta.listHeader(2, thriftStruct, len(columns)+1)
+	meta.begin(0)
+	meta.string(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.end()
+	for _, column := range columns {
+		meta.begin(0)
+		if column.Timestamp {
+			meta.i32(1, parquetTypeInt64)
+		} else {
+			meta.i32(1, parquetTypeByteArray)
+		}
+		meta.i32(3, 0) // REQUIRED
+		meta.string(4, column.Name)
+		if column.Timestamp {
+			meta.i32(6, parquetConvertedTimestampMillis)
+		} else {
+			meta.i32(6, parquetConvertedUTF8)
+		}
+		meta.end()
+	}
+	meta.i64(3, int64(len(rows)))
+	meta.listHeader(4, thriftStruct, 1)
+	meta.begin(0)
+	meta.listHeader(1, thriftStruct, len(columns))
+	total := int64(0)
+	for c, column := range columns {
+		meta.begin(0)
+		meta.i64(2, chunks[c].offset)
+		meta.begin(3)
+		if column.Timestamp {
+			meta.i32(1, parquetTypeInt64)
+		} else {
+			meta.i32(1, parquetTypeByteArray)
+		}
+		meta.listHeader(2, thriftI32, 1)
+		meta.zigzag(0) // PLAIN
+		meta.listHeader(3, thriftBinary, 1)
+		meta.binary(column.Name)
+		meta.i32(4, 0) // UNCOMPRESSED
+		meta.i64(5, int64(len(rows)))
+		meta.i64(6, chunks[c].size)
+		meta.i64(7, chunks[c].size)
+		meta.i64(9, chunks[c].offset)
+		meta.end()
+		meta.end()
+		total += chunks[c].size
+	}
+	meta.i64(2, total)
+	meta.i64(3, int64(len(rows)))
+	meta.end()
+	meta.string(6, "glimesh-bridge")
+	meta.end()
+
+	file.Write(meta.buf.Bytes())
+	_ = binary.Write(&file, binary.LittleEndian, uint32(meta.buf.Len()))
+	file.WriteString("PAR1")
+	_, err := w.Write(file.Bytes())
+	return err
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Phoenix serializer versions
+const (
+	phoenixSerializerV1 = "1.0.0"
+	phoenixSerializerV2 = "2.0.0"
+)
+
+// PhoenixFrame is a message in the Phoenix v2 serializer format, encoded as the array
+// [join_ref, ref, topic, event, payload]. Frames in the v1 format (a JSON object) are decoded too.
+type PhoenixFrame struct {
+	JoinRef *string
+	Ref     *string
+	Topic   string
+	Event   string
+	Payload jsoniter.RawMessage
+	// V1 is set when the frame was decoded from the v1 format
+	V1 bool
+}
+
+// phoenixFrameV1 is a message in the Phoenix v1 serializer format
+type phoenixFrameV1 struct {
+	JoinRef jsoniter.RawMessage `json:"join_ref"`
+	Ref     jsoniter.RawMessage `json:"ref"`
+	Topic   string              `json:"topic"`
+	Event   string              `json:"event"`
+	Payload jsoniter.RawMessage `json:"payload"`
+}
+
+// decodeRef decodes a join_ref/ref field, which can be null, a string or (in some servers) a number
+func decodeRef(raw jsoniter.RawMessage) (*string, error) {
+	// jsoniter decodes null array elements as empty raw messages
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var value interface{}
+	err := jsoniter.ConfigFastest.Unmarshal(raw, &value)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return &v, nil
+	case float64:
+		str := strconv.FormatFloat(v, 'f', -1, 64)
+		return &str, nil
+	}
+	return nil, fmt.Errorf("unexpected ref value %s", string(raw))
+}
+
+func (f *PhoenixFrame) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		return f.unmarshalV1(data)
+	}
+	f.V1 = false
+	var fields []jsoniter.RawMessage
+	err := jsoniter.ConfigFastest.Unmarshal(data, &fields)
+	if err != nil {
+		return fmt.Errorf("frame is not an array: %w", err)
+	}
+	if len(fields) != 5 {
+		return fmt.Errorf("expected 5 elements in frame, got %d", len(fields))
+	}
+
+	if f.JoinRef, err = decodeRef(fields[0]); err != nil {
+		return fmt.Errorf("invalid join_ref: %w", err)
+	}
+	if f.Ref, err = decodeRef(fields[1]); err != nil {
+		return fmt.Errorf("invalid ref: %w", err)
+	}
+	if err = jsoniter.ConfigFastest.Unmarshal(fields[2], &f.Topic); err != nil {
+		return fmt.Errorf("invalid topic: %w", err)
+	}
+	if err = jsoniter.ConfigFastest.Unmarshal(fields[3], &f.Event); err != nil {
+		return fmt.Errorf("invalid event: %w", err)
+	}
+	f.Payload = append(f.Payload[:0], fields[4]...)
+	return nil
+}
+
+func (f *PhoenixFrame) unmarshalV1(data []byte) error {
+	var frame phoenixFrameV1
+	err := jsoniter.ConfigFastest.Unmarshal(data, &frame)
+	if err != nil {
+		return fmt.Errorf("invalid v1 frame: %w", err)
+	}
+	if f.JoinRef, err = decodeRef(frame.JoinRef); err != nil {
+		return fmt.Errorf("invalid join_ref: %w", err)
+	}
+	if f.Ref, err = decodeRef(frame.Ref); err != nil {
+		return fmt.Errorf("invalid ref: %w", err)
+	}
+	f.Topic, f.Event, f.V1 = frame.Topic, frame.Event, true
+	f.Payload = append(f.Payload[:0], frame.Payload...)
+	return nil
+}
+
+// MarshalJSON encodes the frame in the v2 format, or in the v1 format if V1 is set
+func (f PhoenixFrame) MarshalJSON() ([]byte, error) {
+	payload := f.Payload
+	if payload == nil {
+		payload = jsoniter.RawMessage("{}")
+	}
+	if f.V1 {
+		frame := phoenixFrameV1{Topic: f.Topic, Event: f.Event, Payload: payload}
+		frame.JoinRef, _ = jsoniter.ConfigFastest.Marshal(f.JoinRef)
+		frame.Ref, _ = jsoniter.ConfigFastest.Marshal(f.Ref)
+		return jsoniter.ConfigFastest.Marshal(frame)
+	}
+	return jsoniter.ConfigFastest.Marshal([]interface{}{f.JoinRef, f.Ref, f.Topic, f.Event, payload})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func equalRef(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func TestPhoenixFrameUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    PhoenixFrame
+		payload string
+	}{
+		{
+			name:    "v2 null refs",
+			input:   `[null,null,"__absinthe__:doc:1","subscription:data",{"result":{}}]`,
+			want:    PhoenixFrame{Topic: "__absinthe__:doc:1", Event: "subscription:data"},
+			payload: `{"result":{}}`,
+		},
+		{
+			name:    "v2 string refs",
+			input:   `["1","2","__absinthe__:control","phx_reply",{"status":"ok"}]`,
+			want:    PhoenixFrame{JoinRef: strPtr("1"), Ref: strPtr("2"), Topic: "__absinthe__:control", Event: "phx_reply"},
+			payload: `{"status":"ok"}`,
+		},
+		{
+			name:    "v2 numeric refs",
+			input:   `[1,42,"phoenix","phx_reply",{}]`,
+			want:    PhoenixFrame{JoinRef: strPtr("1"), Ref: strPtr("42"), Topic: "phoenix", Event: "phx_reply"},
+			payload: `{}`,
+		},
+		{
+			name:    "v2 reply on the control topic",
+			input:   `[null,"5","__absinthe__:control","phx_reply",{"status":"ok","response":{"subscriptionId":"__absinthe__:doc:7"}}]`,
+			want:    PhoenixFrame{Ref: strPtr("5"), Topic: "__absinthe__:control", Event: "phx_reply"},
+			payload: `{"status":"ok","response":{"subscriptionId":"__absinthe__:doc:7"}}`,
+		},
+		{
+			name:    "v1 object",
+			input:   `{"join_ref":null,"ref":"3","topic":"__absinthe__:control","event":"phx_reply","payload":{"status":"ok"}}`,
+			want:    PhoenixFrame{Ref: strPtr("3"), Topic: "__absinthe__:control", Event: "phx_reply", V1: true},
+			payload: `{"status":"ok"}`,
+		},
+		{
+			name:    "v1 object with numeric ref and leading whitespace",
+			input:   " \n{\"ref\":8,\"topic\":\"phoenix\",\"event\":\"phx_reply\",\"payload\":{}}",
+			want:    PhoenixFrame{Ref: strPtr("8"), Topic: "phoenix", Event: "phx_reply", V1: true},
+			payload: `{}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var frame PhoenixFrame
+			if err := jsoniter.ConfigFastest.Unmarshal([]byte(test.input), &frame); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !equalRef(frame.JoinRef, test.want.JoinRef) || !equalRef(frame.Ref, test.want.Ref) {
+				t.Errorf("refs = %v, %v, want %v, %v", frame.JoinRef, frame.Ref, test.want.JoinRef, test.want.Ref)
+			}
+			if frame.Topic != test.want.Topic || frame.Event != test.want.Event || frame.V1 != test.want.V1 {
+				t.Errorf("got topic %q event %q v1 %v, want %q %q %v", frame.Topic, frame.Event, frame.V1, test.want.Topic, test.want.Event, test.want.V1)
+			}
+			if string(frame.Payload) != test.payload {
+				t.Errorf("payload = %s, want %s", frame.Payload, test.payload)
+			}
+		})
+	}
+}
+
+func TestPhoenixFrameUnmarshalErrors(t *testing.T) {
+	inputs := map[string]string{
+		"too short":          `[null,null,"topic","event"]`,
+		"too long":           `[null,null,"topic","event",{},{}]`,
+		"empty array":        `[]`,
+		"string":             `"phx_reply"`,
+		"number":             `42`,
+		"null":               `null`,
+		"not json":           `[null,null,`,
+		"object ref":         `[{},null,"topic","event",{}]`,
+		"numeric topic":      `[null,null,1,"event",{}]`,
+		"array event":        `[null,null,"topic",[],{}]`,
+		"v1 invalid ref":     `{"ref":[],"topic":"t","event":"e","payload":{}}`,
+		"v1 invalid topic":   `{"topic":1,"event":"e","payload":{}}`,
+		"v1 truncated":       `{"topic":"t"`,
+		"whitespace only":    ` `,
+		"boolean join_ref":   `[true,null,"topic","event",{}]`,
+		"nested array frame": `[[null,null,"topic","event",{}]]`,
+	}
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			var frame PhoenixFrame
+			if err := jsoniter.ConfigFastest.Unmarshal([]byte(input), &frame); err == nil {
+				t.Errorf("expected an error for %s", input)
+			}
+		})
+	}
+}
+
+func TestPhoenixFrameRoundTrip(t *testing.T) {
+	for _, v1 := range []bool{false, true} {
+		frame := PhoenixFrame{JoinRef: strPtr("1"), Ref: strPtr("2"), Topic: "t", Event: "e", Payload: jsoniter.RawMessage(`{"a":1}`), V1: v1}
+		byt, err := jsoniter.ConfigFastest.Marshal(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded PhoenixFrame
+		if err := jsoniter.ConfigFastest.Unmarshal(byt, &decoded); err != nil {
+			t.Fatalf("could not decode %s: %s", byt, err)
+		}
+		if decoded.V1 != v1 || decoded.Topic != "t" || decoded.Event != "e" || !equalRef(decoded.Ref, frame.Ref) || string(decoded.Payload) != `{"a":1}` {
+			t.Errorf("round trip of %s gave %+v", byt, decoded)
+		}
+	}
+}
+
+// FuzzPhoenixFrame checks that any input either fails to decode or round-trips,
+// and never makes the decoder or the frame handler panic
+func FuzzPhoenixFrame(f *testing.F) {
+	for _, seed := range []string{
+		`[null,null,"__absinthe__:doc:1","subscription:data",{"result":{"data":{}}}]`,
+		`["1","2","__absinthe__:control","phx_reply",{"status":"ok","response":{"subscriptionId":"__absinthe__:doc:1"}}]`,
+		`[1,2,"phoenix","phx_reply",{}]`,
+		`{"join_ref":null,"ref":"3","topic":"__absinthe__:control","event":"phx_reply","payload":{"status":"ok"}}`,
+		`[null,null,"topic","event"]`,
+		`[]`,
+		`null`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var frame PhoenixFrame
+		if err := jsoniter.ConfigFastest.Unmarshal(data, &frame); err == nil {
+			byt, err := jsoniter.ConfigFastest.Marshal(frame)
+			if err != nil {
+				t.Fatalf("could not encode decoded frame %+v: %s", frame, err)
+			}
+			var decoded PhoenixFrame
+			if err := jsoniter.ConfigFastest.Unmarshal(byt, &decoded); err != nil {
+				t.Fatalf("could not decode re-encoded frame %s: %s", byt, err)
+			}
+			if decoded.Topic != frame.Topic || decoded.Event != frame.Event || !equalRef(decoded.Ref, frame.Ref) || !equalRef(decoded.JoinRef, frame.JoinRef) {
+				t.Fatalf("round trip of %s gave %+v, want %+v", data, decoded, frame)
+			}
+		}
+
+		socket := newTestSocket()
+		socket.active["__absinthe__:doc:1"] = func(jsoniter.RawMessage) {}
+		socket.pending["1"] = func(jsoniter.RawMessage) {}
+		if err := socket.handleFrame(data); errors.Is(err, ErrFramePanic) {
+			t.Fatalf("handling %q panicked: %s", data, err)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Minimum interval between reposts of a pinned message
+const minPinRepostInterval = time.Minute
+
+// PinRequest is the JSON form of a @pin RPC call, plain text values pin that text
+type PinRequest struct {
+	// MessageID pins a recent chat message, Message is used if it's not set
+	MessageID string `json:"message_id"`
+	Message   string `json:"message"`
+	// Unpin automatically after this many seconds (0 to keep it until @unpin)
+	DurationSeconds int `json:"duration_seconds"`
+	// Repost the message to chat every this many seconds (0 to never repost)
+	RepostSeconds int `json:"repost_seconds"`
+}
+
+// PinnedMessage is written to the pinned-message key
+type PinnedMessage struct {
+	// Active is false once the message is unpinned or expired
+	Active    bool             `json:"active"`
+	MessageID string           `json:"message_id,omitempty"`
+	Message   string           `json:"message"`
+	User      *ChatMessageUser `json:"user,omitempty"`
+	PinnedAt  time.Time        `json:"pinned_at"`
+	ExpiresAt *time.Time       `json:"expires_at,omitempty"`
+	// RepostSeconds is the interval between reposts to chat (0 if disabled)
+	RepostSeconds int `json:"repost_seconds,omitempty"`
+}
+
+// pinManager keeps at most one pinned message, unpinning it when it expires
+// and reposting it to chat if requested
+type pinManager struct {
+	bridge *Bridge
+	key    string
+
+	mu     sync.Mutex
+	pinned PinnedMessage
+	cancel context.CancelFunc
+}
+
+// setupPins registers the @pin and @unpin RPCs, resuming the pinned message left by a previous run
+func (b *Bridge) setupPins(ctx context.Context) error {
+	pins := &pinManager{bridge: b, key: b.key("pinned-message")}
+	var previous PinnedMessage
+	if err := b.kv.GetJSON(pins.key, &previous); err == nil && previous.Active {
+		if previous.ExpiresAt != nil && !previous.ExpiresAt.After(time.Now()) {
+			pins.pinned = previous
+			pins.unpin(nil)
+		} else {
+			pins.start(ctx, previous)
+		}
+	}
+
+	err := b.handleRPC(ctx, "@pin", func(value string) {
+		req := PinRequest{Message: value}
+		trimmed := strings.TrimSpace(value)
+		if strings.HasPrefix(trimmed, "{") {
+			if err := jsoniter.ConfigFastest.UnmarshalFromString(trimmed, &req); err != nil {
+				b.log.WithError(err).Error("Could not decode pin request")
+				return
+			}
+		}
+		pins.pin(ctx, req)
+	})
+	if err != nil {
+		return err
+	}
+	return b.handleRPC(ctx, "@unpin", func(string) {
+		pins.unpin(nil)
+	})
+}
+
+// pin replaces the pinned message
+func (p *pinManager) pin(ctx context.Context, req PinRequest) {
+	pinned := PinnedMessage{Active: true, Message: strings.TrimSpace(req.Message), PinnedAt: time.Now()}
+	if req.MessageID != "" {
+		msg, ok := p.bridge.archive.find(req.MessageID)
+		if !ok {
+			p.bridge.log.WithField("id", req.MessageID).Warn("Can't pin unknown or deleted chat message")
+			return
+		}
+		pinned.MessageID, pinned.Message, pinned.User = msg.ID, msg.Message, &msg.User
+	}
+	if pinned.Message == "" {
+		return
+	}
+	if req.DurationSeconds > 0 {
+		expires := pinned.PinnedAt.Add(time.Duration(req.DurationSeconds) * time.Second)
+		pinned.ExpiresAt = &expires
+	}
+	if req.RepostSeconds > 0 {
+		pinned.RepostSeconds = req.RepostSeconds
+		if interval := time.Duration(req.RepostSeconds) * time.Second; interval < minPinRepostInterval {
+			pinned.RepostSeconds = int(minPinRepostInterval / time.Second)
+		}
+	}
+	p.start(ctx, pinned)
+	p.bridge.setJSON(p.bridge.key("ev/message-pinned"), pinned)
+}
+
+// start publishes a pinned message and runs its expiry and reposts in the background
+func (p *pinManager) start(ctx context.Context, pinned PinnedMessage) {
+	ctx, cancel := context.WithCancel(ctx)
+	p.mu.Lock()
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.pinned, p.cancel = pinned, cancel
+	p.bridge.setJSON(p.key, pinned)
+	p.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		var expired <-chan time.Time
+		if pinned.ExpiresAt != nil {
+			timer := time.NewTimer(time.Until(*pinned.ExpiresAt))
+			defer timer.Stop()
+			expired = timer.C
+		}
+		var reposts <-chan time.Time
+		if pinned.RepostSeconds > 0 {
+			ticker := time.NewTicker(time.Duration(pinned.RepostSeconds) * time.Second)
+			defer ticker.Stop()
+			reposts = ticker.C
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-expired:
+				p.unpin(ctx)
+				return
+			case <-reposts:
+				// Raw: pinned messages can be viewer messages, which must not run as templates
+				p.bridge.chat.send(ChatSendRequest{Message: pinned.Message, Raw: true, Source: "pin"})
+			}
+		}
+	}()
+}
+
+// unpin removes the pinned message, if any. If pinCtx is set, it's only removed
+// if it's still the message started with that context (not replaced in the meantime).
+func (p *pinManager) unpin(pinCtx context.Context) {
+	p.mu.Lock()
+	if pinCtx != nil && pinCtx.Err() != nil {
+		p.mu.Unlock()
+		return
+	}
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+	wasActive := p.pinned.Active
+	p.pinned.Active = false
+	unpinned := p.pinned
+	p.bridge.setJSON(p.key, unpinned)
+	p.mu.Unlock()
+	if wasActive {
+		p.bridge.setJSON(p.bridge.key("ev/message-unpinned"), unpinned)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Plugins are WebAssembly modules (built as WASI reactors/libraries) that export:
+//
+//	alloc(size u32) -> ptr u32                            allocate memory for the host to write into
+//	on_event(name_ptr, name_len, data_ptr, data_len u32)  called for every event, data is the event JSON
+//
+// and can import these functions from the "glimesh" module:
+//
+//	send_message(ptr, len u32)                  send a chat message
+//	set_key(key_ptr, key_len, val_ptr, val_len) write a Kilovolt key, relative to the bridge prefix
+//	log(ptr, len u32)                           write to the bridge log
+//
+// Messages and keys are only sent/written after on_event returns.
+const pluginHostModule = "glimesh"
+
+// Maximum time a plugin can take to handle an event, plugins that take longer are stopped
+const pluginEventTimeout = time.Second
+
+// pluginCallKey is the context key of the actions queued by the host functions during a call
+type pluginCallKey struct{}
+
+type pluginCall struct {
+	actions []func()
+}
+
+// queuePluginAction runs action after the plugin call in ctx returns, or right away outside of calls
+// (eg. while the plugin is being initialized). Running it during the call could publish events
+// that are dispatched back to the same plugin, which would deadlock.
+func queuePluginAction(ctx context.Context, action func()) {
+	if call, ok := ctx.Value(pluginCallKey{}).(*pluginCall); ok {
+		call.actions = append(call.actions, action)
+		return
+	}
+	action()
+}
+
+type wasmPlugin struct {
+	name    string
+	module  api.Module
+	alloc   api.Function
+	onEvent api.Function
+
+	// Modules are not safe for concurrent use
+	mu sync.Mutex
+	// Set when the plugin was stopped for taking too long
+	stopped bool
+}
+
+type pluginRuntime struct {
+	bridge  *Bridge
+	runtime wazero.Runtime
+	plugins []*wasmPlugin
+}
+
+func readString(m api.Module, ptr, size uint32) (string, bool) {
+	byt, ok := m.Memory().Read(ptr, size)
+	return string(byt), ok
+}
+
+// loadPlugins instantiates all the .wasm files in dir
+func (b *Bridge) loadPlugins(ctx context.Context, dir string) (*pluginRuntime, error) {
+	// Stop plugins stuck in a call when its context times out
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+
+	_, err := runtime.NewHostModuleBuilder(pluginHostModule).
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		if message, ok := readString(m, ptr, size); ok {
+			queuePluginAction(ctx, func() {
+				b.chat.send(ChatSendRequest{Message: message, Raw: true, Source: "plugin"})
+			})
+		}
+	}).Export("send_message").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, keyPtr, keySize, valuePtr, valueSize uint32) {
+		key, ok := readString(m, keyPtr, keySize)
+		value, ok2 := readString(m, valuePtr, valueSize)
+		if !ok || !ok2 {
+			return
+		}
+		// Plugins can only write bridge keys, not the ones of other apps
+		if !validKeyName(key) {
+			b.log.WithField("plugin", m.Name()).WithField("key", key).Error("Plugin tried to set an invalid key")
+			return
+		}
+		plugin := m.Name()
+		queuePluginAction(ctx, func() {
+			err := b.kv.SetKey(b.key(key), value)
+			if err != nil {
+				b.log.WithError(err).WithField("plugin", plugin).Error("Plugin could not set key")
+			}
+		})
+	}).Export("set_key").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		if message, ok := readString(m, ptr, size); ok {
+			b.log.WithField("plugin", m.Name()).Info(message)
+		}
+	}).Export("log").
+		Instantiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, err
+	}
+	plugins := &pluginRuntime{bridge: b, runtime: runtime}
+	for _, file := range files {
+		plugin, err := plugins.load(ctx, file)
+		if err != nil {
+			b.log.WithError(err).WithField("plugin", file).Error("Could not load plugin")
+			continue
+		}
+		b.log.WithField("plugin", plugin.name).Info("Loaded plugin")
+		plugins.plugins = append(plugins.plugins, plugin)
+	}
+	return plugins, nil
+}
+
+func (p *pluginRuntime) load(ctx context.Context, file string) (*wasmPlugin, error) {
+	binary, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(file)
+	config := wazero.NewModuleConfig().
+		WithName(name).
+		WithStartFunctions("_initialize").
+		WithStdout(os.Stdout).
+		WithStderr(os.Stderr)
+	module, err := p.runtime.InstantiateWithConfig(ctx, binary, config)
+	if err != nil {
+		return nil, err
+	}
+	plugin := &wasmPlugin{
+		name:    name,
+		module:  module,
+		alloc:   module.ExportedFunction("alloc"),
+		onEvent: module.ExportedFunction("on_event"),
+	}
+	if plugin.alloc == nil || plugin.onEvent == nil {
+		_ = module.Close(ctx)
+		return nil, errors.New("plugin must export alloc and on_event")
+	}
+	return plugin, nil
+}
+
+// write copies data into the plugin memory
+func (w *wasmPlugin) write(ctx context.Context, data []byte) (uint32, error) {
+	results, err := w.alloc.Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	ptr := uint32(results[0])
+	if !w.module.Memory().Write(ptr, data) {
+		return 0, errors.New("allocated memory is out of range")
+	}
+	return ptr, nil
+}
+
+// event calls on_event, returning the actions queued by the plugin during the call
+func (w *wasmPlugin) event(ctx context.Context, name string, payload []byte) ([]func(), error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return nil, nil
+	}
+	call := &pluginCall{}
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, pluginCallKey{}, call), pluginEventTimeout)
+	defer cancel()
+	namePtr, err := w.write(ctx, []byte(name))
+	if err == nil {
+		var dataPtr uint32
+		dataPtr, err = w.write(ctx, payload)
+		if err == nil {
+			_, err = w.onEvent.Call(ctx, uint64(namePtr), uint64(len(name)), uint64(dataPtr), uint64(len(payload)))
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		// The runtime closed the module, it can't be called anymore
+		w.stopped = true
+		return nil, fmt.Errorf("plugin took longer than %s handling %s, stopped it", pluginEventTimeout, name)
+	}
+	return call.actions, err
+}
+
+// dispatch sends an event to all plugins, then runs what they queued
+func (p *pluginRuntime) dispatch(name string, payload []byte) {
+	ctx := p.bridge.ctx
+	for _, plugin := range p.plugins {
+		actions, err := plugin.event(ctx, name, payload)
+		if err != nil {
+			p.bridge.log.WithError(err).WithField("plugin", plugin.name).Error("Plugin failed handling event")
+		}
+		for _, action := range actions {
+			action()
+		}
+	}
+}
+
+func (p *pluginRuntime) close(ctx context.Context) {
+	_ = p.runtime.Close(ctx)
+}
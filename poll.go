@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+type PollRequest struct {
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+	// Duration of the poll, 0 to keep it open until ended via RPC
+	DurationSeconds int `json:"duration_seconds"`
+}
+
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+type Poll struct {
+	Question   string       `json:"question"`
+	Options    []PollOption `json:"options"`
+	TotalVotes int          `json:"total_votes"`
+	StartedAt  time.Time    `json:"started_at"`
+	EndsAt     *time.Time   `json:"ends_at,omitempty"`
+	Active     bool         `json:"active"`
+	// Winners holds the indexes of the options with the most votes, set when the poll ends
+	Winners []int `json:"winners,omitempty"`
+}
+
+// pollManager runs at most one chat poll at a time
+type pollManager struct {
+	bridge *Bridge
+
+	mu     sync.Mutex
+	poll   *Poll
+	voters map[string]bool
+	timer  *time.Timer
+}
+
+func (p *pollManager) start(req PollRequest) error {
+	if len(req.Options) < 2 {
+		return errors.New("a poll needs at least two options")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.poll != nil && p.poll.Active {
+		return errors.New("a poll is already running")
+	}
+
+	poll := &Poll{Question: req.Question, StartedAt: time.Now(), Active: true}
+	for _, option := range req.Options {
+		poll.Options = append(poll.Options, PollOption{Text: option})
+	}
+	if req.DurationSeconds > 0 {
+		duration := time.Duration(req.DurationSeconds) * time.Second
+		endsAt := poll.StartedAt.Add(duration)
+		poll.EndsAt = &endsAt
+		p.timer = time.AfterFunc(duration, p.end)
+	}
+	p.poll = poll
+	p.voters = make(map[string]bool)
+
+	p.bridge.log.WithField("question", req.Question).Info("Poll started")
+	p.bridge.setJSON(p.bridge.key("poll"), poll)
+	p.bridge.setJSON(p.bridge.key("ev/poll-started"), poll)
+	return nil
+}
+
+// end closes the running poll, publishing the final results
+func (p *pollManager) end() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.poll == nil || !p.poll.Active {
+		return
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+
+	p.poll.Active = false
+	most := 0
+	for _, option := range p.poll.Options {
+		if option.Votes > most {
+			most = option.Votes
+		}
+	}
+	p.poll.Winners = make([]int, 0)
+	for i, option := range p.poll.Options {
+		if most > 0 && option.Votes == most {
+			p.poll.Winners = append(p.poll.Winners, i)
+		}
+	}
+
+	p.bridge.log.WithField("votes", p.poll.TotalVotes).Info("Poll ended")
+	p.bridge.setJSON(p.bridge.key("poll"), p.poll)
+	p.bridge.setJSON(p.bridge.key("ev/poll-ended"), p.poll)
+}
+
+// vote counts a chat message as a vote if it's an option number or matches an option text
+func (p *pollManager) vote(msg ChatMessage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.poll == nil || !p.poll.Active {
+		return
+	}
+	voter := strings.ToLower(msg.User.Username)
+	if p.voters[voter] {
+		return
+	}
+
+	text := strings.TrimSpace(msg.Message)
+	choice := -1
+	if n, err := strconv.Atoi(text); err == nil && n >= 1 && n <= len(p.poll.Options) {
+		choice = n - 1
+	} else {
+		for i, option := range p.poll.Options {
+			if strings.EqualFold(text, option.Text) {
+				choice = i
+				break
+			}
+		}
+	}
+	if choice < 0 {
+		return
+	}
+
+	p.voters[voter] = true
+	p.poll.Options[choice].Votes++
+	p.poll.TotalVotes++
+	p.bridge.setJSON(p.bridge.key("poll"), p.poll)
+}
+
+// setupPolls registers the @start-poll and @end-poll RPCs
+func (b *Bridge) setupPolls(ctx context.Context) error {
+	b.polls = &pollManager{bridge: b}
+	err := b.handleRPC(ctx, "@start-poll", func(value string) {
+		var req PollRequest
+		err := jsoniter.ConfigFastest.UnmarshalFromString(value, &req)
+		if err != nil {
+			b.log.WithError(err).Error("Could not decode poll request")
+			return
+		}
+		err = b.polls.start(req)
+		if err != nil {
+			b.log.WithError(err).Error("Could not start poll")
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return b.handleRPC(ctx, "@end-poll", func(string) {
+		b.polls.end()
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// defaultProfilesFile returns where profiles are read from when -profiles is not set
+func defaultProfilesFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "profiles.json"
+	}
+	return filepath.Join(dir, "glimesh-bridge", "profiles.json")
+}
+
+// loadProfile reads a named profile from a JSON file mapping profile names to flag values, eg.
+//
+//	{"testchannel": {"channel-id": 1234, "client-id": "...", "prefix": "glimesh-test/", "config-file": "test.json"}}
+func loadProfile(path string, name string) (map[string]string, error) {
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles map[string]map[string]jsoniter.RawMessage
+	if err := jsoniter.ConfigFastest.Unmarshal(byt, &profiles); err != nil {
+		return nil, fmt.Errorf("invalid profiles file: %w", err)
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("profile %q not found in %s (available: %s)", name, path, strings.Join(names, ", "))
+	}
+
+	values := make(map[string]string, len(profile))
+	for flagName, raw := range profile {
+		// Strings are unquoted, numbers and booleans are used as written
+		var value string
+		if err := jsoniter.ConfigFastest.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+		values[flagName] = value
+	}
+	return values, nil
+}
+
+// applyProfile sets the flags of a profile, flags given on the command line take precedence.
+// It returns the names of the flags it set.
+func applyProfile(flags *flag.FlagSet, values map[string]string) ([]string, error) {
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var applied []string
+	for name, value := range values {
+		if name == "profile" || name == "profiles" {
+			return nil, fmt.Errorf("profiles can't set -%s", name)
+		}
+		if flags.Lookup(name) == nil {
+			return nil, fmt.Errorf("unknown flag -%s in profile", name)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return nil, fmt.Errorf("invalid value for -%s in profile: %w", name, err)
+		}
+		applied = append(applied, name)
+	}
+	sort.Strings(applied)
+	return applied, nil
+}
@@ -0,0 +1,211 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: proto/bridge.proto
+
+package bridgepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Bridge_ChatEvents_FullMethodName    = "/glimeshbridge.v1.Bridge/ChatEvents"
+	Bridge_SendMessage_FullMethodName   = "/glimeshbridge.v1.Bridge/SendMessage"
+	Bridge_DeleteMessage_FullMethodName = "/glimeshbridge.v1.Bridge/DeleteMessage"
+)
+
+// BridgeClient is the client API for Bridge service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BridgeClient interface {
+	ChatEvents(ctx context.Context, in *ChatEventsRequest, opts ...grpc.CallOption) (Bridge_ChatEventsClient, error)
+	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*SendMessageResponse, error)
+	DeleteMessage(ctx context.Context, in *DeleteMessageRequest, opts ...grpc.CallOption) (*DeleteMessageResponse, error)
+}
+
+type bridgeClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBridgeClient(cc grpc.ClientConnInterface) BridgeClient {
+	return &bridgeClient{cc}
+}
+
+func (c *bridgeClient) ChatEvents(ctx context.Context, in *ChatEventsRequest, opts ...grpc.CallOption) (Bridge_ChatEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Bridge_ServiceDesc.Streams[0], Bridge_ChatEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &bridgeChatEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Bridge_ChatEventsClient interface {
+	Recv() (*ChatEvent, error)
+	grpc.ClientStream
+}
+
+type bridgeChatEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *bridgeChatEventsClient) Recv() (*ChatEvent, error) {
+	m := new(ChatEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *bridgeClient) SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*SendMessageResponse, error) {
+	out := new(SendMessageResponse)
+	err := c.cc.Invoke(ctx, Bridge_SendMessage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bridgeClient) DeleteMessage(ctx context.Context, in *DeleteMessageRequest, opts ...grpc.CallOption) (*DeleteMessageResponse, error) {
+	out := new(DeleteMessageResponse)
+	err := c.cc.Invoke(ctx, Bridge_DeleteMessage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BridgeServer is the server API for Bridge service.
+// All implementations must embed UnimplementedBridgeServer
+// for forward compatibility
+type BridgeServer interface {
+	ChatEvents(*ChatEventsRequest, Bridge_ChatEventsServer) error
+	SendMessage(context.Context, *SendMessageRequest) (*SendMessageResponse, error)
+	DeleteMessage(context.Context, *DeleteMessageRequest) (*DeleteMessageResponse, error)
+	mustEmbedUnimplementedBridgeServer()
+}
+
+// UnimplementedBridgeServer must be embedded to have forward compatible implementations.
+type UnimplementedBridgeServer struct {
+}
+
+func (UnimplementedBridgeServer) ChatEvents(*ChatEventsRequest, Bridge_ChatEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ChatEvents not implemented")
+}
+func (UnimplementedBridgeServer) SendMessage(context.Context, *SendMessageRequest) (*SendMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendMessage not implemented")
+}
+func (UnimplementedBridgeServer) DeleteMessage(context.Context, *DeleteMessageRequest) (*DeleteMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMessage not implemented")
+}
+func (UnimplementedBridgeServer) mustEmbedUnimplementedBridgeServer() {}
+
+// UnsafeBridgeServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BridgeServer will
+// result in compilation errors.
+type UnsafeBridgeServer interface {
+	mustEmbedUnimplementedBridgeServer()
+}
+
+func RegisterBridgeServer(s grpc.ServiceRegistrar, srv BridgeServer) {
+	s.RegisterService(&Bridge_ServiceDesc, srv)
+}
+
+func _Bridge_ChatEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ChatEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BridgeServer).ChatEvents(m, &bridgeChatEventsServer{stream})
+}
+
+type Bridge_ChatEventsServer interface {
+	Send(*ChatEvent) error
+	grpc.ServerStream
+}
+
+type bridgeChatEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *bridgeChatEventsServer) Send(m *ChatEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Bridge_SendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).SendMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Bridge_SendMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).SendMessage(ctx, req.(*SendMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bridge_DeleteMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BridgeServer).DeleteMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Bridge_DeleteMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BridgeServer).DeleteMessage(ctx, req.(*DeleteMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Bridge_ServiceDesc is the grpc.ServiceDesc for Bridge service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Bridge_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "glimeshbridge.v1.Bridge",
+	HandlerType: (*BridgeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SendMessage",
+			Handler:    _Bridge_SendMessage_Handler,
+		},
+		{
+			MethodName: "DeleteMessage",
+			Handler:    _Bridge_DeleteMessage_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ChatEvents",
+			Handler:       _Bridge_ChatEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/bridge.proto",
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"regexp"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const maxQuarantinedFrameSize = 2048
+
+// Matches JSON string fields that may carry credentials
+var sensitiveFieldRegex = regexp.MustCompile(`(?i)("[a-z_]*(token|secret|password|key)[a-z_]*"\s*:\s*)"[^"]*"`)
+
+type UnparsedFrame struct {
+	Raw        string    `json:"raw"`
+	Truncated  bool      `json:"truncated"`
+	Error      string    `json:"error"`
+	Count      uint64    `json:"count"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// redactFrame removes credentials from a raw frame and truncates it
+func redactFrame(raw []byte) (string, bool) {
+	redacted := sensitiveFieldRegex.ReplaceAll(raw, []byte(`$1"<redacted>"`))
+	if len(redacted) > maxQuarantinedFrameSize {
+		cut := maxQuarantinedFrameSize
+		// Don't split a multi-byte character
+		for cut > 0 && !utf8.RuneStart(redacted[cut]) {
+			cut--
+		}
+		return string(redacted[:cut]), true
+	}
+	return string(redacted), false
+}
+
+// quarantineFrame publishes a frame that could not be decoded, so protocol changes on
+// Glimesh's side are visible to users instead of only showing up in the logs
+func (b *Bridge) quarantineFrame(raw []byte, err error) {
+	count := atomic.AddUint64(&b.unparsedFrames, 1)
+	text, truncated := redactFrame(raw)
+	b.setJSON(b.key("ev/unparsed"), UnparsedFrame{
+		Raw:        text,
+		Truncated:  truncated,
+		Error:      err.Error(),
+		Count:      count,
+		ReceivedAt: time.Now(),
+	})
+	b.setJSON(b.key("unparsed-count"), count)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Cacheable queries by name, as used in -api-cache. Only idempotent queries belong here,
+// mutations must never be cached or coalesced.
+var cacheableQueries = map[string][]string{
+	"channel":        {fetchChannelDocument},
+	"user":           {lookupUserIDDocument, userProfileDocument},
+	"follower-count": {followerCountDocument},
+}
+
+// parseQueryCacheTTLs parses the -api-cache rules (eg. "channel=10s,user=10m") into TTLs by document
+func parseQueryCacheTTLs(spec string) (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration)
+	for _, item := range parseList(spec) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid API cache rule %q, expected query=ttl", item)
+		}
+		documents, ok := cacheableQueries[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown cacheable query %q", parts[0])
+		}
+		ttl, err := time.ParseDuration(parts[1])
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid TTL for query %q", parts[0])
+		}
+		for _, document := range documents {
+			ttls[document] = ttl
+		}
+	}
+	return ttls, nil
+}
+
+type queryCacheEntry struct {
+	data    jsoniter.RawMessage
+	expires time.Time
+}
+
+func (e queryCacheEntry) memorySize() int {
+	return 32 + len(e.data)
+}
+
+// queryCall is a request shared by all the callers asking for the same query at the same time
+type queryCall struct {
+	done   chan struct{}
+	result GQLResponse
+	err    error
+}
+
+// queryCache keeps the results of idempotent GraphQL queries for a while and coalesces
+// concurrent identical queries into a single request
+type queryCache struct {
+	// Counters, first so they're 64-bit aligned for atomic operations
+	hits      uint64
+	misses    uint64
+	coalesced uint64
+	ttls      map[string]time.Duration
+	entries   *lruCache
+
+	mu       sync.Mutex
+	inflight map[string]*queryCall
+}
+
+func (b *Bridge) newQueryCache(ttls map[string]time.Duration) *queryCache {
+	return &queryCache{ttls: ttls, entries: b.newLRUCache("api", b.memory.UserCaches), inflight: make(map[string]*queryCall)}
+}
+
+// query runs a query through the cache, fetch is only called on misses
+func (c *queryCache) query(ctx context.Context, query string, variables map[string]interface{}, fetch func() (GQLResponse, error)) (GQLResponse, error) {
+	ttl, ok := c.ttls[query]
+	if !ok || ttl <= 0 {
+		return fetch()
+	}
+	// encoding/json sorts map keys, so identical variables always give the same key
+	encoded, err := json.Marshal(variables)
+	if err != nil {
+		return fetch()
+	}
+	key := query + "\x00" + string(encoded)
+
+	if value, ok := c.entries.get(key); ok {
+		if entry := value.(queryCacheEntry); time.Now().Before(entry.expires) {
+			atomic.AddUint64(&c.hits, 1)
+			return GQLResponse{Data: entry.data}, nil
+		}
+	}
+
+	c.mu.Lock()
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		atomic.AddUint64(&c.coalesced, 1)
+		select {
+		case <-call.done:
+			return call.result, call.err
+		case <-ctx.Done():
+			return GQLResponse{}, ctx.Err()
+		}
+	}
+	call := &queryCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	atomic.AddUint64(&c.misses, 1)
+	call.result, call.err = fetch()
+	// Responses with GraphQL errors (eg. user not found) are not cached
+	if call.err == nil && len(call.result.Errors) == 0 {
+		c.entries.put(key, queryCacheEntry{data: call.result.Data, expires: time.Now().Add(ttl)})
+	}
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(call.done)
+	return call.result, call.err
+}
+
+// stats returns the number of cache hits, misses and coalesced requests
+func (c *queryCache) stats() (uint64, uint64, uint64) {
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses), atomic.LoadUint64(&c.coalesced)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueueEntry is a viewer waiting in the queue
+type QueueEntry struct {
+	Username string    `json:"username"`
+	JoinedAt time.Time `json:"joined_at"`
+	Position int       `json:"position"`
+}
+
+// QueueChange is emitted every time someone joins, leaves or is picked from the queue
+type QueueChange struct {
+	Action    string     `json:"action"`
+	Entry     QueueEntry `json:"entry"`
+	Remaining int        `json:"remaining"`
+}
+
+// viewerQueue is a first-come first-served waitlist, persisted to KV so it survives restarts
+type viewerQueue struct {
+	bridge *Bridge
+	key    string
+
+	mu      sync.Mutex
+	entries []QueueEntry
+}
+
+func (b *Bridge) newViewerQueue() *viewerQueue {
+	queue := &viewerQueue{bridge: b, key: b.key("queue")}
+	err := b.kv.GetJSON(queue.key, &queue.entries)
+	if err != nil {
+		queue.entries = make([]QueueEntry, 0)
+		if b.restored != nil && b.restored.Queue != nil {
+			queue.entries = b.restored.Queue
+		}
+	}
+	return queue
+}
+
+func (q *viewerQueue) indexOf(username string) int {
+	for i, entry := range q.entries {
+		if strings.EqualFold(entry.Username, username) {
+			return i
+		}
+	}
+	return -1
+}
+
+// publish renumbers the queue and writes it to KV, must be called with the lock held
+func (q *viewerQueue) publish(action string, entry QueueEntry) {
+	for i := range q.entries {
+		q.entries[i].Position = i + 1
+	}
+	q.bridge.setJSON(q.key, q.entries)
+	q.bridge.setJSON(q.bridge.key("ev/queue-changed"), QueueChange{Action: action, Entry: entry, Remaining: len(q.entries)})
+}
+
+// join adds a user at the end of the queue, returning their position
+func (q *viewerQueue) join(username string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if i := q.indexOf(username); i >= 0 {
+		return i + 1
+	}
+	entry := QueueEntry{Username: username, JoinedAt: time.Now(), Position: len(q.entries) + 1}
+	q.entries = append(q.entries, entry)
+	q.publish("join", entry)
+	return entry.Position
+}
+
+// leave removes a user from the queue, returning false if they weren't in it
+func (q *viewerQueue) leave(username string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := q.indexOf(username)
+	if i < 0 {
+		return false
+	}
+	entry := q.entries[i]
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+	q.publish("leave", entry)
+	return true
+}
+
+// next removes and returns the first user in the queue
+func (q *viewerQueue) next() (QueueEntry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.entries) == 0 {
+		return QueueEntry{}, false
+	}
+	entry := q.entries[0]
+	q.entries = q.entries[1:]
+	q.publish("next", entry)
+	return entry, true
+}
+
+func (q *viewerQueue) clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.entries = make([]QueueEntry, 0)
+	q.publish("clear", QueueEntry{})
+}
+
+// setupQueue registers the !join/!leave/!next chat commands and the queue RPCs
+func (b *Bridge) setupQueue(ctx context.Context) error {
+	b.queue = b.newViewerQueue()
+	join := func(username string) {
+		position := b.queue.join(username)
+		b.say("queue.joined", username, map[string]interface{}{"position": position})
+	}
+	leave := func(username string) {
+		if b.queue.leave(username) {
+			b.say("queue.left", username, nil)
+		}
+	}
+	next := func() {
+		if entry, ok := b.queue.next(); ok {
+			b.say("queue.next", entry.Username, nil)
+		}
+	}
+
+	b.commands.register(func(msg ChatMessage, _ string) {
+		join(msg.User.Username)
+	}, "join")
+	b.commands.register(func(msg ChatMessage, _ string) {
+		leave(msg.User.Username)
+	}, "leave")
+	b.commands.register(func(msg ChatMessage, _ string) {
+		if roleAtLeast(b.chatRole(msg), RoleModerator) {
+			next()
+		}
+	}, "next")
+
+	rpcs := map[string]func(string){
+		"@queue-join":  func(value string) { join(strings.TrimSpace(value)) },
+		"@queue-leave": func(value string) { leave(strings.TrimSpace(value)) },
+		"@queue-next":  func(string) { next() },
+		"@queue-clear": func(string) { b.queue.clear() },
+	}
+	for name, handler := range rpcs {
+		err := b.handleRPC(ctx, name, handler)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
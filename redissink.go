@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// runRedisSink publishes every bridge event to Redis, either on the <prefix>:<channel id>:<event>
+// pub/sub channels ("pubsub" mode) or to the <prefix>:<channel id>:events stream ("stream" mode)
+func (b *Bridge) runRedisSink(ctx context.Context, url string, mode string, prefix string, maxLen int64) error {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return err
+	}
+	if mode != "pubsub" && mode != "stream" {
+		return fmt.Errorf("unknown redis mode %q", mode)
+	}
+	client := redis.NewClient(options)
+	err = client.Ping(ctx).Err()
+	if err != nil {
+		return err
+	}
+	b.log.WithField("addr", options.Addr).Info("Connected to Redis")
+
+	stream := fmt.Sprintf("%s:%d:events", prefix, b.channelID)
+	b.goSafe(ctx, "redis-sink", func(ctx context.Context) {
+		events := b.events.subscribe()
+		defer b.events.unsubscribe(events)
+		for {
+			event, ok := events.next(ctx)
+			if !ok {
+				client.Close()
+				return
+			}
+			var err error
+			if mode == "stream" {
+				err = client.XAdd(ctx, &redis.XAddArgs{
+					Stream: stream,
+					MaxLen: maxLen,
+					Approx: true,
+					Values: map[string]interface{}{"event": event.Name, "data": event.Payload},
+				}).Err()
+			} else {
+				err = client.Publish(ctx, fmt.Sprintf("%s:%d:%s", prefix, b.channelID, event.Name), event.Payload).Err()
+			}
+			if err != nil {
+				b.log.WithError(err).WithField("event", event.Name).Warn("Could not publish event to Redis")
+			}
+		}
+	})
+	return nil
+}
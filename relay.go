@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Default number of messages waiting to be relayed before the oldest ones are dropped
+const defaultRelayBuffer = 200
+
+// RelaySettings configures the paced chat relay, a copy of the chat feed for on-screen
+// overlays that stays readable during raids (ev/chat-message is always full speed)
+type RelaySettings struct {
+	// Maximum number of messages per second published to ev/chat-message-relay (0 to disable the relay)
+	Rate float64 `json:"rate"`
+	// Number of messages waiting to be relayed before the oldest ones are dropped (0 for the default)
+	Buffer int `json:"buffer"`
+	// Hold messages (up to the buffer size) until the relay is unpaused
+	Paused bool `json:"paused"`
+}
+
+// validate returns the name of the first invalid setting, if any
+func (r RelaySettings) validate() (string, bool) {
+	switch {
+	case r.Rate < 0:
+		return "rate", false
+	case r.Buffer < 0:
+		return "buffer", false
+	}
+	return "", true
+}
+
+// chatRelay buffers chat message events and republishes them at a steady pace
+type chatRelay struct {
+	bridge *Bridge
+	key    string
+	wake   chan struct{}
+
+	mu       sync.Mutex
+	settings RelaySettings
+	pending  []ChatEvent
+}
+
+func (b *Bridge) newChatRelay(config Config) *chatRelay {
+	relay := &chatRelay{bridge: b, key: b.key("ev/chat-message-relay"), wake: make(chan struct{}, 1)}
+	relay.configure(config)
+	return relay
+}
+
+// backlog returns the number of messages waiting to be relayed
+func (r *chatRelay) backlog() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+func (r *chatRelay) configure(config Config) {
+	r.mu.Lock()
+	r.settings = config.Relay
+	if r.settings.Rate == 0 {
+		r.pending = nil
+	}
+	r.mu.Unlock()
+	r.signal()
+}
+
+func (r *chatRelay) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// push queues a chat message to be relayed, dropping the oldest one if the buffer is full
+func (r *chatRelay) push(event ChatEvent) {
+	r.mu.Lock()
+	if r.settings.Rate == 0 {
+		r.mu.Unlock()
+		return
+	}
+	limit := r.settings.Buffer
+	if limit == 0 {
+		limit = defaultRelayBuffer
+	}
+	r.pending = append(r.pending, event)
+	if len(r.pending) > limit {
+		r.bridge.log.WithField("dropped", len(r.pending)-limit).Debug("Relay buffer full, dropping oldest messages")
+		r.pending = r.pending[len(r.pending)-limit:]
+	}
+	r.mu.Unlock()
+	r.signal()
+}
+
+// retract removes a message deleted by a moderator before it gets relayed
+func (r *chatRelay) retract(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, event := range r.pending {
+		if event.ID == id {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// next pops the oldest waiting message and returns how long to wait after relaying it,
+// or false if there is nothing to relay right now
+func (r *chatRelay) next() (ChatEvent, time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.settings.Paused || r.settings.Rate == 0 || len(r.pending) == 0 {
+		return ChatEvent{}, 0, false
+	}
+	event := r.pending[0]
+	r.pending = r.pending[1:]
+	return event, time.Duration(float64(time.Second) / r.settings.Rate), true
+}
+
+func (r *chatRelay) run(ctx context.Context) {
+	for {
+		event, interval, ok := r.next()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.wake:
+			}
+			continue
+		}
+		r.bridge.setJSON(r.key, event)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
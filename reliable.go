@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// LoggedEvent is an entry of the event log used by the at-least-once delivery mode
+type LoggedEvent struct {
+	Seq        uint64              `json:"seq"`
+	Event      string              `json:"event"`
+	Data       jsoniter.RawMessage `json:"data"`
+	ReceivedAt time.Time           `json:"received_at"`
+}
+
+// EventAck is the payload of the @ack-events RPC
+type EventAck struct {
+	Consumer string `json:"consumer"`
+	// Seq is the last event the consumer has processed
+	Seq uint64 `json:"seq"`
+	// Unregister removes the consumer, so the log isn't kept around for it anymore
+	Unregister bool `json:"unregister"`
+}
+
+// eventLog keeps every event in the event-log key until all consumers have acknowledged it,
+// so consumers that disconnect for a while can catch up on what they missed
+type eventLog struct {
+	bridge  *Bridge
+	key     string
+	acksKey string
+	max     int
+
+	mu     sync.Mutex
+	events []LoggedEvent
+	acks   map[string]uint64
+}
+
+func (b *Bridge) newEventLog(max int) *eventLog {
+	l := &eventLog{
+		bridge:  b,
+		key:     b.key("event-log"),
+		acksKey: b.key("event-log-acks"),
+		max:     max,
+		events:  make([]LoggedEvent, 0),
+		acks:    make(map[string]uint64),
+	}
+	_ = b.kv.GetJSON(l.key, &l.events)
+	_ = b.kv.GetJSON(l.acksKey, &l.acks)
+
+	// Keep numbering events from where we left off, so acks stay valid across restarts
+	last := uint64(0)
+	if len(l.events) > 0 {
+		last = l.events[len(l.events)-1].Seq
+	}
+	for _, seq := range l.acks {
+		if seq > last {
+			last = seq
+		}
+	}
+	atomic.StoreUint64(&b.eventSeq, last)
+	return l
+}
+
+func (l *eventLog) append(event BridgeEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, LoggedEvent{Seq: event.Seq, Event: event.Name, Data: event.Payload, ReceivedAt: event.ReceivedAt})
+	if len(l.events) > l.max {
+		dropped := len(l.events) - l.max
+		l.bridge.log.WithField("dropped", dropped).Warn("Event log is full, dropping events not acknowledged by all consumers")
+		l.events = l.events[dropped:]
+	}
+	l.bridge.setJSON(l.key, l.events)
+}
+
+func (l *eventLog) ack(ack EventAck) {
+	consumer := strings.TrimSpace(ack.Consumer)
+	if consumer == "" {
+		consumer = "default"
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ack.Unregister {
+		delete(l.acks, consumer)
+	} else if ack.Seq > l.acks[consumer] {
+		l.acks[consumer] = ack.Seq
+	}
+	l.bridge.setJSON(l.acksKey, l.acks)
+
+	// Drop everything that every consumer has seen
+	if len(l.acks) == 0 {
+		return
+	}
+	acked := ^uint64(0)
+	for _, seq := range l.acks {
+		if seq < acked {
+			acked = seq
+		}
+	}
+	i := 0
+	for i < len(l.events) && l.events[i].Seq <= acked {
+		i++
+	}
+	if i > 0 {
+		l.events = l.events[i:]
+		l.bridge.setJSON(l.key, l.events)
+	}
+}
+
+// setupEventLog enables at-least-once delivery, consumers acknowledge events with @ack-events
+func (b *Bridge) setupEventLog(ctx context.Context, max int) error {
+	b.eventLog = b.newEventLog(max)
+	return b.handleRPC(ctx, "@ack-events", func(value string) {
+		var ack EventAck
+		err := jsoniter.ConfigFastest.UnmarshalFromString(value, &ack)
+		if err != nil {
+			b.log.WithError(err).Error("Could not decode event ack")
+			return
+		}
+		b.eventLog.ack(ack)
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// errRestartRequired is reported for connection settings in the config file
+var errRestartRequired = errors.New("connection settings can only be changed with a restart")
+
+// ReloadResult is emitted after every reload, listing what was reloaded and what failed
+type ReloadResult struct {
+	Reloaded []string          `json:"reloaded"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+// ReloadSources are the local files re-read on reload (empty paths are skipped)
+type ReloadSources struct {
+	ConfigFile   string
+	MessagesFile string
+	HooksFile    string
+	APIKeysFile  string
+	SoundsFile   string
+}
+
+// message returns the text of a bridge message
+func (b *Bridge) message(id string) string {
+	b.reloadMu.RLock()
+	defer b.reloadMu.RUnlock()
+	return b.messages[id]
+}
+
+// currentHooks returns the hooks configuration, or nil if there is none
+func (b *Bridge) currentHooks() *HooksConfig {
+	b.reloadMu.RLock()
+	defer b.reloadMu.RUnlock()
+	return b.hooks
+}
+
+// Connection settings are startup flags: changing the channel or the Glimesh instance would
+// need new state for most of the bridge, so they're rejected if they show up in the config file
+var connectionSettings = []string{
+	"channel_id", "client_id", "client_secret", "access_token", "auth_mode",
+	"glimesh_url", "api_path", "socket_path", "oauth_token_path",
+}
+
+// readConfigFile applies the settings in a JSON config file on top of config
+func readConfigFile(path string, config *Config) error {
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return jsoniter.ConfigFastest.Unmarshal(byt, config)
+}
+
+// configFileConnectionSettings returns the connection settings found in a JSON config file
+func configFileConnectionSettings(path string) ([]string, error) {
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]jsoniter.RawMessage
+	if err := jsoniter.ConfigFastest.Unmarshal(byt, &fields); err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, setting := range connectionSettings {
+		if _, ok := fields[setting]; ok {
+			found = append(found, setting)
+		}
+	}
+	return found, nil
+}
+
+// reload re-reads the local files and the config key. Queued outgoing messages and subscriptions
+// are kept: if the API token was refreshed, the websocket reconnects transparently to use it.
+// Files that fail to load keep their previous contents.
+func (b *Bridge) reload(sources ReloadSources) ReloadResult {
+	result := ReloadResult{Reloaded: []string{}, Errors: make(map[string]string)}
+	fail := func(what string, err error) {
+		b.log.WithError(err).WithField("source", what).Error("Could not reload, keeping the previous settings")
+		result.Errors[what] = err.Error()
+	}
+
+	if sources.MessagesFile != "" {
+		if messages, err := loadMessages(sources.MessagesFile); err != nil {
+			fail("messages", err)
+		} else {
+			b.reloadMu.Lock()
+			b.messages = messages
+			b.reloadMu.Unlock()
+			result.Reloaded = append(result.Reloaded, "messages")
+		}
+	}
+	if sources.HooksFile != "" {
+		if hooks, err := loadHooks(sources.HooksFile); err != nil {
+			fail("hooks", err)
+		} else {
+			b.reloadMu.Lock()
+			b.hooks = hooks
+			b.reloadMu.Unlock()
+			result.Reloaded = append(result.Reloaded, "hooks")
+		}
+	}
+	if sources.SoundsFile != "" && b.sounds != nil {
+		if sounds, err := loadSounds(sources.SoundsFile); err != nil {
+			fail("sounds", err)
+		} else {
+			b.sounds.replace(sounds)
+			result.Reloaded = append(result.Reloaded, "sounds")
+		}
+	}
+	if sources.APIKeysFile != "" && b.apiKeys != nil {
+		if keys, err := loadAPIKeys(sources.APIKeysFile); err != nil {
+			fail("api-keys", err)
+		} else {
+			b.apiKeys.replace(keys)
+			result.Reloaded = append(result.Reloaded, "api-keys")
+		}
+	}
+	if sources.ConfigFile != "" {
+		// Written to the config key, which validates and applies it like any other config change
+		configKey := b.key("config")
+		var config Config
+		if err := b.kv.GetJSON(configKey, &config); err != nil {
+			fail("config", err)
+		} else if err := readConfigFile(sources.ConfigFile, &config); err != nil {
+			fail("config", err)
+		} else {
+			b.setJSON(configKey, config)
+			result.Reloaded = append(result.Reloaded, "config")
+		}
+		if settings, err := configFileConnectionSettings(sources.ConfigFile); err == nil {
+			for _, setting := range settings {
+				fail(setting, errRestartRequired)
+			}
+		}
+	}
+	if b.connection != nil && b.connection.tokenChanged() {
+		b.connection.reconnect("token was refreshed")
+		result.Reloaded = append(result.Reloaded, "websocket")
+	}
+
+	b.log.WithField("reloaded", result.Reloaded).Info("Reloaded settings")
+	b.setJSON(b.key("ev/reloaded"), result)
+	return result
+}
+
+// setupReloadRPC registers the @reload-config RPC, doing the same as SIGHUP
+func (b *Bridge) setupReloadRPC(ctx context.Context, sources ReloadSources) error {
+	return b.handleRPC(ctx, "@reload-config", func(string) {
+		b.reload(sources)
+	})
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// Number of chatters listed in the monthly report
+	reportTopChatters = 10
+	// How often to check whether a month ended
+	reportCheckInterval = time.Hour
+	reportMonthLayout   = "2006-01"
+)
+
+// MonthlyReport summarizes the activity of a calendar month, written to disk and published as ev/monthly-report
+type MonthlyReport struct {
+	Month          string             `json:"month"`
+	GeneratedAt    time.Time          `json:"generated_at"`
+	Path           string             `json:"path"`
+	ChatMessages   int                `json:"chat_messages"`
+	UniqueChatters int                `json:"unique_chatters"`
+	TopChatters    []LeaderboardEntry `json:"top_chatters"`
+	// Stream stats are only available with -session-report
+	Streams      int     `json:"streams"`
+	StreamHours  float64 `json:"stream_hours"`
+	PeakViewers  int     `json:"peak_viewers"`
+	NewFollowers int     `json:"new_followers"`
+	// Followers at the end of the month (-1 if they could not be fetched)
+	TotalFollowers int `json:"total_followers"`
+}
+
+const markdownReportTemplate = `# Monthly report: {{ .Month }}
+
+## Chat
+
+- Messages: {{ .ChatMessages }}
+- Unique chatters: {{ .UniqueChatters }}
+{{ if .TopChatters }}
+| # | Chatter | Messages |
+|---|---------|----------|
+{{ range $i, $entry := .TopChatters }}| {{ inc $i }} | {{ $entry.Username }} | {{ $entry.Messages }} |
+{{ end }}{{ end }}
+## Streams
+
+- Streams: {{ .Streams }}
+- Stream hours: {{ printf "%.1f" .StreamHours }}
+- Peak viewers: {{ .PeakViewers }}
+
+## Followers
+
+- New followers: {{ .NewFollowers }}
+- Total followers: {{ if ge .TotalFollowers 0 }}{{ .TotalFollowers }}{{ else }}unknown{{ end }}
+
+_Generated on {{ .GeneratedAt.Format "2006-01-02 15:04" }}_
+`
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Monthly report: {{ .Month }}</title></head>
+<body>
+<h1>Monthly report: {{ .Month }}</h1>
+<h2>Chat</h2>
+<ul>
+<li>Messages: {{ .ChatMessages }}</li>
+<li>Unique chatters: {{ .UniqueChatters }}</li>
+</ul>
+{{ if .TopChatters }}<table>
+<tr><th>#</th><th>Chatter</th><th>Messages</th></tr>
+{{ range $i, $entry := .TopChatters }}<tr><td>{{ inc $i }}</td><td>{{ $entry.Username }}</td><td>{{ $entry.Messages }}</td></tr>
+{{ end }}</table>
+{{ end }}<h2>Streams</h2>
+<ul>
+<li>Streams: {{ .Streams }}</li>
+<li>Stream hours: {{ printf "%.1f" .StreamHours }}</li>
+<li>Peak viewers: {{ .PeakViewers }}</li>
+</ul>
+<h2>Followers</h2>
+<ul>
+<li>New followers: {{ .NewFollowers }}</li>
+<li>Total followers: {{ if ge .TotalFollowers 0 }}{{ .TotalFollowers }}{{ else }}unknown{{ end }}</li>
+</ul>
+<p><em>Generated on {{ .GeneratedAt.Format "2006-01-02 15:04" }}</em></p>
+</body>
+</html>
+`
+
+var reportFuncs = map[string]interface{}{"inc": func(i int) int { return i + 1 }}
+
+// MonthlyReportOptions configures the monthly report, see -monthly-report
+type MonthlyReportOptions struct {
+	Dir    string
+	Format string
+	// Session report file (-session-report) the stream stats are read from
+	SessionReport string
+}
+
+type monthlyReports struct {
+	bridge  *Bridge
+	options MonthlyReportOptions
+}
+
+// reportMonth returns the start and end of the month containing t, in local time
+func reportMonth(t time.Time) (time.Time, time.Time) {
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// generate builds the report of the month starting at start and writes it to disk
+func (r *monthlyReports) generate(ctx context.Context, start time.Time) (MonthlyReport, error) {
+	start, end := reportMonth(start)
+	inMonth := func(t time.Time) bool {
+		return !t.Before(start) && t.Before(end)
+	}
+	report := MonthlyReport{Month: start.Format(reportMonthLayout), GeneratedAt: time.Now(), TotalFollowers: -1}
+
+	// Chat volume, from the archive file if there is one since the in-memory archive is capped
+	var messages []ArchivedMessage
+	if r.bridge.archive.path != "" {
+		var err error
+		messages, err = readChatArchive(r.bridge.archive.path)
+		if err != nil {
+			return report, fmt.Errorf("could not read chat archive: %w", err)
+		}
+	} else {
+		messages = r.bridge.archive.filtered("")
+	}
+	counts := make(map[string]int)
+	for _, message := range messages {
+		if message.Deleted || !inMonth(message.ReceivedAt) {
+			continue
+		}
+		report.ChatMessages++
+		counts[message.User.Username]++
+	}
+	report.UniqueChatters = len(counts)
+	for username, count := range counts {
+		report.TopChatters = append(report.TopChatters, LeaderboardEntry{Username: username, Messages: count})
+	}
+	sort.Slice(report.TopChatters, func(i, j int) bool {
+		if report.TopChatters[i].Messages != report.TopChatters[j].Messages {
+			return report.TopChatters[i].Messages > report.TopChatters[j].Messages
+		}
+		return report.TopChatters[i].Username < report.TopChatters[j].Username
+	})
+	if len(report.TopChatters) > reportTopChatters {
+		report.TopChatters = report.TopChatters[:reportTopChatters]
+	}
+
+	// Stream hours
+	if r.options.SessionReport != "" {
+		sessions, err := readSessionReport(r.options.SessionReport)
+		if err != nil && !os.IsNotExist(err) {
+			r.bridge.log.WithError(err).Warn("Could not read session report for monthly report")
+		}
+		seconds := 0
+		for _, session := range sessions {
+			if !inMonth(session.StartedAt) {
+				continue
+			}
+			report.Streams++
+			seconds += session.DurationSeconds
+			if session.PeakViewers > report.PeakViewers {
+				report.PeakViewers = session.PeakViewers
+			}
+		}
+		report.StreamHours = float64(seconds) / 3600
+	}
+
+	// Follower growth, from the follow dates of the current followers
+	if info, ok := r.bridge.channelInfo(); ok {
+		followers, err := r.bridge.api.fetchFollowers(ctx, info.Streamer.ID)
+		if err != nil {
+			r.bridge.log.WithError(err).Warn("Could not fetch followers for monthly report")
+		} else {
+			report.TotalFollowers = 0
+			for _, follower := range followers {
+				followedAt, err := parseNaiveDateTime(follower.InsertedAt)
+				if err != nil || !followedAt.Before(end) {
+					continue
+				}
+				report.TotalFollowers++
+				if inMonth(followedAt) {
+					report.NewFollowers++
+				}
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	var err error
+	extension := ".md"
+	if r.options.Format == "html" {
+		extension = ".html"
+		err = htmltemplate.Must(htmltemplate.New("report").Funcs(reportFuncs).Parse(htmlReportTemplate)).Execute(&out, report)
+	} else {
+		err = template.Must(template.New("report").Funcs(reportFuncs).Parse(markdownReportTemplate)).Execute(&out, report)
+	}
+	if err != nil {
+		return report, err
+	}
+	if err := os.MkdirAll(r.options.Dir, 0755); err != nil {
+		return report, err
+	}
+	report.Path = filepath.Join(r.options.Dir, "report-"+report.Month+extension)
+	if err := os.WriteFile(report.Path, out.Bytes(), 0644); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// publish generates the report of a month and announces it
+func (r *monthlyReports) publish(ctx context.Context, month time.Time) {
+	report, err := r.generate(ctx, month)
+	if err != nil {
+		r.bridge.log.WithError(err).WithField("month", month.Format(reportMonthLayout)).Error("Could not generate monthly report")
+		return
+	}
+	r.bridge.log.WithField("path", report.Path).Info("Monthly report generated")
+	r.bridge.setJSON(r.bridge.key("monthly-report"), report)
+	r.bridge.setJSON(r.bridge.key("ev/monthly-report"), report)
+}
+
+// run generates the report of the previous month as soon as it ends (or on startup if it was missed)
+func (r *monthlyReports) run(ctx context.Context) {
+	ticker := time.NewTicker(reportCheckInterval)
+	defer ticker.Stop()
+	for {
+		current, _ := reportMonth(time.Now())
+		previous := current.AddDate(0, -1, 0)
+		var last MonthlyReport
+		err := r.bridge.kv.GetJSON(r.bridge.key("monthly-report"), &last)
+		if err != nil || last.Month < previous.Format(reportMonthLayout) {
+			r.publish(ctx, previous)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setupMonthlyReports starts the monthly report schedule and registers the @monthly-report RPC,
+// which generates the report of a month (YYYY-MM, the previous month if empty) right away
+func (b *Bridge) setupMonthlyReports(ctx context.Context, options MonthlyReportOptions) error {
+	if options.Format != "markdown" && options.Format != "html" {
+		return fmt.Errorf("unknown report format %q", options.Format)
+	}
+	reports := &monthlyReports{bridge: b, options: options}
+	err := b.handleRPC(ctx, "@monthly-report", func(value string) {
+		current, _ := reportMonth(time.Now())
+		month := current.AddDate(0, -1, 0)
+		if value = strings.TrimSpace(value); value != "" {
+			parsed, err := time.ParseInLocation(reportMonthLayout, value, time.Local)
+			if err != nil {
+				b.log.WithError(err).Error("Invalid month for monthly report")
+				return
+			}
+			month = parsed
+		}
+		go reports.publish(ctx, month)
+	})
+	if err != nil {
+		return err
+	}
+	b.goSafe(ctx, "monthly-reports", reports.run)
+	return nil
+}
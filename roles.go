@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Chat roles, from the least to the most privileged
+const (
+	RoleViewer     = "viewer"
+	RoleFollower   = "follower"
+	RoleSubscriber = "subscriber"
+	RoleModerator  = "moderator"
+	RoleStreamer   = "streamer"
+)
+
+var roleRank = map[string]int{
+	RoleViewer:     0,
+	RoleFollower:   1,
+	RoleSubscriber: 2,
+	RoleModerator:  3,
+	RoleStreamer:   4,
+}
+
+// roleAtLeast returns whether role is as privileged as minimum
+func roleAtLeast(role, minimum string) bool {
+	return roleRank[role] >= roleRank[minimum]
+}
+
+// How long to wait before looking up a follower status again after a failed lookup
+const followerRetryDelay = 30 * time.Second
+
+// followerCache remembers which users follow the channel, since chat metadata doesn't say
+type followerCache struct {
+	bridge *Bridge
+	ttl    time.Duration
+
+	entries *lruCache
+
+	mu sync.Mutex
+	// Users being looked up in the background
+	pending map[string]bool
+}
+
+type followerCacheEntry struct {
+	following bool
+	expires   time.Time
+}
+
+func (e followerCacheEntry) memorySize() int {
+	return 32
+}
+
+func (b *Bridge) newFollowerCache(ttl time.Duration) *followerCache {
+	return &followerCache{
+		bridge:  b,
+		ttl:     ttl,
+		entries: b.newLRUCache("followers", b.memory.UserCaches),
+		pending: make(map[string]bool),
+	}
+}
+
+// isFollower returns the cached follower status of a user without waiting for the API. If it's
+// missing or expired, it's looked up in the background and the last known status (or false) is
+// returned, so the user gets the follower role from their next message.
+func (f *followerCache) isFollower(userID string) bool {
+	info, ok := f.bridge.channelInfo()
+	if !ok || userID == "" {
+		return false
+	}
+
+	following := false
+	if value, ok := f.entries.get(userID); ok {
+		entry := value.(followerCacheEntry)
+		if time.Now().Before(entry.expires) {
+			return entry.following
+		}
+		following = entry.following
+	}
+
+	if !f.bridge.health.healthy(ComponentAPI) {
+		return following
+	}
+	f.mu.Lock()
+	if f.pending[userID] {
+		f.mu.Unlock()
+		return following
+	}
+	f.pending[userID] = true
+	f.mu.Unlock()
+	go f.lookup(f.bridge.ctx, info.Streamer.ID, userID)
+	return following
+}
+
+// lookup asks the API whether a user follows the channel and caches the result
+func (f *followerCache) lookup(ctx context.Context, streamerID string, userID string) {
+	defer func() {
+		f.mu.Lock()
+		delete(f.pending, userID)
+		f.mu.Unlock()
+	}()
+	ctx, cancel := context.WithTimeout(ctx, userLookupTimeout)
+	defer cancel()
+	result, err := f.bridge.api.IsFollower(ctx, streamerID, userID)
+	if err != nil {
+		f.bridge.log.WithError(err).WithField("user-id", userID).Warn("Could not check follower status")
+		// Keep the last known status, so an API blip doesn't demote followers, and try again soon
+		following := false
+		if value, ok := f.entries.get(userID); ok {
+			following = value.(followerCacheEntry).following
+		}
+		f.entries.put(userID, followerCacheEntry{following: following, expires: time.Now().Add(followerRetryDelay)})
+		return
+	}
+	following := result.Followers != nil && result.Followers.Count > 0
+	f.entries.put(userID, followerCacheEntry{following: following, expires: time.Now().Add(f.ttl)})
+}
+
+// metadataRole derives a role from the chat message metadata alone, which holds for any channel
+func metadataRole(meta *ChatMessageMetadata) string {
+	if meta != nil {
+		switch {
+		case meta.Streamer:
+			return RoleStreamer
+		case meta.Moderator || meta.Admin:
+			return RoleModerator
+		case meta.Subscriber:
+			return RoleSubscriber
+		}
+	}
+	return RoleViewer
+}
+
+// chatRole derives the normalized role of the author of a chat message
+func (b *Bridge) chatRole(msg ChatMessage) string {
+	if b.isStreamer(msg.User.Username) {
+		return RoleStreamer
+	}
+	if role := metadataRole(msg.Metadata); role != RoleViewer {
+		return role
+	}
+	if b.followers != nil && b.followers.isFollower(msg.User.ID) {
+		return RoleFollower
+	}
+	return RoleViewer
+}
@@ -0,0 +1,29 @@
+package main
+
+import "context"
+
+// handleRPC subscribes to an RPC key under the bridge prefix and calls handler
+// with every value written to it
+func (b *Bridge) handleRPC(ctx context.Context, name string, handler func(value string)) error {
+	key := b.key(name)
+	incoming, err := b.kv.SubscribeKey(key)
+	if err != nil {
+		return err
+	}
+	b.goSafe(ctx, "rpc:"+name, func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case kv := <-incoming:
+				if logger, ok := b.sampledLog(logCategoryRPC); ok {
+					logger.WithField("key", kv.Key).Debug("Received RPC message")
+				}
+				b.protect("rpc:"+name, func() {
+					handler(kv.Value)
+				})
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// isInvisible returns whether r is a zero-width or direction override character,
+// often used to evade word filters or mess with the layout of overlays
+func isInvisible(r rune) bool {
+	switch r {
+	case '\u00ad', '\u180e', '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff':
+		return true
+	}
+	return (r >= '\u202a' && r <= '\u202e') || (r >= '\u2066' && r <= '\u2069')
+}
+
+// sanitizeText replaces invalid UTF-8, turns whitespace control characters into spaces,
+// drops all other control characters and optionally invisible characters
+func sanitizeText(text string, stripInvisible bool) string {
+	text = strings.ToValidUTF8(text, "\ufffd")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		case stripInvisible && isInvisible(r):
+			return -1
+		}
+		return r
+	}, text)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sendCommand sends chat messages from the command line or, with -stdin, one per line read from stdin
+func sendCommand(args []string) {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	channelID := fs.Int("channel-id", -1, "Glimesh channel ID")
+	clientID := fs.String("client-id", "", "Glimesh app client ID")
+	clientSecret := fs.String("client-secret", "", "Glimesh app secret key")
+	server := registerServerFlags(fs)
+	fromStdin := fs.Bool("stdin", false, "Send every line read from stdin as a chat message")
+	interval := fs.Duration("interval", time.Second, "Minimum time between messages")
+	maxParts := fs.Int("max-parts", 3, "Split messages longer than the Glimesh limit in up to this many messages")
+	_ = fs.Parse(args)
+
+	if *channelID == -1 {
+		check(fmt.Errorf("missing required flags"), "You must provide a channel ID")
+	}
+	check(server.validate(*clientID, *clientSecret), "Invalid Glimesh server options")
+	if server.readOnly() {
+		check(ErrReadOnly, "Sending chat messages needs a secret key or access token")
+	}
+	if !*fromStdin && fs.NArg() == 0 {
+		check(fmt.Errorf("no message"), "You must provide a message or use -stdin")
+	}
+
+	ctx := context.Background()
+	credentials, err := server.credentials(ctx, *clientID, *clientSecret, "public chat")
+	check(err, "Could not retrieve Glimesh API token")
+	api := server.newClient(credentials.AccessToken)
+
+	var last time.Time
+	send := func(text string) {
+		for _, part := range splitMessage(strings.TrimSpace(text), glimeshMaxMessageLength, *maxParts) {
+			if wait := time.Until(last.Add(*interval)); wait > 0 {
+				time.Sleep(wait)
+			}
+			_, err := api.SendChatMessage(ctx, strconv.Itoa(*channelID), ChatMessageInput{Message: part})
+			last = time.Now()
+			check(err, "Could not send chat message")
+		}
+	}
+
+	if !*fromStdin {
+		send(strings.Join(fs.Args(), " "))
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		send(scanner.Text())
+	}
+	check(scanner.Err(), "Could not read from stdin")
+}
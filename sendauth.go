@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errSendUnauthorized = errors.New("unauthorized sender")
+
+// sendAuth checks the credentials of RPC senders, so a compromised overlay page
+// can't post to chat through the open RPC keys
+type sendAuth struct {
+	secret string
+	// Secret by source
+	sources map[string]string
+}
+
+// parseSendAuth parses -send-secret and -send-sources ("name=secret" entries). Every source needs
+// a secret: senders name themselves, so a name alone would let anyone pretend to be that source.
+func parseSendAuth(secret string, sources string) (*sendAuth, error) {
+	auth := &sendAuth{secret: secret, sources: make(map[string]string)}
+	for _, item := range parseList(sources) {
+		parts := strings.SplitN(item, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if name == "" || len(parts) < 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid sender %q, expected name=secret", item)
+		}
+		auth.sources[name] = parts[1]
+	}
+	return auth, nil
+}
+
+// required returns whether senders must authenticate at all
+func (a *sendAuth) required() bool {
+	return a != nil && (a.secret != "" || len(a.sources) > 0)
+}
+
+func secretsEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authorize returns nil if the sender can post to chat. Requests that send messages
+// (@send-chat-message, @send-canned-response, @announce, @graphql) name their source and include
+// the shared secret (-send-secret) or the one of their source (-send-sources).
+func (a *sendAuth) authorize(source string, secret string) error {
+	if !a.required() {
+		return nil
+	}
+	if a.secret != "" && secretsEqual(secret, a.secret) {
+		return nil
+	}
+	if expected, ok := a.sources[source]; ok && secretsEqual(secret, expected) {
+		return nil
+	}
+	return errSendUnauthorized
+}
+
+// authorizeSend checks an RPC sender, logging and reporting rejected requests
+func (b *Bridge) authorizeSend(rpc string, id string, message string, source string, secret string) bool {
+	err := b.sendAuth.authorize(source, secret)
+	if err == nil {
+		return true
+	}
+	b.log.WithField("rpc", rpc).WithField("source", source).Warn("Rejected chat message from unauthorized sender")
+	b.chat.report(ChatSendResult{ID: id, Message: message, Source: source, Status: "rejected", Error: err.Error()})
+	return false
+}
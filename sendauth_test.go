@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestParseSendAuth(t *testing.T) {
+	tests := []struct {
+		sources string
+		valid   bool
+	}{
+		{"", true},
+		{"dashboard=s3cret", true},
+		{"dashboard=s3cret, overlay=other=secret", true},
+		{"dashboard", false},
+		{"dashboard=", false},
+		{"=s3cret", false},
+		{"dashboard=s3cret,overlay", false},
+	}
+	for _, test := range tests {
+		_, err := parseSendAuth("", test.sources)
+		if (err == nil) != test.valid {
+			t.Errorf("parseSendAuth(%q) error = %v, want valid %v", test.sources, err, test.valid)
+		}
+	}
+}
+
+func TestSendAuthAuthorize(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		sources string
+		source  string
+		key     string
+		allowed bool
+	}{
+		{"no auth configured", "", "", "anyone", "", true},
+		{"shared secret", "shared", "", "overlay", "shared", true},
+		{"shared secret without source", "shared", "", "", "shared", true},
+		{"wrong shared secret", "shared", "", "overlay", "nope", false},
+		{"missing secret", "shared", "", "overlay", "", false},
+		{"source secret", "", "dashboard=s3cret", "dashboard", "s3cret", true},
+		{"source name alone", "", "dashboard=s3cret", "dashboard", "", false},
+		{"secret of another source", "", "dashboard=s3cret,overlay=other", "overlay", "s3cret", false},
+		{"unknown source", "", "dashboard=s3cret", "bot", "s3cret", false},
+		{"secret containing =", "", "overlay=other=secret", "overlay", "other=secret", true},
+		{"shared secret with sources", "shared", "dashboard=s3cret", "bot", "shared", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth, err := parseSendAuth(test.secret, test.sources)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := auth.authorize(test.source, test.key); (err == nil) != test.allowed {
+				t.Errorf("authorize(%q, %q) = %v, want allowed %v", test.source, test.key, err, test.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// Maximum number of outgoing messages waiting to be sent, anything more is dropped
+	chatSendQueueSize = 10
+	// Maximum length (in characters) of a Glimesh chat message
+	glimeshMaxMessageLength = 255
+	// How long to wait for Glimesh to accept a sent message
+	chatSendReplyTimeout = 10 * time.Second
+	// Pace used when Glimesh rejects a message because of slow mode, doubled on every rejection
+	minDetectedSlowMode = 5 * time.Second
+	maxDetectedSlowMode = 2 * time.Minute
+)
+
+// ChatSendRequest is the JSON form of a @send-chat-message RPC call,
+// plain text values are also accepted (with no ID)
+type ChatSendRequest struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	// User the message is addressed to, available as {{.User}} in templates
+	User string `json:"user"`
+	// Raw disables template rendering
+	Raw bool `json:"raw"`
+	// Source names the sender, sent messages are tagged with it. Secret authenticates it
+	// when -send-secret or -send-sources are set.
+	Source string `json:"source"`
+	Secret string `json:"secret"`
+	// Requester is who asked for the message (eg. the chatter who ran a command), for the outgoing log
+	Requester string `json:"requester"`
+}
+
+// ChatSendResult reports what happened to an outgoing message, so callers know
+// when their message was delayed or dropped because of chat restrictions
+type ChatSendResult struct {
+	ID      string `json:"id,omitempty"`
+	Message string `json:"message"`
+	// Source and Requester of the request (see ChatSendRequest)
+	Source    string `json:"source,omitempty"`
+	Requester string `json:"requester,omitempty"`
+	// Status is one of "sent", "delayed", "dropped", "failed", "rejected" (unauthorized sender,
+	// or refused by Glimesh, eg. because of slow mode or a ban) or "suppressed" (automated
+	// message in maintenance mode)
+	Status  string `json:"status"`
+	DelayMS int64  `json:"delay_ms,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// chatSender sends chat messages from a queue, pacing them to respect the channel slow mode
+type chatSender struct {
+	bridge *Bridge
+	socket *glimeshSocket
+	queue  chan ChatSendRequest
+
+	mu       sync.Mutex
+	slowMode time.Duration
+	// Slow mode found out from rejected messages, used if longer than the configured one
+	detectedSlowMode time.Duration
+	maxParts         int
+	// When the next message can be sent, taking queued messages into account
+	nextSlot time.Time
+}
+
+// newChatSender creates the outgoing message queue, messages are only sent once
+// the sender is started with setupChatSender
+func (b *Bridge) newChatSender(config Config) *chatSender {
+	return &chatSender{
+		bridge:   b,
+		queue:    make(chan ChatSendRequest, chatSendQueueSize),
+		slowMode: time.Duration(config.ChatSlowMode) * time.Second,
+		maxParts: config.ChatMaxParts,
+	}
+}
+
+func (s *chatSender) configure(config Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slowMode = time.Duration(config.ChatSlowMode) * time.Second
+	s.maxParts = config.ChatMaxParts
+}
+
+// pace returns the time to wait between messages, must be called with mu held
+func (s *chatSender) pace() time.Duration {
+	if s.detectedSlowMode > s.slowMode {
+		return s.detectedSlowMode
+	}
+	return s.slowMode
+}
+
+// slowedDown raises the detected slow mode after a message was rejected because of it,
+// returning the new pace
+func (s *chatSender) slowedDown() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.detectedSlowMode *= 2
+	if s.detectedSlowMode < minDetectedSlowMode {
+		s.detectedSlowMode = minDetectedSlowMode
+	}
+	if s.detectedSlowMode > maxDetectedSlowMode {
+		s.detectedSlowMode = maxDetectedSlowMode
+	}
+	s.bridge.log.WithField("pace", s.pace()).Warn("Chat is in slow mode, pacing outgoing messages")
+	return s.pace()
+}
+
+// isSlowModeError returns whether Glimesh rejected a message because it was sent too soon
+func isSlowModeError(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "slow") || strings.Contains(message, "too quickly") || strings.Contains(message, "too fast")
+}
+
+func (s *chatSender) report(result ChatSendResult) {
+	s.bridge.setJSON(s.bridge.key("ev/chat-send-result"), result)
+	if s.bridge.outgoing != nil {
+		s.bridge.outgoing.record(result)
+	}
+}
+
+// send renders and queues a message for sending, splitting it in multiple messages if it's too long
+func (s *chatSender) send(req ChatSendRequest) {
+	if s.bridge.readOnly {
+		s.report(ChatSendResult{ID: req.ID, Message: req.Message, Source: req.Source, Requester: req.Requester, Status: "failed", Error: ErrReadOnly.Error()})
+		return
+	}
+	if s.bridge.inMaintenance() && automatedSources[req.Source] {
+		s.report(ChatSendResult{ID: req.ID, Message: req.Message, Source: req.Source, Requester: req.Requester, Status: "suppressed"})
+		return
+	}
+	if !req.Raw {
+		rendered, err := s.bridge.renderTemplate(req.Message, s.bridge.templateData(req.User))
+		if err != nil {
+			s.bridge.log.WithError(err).Error("Could not render message template")
+			s.report(ChatSendResult{ID: req.ID, Message: req.Message, Source: req.Source, Requester: req.Requester, Status: "failed", Error: err.Error()})
+			return
+		}
+		req.Message = rendered
+	}
+
+	s.mu.Lock()
+	maxParts := s.maxParts
+	s.mu.Unlock()
+
+	message := sanitizeText(req.Message, s.bridge.stripInvisible)
+	parts := splitMessage(strings.TrimSpace(message), glimeshMaxMessageLength, maxParts)
+	if len(parts) > 1 {
+		s.bridge.log.WithField("parts", len(parts)).Debug("Splitting long chat message")
+	}
+	for _, part := range parts {
+		s.enqueue(ChatSendRequest{ID: req.ID, Message: part, Source: req.Source, Requester: req.Requester})
+	}
+}
+
+// enqueue queues a single message, reporting right away if it's dropped or delayed
+func (s *chatSender) enqueue(req ChatSendRequest) {
+	s.mu.Lock()
+	now := time.Now()
+	delay := s.nextSlot.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	select {
+	case s.queue <- req:
+		s.nextSlot = now.Add(delay + s.pace())
+	default:
+		s.mu.Unlock()
+		s.bridge.log.WithField("id", req.ID).Warn("Outgoing chat queue is full, dropping message")
+		s.report(ChatSendResult{ID: req.ID, Message: req.Message, Source: req.Source, Requester: req.Requester, Status: "dropped", Error: "too many messages queued"})
+		return
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		s.report(ChatSendResult{ID: req.ID, Message: req.Message, Source: req.Source, Requester: req.Requester, Status: "delayed", DelayMS: delay.Milliseconds()})
+	}
+}
+
+// run sends queued messages, waiting between them as required by slow mode
+func (s *chatSender) run(ctx context.Context) {
+	var last time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-s.queue:
+			s.mu.Lock()
+			wait := time.Until(last.Add(s.pace()))
+			s.mu.Unlock()
+			if !sleepContext(ctx, wait) {
+				return
+			}
+			result := s.deliver(ctx, req)
+			last = time.Now()
+			if ctx.Err() != nil {
+				return
+			}
+			switch result.Status {
+			case "sent":
+				if logger, ok := s.bridge.sampledLog(logCategorySend); ok {
+					logger.Debug("Sent message")
+				}
+			case "rejected":
+				s.bridge.log.WithField("error", result.Error).Warn("Glimesh rejected chat message")
+			default:
+				s.bridge.log.WithField("error", result.Error).Error("Could not send chat message")
+			}
+			s.report(result)
+		}
+	}
+}
+
+// deliver sends a message and waits for Glimesh to accept it. A message rejected because of
+// slow mode is sent again once, after waiting for the (raised) pace.
+func (s *chatSender) deliver(ctx context.Context, req ChatSendRequest) ChatSendResult {
+	result := ChatSendResult{ID: req.ID, Message: req.Message, Source: req.Source, Requester: req.Requester, Status: "sent"}
+	variables := map[string]interface{}{
+		"channelId": s.bridge.channelIDString(),
+		"message":   ChatMessageInput{Message: req.Message},
+	}
+	for attempt := 0; ; attempt++ {
+		reply, err := s.socket.request(ctx, chatSendReplyTimeout, sendChatMessageDocument, variables)
+		if err != nil {
+			result.Status, result.Error = "failed", err.Error()
+			return result
+		}
+		messages := make([]string, 0, len(reply.Response.Errors))
+		for _, gqlErr := range reply.Response.Errors {
+			messages = append(messages, gqlErr.Message)
+		}
+		if reply.Status != "ok" && len(messages) == 0 {
+			messages = append(messages, "request failed with status "+reply.Status)
+		}
+		if len(messages) == 0 {
+			return result
+		}
+		message := strings.Join(messages, "; ")
+		if attempt == 0 && isSlowModeError(message) {
+			delay := s.slowedDown()
+			s.report(ChatSendResult{ID: req.ID, Message: req.Message, Source: req.Source, Requester: req.Requester, Status: "delayed", DelayMS: delay.Milliseconds(), Error: message})
+			if !sleepContext(ctx, delay) {
+				result.Status, result.Error = "failed", ctx.Err().Error()
+				return result
+			}
+			continue
+		}
+		result.Status, result.Error = "rejected", message
+		return result
+	}
+}
+
+// sleepContext waits for d, returning false if ctx is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// splitMessage splits text in chunks of at most limit characters on word boundaries
+// (words longer than limit are cut). If more than maxParts chunks would be needed,
+// the last one is truncated and ends with an ellipsis.
+func splitMessage(text string, limit int, maxParts int) []string {
+	if maxParts < 1 {
+		maxParts = 1
+	}
+	parts := make([]string, 0)
+	current := make([]rune, 0, limit)
+	flush := func() {
+		if len(current) > 0 {
+			parts = append(parts, string(current))
+			current = current[:0]
+		}
+	}
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		if len(current) > 0 && len(current)+1+len(runes) > limit {
+			flush()
+		}
+		for len(runes) > limit {
+			flush()
+			parts = append(parts, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		if len(current) > 0 {
+			current = append(current, ' ')
+		}
+		current = append(current, runes...)
+	}
+	flush()
+
+	if len(parts) > maxParts {
+		parts = parts[:maxParts]
+		last := []rune(parts[maxParts-1])
+		if len(last) >= limit {
+			last = last[:limit-1]
+		}
+		parts[maxParts-1] = string(last) + "…"
+	}
+	return parts
+}
+
+// parseChatSendRequest accepts both a JSON ChatSendRequest and plain text
+func parseChatSendRequest(value string) ChatSendRequest {
+	var req ChatSendRequest
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "{") && jsoniter.ConfigFastest.UnmarshalFromString(trimmed, &req) == nil {
+		return req
+	}
+	return ChatSendRequest{Message: value}
+}
+
+// setupChatSender starts sending queued messages and registers the @send-chat-message RPC
+func (b *Bridge) setupChatSender(ctx context.Context, socket *glimeshSocket) error {
+	b.chat.socket = socket
+	if b.readOnly {
+		// Don't even listen on the send key, so nobody expects messages to go through
+		return nil
+	}
+	b.goSafe(ctx, "chat-sender", b.chat.run)
+	return b.handleRPC(ctx, "@send-chat-message", func(value string) {
+		req := parseChatSendRequest(value)
+		if b.authorizeSend("@send-chat-message", req.ID, req.Message, req.Source, req.Secret) {
+			b.chat.send(req)
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Glimesh returns timestamps as NaiveDateTime, in UTC
+const naiveDateTimeLayout = "2006-01-02T15:04:05"
+
+// SessionSummary describes a stream session, published when the stream goes offline
+type SessionSummary struct {
+	Title           string    `json:"title"`
+	StartedAt       time.Time `json:"started_at"`
+	EndedAt         time.Time `json:"ended_at"`
+	DurationSeconds int       `json:"duration_seconds"`
+	PeakViewers     int       `json:"peak_viewers"`
+	TotalMessages   int       `json:"total_messages"`
+	NewFollowers    int       `json:"new_followers"`
+}
+
+func parseNaiveDateTime(value string) (time.Time, error) {
+	return time.ParseInLocation(naiveDateTimeLayout, value, time.UTC)
+}
+
+// sessionTracker follows the stream status and collects stats for the current session
+type sessionTracker struct {
+	bridge     *Bridge
+	reportPath string
+
+	mu             sync.Mutex
+	live           bool
+	summary        SessionSummary
+	startFollowers int
+}
+
+func (b *Bridge) newSessionTracker(reportPath string) *sessionTracker {
+	tracker := &sessionTracker{bridge: b, reportPath: reportPath}
+	// Resume the session, it's ended right away if the stream went offline in the meantime
+	if b.restored != nil && b.restored.Session != nil {
+		tracker.live = true
+		tracker.summary = b.restored.Session.Summary
+		tracker.startFollowers = b.restored.Session.StartFollowers
+	}
+	return tracker
+}
+
+func (s *sessionTracker) followerCount(ctx context.Context, info *ChannelInfo) int {
+	result, err := s.bridge.api.FollowerCount(ctx, info.Streamer.ID)
+	if err != nil || result.Followers == nil {
+		s.bridge.log.WithError(err).Warn("Could not fetch follower count for session summary")
+		return -1
+	}
+	return result.Followers.Count
+}
+
+// liveSince returns when the current session started, if the stream is live
+func (s *sessionTracker) liveSince() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.summary.StartedAt, s.live
+}
+
+func (s *sessionTracker) recordMessage() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.live {
+		s.summary.TotalMessages++
+	}
+}
+
+// update is called with fresh channel info and handles stream status transitions
+func (s *sessionTracker) update(ctx context.Context, info *ChannelInfo) {
+	live := info.Status == "LIVE" && info.Stream != nil
+
+	s.mu.Lock()
+	wasLive := s.live
+	s.mu.Unlock()
+
+	switch {
+	case live && !wasLive:
+		startedAt, err := parseNaiveDateTime(info.Stream.StartedAt)
+		if err != nil {
+			startedAt = time.Now()
+		}
+		followers := s.followerCount(ctx, info)
+
+		s.mu.Lock()
+		s.live = true
+		s.summary = SessionSummary{Title: info.Title, StartedAt: startedAt, PeakViewers: info.Stream.PeakViewers}
+		s.startFollowers = followers
+		s.mu.Unlock()
+		s.bridge.log.Info("Stream session started")
+		s.bridge.setJSON(s.bridge.key("ev/session-started"), info)
+		if hooks := s.bridge.currentHooks(); hooks != nil && time.Since(startedAt) < liveHookMaxDelay {
+			payload, _ := jsoniter.ConfigFastest.Marshal(info)
+			s.bridge.runHooks(ctx, hooks.OnLive, payload)
+		}
+	case live:
+		s.mu.Lock()
+		if info.Stream.CountViewers > s.summary.PeakViewers {
+			s.summary.PeakViewers = info.Stream.CountViewers
+		}
+		if info.Stream.PeakViewers > s.summary.PeakViewers {
+			s.summary.PeakViewers = info.Stream.PeakViewers
+		}
+		s.mu.Unlock()
+	case !live && wasLive:
+		followers := s.followerCount(ctx, info)
+
+		s.mu.Lock()
+		s.live = false
+		summary := s.summary
+		if followers >= 0 && s.startFollowers >= 0 {
+			summary.NewFollowers = followers - s.startFollowers
+		}
+		s.mu.Unlock()
+
+		summary.EndedAt = time.Now()
+		summary.DurationSeconds = int(summary.EndedAt.Sub(summary.StartedAt).Seconds())
+		s.bridge.log.WithField("duration", summary.EndedAt.Sub(summary.StartedAt).Round(time.Second)).Info("Stream session ended")
+		s.bridge.setJSON(s.bridge.key("session-summary"), summary)
+		s.bridge.setJSON(s.bridge.key("ev/session-ended"), summary)
+		if hooks := s.bridge.currentHooks(); hooks != nil {
+			payload, _ := jsoniter.ConfigFastest.Marshal(summary)
+			s.bridge.runHooks(ctx, hooks.OnOffline, payload)
+		}
+		if s.reportPath != "" {
+			err := appendSessionReport(s.reportPath, summary)
+			if err != nil {
+				s.bridge.log.WithError(err).Error("Could not write session report")
+			}
+		}
+	}
+}
+
+// appendSessionReport appends a summary to a CSV file (if the path ends in .csv)
+// or to a JSON lines file (everything else)
+func appendSessionReport(path string, summary SessionSummary) error {
+	_, statErr := os.Stat(path)
+	isNew := os.IsNotExist(statErr)
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if filepath.Ext(path) != ".csv" {
+		return jsoniter.ConfigFastest.NewEncoder(file).Encode(summary)
+	}
+
+	out := csv.NewWriter(file)
+	if isNew {
+		err = out.Write([]string{"title", "started_at", "ended_at", "duration_seconds", "peak_viewers", "total_messages", "new_followers"})
+		if err != nil {
+			return err
+		}
+	}
+	err = out.Write([]string{
+		summary.Title,
+		summary.StartedAt.Format(time.RFC3339),
+		summary.EndedAt.Format(time.RFC3339),
+		strconv.Itoa(summary.DurationSeconds),
+		strconv.Itoa(summary.PeakViewers),
+		strconv.Itoa(summary.TotalMessages),
+		strconv.Itoa(summary.NewFollowers),
+	})
+	if err != nil {
+		return err
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// readSessionReport reads the summaries written by appendSessionReport
+func readSessionReport(path string) ([]SessionSummary, error) {
+	var summaries []SessionSummary
+	if filepath.Ext(path) != ".csv" {
+		err := readJSONLines(path, func(line []byte) error {
+			var summary SessionSummary
+			if err := jsoniter.ConfigFastest.Unmarshal(line, &summary); err != nil {
+				return err
+			}
+			summaries = append(summaries, summary)
+			return nil
+		})
+		return summaries, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for i, record := range records {
+		if i == 0 || len(record) < 7 {
+			// Header
+			continue
+		}
+		summary := SessionSummary{Title: record[0]}
+		summary.StartedAt, _ = time.Parse(time.RFC3339, record[1])
+		summary.EndedAt, _ = time.Parse(time.RFC3339, record[2])
+		summary.DurationSeconds, _ = strconv.Atoi(record[3])
+		summary.PeakViewers, _ = strconv.Atoi(record[4])
+		summary.TotalMessages, _ = strconv.Atoi(record[5])
+		summary.NewFollowers, _ = strconv.Atoi(record[6])
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Value of -snapshot that stores snapshots in the snapshot key instead of a file
+const snapshotToKV = "kv"
+
+// SessionSnapshot is the state of the current stream session
+type SessionSnapshot struct {
+	Summary        SessionSummary `json:"summary"`
+	StartFollowers int            `json:"start_followers"`
+}
+
+// BridgeSnapshot is the internal state saved periodically, so a restart mid-stream
+// doesn't lose moderation and stats context
+type BridgeSnapshot struct {
+	TakenAt time.Time `json:"taken_at"`
+	// When the bridge started, for uptime
+	StartedAt time.Time `json:"started_at"`
+	// Current stream session, if live
+	Session *SessionSnapshot `json:"session,omitempty"`
+	// Users who already chatted (and were greeted) in the current stream
+	Stream         time.Time              `json:"stream"`
+	StreamChatters []string               `json:"stream_chatters"`
+	Greeted        []string               `json:"greeted"`
+	Strikes        map[string]UserStrikes `json:"strikes"`
+	Queue          []QueueEntry           `json:"queue"`
+	// Message counts of the leaderboards, by period
+	Leaderboards map[string]LeaderboardSnapshot `json:"leaderboards,omitempty"`
+}
+
+// snapshotter saves the bridge state to a file or the snapshot key
+type snapshotter struct {
+	bridge *Bridge
+	path   string
+}
+
+func (b *Bridge) newSnapshotter(path string) *snapshotter {
+	return &snapshotter{bridge: b, path: path}
+}
+
+// load returns the last snapshot, or nil if there is none or it's older than maxAge
+func (s *snapshotter) load(maxAge time.Duration) *BridgeSnapshot {
+	var snapshot BridgeSnapshot
+	var err error
+	if s.path == snapshotToKV {
+		err = s.bridge.kv.GetJSON(s.bridge.key("snapshot"), &snapshot)
+	} else {
+		var byt []byte
+		byt, err = os.ReadFile(s.path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err == nil {
+			err = jsoniter.ConfigFastest.Unmarshal(byt, &snapshot)
+		}
+	}
+	if err != nil {
+		s.bridge.log.WithError(err).Debug("No state snapshot to restore")
+		return nil
+	}
+	if age := time.Since(snapshot.TakenAt); age > maxAge {
+		s.bridge.log.WithField("age", age.Round(time.Second)).Info("State snapshot is too old, starting fresh")
+		return nil
+	}
+	s.bridge.log.WithField("taken-at", snapshot.TakenAt.Format(time.RFC3339)).Info("Restoring state snapshot")
+	return &snapshot
+}
+
+func (s *snapshotter) save() {
+	snapshot := s.bridge.takeSnapshot()
+	if s.path == snapshotToKV {
+		s.bridge.setJSON(s.bridge.key("snapshot"), snapshot)
+		return
+	}
+	byt, err := jsoniter.ConfigFastest.Marshal(snapshot)
+	if err == nil {
+		// Write to a temporary file first, so a crash mid-write doesn't corrupt the last snapshot
+		err = os.WriteFile(s.path+".tmp", byt, 0644)
+	}
+	if err == nil {
+		err = os.Rename(s.path+".tmp", s.path)
+	}
+	if err != nil {
+		s.bridge.log.WithError(err).Error("Could not save state snapshot")
+	}
+}
+
+// run saves a snapshot every interval until ctx is cancelled
+func (s *snapshotter) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.save()
+		}
+	}
+}
+
+// takeSnapshot collects the state of all the subsystems
+func (b *Bridge) takeSnapshot() BridgeSnapshot {
+	snapshot := BridgeSnapshot{TakenAt: time.Now(), StartedAt: b.connStats.started}
+
+	b.session.mu.Lock()
+	if b.session.live {
+		snapshot.Session = &SessionSnapshot{Summary: b.session.summary, StartFollowers: b.session.startFollowers}
+	}
+	b.session.mu.Unlock()
+
+	b.firsts.mu.Lock()
+	snapshot.Stream = b.firsts.stream
+	snapshot.StreamChatters = b.firsts.seen.keys()
+	snapshot.Greeted = make([]string, 0, len(b.firsts.greeted))
+	for username := range b.firsts.greeted {
+		snapshot.Greeted = append(snapshot.Greeted, username)
+	}
+	b.firsts.mu.Unlock()
+
+	b.escalation.mu.Lock()
+	snapshot.Strikes = make(map[string]UserStrikes, len(b.escalation.strikes))
+	for username, strikes := range b.escalation.strikes {
+		snapshot.Strikes[username] = strikes
+	}
+	b.escalation.mu.Unlock()
+
+	if b.queue != nil {
+		b.queue.mu.Lock()
+		snapshot.Queue = append([]QueueEntry{}, b.queue.entries...)
+		b.queue.mu.Unlock()
+	}
+	if b.topChat != nil {
+		snapshot.Leaderboards = b.topChat.snapshot()
+	}
+	return snapshot
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"nhooyr.io/websocket"
+)
+
+const absintheControlTopic = "__absinthe__:control"
+
+// Where subscription data frames carry their subscription ID, see SocketProtocol
+const (
+	subscriptionIDAuto    = "auto"
+	subscriptionIDPayload = "payload"
+	subscriptionIDTopic   = "topic"
+)
+
+// SocketProtocol selects the websocket protocol details, so the bridge can follow
+// protocol changes on Glimesh (or talk to a fork) without a new release
+type SocketProtocol struct {
+	// Phoenix serializer version: "1.0.0", "2.0.0" or "auto" (2.0.0, switching to
+	// 1.0.0 if the server answers with v1 frames)
+	Serializer string
+	// Topic of the Absinthe control channel, where documents are sent
+	ControlTopic string
+	// Where subscription data frames carry their subscription ID: "payload" (subscriptionId field),
+	// "topic" (frame topic) or "auto" (payload, then topic)
+	SubscriptionID string
+}
+
+// validate checks the protocol options and fills in the defaults
+func (p *SocketProtocol) validate() error {
+	switch p.Serializer {
+	case "":
+		p.Serializer = "auto"
+	case "auto", phoenixSerializerV1, phoenixSerializerV2:
+	default:
+		return fmt.Errorf("unknown Phoenix serializer version %q", p.Serializer)
+	}
+	if p.ControlTopic == "" {
+		p.ControlTopic = absintheControlTopic
+	}
+	switch p.SubscriptionID {
+	case "":
+		p.SubscriptionID = subscriptionIDAuto
+	case subscriptionIDAuto, subscriptionIDPayload, subscriptionIDTopic:
+	default:
+		return fmt.Errorf("unknown subscription ID source %q", p.SubscriptionID)
+	}
+	return nil
+}
+
+// vsn returns the serializer version to ask for when connecting
+func (p SocketProtocol) vsn() string {
+	if p.Serializer == phoenixSerializerV1 {
+		return phoenixSerializerV1
+	}
+	return phoenixSerializerV2
+}
+
+// Number of outgoing frames waiting for the writer before senders block
+const socketWriteQueueSize = 32
+
+// subscriptionHandler receives the "data" field of a subscription result
+type subscriptionHandler func(data jsoniter.RawMessage)
+
+type replyPayload struct {
+	Status   string `json:"status"`
+	Response struct {
+		SubscriptionID string `json:"subscriptionId"`
+		// Result of queries and mutations
+		Data   jsoniter.RawMessage `json:"data"`
+		Errors []GQLError          `json:"errors"`
+	} `json:"response"`
+}
+
+type subscriptionDataPayload struct {
+	Result struct {
+		Data jsoniter.RawMessage `json:"data"`
+	} `json:"result"`
+	SubscriptionID string `json:"subscriptionId"`
+}
+
+// glimeshSocket wraps the Absinthe/Phoenix websocket connection to Glimesh,
+// keeping track of which subscription each incoming frame belongs to. The socket
+// outlives its connections: queued writes and subscriptions carry over to the next one.
+type glimeshSocket struct {
+	log      logrus.FieldLogger
+	ref      uint64
+	protocol SocketProtocol
+	// Set (atomically) when frames are sent in the v1 format
+	v1 uint32
+	// All writes go through a single writer goroutine per connection, so frames are never interleaved
+	writes chan socketWrite
+
+	// Called with the round-trip time of every acknowledged heartbeat, if set
+	onHeartbeatAck func(rtt time.Duration)
+	// When the frame being handled was received, only meant to be read by subscription handlers
+	frameReceivedAt time.Time
+
+	mu sync.Mutex
+	// Current connection (nil while disconnected) and how many connections were attached
+	conn       *websocket.Conn
+	generation uint64
+	// Subscriptions to start on every connection
+	subscriptions []socketSubscription
+	// Writes that failed because their connection dropped, written first on the next one
+	carried []socketWrite
+	// Last heartbeat sent, to measure the round-trip time when it's acknowledged
+	heartbeatRef  string
+	heartbeatSent time.Time
+	// Subscriptions waiting for their subscription ID, by message ref
+	pending map[string]subscriptionHandler
+	// Active subscriptions, by subscription ID
+	active map[string]subscriptionHandler
+	// Requests waiting for their reply, by message ref. Kept across connections,
+	// since queued requests can go out on the next one.
+	replies map[string]chan replyPayload
+}
+
+// socketWrite is a frame queued for writing, the write error is sent to result
+type socketWrite struct {
+	data []byte
+	// Connection the frame was made for (0 for frames that can go on any connection),
+	// frames made for a previous connection are dropped instead of written
+	generation uint64
+	result     chan error
+}
+
+// socketSubscription is a GraphQL subscription, sent again on every new connection
+type socketSubscription struct {
+	document  string
+	variables map[string]interface{}
+	handler   subscriptionHandler
+}
+
+// newGlimeshSocket creates a socket without a connection, frames are queued until one is attached
+func newGlimeshSocket(log logrus.FieldLogger, protocol SocketProtocol) *glimeshSocket {
+	socket := &glimeshSocket{
+		log:      log,
+		protocol: protocol,
+		writes:   make(chan socketWrite, socketWriteQueueSize),
+		pending:  make(map[string]subscriptionHandler),
+		active:   make(map[string]subscriptionHandler),
+		replies:  make(map[string]chan replyPayload),
+	}
+	if protocol.Serializer == phoenixSerializerV1 {
+		socket.v1 = 1
+	}
+	return socket
+}
+
+// attach starts using a new connection: it joins the control topic, starts all the subscriptions
+// again and then starts the writer for the queued frames, which stops when ctx is cancelled
+func (s *glimeshSocket) attach(ctx context.Context, conn *websocket.Conn) error {
+	frames, carried, generation, err := s.handshake(conn)
+	if err != nil {
+		return err
+	}
+	// Written before starting the writer, so queued frames only go out after the join. The lock
+	// isn't held, so a slow handshake doesn't hold up incoming frames and heartbeats.
+	for i, byt := range frames {
+		if err := conn.Write(ctx, websocket.MessageText, byt); err != nil {
+			if i == 0 {
+				return fmt.Errorf("%w: could not join: %s", ErrDisconnected, err)
+			}
+			return fmt.Errorf("%w: could not subscribe: %s", ErrDisconnected, err)
+		}
+	}
+	for i, write := range carried {
+		if err := conn.Write(ctx, websocket.MessageText, write.data); err != nil {
+			s.carry(carried[i:]...)
+			return fmt.Errorf("%w: could not resend: %s", ErrDisconnected, err)
+		}
+		write.result <- nil
+	}
+	go s.writeLoop(ctx, conn, generation)
+	return nil
+}
+
+// carry keeps writes that failed because the connection dropped for the next connection
+func (s *glimeshSocket) carry(writes ...socketWrite) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.carried = append(s.carried, writes...)
+}
+
+// handshake resets the state for a new connection and encodes the join and subscription frames,
+// also returning the writes carried over from the previous connection
+func (s *glimeshSocket) handshake(conn *websocket.Conn) ([][]byte, []socketWrite, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn = conn
+	s.generation++
+	s.pending = make(map[string]subscriptionHandler)
+	s.active = make(map[string]subscriptionHandler)
+	s.heartbeatRef = ""
+
+	frames := make([][]byte, 0, len(s.subscriptions)+1)
+	byt, err := s.encode(s.nextRef(), s.protocol.ControlTopic, "phx_join", map[string]interface{}{})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	frames = append(frames, byt)
+	for _, sub := range s.subscriptions {
+		ref := s.nextRef()
+		byt, err := s.encode(ref, s.protocol.ControlTopic, "doc", GQLQuery{Query: sub.document, Variables: sub.variables})
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		frames = append(frames, byt)
+		s.pending[ref] = sub.handler
+	}
+	carried := s.carried
+	s.carried = nil
+	return frames, carried, s.generation, nil
+}
+
+// detach stops using the current connection, frames queued from now on wait for the next one
+func (s *glimeshSocket) detach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn = nil
+}
+
+// connection returns the generation of the current connection, or 0 if disconnected
+func (s *glimeshSocket) connection() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return 0
+	}
+	return s.generation
+}
+
+func (s *glimeshSocket) writeLoop(ctx context.Context, conn *websocket.Conn, generation uint64) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case write := <-s.writes:
+			if write.generation != 0 && write.generation != generation {
+				write.result <- fmt.Errorf("%w: frame was made for a previous connection", ErrDisconnected)
+				continue
+			}
+			err := conn.Write(ctx, websocket.MessageText, write.data)
+			if err != nil && write.generation == 0 {
+				// The connection is gone: the frame goes out on the next one instead of failing,
+				// so a reconnect doesn't lose messages being sent
+				s.carry(write)
+				return
+			}
+			write.result <- err
+		}
+	}
+}
+
+// write queues a frame for the writer and waits until it has been written
+func (s *glimeshSocket) write(ctx context.Context, data []byte, generation uint64) error {
+	write := socketWrite{data: data, generation: generation, result: make(chan error, 1)}
+	select {
+	case s.writes <- write:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-write.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *glimeshSocket) nextRef() string {
+	return strconv.FormatUint(atomic.AddUint64(&s.ref, 1), 10)
+}
+
+// encode builds a frame in the serializer format in use
+func (s *glimeshSocket) encode(ref string, topic string, event string, payload interface{}) ([]byte, error) {
+	data, err := jsoniter.ConfigFastest.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	joinRef := "1"
+	frame := PhoenixFrame{JoinRef: &joinRef, Ref: &ref, Topic: topic, Event: event, Payload: data, V1: atomic.LoadUint32(&s.v1) == 1}
+	return jsoniter.ConfigFastest.Marshal(frame)
+}
+
+// send writes a message to the socket and returns the ref it was sent with. If the socket
+// is disconnected, the message is sent as soon as it reconnects.
+func (s *glimeshSocket) send(ctx context.Context, topic string, event string, payload interface{}) (string, error) {
+	ref := s.nextRef()
+	return ref, s.sendRef(ctx, ref, 0, topic, event, payload)
+}
+
+// sendRef writes a message with the given ref, only on the given connection if generation isn't 0
+func (s *glimeshSocket) sendRef(ctx context.Context, ref string, generation uint64, topic string, event string, payload interface{}) error {
+	byt, err := s.encode(ref, topic, event, payload)
+	if err != nil {
+		return err
+	}
+	err = s.write(ctx, byt, generation)
+	if err != nil && !errors.Is(err, ErrDisconnected) {
+		return fmt.Errorf("%w: %s", ErrDisconnected, err)
+	}
+	return err
+}
+
+// heartbeat keeps the current connection alive, it isn't queued while disconnected
+func (s *glimeshSocket) heartbeat(ctx context.Context) error {
+	generation := s.connection()
+	if generation == 0 {
+		return fmt.Errorf("%w: no connection to send a heartbeat on", ErrDisconnected)
+	}
+	ref := s.nextRef()
+	s.mu.Lock()
+	s.heartbeatRef = ref
+	s.heartbeatSent = time.Now()
+	s.mu.Unlock()
+	return s.sendRef(ctx, ref, generation, "phoenix", "heartbeat", map[string]interface{}{})
+}
+
+// doc sends a GraphQL document (query or mutation) over the socket
+func (s *glimeshSocket) doc(ctx context.Context, document string, variables map[string]interface{}) (string, error) {
+	return s.send(ctx, s.protocol.ControlTopic, "doc", GQLQuery{Query: document, Variables: variables})
+}
+
+// request sends a GraphQL document (query or mutation) over the socket and waits for its reply.
+// If the socket is disconnected, the document is sent when it reconnects: timeout only starts once it's sent.
+func (s *glimeshSocket) request(ctx context.Context, timeout time.Duration, document string, variables map[string]interface{}) (replyPayload, error) {
+	ref := s.nextRef()
+	reply := make(chan replyPayload, 1)
+	s.mu.Lock()
+	s.replies[ref] = reply
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.replies, ref)
+		s.mu.Unlock()
+	}()
+
+	err := s.sendRef(ctx, ref, 0, s.protocol.ControlTopic, "doc", GQLQuery{Query: document, Variables: variables})
+	if err != nil {
+		return replyPayload{}, err
+	}
+	select {
+	case result := <-reply:
+		return result, nil
+	case <-time.After(timeout):
+		return replyPayload{}, fmt.Errorf("no reply after %s", timeout)
+	case <-ctx.Done():
+		return replyPayload{}, ctx.Err()
+	}
+}
+
+// subscribe starts a GraphQL subscription, routing all its results to handler. The subscription
+// is started again on every new connection, if there is no connection it starts on the next one.
+func (s *glimeshSocket) subscribe(ctx context.Context, document string, variables map[string]interface{}, handler subscriptionHandler) error {
+	ref := s.nextRef()
+	// Register the handler before sending, so the reply can't be processed before it
+	s.mu.Lock()
+	s.subscriptions = append(s.subscriptions, socketSubscription{document: document, variables: variables, handler: handler})
+	generation := s.generation
+	connected := s.conn != nil
+	if connected {
+		s.pending[ref] = handler
+	}
+	s.mu.Unlock()
+	if !connected {
+		return nil
+	}
+	return s.sendRef(ctx, ref, generation, s.protocol.ControlTopic, "doc", GQLQuery{Query: document, Variables: variables})
+}
+
+// handleFrame decodes an incoming frame and dispatches it, returning an error for malformed frames.
+// The decoder and handlers are fuzzed (see FuzzPhoenixFrame and FuzzSubscriptionPayload); the recover
+// is only a backstop so a bug there can't take the bridge down, it returns ErrFramePanic.
+func (s *glimeshSocket) handleFrame(byt []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.log.WithField("panic", r).Error("Recovered from panic while handling frame")
+			err = fmt.Errorf("%w: %v", ErrFramePanic, r)
+		}
+	}()
+	s.frameReceivedAt = time.Now()
+	var frame PhoenixFrame
+	err = jsoniter.ConfigFastest.Unmarshal(byt, &frame)
+	if err != nil {
+		return err
+	}
+	if frame.V1 && s.protocol.Serializer == "auto" && atomic.CompareAndSwapUint32(&s.v1, 0, 1) {
+		s.log.Warn("Server sent a Phoenix v1 frame, switching to the v1 serializer")
+	}
+
+	switch frame.Event {
+	case "phx_reply":
+		if frame.Ref == nil {
+			return nil
+		}
+		var reply replyPayload
+		err = jsoniter.ConfigFastest.Unmarshal(frame.Payload, &reply)
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if *frame.Ref == s.heartbeatRef {
+			if s.onHeartbeatAck != nil {
+				s.onHeartbeatAck(time.Since(s.heartbeatSent))
+			}
+			s.heartbeatRef = ""
+			return nil
+		}
+		if waiter, ok := s.replies[*frame.Ref]; ok {
+			select {
+			case waiter <- reply:
+			default:
+			}
+			return nil
+		}
+		handler, ok := s.pending[*frame.Ref]
+		if !ok {
+			if reply.Status != "ok" {
+				s.log.WithFields(logrus.Fields{"topic": frame.Topic, "status": reply.Status, "payload": string(frame.Payload)}).Warn("Request was rejected")
+			}
+			return nil
+		}
+		delete(s.pending, *frame.Ref)
+		if reply.Status != "ok" || reply.Response.SubscriptionID == "" {
+			s.log.WithFields(logrus.Fields{"status": reply.Status, "payload": string(frame.Payload)}).Error("Subscription was rejected")
+			return nil
+		}
+		s.active[reply.Response.SubscriptionID] = handler
+		s.log.WithField("subscription-id", reply.Response.SubscriptionID).Debug("Subscription started")
+	case "subscription:data":
+		var data subscriptionDataPayload
+		err = jsoniter.ConfigFastest.Unmarshal(frame.Payload, &data)
+		if err != nil {
+			return err
+		}
+
+		id := data.SubscriptionID
+		switch {
+		case s.protocol.SubscriptionID == subscriptionIDTopic:
+			id = frame.Topic
+		case s.protocol.SubscriptionID == subscriptionIDAuto && id == "":
+			id = frame.Topic
+		}
+		s.mu.Lock()
+		handler, ok := s.active[id]
+		s.mu.Unlock()
+		if !ok {
+			s.log.WithField("subscription-id", id).Warn("Received data for unknown subscription")
+			return nil
+		}
+		handler(data.Result.Data)
+	case "phx_error", "phx_close":
+		s.log.WithFields(logrus.Fields{"topic": frame.Topic, "event": frame.Event}).Error("Channel was closed by remote")
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"nhooyr.io/websocket"
+)
+
+const testSubscriptionID = "__absinthe__:doc:1"
+
+// newTestSocket returns a socket without a connection, for feeding frames to handleFrame
+func newTestSocket() *glimeshSocket {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	protocol := SocketProtocol{}
+	_ = protocol.validate()
+	return newGlimeshSocket(log, protocol)
+}
+
+// chatSubscriptionHandler decodes subscription data the same way the chat subscription does
+func chatSubscriptionHandler() subscriptionHandler {
+	return func(data jsoniter.RawMessage) {
+		var result ChatMessagesResponse
+		if err := jsoniter.ConfigFastest.Unmarshal(data, &result); err != nil {
+			return
+		}
+		if result.ChatMessage != nil {
+			_ = chatMessageExtraFields(data)
+			_, _ = jsoniter.ConfigFastest.Marshal(result.ChatMessage)
+		}
+	}
+}
+
+func TestHandleFrameSubscriptionData(t *testing.T) {
+	socket := newTestSocket()
+	var got []string
+	socket.active[testSubscriptionID] = func(data jsoniter.RawMessage) {
+		got = append(got, string(data))
+	}
+	frames := []string{
+		`[null,null,"__absinthe__:doc:1","subscription:data",{"result":{"data":{"a":1}},"subscriptionId":"__absinthe__:doc:1"}]`,
+		// Subscription ID only in the topic
+		`[null,null,"__absinthe__:doc:1","subscription:data",{"result":{"data":{"a":2}}}]`,
+		// Unknown subscription
+		`[null,null,"__absinthe__:doc:2","subscription:data",{"result":{"data":{"a":3}}}]`,
+	}
+	for _, frame := range frames {
+		if err := socket.handleFrame([]byte(frame)); err != nil {
+			t.Fatalf("could not handle %s: %s", frame, err)
+		}
+	}
+	if len(got) != 2 || got[0] != `{"a":1}` || got[1] != `{"a":2}` {
+		t.Errorf("handler got %v", got)
+	}
+}
+
+func TestHandleFrameSubscriptionReply(t *testing.T) {
+	socket := newTestSocket()
+	called := false
+	socket.pending["4"] = func(jsoniter.RawMessage) { called = true }
+	reply := `[null,"4","__absinthe__:control","phx_reply",{"status":"ok","response":{"subscriptionId":"__absinthe__:doc:9"}}]`
+	if err := socket.handleFrame([]byte(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if len(socket.pending) != 0 || socket.active["__absinthe__:doc:9"] == nil {
+		t.Fatalf("subscription was not activated: pending %v, active %v", socket.pending, socket.active)
+	}
+	data := `[null,null,"__absinthe__:doc:9","subscription:data",{"result":{"data":{}},"subscriptionId":"__absinthe__:doc:9"}]`
+	if err := socket.handleFrame([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Error("handler was not called")
+	}
+}
+
+func TestHandleFrameRecoversHandlerPanic(t *testing.T) {
+	socket := newTestSocket()
+	socket.active[testSubscriptionID] = func(jsoniter.RawMessage) { panic("boom") }
+	frame := `[null,null,"__absinthe__:doc:1","subscription:data",{"result":{"data":{}}}]`
+	if err := socket.handleFrame([]byte(frame)); !errors.Is(err, ErrFramePanic) {
+		t.Errorf("expected a frame panic error, got %v", err)
+	}
+}
+
+// FuzzSubscriptionPayload feeds arbitrary payloads to the chat subscription handler
+// through handleFrame, which must reject or handle them without panicking
+func FuzzSubscriptionPayload(f *testing.F) {
+	for _, seed := range []string{
+		`{"result":{"data":{"chatMessage":{"id":"1","message":"hi","user":{"id":"2","username":"someone"}}}},"subscriptionId":"__absinthe__:doc:1"}`,
+		`{"result":{"data":{"chatMessage":{"id":"1","message":"hi :wave:","tokens":[{"type":"text","text":"hi "},{"type":"emote","text":":wave:","src":"https://example.com/wave.svg"}],"user":{"id":"2","username":"someone"}}}}}`,
+		`{"result":{"data":{"chatMessage":null}}}`,
+		`{"result":{"data":null}}`,
+		`{"result":null}`,
+		`{}`,
+		`[]`,
+		`null`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		socket := newTestSocket()
+		socket.active[testSubscriptionID] = chatSubscriptionHandler()
+		frame := append([]byte(`[null,null,"__absinthe__:doc:1","subscription:data",`), payload...)
+		frame = append(frame, ']')
+		if err := socket.handleFrame(frame); errors.Is(err, ErrFramePanic) {
+			t.Fatalf("handling payload %q panicked: %s", payload, err)
+		}
+	})
+}
+
+// testSocketServer accepts websocket connections and sends the frames it reads to frames
+func testSocketServer(t *testing.T) (string, chan PhoenixFrame) {
+	frames := make(chan PhoenixFrame, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close(websocket.StatusNormalClosure, "")
+		for {
+			_, byt, err := conn.Read(r.Context())
+			if err != nil {
+				return
+			}
+			var frame PhoenixFrame
+			if err := jsoniter.ConfigFastest.Unmarshal(byt, &frame); err == nil {
+				frames <- frame
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http"), frames
+}
+
+func nextFrame(t *testing.T, frames chan PhoenixFrame) PhoenixFrame {
+	t.Helper()
+	select {
+	case frame := <-frames:
+		return frame
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a frame")
+	}
+	return PhoenixFrame{}
+}
+
+func TestSocketKeepsQueueAndSubscriptionsAcrossConnections(t *testing.T) {
+	url, frames := testSocketServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	socket := newTestSocket()
+
+	// Subscribed and sent while disconnected: both wait for a connection
+	if err := socket.subscribe(ctx, "subscription { chatMessage }", nil, func(jsoniter.RawMessage) {}); err != nil {
+		t.Fatal(err)
+	}
+	sent := make(chan error, 1)
+	go func() {
+		_, err := socket.doc(ctx, "mutation { send }", nil)
+		sent <- err
+	}()
+	if err := socket.heartbeat(ctx); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("expected heartbeat to fail while disconnected, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		conn, _, err := websocket.Dial(ctx, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		connCtx, connCancel := context.WithCancel(ctx)
+		if err := socket.attach(connCtx, conn); err != nil {
+			t.Fatal(err)
+		}
+		if frame := nextFrame(t, frames); frame.Event != "phx_join" {
+			t.Fatalf("connection %d: expected a join first, got %s", i, frame.Event)
+		}
+		var doc GQLQuery
+		if frame := nextFrame(t, frames); frame.Event != "doc" || jsoniter.ConfigFastest.Unmarshal(frame.Payload, &doc) != nil || doc.Query != "subscription { chatMessage }" {
+			t.Fatalf("connection %d: expected the subscription, got %s %s", i, frame.Event, frame.Payload)
+		}
+		if i == 0 {
+			if frame := nextFrame(t, frames); jsoniter.ConfigFastest.Unmarshal(frame.Payload, &doc) != nil || doc.Query != "mutation { send }" {
+				t.Fatalf("expected the queued message, got %s", frame.Payload)
+			}
+			if err := <-sent; err != nil {
+				t.Errorf("queued message failed: %s", err)
+			}
+		}
+		connCancel()
+		socket.detach()
+		_ = conn.Close(websocket.StatusNormalClosure, "")
+	}
+}
+
+func TestSocketRequestWaitsForReply(t *testing.T) {
+	url, frames := testSocketServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	socket := newTestSocket()
+	conn, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := socket.attach(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	nextFrame(t, frames) // phx_join
+
+	type result struct {
+		reply replyPayload
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		reply, err := socket.request(ctx, 5*time.Second, "mutation { send }", nil)
+		results <- result{reply, err}
+	}()
+	frame := nextFrame(t, frames)
+	reply := `["1","` + *frame.Ref + `","__absinthe__:control","phx_reply",{"status":"ok","response":{"data":{"createChatMessage":null},"errors":[{"message":"slow mode"}]}}]`
+	if err := socket.handleFrame([]byte(reply)); err != nil {
+		t.Fatal(err)
+	}
+	got := <-results
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+	if len(got.reply.Response.Errors) != 1 || got.reply.Response.Errors[0].Message != "slow mode" {
+		t.Errorf("unexpected reply %+v", got.reply)
+	}
+
+	if _, err := socket.request(ctx, 10*time.Millisecond, "mutation { send }", nil); err == nil {
+		t.Error("expected a request without reply to time out")
+	}
+}
+
+func TestSocketResendsWritesFailedByDisconnection(t *testing.T) {
+	url, frames := testSocketServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	socket := newTestSocket()
+
+	first, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstCtx, firstCancel := context.WithCancel(ctx)
+	defer firstCancel()
+	if err := socket.attach(firstCtx, first); err != nil {
+		t.Fatal(err)
+	}
+	nextFrame(t, frames) // phx_join
+	// The connection drops before the writer gets to the frame
+	_ = first.Close(websocket.StatusGoingAway, "")
+
+	sent := make(chan error, 1)
+	go func() {
+		_, err := socket.doc(ctx, "mutation { send }", nil)
+		sent <- err
+	}()
+	select {
+	case err := <-sent:
+		t.Fatalf("send finished on a dropped connection with %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	firstCancel()
+	socket.detach()
+
+	second, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := socket.attach(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	nextFrame(t, frames) // phx_join
+	var doc GQLQuery
+	if frame := nextFrame(t, frames); jsoniter.ConfigFastest.Unmarshal(frame.Payload, &doc) != nil || doc.Query != "mutation { send }" {
+		t.Fatalf("expected the message on the new connection, got %s", frame.Payload)
+	}
+	if err := <-sent; err != nil {
+		t.Errorf("send failed: %s", err)
+	}
+}
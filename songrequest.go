@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Window over which the per-user song request limit applies
+const songRequestLimitWindow = time.Hour
+
+var (
+	errInvalidSongURL  = errors.New("not a valid URL")
+	errSongSiteBlocked = errors.New("site not allowed")
+)
+
+// SongRequest is emitted for every accepted !sr request
+type SongRequest struct {
+	Username    string    `json:"username"`
+	URL         string    `json:"url"`
+	Host        string    `json:"host"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// SongRequestRejection is emitted when a request is refused, so widgets can tell the user why
+type SongRequestRejection struct {
+	Username string `json:"username"`
+	Input    string `json:"input"`
+	Reason   string `json:"reason"`
+}
+
+type songRequests struct {
+	bridge  *Bridge
+	allowed []string
+	limit   int
+
+	mu     sync.Mutex
+	recent map[string][]time.Time
+}
+
+func (b *Bridge) newSongRequests(hosts string, limit int) *songRequests {
+	sr := &songRequests{bridge: b, limit: limit, recent: make(map[string][]time.Time)}
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" {
+			sr.allowed = append(sr.allowed, host)
+		}
+	}
+	return sr
+}
+
+// validate parses a requested URL and checks its host (or any parent domain) is allowed
+func (s *songRequests) validate(input string) (*url.URL, error) {
+	parsed, err := url.Parse(input)
+	if err != nil || parsed.Host == "" {
+		return nil, errInvalidSongURL
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, errInvalidSongURL
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, allowed := range s.allowed {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return parsed, nil
+		}
+	}
+	return nil, errSongSiteBlocked
+}
+
+// allow checks and records a request against the per-user limit
+func (s *songRequests) allow(username string, now time.Time) bool {
+	if s.limit <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := strings.ToLower(username)
+	var kept []time.Time
+	for _, t := range s.recent[user] {
+		if now.Sub(t) < songRequestLimitWindow {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) >= s.limit {
+		s.recent[user] = kept
+		return false
+	}
+	s.recent[user] = append(kept, now)
+	return true
+}
+
+func (s *songRequests) handle(msg ChatMessage, args string) {
+	reject := func(reason string, messageID string) {
+		s.bridge.say(messageID, msg.User.Username, nil)
+		s.bridge.setJSON(s.bridge.key("ev/song-request-rejected"), SongRequestRejection{
+			Username: msg.User.Username,
+			Input:    args,
+			Reason:   reason,
+		})
+	}
+
+	parsed, err := s.validate(strings.TrimSpace(args))
+	if err == errSongSiteBlocked {
+		reject(err.Error(), "songrequest.blocked")
+		return
+	} else if err != nil {
+		reject(err.Error(), "songrequest.invalid")
+		return
+	}
+	now := time.Now()
+	if !s.allow(msg.User.Username, now) {
+		reject("request limit reached", "songrequest.limit")
+		return
+	}
+
+	s.bridge.log.WithField("user", msg.User.Username).WithField("url", parsed.String()).Info("Song requested")
+	s.bridge.setJSON(s.bridge.key("ev/song-request"), SongRequest{
+		Username:    msg.User.Username,
+		URL:         parsed.String(),
+		Host:        strings.ToLower(parsed.Hostname()),
+		RequestedAt: now,
+	})
+	s.bridge.say("songrequest.accepted", msg.User.Username, nil)
+}
+
+// setupSongRequests registers the !sr/!songrequest chat commands
+func (b *Bridge) setupSongRequests(hosts string, limit int) {
+	sr := b.newSongRequests(hosts, limit)
+	b.commands.register(sr.handle, "sr", "songrequest")
+}
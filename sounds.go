@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Sounds still playing after this long are stopped
+const soundMaxDuration = time.Minute
+
+// SoundAlert plays a local audio file when it matches an event or chat message,
+// only one of Event, Keyword and Mention should be set
+type SoundAlert struct {
+	// Event plays the sound on an event (eg. "alert" or "first-message")
+	Event string `json:"event,omitempty"`
+	// Keyword plays the sound on chat messages containing it (case insensitive)
+	Keyword string `json:"keyword,omitempty"`
+	// Mention plays the sound on chat messages mentioning the streamer
+	Mention bool   `json:"mention,omitempty"`
+	File    string `json:"file"`
+	// Volume from 0 to 100 (defaults to 100)
+	Volume *int `json:"volume,omitempty"`
+	// Minimum time between two plays of this sound
+	CooldownSeconds int `json:"cooldown_seconds,omitempty"`
+}
+
+// SoundsConfig is the format of the sounds file
+type SoundsConfig struct {
+	Sounds []SoundAlert `json:"sounds"`
+}
+
+func loadSounds(path string) (*SoundsConfig, error) {
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sounds SoundsConfig
+	if err := jsoniter.ConfigFastest.Unmarshal(byt, &sounds); err != nil {
+		return nil, err
+	}
+	for i, sound := range sounds.Sounds {
+		if sound.File == "" {
+			return nil, fmt.Errorf("sound %d has no file", i)
+		}
+		if sound.Volume != nil && (*sound.Volume < 0 || *sound.Volume > 100) {
+			return nil, fmt.Errorf("sound %d has an invalid volume (must be 0-100)", i)
+		}
+	}
+	return &sounds, nil
+}
+
+// defaultSoundPlayer returns the command used to play sounds on this OS, see -sound-player
+func defaultSoundPlayer() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "paplay --volume={volume_pa} {file}"
+	case "darwin":
+		return "afplay -v {volume_fraction} {file}"
+	default:
+		return "ffplay -nodisp -autoexit -loglevel quiet -volume {volume} {file}"
+	}
+}
+
+// soundPlayer plays the configured sounds with an external player command
+type soundPlayer struct {
+	bridge  *Bridge
+	command []string
+
+	mu     sync.Mutex
+	sounds []SoundAlert
+	// Last time each sound was played, by index in sounds
+	played map[int]time.Time
+}
+
+func (b *Bridge) newSoundPlayer(command string, sounds *SoundsConfig) *soundPlayer {
+	player := &soundPlayer{bridge: b, command: strings.Fields(command)}
+	player.replace(sounds)
+	return player
+}
+
+// replace swaps the configured sounds, resetting their cooldowns
+func (s *soundPlayer) replace(sounds *SoundsConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sounds = sounds.Sounds
+	s.played = make(map[int]time.Time)
+}
+
+// event plays the sounds matching an event and, for chat messages, their text
+func (s *soundPlayer) event(name string, payload []byte) {
+	var text, mention string
+	if name == "chat-message" {
+		var msg ChatMessage
+		if jsoniter.ConfigFastest.Unmarshal(payload, &msg) == nil {
+			text = strings.ToLower(msg.Message)
+		}
+		if info, ok := s.bridge.channelInfo(); ok {
+			mention = "@" + strings.ToLower(info.Streamer.Username)
+		}
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	var matched []SoundAlert
+	for i, sound := range s.sounds {
+		switch {
+		case sound.Event != "":
+			if sound.Event != name {
+				continue
+			}
+		case sound.Keyword != "":
+			if text == "" || !strings.Contains(text, strings.ToLower(sound.Keyword)) {
+				continue
+			}
+		case sound.Mention:
+			if text == "" || mention == "@" || !strings.Contains(text, mention) {
+				continue
+			}
+		default:
+			continue
+		}
+		if last, ok := s.played[i]; ok && now.Sub(last) < time.Duration(sound.CooldownSeconds)*time.Second {
+			continue
+		}
+		s.played[i] = now
+		matched = append(matched, sound)
+	}
+	s.mu.Unlock()
+
+	for _, sound := range matched {
+		go s.play(sound)
+	}
+}
+
+// play runs the player command for a sound
+func (s *soundPlayer) play(sound SoundAlert) {
+	if len(s.command) == 0 {
+		return
+	}
+	volume := 100
+	if sound.Volume != nil {
+		volume = *sound.Volume
+	}
+	replacer := strings.NewReplacer(
+		"{file}", sound.File,
+		"{volume}", strconv.Itoa(volume),
+		"{volume_fraction}", strconv.FormatFloat(float64(volume)/100, 'f', 2, 64),
+		"{volume_pa}", strconv.Itoa(volume*65536/100),
+	)
+	args := make([]string, len(s.command))
+	for i, arg := range s.command {
+		args[i] = replacer.Replace(arg)
+	}
+
+	ctx, cancel := context.WithTimeout(s.bridge.ctx, soundMaxDuration)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		s.bridge.log.WithError(err).WithField("file", sound.File).WithField("output", string(output)).Warn("Could not play sound")
+	}
+}
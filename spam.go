@@ -0,0 +1,161 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Actions taken on chat messages flagged by the spam heuristics
+const (
+	SpamActionTag    = "tag"
+	SpamActionFilter = "filter"
+	SpamActionDelete = "delete"
+)
+
+// Glimesh emotes are written as :name:
+var emotePattern = regexp.MustCompile(`:[A-Za-z0-9_]+:`)
+
+// SpamHeuristics configures the checks that flag spammy chat messages
+type SpamHeuristics struct {
+	// Flag messages with at least this percentage of uppercase letters (0 to disable)
+	CapsPercent int `json:"caps_percent"`
+	// Messages with fewer letters than this are never flagged for caps
+	CapsMinLetters int `json:"caps_min_letters"`
+	// Flag messages made only of emotes/emoji, with at least this many of them (0 to disable)
+	EmoteOnlyMin int `json:"emote_only_min"`
+	// Flag messages repeating the same character this many times in a row (0 to disable)
+	RepeatedChars int `json:"repeated_chars"`
+	// What to do with flagged messages: "tag" (only publish them as flagged), "filter" (also leave
+	// them out of the history and overlays) or "delete" (also delete them from chat)
+	Action string `json:"action"`
+	// Messages from users with this role or higher are never checked
+	ExemptRole string `json:"exempt_role"`
+}
+
+// validate returns the name of the first invalid setting, if any
+func (s SpamHeuristics) validate() (string, bool) {
+	switch {
+	case s.CapsPercent < 0 || s.CapsPercent > 100:
+		return "caps_percent", false
+	case s.CapsMinLetters < 0:
+		return "caps_min_letters", false
+	case s.EmoteOnlyMin < 0:
+		return "emote_only_min", false
+	case s.RepeatedChars < 0:
+		return "repeated_chars", false
+	case s.Action != "" && s.Action != SpamActionTag && s.Action != SpamActionFilter && s.Action != SpamActionDelete:
+		return "action", false
+	}
+	if _, ok := roleRank[s.ExemptRole]; s.ExemptRole != "" && !ok {
+		return "exempt_role", false
+	}
+	return "", true
+}
+
+// spamFilter checks chat messages against the spam heuristics
+type spamFilter struct {
+	mu       sync.RWMutex
+	settings SpamHeuristics
+}
+
+func (s *spamFilter) configure(config Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = config.Spam
+}
+
+func (s *spamFilter) current() SpamHeuristics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings
+}
+
+// check returns the flags for a message from a user with the given role
+func (s *spamFilter) check(text string, role string) []string {
+	settings := s.current()
+	if settings.ExemptRole != "" && roleAtLeast(role, settings.ExemptRole) {
+		return nil
+	}
+	var flags []string
+	if settings.CapsPercent > 0 && capsPercent(text, settings.CapsMinLetters) >= settings.CapsPercent {
+		flags = append(flags, "caps")
+	}
+	if settings.EmoteOnlyMin > 0 && emoteOnlyCount(text) >= settings.EmoteOnlyMin {
+		flags = append(flags, "emote-only")
+	}
+	if settings.RepeatedChars > 1 && longestRun(text) >= settings.RepeatedChars {
+		flags = append(flags, "repeated-chars")
+	}
+	return flags
+}
+
+// capsPercent returns the percentage of uppercase letters in text, or -1 if it has less than minLetters letters
+func capsPercent(text string, minLetters int) int {
+	letters, upper := 0, 0
+	for _, r := range emotePattern.ReplaceAllString(text, "") {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	if letters == 0 || letters < minLetters {
+		return -1
+	}
+	return upper * 100 / letters
+}
+
+// emoteOnlyCount returns how many emotes/emoji a message made only of them has (0 if it has anything else)
+func emoteOnlyCount(text string) int {
+	count := len(emotePattern.FindAllString(text, -1))
+	for _, r := range emotePattern.ReplaceAllString(text, "") {
+		switch {
+		case unicode.IsSpace(r), r == '\u200d', r == '\ufe0f', unicode.Is(unicode.Sk, r):
+			// Joiners, variation selectors and skin tone modifiers are part of emoji
+		case unicode.Is(unicode.So, r):
+			count++
+		default:
+			return 0
+		}
+	}
+	return count
+}
+
+// longestRun returns the length of the longest sequence of the same (non-space) character
+func longestRun(text string) int {
+	longest, run := 0, 0
+	var last rune
+	for _, r := range strings.ToLower(text) {
+		if r == last && !unicode.IsSpace(r) {
+			run++
+		} else {
+			run = 1
+		}
+		last = r
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
+
+// deleteChatMessage removes a message from chat, recording it in the audit log with the reason
+func (b *Bridge) deleteChatMessage(msg ChatMessage, reason string) {
+	err := b.api.DeleteChatMessage(b.ctx, b.channelIDString(), msg.ID)
+	if err != nil {
+		b.log.WithError(err).WithField("user", msg.User.Username).Error("Could not delete chat message")
+	}
+	b.audit.record(ModerationAuditEntry{
+		Action:    EscalationDelete,
+		By:        AuditByBridge,
+		User:      msg.User,
+		MessageID: msg.ID,
+		Message:   msg.Message,
+		Reason:    reason,
+		Error:     errorString(err),
+	})
+}
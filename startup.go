@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Delay before retrying a failed startup connection, doubled after every attempt
+	startupRetryDelay    = time.Second
+	startupMaxRetryDelay = 30 * time.Second
+)
+
+// retryStartup runs connect, and if wait is set keeps retrying it with backoff until it succeeds,
+// ctx is cancelled or it fails with an error permanent returns true for (eg. bad credentials)
+func retryStartup(ctx context.Context, log logrus.FieldLogger, wait bool, what string, permanent func(error) bool, connect func() error) error {
+	delay := startupRetryDelay
+	for {
+		err := connect()
+		if err == nil || !wait || (permanent != nil && permanent(err)) {
+			return err
+		}
+		log.WithError(err).WithFields(logrus.Fields{"dependency": what, "retry-in": delay}).Warn("Could not connect, retrying")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > startupMaxRetryDelay {
+			delay = startupMaxRetryDelay
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// EventLine is the JSON line written for each event in stdout output mode
+type EventLine struct {
+	Event string              `json:"event"`
+	Data  jsoniter.RawMessage `json:"data"`
+}
+
+// writeEventLines writes every bridge event to w as a JSON line
+func (b *Bridge) writeEventLines(ctx context.Context, w io.Writer) {
+	events := b.events.subscribe()
+	defer b.events.unsubscribe(events)
+	out := bufio.NewWriter(w)
+	enc := jsoniter.ConfigFastest.NewEncoder(out)
+	for {
+		event, ok := events.next(ctx)
+		if !ok {
+			return
+		}
+		err := enc.Encode(EventLine{Event: event.Name, Data: event.Payload})
+		if err == nil {
+			err = out.Flush()
+		}
+		if err != nil {
+			b.log.WithError(err).Error("Could not write event to stdout")
+			return
+		}
+	}
+}
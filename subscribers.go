@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// fetchSubscribers pages through all the active subscriptions to a streamer
+func (g *GlimeshClient) fetchSubscribers(ctx context.Context, streamerID string) ([]Subscriber, error) {
+	subscribers := make([]Subscriber, 0)
+	var after *string
+	for {
+		result, err := g.Subscribers(ctx, streamerID, after)
+		if err != nil {
+			return subscribers, err
+		}
+		if result.Subscriptions == nil {
+			return subscribers, nil
+		}
+		for _, edge := range result.Subscriptions.Edges {
+			if edge.Node != nil {
+				subscribers = append(subscribers, *edge.Node)
+			}
+		}
+		if !result.Subscriptions.PageInfo.HasNextPage {
+			return subscribers, nil
+		}
+		cursor := result.Subscriptions.PageInfo.EndCursor
+		after = &cursor
+	}
+}
+
+// diffSubscribers returns the subscribers in a whose user is not in b
+func diffSubscribers(a, b []Subscriber) []Subscriber {
+	known := make(map[string]bool)
+	for _, sub := range b {
+		known[sub.User.ID] = true
+	}
+	out := make([]Subscriber, 0)
+	for _, sub := range a {
+		if !known[sub.User.ID] {
+			out = append(out, sub)
+		}
+	}
+	return out
+}
+
+// syncSubscribers periodically publishes the active subscribers of the channel,
+// emitting events for new and expired subscriptions
+func (b *Bridge) syncSubscribers(ctx context.Context, interval time.Duration) {
+	listKey := b.key("subscribers")
+	newEventKey := b.key("ev/new-subscriber")
+	expiredEventKey := b.key("ev/expired-subscriber")
+
+	var subscribers []Subscriber
+	hasPrevious := b.kv.GetJSON(listKey, &subscribers) == nil
+
+	streamerID := ""
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if streamerID == "" {
+			info, err := b.fetchChannelInfo(ctx)
+			if err != nil {
+				b.log.WithError(err).Error("Could not fetch channel info for subscriber sync")
+			} else {
+				streamerID = info.Streamer.ID
+			}
+		}
+
+		if streamerID != "" {
+			current, err := b.api.fetchSubscribers(ctx, streamerID)
+			if err != nil {
+				b.log.WithError(err).Error("Could not fetch subscribers")
+			} else {
+				// Don't emit a flood of events on the very first sync
+				if hasPrevious {
+					for _, sub := range diffSubscribers(current, subscribers) {
+						b.log.WithField("user", sub.User.Username).Info("New subscriber")
+						b.setJSON(newEventKey, sub)
+						b.publishAlert(Alert{Type: "subscription", Source: "glimesh", Username: sub.User.Username})
+					}
+					for _, sub := range diffSubscribers(subscribers, current) {
+						b.log.WithField("user", sub.User.Username).Info("Subscription expired")
+						b.setJSON(expiredEventKey, sub)
+					}
+				}
+				subscribers = current
+				hasPrevious = true
+				b.setJSON(listKey, subscribers)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateData is the live bridge state available to outgoing message templates
+type TemplateData struct {
+	// User that triggered the message, if any
+	User        string
+	Channel     string
+	Title       string
+	Category    string
+	Subcategory string
+	// Names of the channel tags, comma-separated
+	Tags    string
+	Live    bool
+	Viewers int
+	// Uptime of the current stream (eg. "1h23m"), empty if offline
+	Uptime string
+	// Message-specific values, for bridge messages
+	Vars map[string]interface{}
+}
+
+func formatUptime(d time.Duration) string {
+	d = d.Truncate(time.Minute)
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	if hours > 0 {
+		return fmt.Sprintf("%dh%02dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+func (b *Bridge) templateData(user string) TemplateData {
+	data := TemplateData{User: user}
+	if info, ok := b.channelInfo(); ok {
+		data.Channel = info.Streamer.Displayname
+		data.Title = info.Title
+		if info.Category != nil {
+			data.Category = info.Category.Name
+		}
+		if info.Subcategory != nil {
+			data.Subcategory = info.Subcategory.Name
+		}
+		tags := make([]string, len(info.Tags))
+		for i, tag := range info.Tags {
+			tags[i] = tag.Name
+		}
+		data.Tags = strings.Join(tags, ", ")
+		if info.Stream != nil {
+			data.Viewers = info.Stream.CountViewers
+		}
+	}
+	if startedAt, live := b.session.liveSince(); live {
+		data.Live = true
+		data.Uptime = formatUptime(time.Since(startedAt))
+	}
+	return data
+}
+
+// renderTemplate resolves the Go template placeholders in an outgoing message. The "key" function
+// reads the value of a bridge key, by name relative to the prefix (eg. {{key "leaderboard/daily"}}):
+// templates can come from anyone allowed to send messages, so they can't read keys of other apps.
+func (b *Bridge) renderTemplate(text string, data TemplateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tpl, err := template.New("message").Funcs(template.FuncMap{
+		"key": func(name string) (string, error) {
+			if !validKeyName(name) {
+				return "", fmt.Errorf("invalid key name %q", name)
+			}
+			return b.kv.GetKey(b.key(name))
+		},
+	}).Parse(text)
+	if err != nil {
+		return text, err
+	}
+	var out strings.Builder
+	err = tpl.Execute(&out, data)
+	if err != nil {
+		return text, err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type StreamThumbnail struct {
+	URL       string    `json:"url"`
+	Path      string    `json:"path,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// thumbnailFetcher publishes the live thumbnail of the channel and, if enabled, keeps
+// a local copy of it that can be saved to a file and/or served over HTTP
+type thumbnailFetcher struct {
+	bridge   *Bridge
+	download bool
+	path     string
+	client   *http.Client
+
+	mu          sync.RWMutex
+	lastURL     string
+	data        []byte
+	contentType string
+}
+
+func (b *Bridge) newThumbnailFetcher(download bool, path string) *thumbnailFetcher {
+	return &thumbnailFetcher{
+		bridge:   b,
+		download: download || path != "",
+		path:     path,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (t *thumbnailFetcher) update(ctx context.Context, info *ChannelInfo) {
+	if info.Stream == nil || info.Stream.ThumbnailURL == "" {
+		return
+	}
+	url := info.Stream.ThumbnailURL
+
+	t.mu.RLock()
+	unchanged := url == t.lastURL
+	t.mu.RUnlock()
+	if unchanged && !t.download {
+		return
+	}
+
+	thumbnail := StreamThumbnail{URL: url, UpdatedAt: time.Now()}
+	if t.download {
+		err := t.fetch(ctx, url)
+		if err != nil {
+			t.bridge.log.WithError(err).Warn("Could not download stream thumbnail")
+			return
+		}
+		thumbnail.Path = t.path
+	}
+
+	t.mu.Lock()
+	t.lastURL = url
+	t.mu.Unlock()
+	t.bridge.setJSON(t.bridge.key("stream-thumbnail"), thumbnail)
+}
+
+func (t *thumbnailFetcher) fetch(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if t.path != "" {
+		// Write to a temporary file first so readers never see a partially written image
+		err = os.WriteFile(t.path+".tmp", data, 0644)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(t.path+".tmp", t.path)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.mu.Lock()
+	t.data = data
+	t.contentType = res.Header.Get("Content-Type")
+	t.mu.Unlock()
+	return nil
+}
+
+// ServeHTTP serves the last downloaded thumbnail
+func (t *thumbnailFetcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mu.RLock()
+	data := t.data
+	contentType := t.contentType
+	t.mu.RUnlock()
+
+	if data == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(data)
+}
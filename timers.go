@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Name of the timer used when none is given
+const defaultTimerName = "default"
+
+// Timer modes
+const (
+	TimerCountdown = "countdown"
+	TimerStopwatch = "stopwatch"
+)
+
+// TimerRequest is the JSON form of a @start-timer RPC call, plain text values are
+// parsed as "<duration> [name]" like the !timer chat command
+type TimerRequest struct {
+	Name string `json:"name"`
+	// Countdown length, 0 to count up from zero (stopwatch)
+	DurationSeconds int `json:"duration_seconds"`
+	// Free text for overlays (eg. "Starting soon", "Be right back")
+	Label string `json:"label"`
+}
+
+// TimerState is written to timers/<name> every second while the timer runs
+type TimerState struct {
+	Name  string `json:"name"`
+	Label string `json:"label,omitempty"`
+	Mode  string `json:"mode"`
+	// Running is false once the timer is stopped or the countdown is over
+	Running          bool       `json:"running"`
+	Paused           bool       `json:"paused"`
+	Finished         bool       `json:"finished"`
+	DurationSeconds  int        `json:"duration_seconds,omitempty"`
+	ElapsedSeconds   int        `json:"elapsed_seconds"`
+	RemainingSeconds int        `json:"remaining_seconds"`
+	EndsAt           *time.Time `json:"ends_at,omitempty"`
+	// Formatted remaining time (elapsed for stopwatches), eg. "04:59" or "1:02:03"
+	Display string `json:"display"`
+}
+
+type runningTimer struct {
+	state    TimerState
+	duration time.Duration
+	// Time counted before the last resume, and when the timer was last resumed
+	elapsed   time.Duration
+	resumedAt time.Time
+}
+
+// timerManager runs named countdowns and stopwatches, continuously publishing their remaining time
+type timerManager struct {
+	bridge *Bridge
+
+	mu     sync.Mutex
+	timers map[string]*runningTimer
+}
+
+// formatTimer formats a number of seconds as mm:ss, or h:mm:ss for an hour or more
+func formatTimer(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+// parseTimerDuration parses a number of seconds or a Go duration (eg. "5m", "1h30m")
+func parseTimerDuration(value string) (int, error) {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return seconds, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return int(duration / time.Second), nil
+}
+
+// parseTimerRequest parses the "<duration> [name]" text form of a timer request
+func parseTimerRequest(value string) (TimerRequest, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return TimerRequest{}, fmt.Errorf("missing duration")
+	}
+	seconds, err := parseTimerDuration(fields[0])
+	if err != nil {
+		return TimerRequest{}, err
+	}
+	req := TimerRequest{DurationSeconds: seconds}
+	if len(fields) > 1 {
+		req.Name = fields[1]
+	}
+	return req, nil
+}
+
+func timerName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return defaultTimerName
+	}
+	return name
+}
+
+func (t *timerManager) key(name string) string {
+	return t.bridge.key("timers/" + name)
+}
+
+// update refreshes the computed fields of a timer, returning whether a countdown just ended.
+// Must be called with the lock held.
+func (r *runningTimer) update(now time.Time) bool {
+	elapsed := r.elapsed
+	if r.state.Running && !r.state.Paused {
+		elapsed += now.Sub(r.resumedAt)
+	}
+	finished := false
+	if r.state.Mode == TimerCountdown && elapsed >= r.duration {
+		elapsed = r.duration
+		if r.state.Running {
+			finished = true
+			r.state.Running, r.state.Finished = false, true
+		}
+	}
+	r.state.ElapsedSeconds = int(elapsed / time.Second)
+	r.state.EndsAt = nil
+	if r.state.Mode == TimerCountdown {
+		// Round up, so the countdown shows 00:00 only when it's over
+		r.state.RemainingSeconds = int((r.duration - elapsed + time.Second - 1) / time.Second)
+		r.state.Display = formatTimer(r.state.RemainingSeconds)
+		if r.state.Running && !r.state.Paused {
+			endsAt := now.Add(r.duration - elapsed)
+			r.state.EndsAt = &endsAt
+		}
+	} else {
+		r.state.Display = formatTimer(r.state.ElapsedSeconds)
+	}
+	return finished
+}
+
+func (t *timerManager) start(req TimerRequest) {
+	name := timerName(req.Name)
+	timer := &runningTimer{
+		state:     TimerState{Name: name, Label: req.Label, Mode: TimerStopwatch, Running: true},
+		duration:  time.Duration(req.DurationSeconds) * time.Second,
+		resumedAt: time.Now(),
+	}
+	if req.DurationSeconds > 0 {
+		timer.state.Mode = TimerCountdown
+		timer.state.DurationSeconds = req.DurationSeconds
+	}
+	t.mu.Lock()
+	t.timers[name] = timer
+	timer.update(time.Now())
+	state := timer.state
+	t.mu.Unlock()
+	t.bridge.setJSON(t.key(name), state)
+	t.bridge.setJSON(t.bridge.key("ev/timer-started"), state)
+}
+
+// change applies fn to a running timer and publishes it, returning false if there's no such timer
+// (or it just finished)
+func (t *timerManager) change(name string, fn func(timer *runningTimer, now time.Time)) bool {
+	name = timerName(name)
+	now := time.Now()
+	t.mu.Lock()
+	timer, ok := t.timers[name]
+	if !ok {
+		t.mu.Unlock()
+		return false
+	}
+	// The countdown might have ended since the last tick
+	finished := timer.update(now)
+	if !finished {
+		fn(timer, now)
+		timer.update(now)
+	}
+	state := timer.state
+	if !state.Running {
+		delete(t.timers, name)
+	}
+	t.mu.Unlock()
+	t.bridge.setJSON(t.key(name), state)
+	if finished {
+		t.bridge.setJSON(t.bridge.key("ev/timer-finished"), state)
+	}
+	return !finished
+}
+
+func (t *timerManager) stop(name string) {
+	if t.change(name, func(timer *runningTimer, now time.Time) {
+		if !timer.state.Paused {
+			timer.elapsed += now.Sub(timer.resumedAt)
+		}
+		timer.state.Running, timer.state.Paused = false, false
+	}) {
+		t.bridge.setJSON(t.bridge.key("ev/timer-stopped"), timerName(name))
+	}
+}
+
+func (t *timerManager) pause(name string) {
+	t.change(name, func(timer *runningTimer, now time.Time) {
+		if !timer.state.Paused {
+			timer.elapsed += now.Sub(timer.resumedAt)
+			timer.state.Paused = true
+		}
+	})
+}
+
+func (t *timerManager) resume(name string) {
+	t.change(name, func(timer *runningTimer, now time.Time) {
+		if timer.state.Paused {
+			timer.resumedAt = now
+			timer.state.Paused = false
+		}
+	})
+}
+
+// run publishes the running timers every second, emitting ev/timer-finished when a countdown ends
+func (t *timerManager) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			var states, finished []TimerState
+			t.mu.Lock()
+			for name, timer := range t.timers {
+				if timer.state.Paused {
+					continue
+				}
+				if timer.update(now) {
+					finished = append(finished, timer.state)
+					delete(t.timers, name)
+				}
+				states = append(states, timer.state)
+			}
+			t.mu.Unlock()
+			for _, state := range states {
+				t.bridge.setJSON(t.key(state.Name), state)
+			}
+			for _, state := range finished {
+				t.bridge.setJSON(t.bridge.key("ev/timer-finished"), state)
+			}
+		}
+	}
+}
+
+// setupTimers registers the !timer chat command (for moderators) and the timer RPCs
+func (b *Bridge) setupTimers(ctx context.Context) error {
+	timers := &timerManager{bridge: b, timers: make(map[string]*runningTimer)}
+	b.goSafe(ctx, "timers", timers.run)
+
+	b.commands.register(func(msg ChatMessage, args string) {
+		if !roleAtLeast(b.chatRole(msg), RoleModerator) {
+			return
+		}
+		action, name := args, ""
+		if parts := strings.SplitN(args, " ", 2); len(parts) == 2 {
+			action, name = parts[0], parts[1]
+		}
+		switch strings.ToLower(action) {
+		case "stop":
+			timers.stop(name)
+		case "pause":
+			timers.pause(name)
+		case "resume":
+			timers.resume(name)
+		default:
+			req, err := parseTimerRequest(args)
+			if err != nil {
+				return
+			}
+			timers.start(req)
+		}
+	}, "timer")
+
+	rpcs := map[string]func(string){
+		"@start-timer": func(value string) {
+			var req TimerRequest
+			var err error
+			if trimmed := strings.TrimSpace(value); strings.HasPrefix(trimmed, "{") {
+				err = jsoniter.ConfigFastest.UnmarshalFromString(trimmed, &req)
+			} else {
+				req, err = parseTimerRequest(trimmed)
+			}
+			if err == nil && req.DurationSeconds < 0 {
+				err = fmt.Errorf("negative duration")
+			}
+			if err != nil {
+				b.log.WithError(err).Error("Could not decode timer request")
+				return
+			}
+			timers.start(req)
+		},
+		"@stop-timer":   timers.stop,
+		"@pause-timer":  timers.pause,
+		"@resume-timer": timers.resume,
+	}
+	for name, handler := range rpcs {
+		err := b.handleRPC(ctx, name, handler)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
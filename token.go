@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Local clocks further off than this from the Glimesh one get a warning
+const clockSkewWarning = time.Minute
+
+// Minimum time between token refreshes, in case the server returns very short lifetimes
+const minTokenRefreshInterval = time.Minute
+
+// expiry returns when the token should be refreshed, in local time, margin before it expires.
+// The remaining lifetime is computed on the server clock (created_at + expires_in - response Date)
+// and then added to the local time the token was received at, so a skewed local clock doesn't matter.
+// Returns false if the token doesn't expire.
+func (c ClientCredentialsResult) expiry(margin time.Duration) (time.Time, bool) {
+	if c.Expires <= 0 {
+		return time.Time{}, false
+	}
+	lifetime := time.Duration(c.Expires) * time.Second
+	remaining := lifetime
+	if created, err := parseTokenTime(c.CreatedAt); err == nil && !c.ServerTime.IsZero() {
+		elapsed := c.ServerTime.Sub(created)
+		// Ignore nonsensical timestamps (eg. created in the future)
+		if elapsed >= 0 && elapsed < lifetime {
+			remaining = lifetime - elapsed
+		}
+	}
+	return c.ReceivedAt.Add(remaining - margin), true
+}
+
+// clockSkew returns how far the local clock is ahead of the server one (negative if behind),
+// or false if the server didn't say what time it is
+func (c ClientCredentialsResult) clockSkew() (time.Duration, bool) {
+	if c.ServerTime.IsZero() {
+		return 0, false
+	}
+	return c.ReceivedAt.Sub(c.ServerTime), true
+}
+
+func parseTokenTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return parseNaiveDateTime(value)
+}
+
+// refreshToken obtains a new token before the current one expires, until ctx is cancelled
+func (b *Bridge) refreshToken(ctx context.Context, server *GlimeshServer, clientID, clientSecret, scope string, credentials ClientCredentialsResult, margin time.Duration) {
+	for {
+		if skew, ok := credentials.clockSkew(); ok && (skew > clockSkewWarning || skew < -clockSkewWarning) {
+			b.log.WithField("skew", skew.Round(time.Second)).Warn("Local clock is out of sync with Glimesh, token expiry is computed on the server clock")
+		}
+		expiry, ok := credentials.expiry(margin)
+		if !ok {
+			return
+		}
+		wait := time.Until(expiry)
+		if wait < minTokenRefreshInterval {
+			wait = minTokenRefreshInterval
+		}
+		b.log.WithField("refresh-at", time.Now().Add(wait).Format(time.RFC3339)).Debug("Scheduled token refresh")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		err := retryStartup(ctx, b.log, true, "glimesh", func(err error) bool {
+			return errors.Is(err, ErrAuthFailed)
+		}, func() (err error) {
+			credentials, err = server.credentials(ctx, clientID, clientSecret, scope)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				b.log.WithError(err).Error("Could not refresh Glimesh API token")
+			}
+			return
+		}
+		b.api.SetToken(credentials.AccessToken)
+		b.log.Info("Refreshed Glimesh API token")
+	}
+}
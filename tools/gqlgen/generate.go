@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"regexp"
+	"strings"
+)
+
+var (
+	scalarTypes = map[string]string{
+		"ID":            "string",
+		"String":        "string",
+		"Int":           "int",
+		"Float":         "float64",
+		"Boolean":       "bool",
+		"DateTime":      "string",
+		"NaiveDateTime": "string",
+	}
+	goKeywords = map[string]bool{
+		"break": true, "case": true, "chan": true, "const": true, "continue": true, "default": true,
+		"defer": true, "else": true, "fallthrough": true, "for": true, "func": true, "go": true, "goto": true,
+		"if": true, "import": true, "interface": true, "map": true, "package": true, "range": true,
+		"return": true, "select": true, "struct": true, "switch": true, "type": true, "var": true,
+		// Names used inside the generated methods
+		"ctx": true, "g": true, "result": true, "err": true,
+	}
+	initialisms = regexp.MustCompile(`(Id|Url)([A-Z]|$)`)
+)
+
+// goName converts a GraphQL name to an exported Go identifier
+func goName(name string) string {
+	if name == "" {
+		return name
+	}
+	name = strings.ToUpper(name[:1]) + name[1:]
+	if name == "Id" || name == "Url" {
+		return strings.ToUpper(name)
+	}
+	return initialisms.ReplaceAllStringFunc(name, func(match string) string {
+		for _, initialism := range []string{"Id", "Url"} {
+			if strings.HasPrefix(match, initialism) {
+				return strings.ToUpper(initialism) + match[len(initialism):]
+			}
+		}
+		return match
+	})
+}
+
+// paramName converts a GraphQL variable name to an unexported Go identifier
+func paramName(name string) string {
+	param := goName(name)
+	if strings.HasPrefix(param, "ID") || strings.HasPrefix(param, "URL") {
+		param = strings.ToLower(param[:2]) + param[2:]
+	}
+	param = strings.ToLower(param[:1]) + param[1:]
+	if goKeywords[param] {
+		param += "Value"
+	}
+	return param
+}
+
+type generator struct {
+	schema    *Schema
+	pkg       string
+	fragments map[string]*Definition
+	emitted   map[string]bool
+
+	docs    bytes.Buffer
+	types   bytes.Buffer
+	methods bytes.Buffer
+}
+
+func newGenerator(schema *Schema, pkg string) *generator {
+	return &generator{
+		schema:    schema,
+		pkg:       pkg,
+		fragments: make(map[string]*Definition),
+		emitted:   make(map[string]bool),
+	}
+}
+
+func (g *generator) Generate(defs []*Definition) ([]byte, error) {
+	for _, def := range defs {
+		if def.Kind != "fragment" {
+			continue
+		}
+		if _, ok := g.fragments[def.Name]; ok {
+			return nil, fmt.Errorf("%s: duplicate fragment %s", def.File, def.Name)
+		}
+		g.fragments[def.Name] = def
+	}
+
+	for _, def := range defs {
+		var err error
+		if def.Kind == "fragment" {
+			err = g.fragment(def)
+		} else {
+			err = g.operation(def)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by tools/gqlgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\nimport \"context\"\n\n", g.pkg)
+	out.Write(g.docs.Bytes())
+	out.Write(g.types.Bytes())
+	out.Write(g.methods.Bytes())
+	return format.Source(out.Bytes())
+}
+
+func (g *generator) fragment(def *Definition) error {
+	on := g.schema.Type(def.On)
+	if on == nil {
+		return fmt.Errorf("%s: fragment %s is on unknown type %s", def.File, def.Name, def.On)
+	}
+	return g.emitStruct(def.Name, on, def.Selection, nil, def)
+}
+
+// usedFragments returns all the fragments (transitively) spread in a selection set, in order of use
+func (g *generator) usedFragments(selections []*Selection, seen map[string]bool, out []*Definition) ([]*Definition, error) {
+	for _, sel := range selections {
+		if sel.Spread != "" {
+			if seen[sel.Spread] {
+				continue
+			}
+			frag, ok := g.fragments[sel.Spread]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %s", sel.Spread)
+			}
+			seen[sel.Spread] = true
+			out = append(out, frag)
+			var err error
+			if out, err = g.usedFragments(frag.Selection, seen, out); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var err error
+		if out, err = g.usedFragments(sel.Selection, seen, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (g *generator) operation(def *Definition) error {
+	root, err := g.schema.RootType(def.Kind)
+	if err != nil {
+		return fmt.Errorf("%s: %w", def.File, err)
+	}
+
+	variables := make(map[string]bool)
+	for _, v := range def.Variables {
+		variables[v.Name] = true
+	}
+
+	fragments, err := g.usedFragments(def.Selection, make(map[string]bool), nil)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", def.File, def.Name, err)
+	}
+	document := def.Source
+	for _, frag := range fragments {
+		document += "\n\n" + frag.Source
+	}
+	docName := strings.ToLower(def.Name[:1]) + def.Name[1:] + "Document"
+	fmt.Fprintf(&g.docs, "// %s is the document for the %s %s\nconst %s = `%s`\n\n", docName, def.Name, def.Kind, docName, document)
+
+	responseName := def.Name + "Response"
+	err = g.emitStruct(responseName, root, def.Selection, variables, def)
+	if err != nil {
+		return err
+	}
+
+	// Subscriptions go through the websocket, so they don't get a HTTP method
+	if def.Kind == "subscription" {
+		return nil
+	}
+
+	var params []string
+	var values []string
+	for _, v := range def.Variables {
+		typ, err := g.variableType(v.Type, true)
+		if err != nil {
+			return fmt.Errorf("%s: %s: variable %s: %w", def.File, def.Name, v.Name, err)
+		}
+		param := paramName(v.Name)
+		params = append(params, fmt.Sprintf("%s %s", param, typ))
+		values = append(values, fmt.Sprintf("%q: %s,\n", v.Name, param))
+	}
+
+	fmt.Fprintf(&g.methods, "// %s runs the %s %s\n", def.Name, def.Name, def.Kind)
+	fmt.Fprintf(&g.methods, "func (g *GlimeshClient) %s(ctx context.Context", def.Name)
+	for _, param := range params {
+		fmt.Fprintf(&g.methods, ", %s", param)
+	}
+	fmt.Fprintf(&g.methods, ") (*%s, error) {\n", responseName)
+	fmt.Fprintf(&g.methods, "var result %s\n", responseName)
+	fmt.Fprintf(&g.methods, "err := g.Query(ctx, %s, map[string]interface{}{\n%s}, &result)\n", docName, strings.Join(values, ""))
+	g.methods.WriteString("if err != nil {\nreturn nil, err\n}\nreturn &result, nil\n}\n\n")
+	return nil
+}
+
+// variableType returns the Go type for an operation variable, emitting input object types as needed.
+// Nullable top-level variables are pointers so they can be omitted (sent as null).
+func (g *generator) variableType(typ *VarType, topLevel bool) (string, error) {
+	var goType string
+	if typ.List != nil {
+		inner, err := g.variableType(typ.List, false)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + inner, nil
+	}
+
+	schemaType := g.schema.Type(typ.Name)
+	if schemaType == nil {
+		return "", fmt.Errorf("unknown type %s", typ.Name)
+	}
+	switch schemaType.Kind {
+	case "SCALAR":
+		goType = scalarGoType(typ.Name)
+	case "ENUM":
+		goType = "string"
+	case "INPUT_OBJECT":
+		if err := g.emitInput(schemaType); err != nil {
+			return "", err
+		}
+		goType = schemaType.Name
+	default:
+		return "", fmt.Errorf("type %s cannot be used as input", typ.Name)
+	}
+	if topLevel && !typ.NonNull {
+		goType = "*" + goType
+	}
+	return goType, nil
+}
+
+func (g *generator) emitInput(typ *FullType) error {
+	if g.emitted[typ.Name] {
+		return nil
+	}
+	g.emitted[typ.Name] = true
+
+	var body bytes.Buffer
+	for _, field := range typ.InputFields {
+		named := field.Type.Named()
+		schemaType := g.schema.Type(named.Name)
+		if schemaType == nil {
+			return fmt.Errorf("unknown type %s", named.Name)
+		}
+		elem := scalarGoType(named.Name)
+		if schemaType.Kind == "INPUT_OBJECT" {
+			if err := g.emitInput(schemaType); err != nil {
+				return err
+			}
+			elem = schemaType.Name
+		}
+		fmt.Fprintf(&body, "%s %s `json:\"%s,omitempty\"`\n", goName(field.Name), wrapType(field.Type, elem, false), field.Name)
+	}
+	fmt.Fprintf(&g.types, "type %s struct {\n%s}\n\n", typ.Name, body.String())
+	return nil
+}
+
+func scalarGoType(name string) string {
+	if typ, ok := scalarTypes[name]; ok {
+		return typ
+	}
+	// Custom scalars are passed through as strings
+	return "string"
+}
+
+// wrapType applies list and nullability wrappers of a schema type to a Go element type.
+// Nullable objects become pointers, everything else stays a value.
+func wrapType(ref *TypeRef, elem string, object bool) string {
+	switch ref.Kind {
+	case "NON_NULL":
+		if ref.OfType.Kind == "LIST" {
+			return wrapType(ref.OfType, elem, object)
+		}
+		return elem
+	case "LIST":
+		inner := ref.OfType
+		if inner.Kind == "NON_NULL" {
+			inner = inner.OfType
+		}
+		if inner.Kind == "LIST" {
+			return "[]" + wrapType(inner, elem, object)
+		}
+		return "[]" + elem
+	}
+	if object {
+		return "*" + elem
+	}
+	return elem
+}
+
+// emitStruct writes a named struct type for a selection set on a schema type, recursing into
+// nested selections. variables is nil for fragments, where variable usage isn't checked.
+func (g *generator) emitStruct(name string, parent *FullType, selections []*Selection, variables map[string]bool, def *Definition) error {
+	if g.emitted[name] {
+		return fmt.Errorf("%s: type %s would be generated twice, rename the operation or fragment", def.File, name)
+	}
+	g.emitted[name] = true
+
+	var body bytes.Buffer
+	for _, sel := range selections {
+		if sel.Spread != "" {
+			frag, ok := g.fragments[sel.Spread]
+			if !ok {
+				return fmt.Errorf("%s: unknown fragment %s", def.File, sel.Spread)
+			}
+			if frag.On != parent.Name {
+				return fmt.Errorf("%s: fragment %s is on %s, cannot spread it on %s", def.File, frag.Name, frag.On, parent.Name)
+			}
+			fmt.Fprintf(&body, "%s\n", frag.Name)
+			continue
+		}
+
+		if sel.Name == "__typename" {
+			fmt.Fprintf(&body, "Typename string `json:\"%s\"`\n", sel.ResponseName())
+			continue
+		}
+
+		field := parent.Field(sel.Name)
+		if field == nil {
+			return fmt.Errorf("%s: %s: type %s has no field %s", def.File, def.Name, parent.Name, sel.Name)
+		}
+		for _, arg := range sel.Arguments {
+			found := false
+			for _, fieldArg := range field.Args {
+				if fieldArg.Name == arg.Name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%s: %s: field %s.%s has no argument %s", def.File, def.Name, parent.Name, sel.Name, arg.Name)
+			}
+			if arg.Variable != "" && variables != nil && !variables[arg.Variable] {
+				return fmt.Errorf("%s: %s: variable $%s is not declared", def.File, def.Name, arg.Variable)
+			}
+		}
+
+		named := field.Type.Named()
+		schemaType := g.schema.Type(named.Name)
+		if schemaType == nil {
+			return fmt.Errorf("%s: unknown type %s", def.File, named.Name)
+		}
+
+		var elem string
+		object := schemaType.Kind == "OBJECT" || schemaType.Kind == "INTERFACE"
+		if object {
+			if len(sel.Selection) == 0 {
+				return fmt.Errorf("%s: %s: field %s.%s needs a selection set", def.File, def.Name, parent.Name, sel.Name)
+			}
+			if len(sel.Selection) == 1 && sel.Selection[0].Spread != "" {
+				// A selection made of a single fragment spread uses the fragment type directly
+				frag, ok := g.fragments[sel.Selection[0].Spread]
+				if !ok {
+					return fmt.Errorf("%s: unknown fragment %s", def.File, sel.Selection[0].Spread)
+				}
+				if frag.On != schemaType.Name {
+					return fmt.Errorf("%s: fragment %s is on %s, cannot spread it on %s", def.File, frag.Name, frag.On, schemaType.Name)
+				}
+				elem = frag.Name
+			} else {
+				elem = name + goName(sel.ResponseName())
+				if err := g.emitStruct(elem, schemaType, sel.Selection, variables, def); err != nil {
+					return err
+				}
+			}
+		} else {
+			if len(sel.Selection) > 0 {
+				return fmt.Errorf("%s: %s: field %s.%s is a %s and cannot have a selection set", def.File, def.Name, parent.Name, sel.Name, schemaType.Kind)
+			}
+			elem = scalarGoType(named.Name)
+			if schemaType.Kind == "ENUM" {
+				elem = "string"
+			}
+		}
+
+		fmt.Fprintf(&body, "%s %s `json:\"%s\"`\n", goName(sel.ResponseName()), wrapType(field.Type, elem, object), sel.ResponseName())
+	}
+
+	fmt.Fprintf(&g.types, "type %s struct {\n%s}\n\n", name, body.String())
+	return nil
+}
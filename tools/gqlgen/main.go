@@ -0,0 +1,115 @@
+// gqlgen generates typed Go code for the GraphQL operations used by the bridge,
+// validating them against the Glimesh schema (introspection JSON).
+//
+// Usage:
+//
+//	go run ./tools/gqlgen -schema schema/glimesh.json -queries queries -out graphql_gen.go
+//	go run ./tools/gqlgen -fetch -token <token> -schema schema/glimesh.json
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const introspectionQuery = `query IntrospectionQuery {
+	__schema {
+		queryType { name }
+		mutationType { name }
+		subscriptionType { name }
+		types {
+			kind name
+			fields(includeDeprecated: true) { name args { name type { ...TypeRef } } type { ...TypeRef } }
+			inputFields { name type { ...TypeRef } }
+			enumValues(includeDeprecated: true) { name }
+		}
+	}
+}
+
+fragment TypeRef on __Type {
+	kind name
+	ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } }
+}`
+
+func fatal(err error, what string) {
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %s\n", what, err)
+		os.Exit(1)
+	}
+}
+
+// fetchSchema runs the introspection query against the API and saves the result
+func fetchSchema(endpoint, token, path string) error {
+	body, err := jsoniter.ConfigFastest.Marshal(map[string]interface{}{"query": introspectionQuery, "variables": map[string]interface{}{}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	var result interface{}
+	err = jsoniter.ConfigFastest.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return err
+	}
+	data, err := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func main() {
+	schemaPath := flag.String("schema", "schema/glimesh.json", "Path to the schema introspection JSON")
+	queriesDir := flag.String("queries", "queries", "Directory containing the .graphql operation files")
+	out := flag.String("out", "graphql_gen.go", "Output file")
+	pkg := flag.String("package", "main", "Package name of the generated file")
+	fetch := flag.Bool("fetch", false, "Fetch the schema from the API instead of generating code")
+	endpoint := flag.String("endpoint", "https://glimesh.tv/api/graph", "GraphQL endpoint used with -fetch")
+	token := flag.String("token", "", "API token used with -fetch")
+	flag.Parse()
+
+	if *fetch {
+		fatal(fetchSchema(*endpoint, *token, *schemaPath), "Could not fetch schema")
+		return
+	}
+
+	schema, err := loadSchema(*schemaPath)
+	fatal(err, "Could not load schema")
+
+	files, err := filepath.Glob(filepath.Join(*queriesDir, "*.graphql"))
+	fatal(err, "Could not list operation files")
+	sort.Strings(files)
+
+	var defs []*Definition
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		fatal(err, "Could not read operation file")
+		fileDefs, err := parseDocument(filepath.ToSlash(file), string(src))
+		fatal(err, "Could not parse operation file")
+		defs = append(defs, fileDefs...)
+	}
+
+	code, err := newGenerator(schema, *pkg).Generate(defs)
+	fatal(err, "Could not generate code")
+	fatal(os.WriteFile(*out, code, 0644), "Could not write output")
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Minimal parser for GraphQL executable documents (operations and fragments).
+// Inline fragments and directives are not supported.
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokNumber
+	tokString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	start int
+	end   int
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameContinue(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+func (l *lexer) next() (token, error) {
+	// Skip whitespace, commas and comments
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+		} else if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		} else {
+			break
+		}
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, start: l.pos, end: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return token{kind: tokPunct, value: "...", start: start, end: l.pos}, nil
+	case strings.IndexByte("!$()[]{}:=@|&", c) >= 0:
+		l.pos++
+		return token{kind: tokPunct, value: string(c), start: start, end: l.pos}, nil
+	case isNameStart(c):
+		for l.pos < len(l.src) && isNameContinue(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokName, value: l.src[start:l.pos], start: start, end: l.pos}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		l.pos++
+		for l.pos < len(l.src) && strings.IndexByte("0123456789.eE+-", l.src[l.pos]) >= 0 {
+			l.pos++
+		}
+		return token{kind: tokNumber, value: l.src[start:l.pos], start: start, end: l.pos}, nil
+	case c == '"':
+		l.pos++
+		for l.pos < len(l.src) && l.src[l.pos] != '"' {
+			if l.src[l.pos] == '\\' {
+				l.pos++
+			}
+			l.pos++
+		}
+		if l.pos >= len(l.src) {
+			return token{}, fmt.Errorf("unterminated string at offset %d", start)
+		}
+		l.pos++
+		return token{kind: tokString, value: l.src[start:l.pos], start: start, end: l.pos}, nil
+	}
+	return token{}, fmt.Errorf("unexpected character %q at offset %d", c, start)
+}
+
+type VarType struct {
+	Name    string
+	List    *VarType
+	NonNull bool
+}
+
+type VariableDef struct {
+	Name string
+	Type *VarType
+}
+
+type Argument struct {
+	Name string
+	// Variable is the name of the variable used as value, if any
+	Variable string
+}
+
+type Selection struct {
+	// Set for fields
+	Alias     string
+	Name      string
+	Arguments []Argument
+	Selection []*Selection
+	// Set for fragment spreads
+	Spread string
+}
+
+// ResponseName is the key the field will have in the response
+func (s *Selection) ResponseName() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+type Definition struct {
+	// Kind is query, mutation, subscription or fragment
+	Kind      string
+	Name      string
+	On        string
+	Variables []VariableDef
+	Selection []*Selection
+	Source    string
+	File      string
+}
+
+type parser struct {
+	lex  *lexer
+	tok  token
+	file string
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.file, err)
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: offset %d: %s", p.file, p.tok.start, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(value string) error {
+	if p.tok.kind != tokPunct || p.tok.value != value {
+		return p.errorf("expected %q, got %q", value, p.tok.value)
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.errorf("expected name, got %q", p.tok.value)
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) is(value string) bool {
+	return p.tok.kind == tokPunct && p.tok.value == value
+}
+
+func parseDocument(file, src string) ([]*Definition, error) {
+	p := &parser{lex: &lexer{src: src}, file: file}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var defs []*Definition
+	for p.tok.kind != tokEOF {
+		start := p.tok.start
+		def, err := p.definition()
+		if err != nil {
+			return nil, err
+		}
+		def.Source = strings.TrimSpace(src[start:p.tok.start])
+		def.File = file
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+func (p *parser) definition() (*Definition, error) {
+	kind, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	def := &Definition{Kind: kind}
+	switch kind {
+	case "fragment":
+		if def.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if on, err := p.name(); err != nil || on != "on" {
+			return nil, p.errorf("expected \"on\" after fragment name")
+		}
+		if def.On, err = p.name(); err != nil {
+			return nil, err
+		}
+	case "query", "mutation", "subscription":
+		if def.Name, err = p.name(); err != nil {
+			return nil, fmt.Errorf("%w (operations must be named)", err)
+		}
+		if p.is("(") {
+			if def.Variables, err = p.variableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, p.errorf("unexpected definition %q", kind)
+	}
+	def.Selection, err = p.selectionSet()
+	return def, err
+}
+
+func (p *parser) variableDefinitions() ([]VariableDef, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var vars []VariableDef
+	for !p.is(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, err := p.varType()
+		if err != nil {
+			return nil, err
+		}
+		if p.is("=") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if _, err := p.value(); err != nil {
+				return nil, err
+			}
+		}
+		vars = append(vars, VariableDef{Name: name, Type: typ})
+	}
+	return vars, p.advance()
+}
+
+func (p *parser) varType() (*VarType, error) {
+	typ := &VarType{}
+	if p.is("[") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		inner, err := p.varType()
+		if err != nil {
+			return nil, err
+		}
+		typ.List = inner
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		typ.Name = name
+	}
+	if p.is("!") {
+		typ.NonNull = true
+		return typ, p.advance()
+	}
+	return typ, nil
+}
+
+// value parses an argument value, returning the variable name if the value is a variable
+func (p *parser) value() (string, error) {
+	switch {
+	case p.is("$"):
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		return p.name()
+	case p.is("["):
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		for !p.is("]") {
+			if _, err := p.value(); err != nil {
+				return "", err
+			}
+		}
+		return "", p.advance()
+	case p.is("{"):
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		for !p.is("}") {
+			if _, err := p.name(); err != nil {
+				return "", err
+			}
+			if err := p.expect(":"); err != nil {
+				return "", err
+			}
+			if _, err := p.value(); err != nil {
+				return "", err
+			}
+		}
+		return "", p.advance()
+	case p.tok.kind == tokName || p.tok.kind == tokNumber || p.tok.kind == tokString:
+		return "", p.advance()
+	}
+	return "", p.errorf("unexpected %q in value", p.tok.value)
+}
+
+func (p *parser) selectionSet() ([]*Selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []*Selection
+	for !p.is("}") {
+		if p.tok.kind == tokEOF {
+			return nil, p.errorf("unterminated selection set")
+		}
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	return selections, p.advance()
+}
+
+func (p *parser) selection() (*Selection, error) {
+	if p.is("...") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if name == "on" {
+			return nil, p.errorf("inline fragments are not supported")
+		}
+		return &Selection{Spread: name}, nil
+	}
+
+	sel := &Selection{}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if p.is(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		sel.Alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	sel.Name = name
+
+	if p.is("(") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for !p.is(")") {
+			argName, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			variable, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			sel.Arguments = append(sel.Arguments, Argument{Name: argName, Variable: variable})
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is("@") {
+		return nil, p.errorf("directives are not supported")
+	}
+	if p.is("{") {
+		if sel.Selection, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Subset of the GraphQL introspection result, only what's needed for code generation
+
+type TypeRef struct {
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	OfType *TypeRef `json:"ofType"`
+}
+
+// Named returns the innermost named type, skipping NON_NULL and LIST wrappers
+func (t *TypeRef) Named() *TypeRef {
+	for t.OfType != nil && (t.Kind == "NON_NULL" || t.Kind == "LIST") {
+		t = t.OfType
+	}
+	return t
+}
+
+type InputValue struct {
+	Name string   `json:"name"`
+	Type *TypeRef `json:"type"`
+}
+
+type Field struct {
+	Name string       `json:"name"`
+	Args []InputValue `json:"args"`
+	Type *TypeRef     `json:"type"`
+}
+
+type FullType struct {
+	Kind        string       `json:"kind"`
+	Name        string       `json:"name"`
+	Fields      []Field      `json:"fields"`
+	InputFields []InputValue `json:"inputFields"`
+}
+
+func (t *FullType) Field(name string) *Field {
+	for i := range t.Fields {
+		if t.Fields[i].Name == name {
+			return &t.Fields[i]
+		}
+	}
+	return nil
+}
+
+type Schema struct {
+	QueryType        *struct{ Name string } `json:"queryType"`
+	MutationType     *struct{ Name string } `json:"mutationType"`
+	SubscriptionType *struct{ Name string } `json:"subscriptionType"`
+	Types            []*FullType            `json:"types"`
+
+	byName map[string]*FullType
+}
+
+func (s *Schema) Type(name string) *FullType {
+	return s.byName[name]
+}
+
+// RootType returns the root type for an operation kind (query, mutation, subscription)
+func (s *Schema) RootType(operation string) (*FullType, error) {
+	var root *struct{ Name string }
+	switch operation {
+	case "query":
+		root = s.QueryType
+	case "mutation":
+		root = s.MutationType
+	case "subscription":
+		root = s.SubscriptionType
+	}
+	if root == nil {
+		return nil, fmt.Errorf("schema has no %s type", operation)
+	}
+	typ := s.Type(root.Name)
+	if typ == nil {
+		return nil, fmt.Errorf("schema is missing root type %s", root.Name)
+	}
+	return typ, nil
+}
+
+type introspectionResult struct {
+	Data struct {
+		Schema *Schema `json:"__schema"`
+	} `json:"data"`
+}
+
+func loadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var result introspectionResult
+	err = jsoniter.ConfigFastest.Unmarshal(data, &result)
+	if err != nil {
+		return nil, err
+	}
+	schema := result.Data.Schema
+	if schema == nil {
+		return nil, fmt.Errorf("%s does not contain an introspection result", path)
+	}
+	schema.byName = make(map[string]*FullType)
+	for _, typ := range schema.Types {
+		schema.byName[typ.Name] = typ
+	}
+	return schema, nil
+}
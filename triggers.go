@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Default values of trigger keys, for hooks that don't set them
+const (
+	defaultTriggerValue    = "true"
+	defaultTriggerReset    = "false"
+	defaultTriggerDuration = 5 * time.Second
+)
+
+// triggerKeys writes short-lived trigger keys (triggers/<name>) for OBS plugins and
+// automations, resetting them after a while
+type triggerKeys struct {
+	bridge *Bridge
+
+	mu     sync.Mutex
+	resets map[string]*time.Timer
+}
+
+func (b *Bridge) newTriggerKeys() *triggerKeys {
+	return &triggerKeys{bridge: b, resets: make(map[string]*time.Timer)}
+}
+
+// fire sets a trigger key to value, then to reset after duration. Firing a trigger
+// again before it's reset postpones the reset.
+func (t *triggerKeys) fire(name string, value string, reset string, duration time.Duration) {
+	key := t.bridge.key("triggers/" + name)
+	if err := t.bridge.kv.SetKey(key, value); err != nil {
+		t.bridge.log.WithError(err).WithField("key", key).Error("Could not set trigger key")
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if previous, ok := t.resets[name]; ok {
+		previous.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(duration, func() {
+		t.mu.Lock()
+		if t.resets[name] != timer {
+			t.mu.Unlock()
+			return
+		}
+		delete(t.resets, name)
+		t.mu.Unlock()
+		if err := t.bridge.kv.SetKey(key, reset); err != nil {
+			t.bridge.log.WithError(err).WithField("key", key).Error("Could not reset trigger key")
+		}
+	})
+	t.resets[name] = timer
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// How long to wait for a profile lookup before giving up on enriching a message
+const userLookupTimeout = 3 * time.Second
+
+// CachedUserProfile is a user profile as stored in the cache (and optionally in KV)
+type CachedUserProfile struct {
+	UserProfile
+	// AccountAgeDays is the age of the account when the profile was fetched
+	AccountAgeDays int       `json:"account_age_days"`
+	FetchedAt      time.Time `json:"fetched_at"`
+}
+
+// ChatEvent is a chat message as published by the bridge, with the normalized role
+// and (when enrichment is enabled) the profile of its author
+type ChatEvent struct {
+	ChatMessage
+	Role    string             `json:"role"`
+	Profile *CachedUserProfile `json:"profile,omitempty"`
+	// Suspicious is set when the message looks like it's trying to evade filters
+	Suspicious bool `json:"suspicious,omitempty"`
+	// Flags lists what the moderation heuristics found in the message (eg. "confusables")
+	Flags []string `json:"flags,omitempty"`
+	// TTSText is the message cleaned up for text-to-speech, when enabled
+	TTSText string `json:"tts_text,omitempty"`
+	// Extra holds the fields requested with -chat-extra-fields, as returned by Glimesh
+	Extra map[string]jsoniter.RawMessage `json:"extra,omitempty"`
+	// Origin is the channel the message was sent in, set when chat is merged (see -merge-channels)
+	Origin *ChannelOrigin `json:"origin,omitempty"`
+}
+
+// ChatMessageProfile is published when the profile of the author of a chat message wasn't
+// cached when the message was, so consumers can add it to that message (and any other message
+// from the same user published while it was being fetched)
+type ChatMessageProfile struct {
+	ID      string             `json:"id"`
+	User    ChatMessageUser    `json:"user"`
+	Profile *CachedUserProfile `json:"profile"`
+}
+
+type userCacheEntry struct {
+	profile *CachedUserProfile
+	expires time.Time
+}
+
+func (e userCacheEntry) memorySize() int {
+	size := 32
+	if e.profile != nil {
+		size += entrySize("", e.profile) - lruEntryOverhead
+	}
+	return size
+}
+
+// userCache keeps user profiles in memory for a while, so they can be used for every chat message
+// without querying the API each time. Failed lookups are cached too, to avoid retrying on every message.
+type userCache struct {
+	bridge  *Bridge
+	ttl     time.Duration
+	storeKV bool
+
+	entries *lruCache
+
+	mu sync.Mutex
+	// Users being fetched in the background
+	pending map[string]bool
+}
+
+func (b *Bridge) newUserCache(ttl time.Duration, storeKV bool) *userCache {
+	return &userCache{
+		bridge:  b,
+		ttl:     ttl,
+		storeKV: storeKV,
+		entries: b.newLRUCache("user-profiles", b.memory.UserCaches),
+		pending: make(map[string]bool),
+	}
+}
+
+// cached returns the profile of a user if it's in the memory cache, without waiting for KV or the API
+func (c *userCache) cached(username string) (*CachedUserProfile, bool) {
+	value, ok := c.entries.get(strings.ToLower(username))
+	if !ok {
+		return nil, false
+	}
+	entry := value.(userCacheEntry)
+	if time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.profile, true
+}
+
+// enrich adds the author's profile to a chat event if it's cached. Otherwise the profile is fetched
+// in the background and published as ev/chat-message-profile, so the chat loop never waits for it.
+func (c *userCache) enrich(event *ChatEvent) {
+	if profile, ok := c.cached(event.User.Username); ok {
+		event.Profile = profile
+		return
+	}
+	username := strings.ToLower(event.User.Username)
+	c.mu.Lock()
+	if c.pending[username] {
+		c.mu.Unlock()
+		return
+	}
+	c.pending[username] = true
+	c.mu.Unlock()
+
+	id, user := event.ID, event.User
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.pending, username)
+			c.mu.Unlock()
+		}()
+		if profile := c.get(c.bridge.ctx, username); profile != nil {
+			c.bridge.setJSON(c.bridge.key("ev/chat-message-profile"), ChatMessageProfile{ID: id, User: user, Profile: profile})
+		}
+	}()
+}
+
+func (c *userCache) kvKey(username string) string {
+	return c.bridge.key("users/" + username + "/profile")
+}
+
+// get returns the profile of a user from the cache, KV or the Glimesh API, in this order.
+// Returns nil if the user could not be found.
+func (c *userCache) get(ctx context.Context, username string) *CachedUserProfile {
+	username = strings.ToLower(username)
+	now := time.Now()
+
+	if value, ok := c.entries.get(username); ok {
+		if entry := value.(userCacheEntry); now.Before(entry.expires) {
+			return entry.profile
+		}
+	}
+
+	if c.storeKV {
+		var stored CachedUserProfile
+		err := c.bridge.kv.GetJSON(c.kvKey(username), &stored)
+		if err == nil && now.Sub(stored.FetchedAt) < c.ttl {
+			c.put(username, &stored, stored.FetchedAt.Add(c.ttl))
+			return &stored
+		}
+	}
+
+	// Don't cache anything while the API is down, so profiles are fetched again when it recovers
+	if !c.bridge.health.healthy(ComponentAPI) {
+		return nil
+	}
+	profile, err := c.fetch(ctx, username)
+	if err != nil {
+		c.bridge.log.WithError(err).WithField("user", username).Warn("Could not fetch user profile")
+	}
+	c.put(username, profile, now.Add(c.ttl))
+	if profile != nil && c.storeKV {
+		c.bridge.setJSON(c.kvKey(username), profile)
+	}
+	return profile
+}
+
+func (c *userCache) put(username string, profile *CachedUserProfile, expires time.Time) {
+	c.entries.put(username, userCacheEntry{profile: profile, expires: expires})
+	// Drop expired entries once in a while so the cache doesn't grow forever
+	if c.entries.len()%1000 == 0 {
+		now := time.Now()
+		c.entries.removeFunc(func(_ string, value interface{}) bool {
+			return now.After(value.(userCacheEntry).expires)
+		})
+	}
+}
+
+func (c *userCache) fetch(ctx context.Context, username string) (*CachedUserProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, userLookupTimeout)
+	defer cancel()
+	result, err := c.bridge.api.UserProfile(ctx, username)
+	if err != nil || result.User == nil {
+		return nil, err
+	}
+	profile := &CachedUserProfile{UserProfile: *result.User, FetchedAt: time.Now()}
+	if created, err := parseNaiveDateTime(result.User.InsertedAt); err == nil {
+		profile.AccountAgeDays = int(time.Since(created).Hours() / 24)
+	}
+	return profile, nil
+}
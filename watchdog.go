@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// A resource growing on this many consecutive checks is considered leaking
+const watchdogGrowthSamples = 10
+
+// ResourceUsage is written to the watchdog key on every check
+type ResourceUsage struct {
+	Goroutines int `json:"goroutines"`
+	// Open connections to the embedded HTTP server
+	HTTPConnections int64 `json:"http_connections"`
+	// In-process event consumers (streaming APIs, sinks...)
+	EventSubscribers int `json:"event_subscribers"`
+	// Events waiting to be delivered to all the consumers
+	EventBacklog int `json:"event_backlog"`
+	// Outgoing chat messages waiting to be sent
+	ChatSendQueue int `json:"chat_send_queue"`
+	// Chat messages waiting to be relayed
+	RelayBacklog int `json:"relay_backlog"`
+	// Webhooks, commands and OBS actions run by hooks
+	RunningHooks int64     `json:"running_hooks"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+// resources lists the watched values by name
+func (u ResourceUsage) resources() map[string]int64 {
+	return map[string]int64{
+		"goroutines":        int64(u.Goroutines),
+		"http-connections":  u.HTTPConnections,
+		"event-subscribers": int64(u.EventSubscribers),
+		"event-backlog":     int64(u.EventBacklog),
+		"chat-send-queue":   int64(u.ChatSendQueue),
+		"relay-backlog":     int64(u.RelayBacklog),
+		"running-hooks":     u.RunningHooks,
+	}
+}
+
+// WatchdogWarning is published to ev/watchdog-warning when a resource looks like it's leaking
+type WatchdogWarning struct {
+	Resource string `json:"resource"`
+	Value    int64  `json:"value"`
+	// Value when the resource started growing
+	From int64 `json:"from"`
+	// Reason is "growing" (up on every recent check) or "limit" (over -watchdog-max-goroutines)
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// resourceUsage samples the goroutines, connections and queues of the bridge
+func (b *Bridge) resourceUsage() ResourceUsage {
+	usage := ResourceUsage{
+		Goroutines:      runtime.NumGoroutine(),
+		HTTPConnections: atomic.LoadInt64(&b.httpConns),
+		RunningHooks:    atomic.LoadInt64(&b.runningHooks),
+		CheckedAt:       time.Now(),
+	}
+	if b.events != nil {
+		usage.EventSubscribers, usage.EventBacklog = b.events.stats()
+	}
+	if b.chat != nil {
+		usage.ChatSendQueue = len(b.chat.queue)
+	}
+	if b.relay != nil {
+		usage.RelayBacklog = b.relay.backlog()
+	}
+	return usage
+}
+
+// watchedResource is the growth streak of a resource
+type watchedResource struct {
+	last   int64
+	from   int64
+	growth int
+	warned bool
+}
+
+// runWatchdog checks resource usage every interval, warning about resources that keep growing
+// (reconnect logic leaking readers, consumers that never unsubscribe...) or go over maxGoroutines
+func (b *Bridge) runWatchdog(ctx context.Context, interval time.Duration, maxGoroutines int) {
+	watched := make(map[string]*watchedResource)
+	overLimit := false
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		usage := b.resourceUsage()
+		b.setJSON(b.key("watchdog"), usage)
+
+		for name, value := range usage.resources() {
+			resource, ok := watched[name]
+			if !ok {
+				watched[name] = &watchedResource{last: value, from: value}
+				continue
+			}
+			if value > resource.last {
+				resource.growth++
+			} else {
+				resource.growth, resource.from, resource.warned = 0, value, false
+			}
+			resource.last = value
+			if resource.growth >= watchdogGrowthSamples && !resource.warned {
+				resource.warned = true
+				b.warnResource(WatchdogWarning{Resource: name, Value: value, From: resource.from, Reason: "growing"})
+			}
+		}
+
+		if maxGoroutines > 0 && usage.Goroutines > maxGoroutines {
+			if !overLimit {
+				b.warnResource(WatchdogWarning{Resource: "goroutines", Value: int64(usage.Goroutines), From: int64(maxGoroutines), Reason: "limit"})
+			}
+			overLimit = true
+		} else {
+			overLimit = false
+		}
+	}
+}
+
+func (b *Bridge) warnResource(warning WatchdogWarning) {
+	warning.Time = time.Now()
+	b.log.WithField("resource", warning.Resource).WithField("value", warning.Value).WithField("from", warning.From).WithField("reason", warning.Reason).Warn("Resource usage keeps growing, possible leak")
+	b.setJSON(b.key("ev/watchdog-warning"), warning)
+}